@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+type AdminAPI struct {
+	Config *conf.Configuration
+}
+
+/*
+	Returns the configuration in effect, after overlays, environment
+	overrides and defaults, with secrets redacted
+*/
+func (a *AdminAPI) GetConfig(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(a.Config, w, r) {
+		return
+	}
+	responseNegotiated(w, r, a.Config.Redacted())
+}
+
+/*
+	Checks the X-Bamboo-Admin-Token header against Bamboo.Admin.Token,
+	refusing every request when no token is configured
+*/
+func adminAuthorized(config *conf.Configuration, w http.ResponseWriter, r *http.Request) bool {
+	return tokenAuthorized(config.Bamboo.Admin.Token, w, r)
+}
+
+func tokenAuthorized(token string, w http.ResponseWriter, r *http.Request) bool {
+	if len(token) == 0 {
+		responseErrorCode(w, http.StatusForbidden, CodeInvalidToken, "Admin endpoints require Bamboo.Admin.Token (or BAMBOO_ADMIN_TOKEN)", nil)
+		return false
+	}
+	if !validToken(r.Header.Get("X-Bamboo-Admin-Token"), token) {
+		responseErrorCode(w, http.StatusForbidden, CodeInvalidToken, "Invalid admin token", nil)
+		return false
+	}
+	return true
+}
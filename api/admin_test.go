@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+func TestAdmin(t *testing.T) {
+	Convey("#GetConfig", t, func() {
+		config := &conf.Configuration{}
+		config.FaultInjection.Token = "faults"
+		adminAPI := &AdminAPI{Config: config}
+		get := func(token string) *httptest.ResponseRecorder {
+			request, _ := http.NewRequest("GET", "/api/admin/config", nil)
+			request.Header.Set("X-Bamboo-Admin-Token", token)
+			recorder := httptest.NewRecorder()
+			adminAPI.GetConfig(recorder, request)
+			return recorder
+		}
+
+		Convey("should be refused without an admin token", func() {
+			So(get("").Code, ShouldEqual, http.StatusForbidden)
+			So(get("faults").Code, ShouldEqual, http.StatusForbidden)
+		})
+
+		Convey("should require the admin token", func() {
+			config.Bamboo.Admin.Token = "secret"
+			So(get("faults").Code, ShouldEqual, http.StatusForbidden)
+
+			response := get("secret")
+			So(response.Code, ShouldEqual, http.StatusOK)
+			So(response.Body.String(), ShouldNotContainSubstring, "secret")
+		})
+	})
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/haproxy"
+)
+
+/*
+	Endpoint of `bamboo agent`, receiving configurations pushed by a
+	controller Bamboo managing this proxy host
+*/
+type AgentAPI struct {
+	Config   *conf.Configuration
+	Reloader haproxy.Reloader
+
+	lock sync.Mutex
+}
+
+/*
+	Applies a pushed configuration, e.g.
+	{"Config": "global\n...", "Action": "apply"}. A plain text body is
+	applied as is. Responds with the result, 422 when the configuration
+	is invalid and 500 when it could not be applied.
+*/
+func (a *AgentAPI) PutConfig(w http.ResponseWriter, r *http.Request) {
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") || !validToken(strings.TrimPrefix(authorization, "Bearer "), a.Config.HAProxy.Remote.Token) {
+		responseErrorCode(w, http.StatusForbidden, CodeInvalidToken, "Invalid agent token", nil)
+		return
+	}
+
+	push, err := extractAgentPush(w, r, int64(a.Config.HAProxy.MaxConfigSize))
+	if err != nil {
+		responseError(w, err.Error())
+		return
+	}
+	if len(push.Config) == 0 {
+		responseError(w, "Empty configuration")
+		return
+	}
+
+	// pushes of several controllers must not reload concurrently
+	a.lock.Lock()
+	result := haproxy.ApplyPush(a.Config.HAProxy, push, a.Reloader)
+	a.lock.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case !result.Valid:
+		log.Printf("Agent: HAProxy: rejected configuration from %s: %s\n", r.RemoteAddr, result.Error)
+		a.Config.StatsD.Increment(1.0, "agent.invalid", 1)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	case len(result.Error) > 0:
+		log.Printf("Agent: HAProxy: update failed: %s\n", result.Error)
+		a.Config.StatsD.Increment(1.0, "agent.failed", 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	case result.Reloaded:
+		log.Printf("Agent: HAProxy: Configuration from %s applied in %dms\n", r.RemoteAddr, result.DurationMs)
+		a.Config.StatsD.Increment(1.0, "agent.reloaded", 1)
+	}
+	bites, _ := json.Marshal(result)
+	w.Write(bites)
+}
+
+func extractAgentPush(w http.ResponseWriter, r *http.Request, maxSize int64) (haproxy.AgentPush, error) {
+	push := haproxy.AgentPush{}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxSize))
+	if err != nil {
+		return push, err
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		err = json.Unmarshal(body, &push)
+		return push, err
+	}
+	push.Config = string(body)
+	return push, nil
+}
+
+/*
+	Compares a token of a request with the configured one in constant
+	time. No token is valid when none is configured.
+*/
+func validToken(given string, expected string) bool {
+	if len(expected) == 0 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1
+}
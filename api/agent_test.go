@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+func TestAgent(t *testing.T) {
+	Convey("#validToken", t, func() {
+		So(validToken("secret", "secret"), ShouldBeTrue)
+		So(validToken("secreT", "secret"), ShouldBeFalse)
+		So(validToken("", ""), ShouldBeFalse)
+	})
+
+	Convey("#PutConfig", t, func() {
+		config := &conf.Configuration{}
+		agentAPI := &AgentAPI{Config: config}
+		push := func(authorization string) int {
+			request, _ := http.NewRequest("PUT", "/api/agent/config", strings.NewReader("global\n"))
+			if len(authorization) > 0 {
+				request.Header.Set("Authorization", authorization)
+			}
+			recorder := httptest.NewRecorder()
+			agentAPI.PutConfig(recorder, request)
+			return recorder.Code
+		}
+
+		Convey("should refuse pushes when no token is configured", func() {
+			So(push(""), ShouldEqual, http.StatusForbidden)
+			So(push("Bearer "), ShouldEqual, http.StatusForbidden)
+		})
+
+		Convey("should refuse pushes without the bearer token", func() {
+			config.HAProxy.Remote.Token = "secret"
+			So(push("secret"), ShouldEqual, http.StatusForbidden)
+			So(push("Bearer other"), ShouldEqual, http.StatusForbidden)
+		})
+	})
+}
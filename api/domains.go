@@ -0,0 +1,21 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/samuel/go-zookeeper/zk"
+	"github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/haproxy"
+)
+
+type DomainAPI struct {
+	Config    *configuration.Configuration
+	Zookeeper *zk.Conn
+}
+
+/*
+	Returns the domains generated by the naming scheme
+*/
+func (d *DomainAPI) All(w http.ResponseWriter, r *http.Request) {
+	responseNegotiated(w, r, haproxy.GetTemplateData(d.Config, d.Zookeeper).Domains())
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/zenazn/goji/web"
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/zenazn/goji/web/middleware"
+)
+
+// Machine readable codes of error responses, stable across releases
+const (
+	CodeValidationFailed = "VALIDATION_FAILED"
+	CodeServiceConflict  = "SERVICE_CONFLICT"
+	CodeServiceExists    = "SERVICE_EXISTS"
+	CodeServiceDeleted   = "SERVICE_DELETED"
+	CodeNotFound         = "NOT_FOUND"
+	CodeFeatureDisabled  = "FEATURE_DISABLED"
+	CodeInvalidToken     = "INVALID_TOKEN"
+	CodeDomainNotOwned   = "DOMAIN_NOT_OWNED"
+	CodePolicyViolation  = "POLICY_VIOLATION"
+	CodeNotAcceptable    = "NOT_ACCEPTABLE"
+	// Zookeeper could not be read or written
+	CodeStorageFailed = "STORAGE_FAILED"
+	// A file or service Bamboo depends on is unavailable
+	CodeUnavailable = "UNAVAILABLE"
+)
+
+// Header carrying the id of a request, also logged with the request
+const correlationHeader = "X-Correlation-Id"
+
+/*
+	Body of every error response. Clients branch on Code, Message is
+	meant for humans and may change.
+*/
+type ErrorResponse struct {
+	Code    string
+	Message string
+	Details interface{} `json:",omitempty"`
+	// Id of the request in the Bamboo log
+	CorrelationId string `json:",omitempty"`
+}
+
+/*
+	Sets the id the request is logged with as the correlation id
+	header of the response
+*/
+func Correlation(c *web.C, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := middleware.GetReqID(*c); len(id) > 0 {
+			w.Header().Set(correlationHeader, id)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func responseErrorCode(w http.ResponseWriter, status int, code string, message string, details interface{}) {
+	var data interface{} = ErrorResponse{
+		Code:          code,
+		Message:       message,
+		Details:       details,
+		CorrelationId: w.Header().Get(correlationHeader),
+	}
+	if isV2(w) {
+		data = toV2(reflect.ValueOf(data))
+	}
+	bites, _ := json.Marshal(data)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(bites)
+}
+
+// Responds 400 for requests failing validation
+func responseError(w http.ResponseWriter, message string) {
+	responseErrorCode(w, http.StatusBadRequest, CodeValidationFailed, message, nil)
+}
+
+// Responds 400 when Zookeeper fails, as Bamboo always has
+func responseStorageError(w http.ResponseWriter, err error) {
+	responseErrorCode(w, http.StatusBadRequest, CodeStorageFailed, err.Error(), nil)
+}
+
+func responseNotFound(w http.ResponseWriter, message string) {
+	responseErrorCode(w, http.StatusNotFound, CodeNotFound, message, nil)
+}
+
+func responseDisabled(w http.ResponseWriter, message string) {
+	responseErrorCode(w, http.StatusNotFound, CodeFeatureDisabled, message, nil)
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/zenazn/goji/web"
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/zenazn/goji/web/middleware"
+)
+
+func TestErrorResponses(t *testing.T) {
+	Convey("#responseErrorCode", t, func() {
+		Convey("should write the code, message and correlation id as JSON", func() {
+			recorder := httptest.NewRecorder()
+			recorder.Header().Set(correlationHeader, "host/abc-000042")
+			responseErrorCode(recorder, http.StatusConflict, CodeServiceConflict, "ACL overlaps other services", []string{"/app-2"})
+
+			So(recorder.Code, ShouldEqual, http.StatusConflict)
+			So(recorder.Header().Get("Content-Type"), ShouldEqual, "application/json")
+			response := map[string]interface{}{}
+			So(json.Unmarshal(recorder.Body.Bytes(), &response), ShouldBeNil)
+			So(response["Code"], ShouldEqual, "SERVICE_CONFLICT")
+			So(response["Message"], ShouldEqual, "ACL overlaps other services")
+			So(response["Details"], ShouldResemble, []interface{}{"/app-2"})
+			So(response["CorrelationId"], ShouldEqual, "host/abc-000042")
+		})
+
+		Convey("should use the v2 field names on v2 requests", func() {
+			recorder := httptest.NewRecorder()
+			responseError(&v2ResponseWriter{recorder}, "since must be a revision number")
+
+			So(recorder.Code, ShouldEqual, http.StatusBadRequest)
+			So(recorder.Body.String(), ShouldEqual, `{"code":"VALIDATION_FAILED","message":"since must be a revision number"}`)
+		})
+	})
+
+	Convey("#Correlation", t, func() {
+		Convey("should return the logged request id", func() {
+			c := &web.C{Env: map[string]interface{}{middleware.RequestIDKey: "host/abc-000042"}}
+			recorder := httptest.NewRecorder()
+			handler := Correlation(c, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				responseNotFound(w, "Task /app.1 is not excluded")
+			}))
+			handler.ServeHTTP(recorder, &http.Request{})
+
+			So(recorder.Header().Get(correlationHeader), ShouldEqual, "host/abc-000042")
+			So(recorder.Body.String(), ShouldContainSubstring, `"CorrelationId":"host/abc-000042"`)
+		})
+	})
+}
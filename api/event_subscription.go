@@ -4,9 +4,10 @@ package api
 import (
 	"github.com/QubitProducts/bamboo/configuration"
 	eb "github.com/QubitProducts/bamboo/services/event_bus"
+	"github.com/QubitProducts/bamboo/services/logging"
+	"github.com/QubitProducts/bamboo/services/marathon"
 	"net/http"
 	"io"
-	"log"
 	"encoding/json"
 	"io/ioutil"
 )
@@ -23,9 +24,10 @@ func (sub *EventSubscriptionAPI) Callback(w http.ResponseWriter, r *http.Request
 	err := json.Unmarshal(payload, &event)
 
 	if err != nil {
-		log.Printf("Unable to decode JSON Marathon Event request: %s \n", string(payload))
+		logging.Logf("marathon.callback", "Unable to decode JSON Marathon Event request: %s \n", string(payload))
 	}
 
+	marathon.RecordEvent(event.EventType)
 	sub.EventBus.Publish(event)
 	io.WriteString(w, "Got it!")
 }
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/faults"
+)
+
+type FaultAPI struct {
+	Config *conf.Configuration
+}
+
+func (f *FaultAPI) Get(w http.ResponseWriter, r *http.Request) {
+	if !f.authorized(w, r) {
+		return
+	}
+	responseJSON(w, faults.Current())
+}
+
+/*
+	Replaces the injected faults, e.g.
+	{"FailRenders": 1, "ReloadDelay": 30, "DropEvents": 5}
+*/
+func (f *FaultAPI) Set(w http.ResponseWriter, r *http.Request) {
+	if !f.authorized(w, r) {
+		return
+	}
+
+	injected, err := extractFaults(r)
+	if err != nil {
+		responseError(w, err.Error())
+		return
+	}
+
+	faults.Set(injected)
+	log.Printf("Injecting faults: %d failed renders, %ds reload delay, %d dropped events\n", injected.FailRenders, injected.ReloadDelay, injected.DropEvents)
+	responseJSON(w, injected)
+}
+
+func (f *FaultAPI) Clear(w http.ResponseWriter, r *http.Request) {
+	if !f.authorized(w, r) {
+		return
+	}
+	faults.Set(faults.Faults{})
+	responseJSON(w, faults.Current())
+}
+
+func (f *FaultAPI) authorized(w http.ResponseWriter, r *http.Request) bool {
+	token := f.Config.FaultInjection.Token
+	if len(token) == 0 {
+		token = f.Config.Bamboo.Admin.Token
+	}
+	return tokenAuthorized(token, w, r)
+}
+
+func extractFaults(r *http.Request) (faults.Faults, error) {
+	injected := faults.Faults{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return injected, err
+	}
+	if err := json.Unmarshal(body, &injected); err != nil {
+		return injected, err
+	}
+	if injected.FailRenders < 0 || injected.ReloadDelay < 0 || injected.DropEvents < 0 {
+		return injected, errors.New("Faults must not be negative")
+	}
+	return injected, nil
+}
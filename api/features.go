@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/zenazn/goji/web"
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/features"
+)
+
+type FeatureAPI struct {
+	Config *conf.Configuration
+}
+
+func (f *FeatureAPI) All(w http.ResponseWriter, r *http.Request) {
+	responseNegotiated(w, r, features.All())
+}
+
+/*
+	Toggles a runtime feature flag until the next start, e.g.
+	{"Enabled": false}
+*/
+func (f *FeatureAPI) Set(c web.C, w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(f.Config, w, r) {
+		return
+	}
+
+	request := struct{ Enabled *bool }{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &request)
+	}
+	if err != nil {
+		responseError(w, err.Error())
+		return
+	}
+	if request.Enabled == nil {
+		responseError(w, "Enabled is required")
+		return
+	}
+
+	flag, err := features.Set(c.URLParams["name"], *request.Enabled)
+	if err != nil {
+		responseError(w, err.Error())
+		return
+	}
+
+	log.Printf("Feature flag %s set to %t\n", flag.Name, flag.Enabled)
+	f.Config.StatsD.Increment(1.0, "features.toggled", 1)
+	responseJSON(w, flag)
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/samuel/go-zookeeper/zk"
+	"github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/diff"
+	"github.com/QubitProducts/bamboo/services/haproxy"
+)
+
+type HAProxyAPI struct {
+	Config    *configuration.Configuration
+	Zookeeper *zk.Conn
+}
+
+// Rendered configuration split into sections for the config viewer
+type AnnotatedConfig struct {
+	Path     string
+	Hash     string
+	Lines    int
+	Sections []haproxy.ConfigSection
+}
+
+// Comparison of a shadow instance's configuration with the active one
+type ShadowDiff struct {
+	Identical  bool
+	ActiveHash string
+	ShadowHash string
+	Added      int
+	Removed    int
+	// Unified diff from the active to the shadow configuration
+	Diff string
+}
+
+/*
+	Returns the latest push to each proxy host of the remote reload
+	strategy, with the results reported by agents
+*/
+func (h *HAProxyAPI) Remote(w http.ResponseWriter, r *http.Request) {
+	responseNegotiated(w, r, haproxy.RemoteStatuses())
+}
+
+/*
+	Returns the HAProxy process run by the supervise reload strategy,
+	with its restarts and why it last exited
+*/
+func (h *HAProxyAPI) Process(w http.ResponseWriter, r *http.Request) {
+	status, ok := haproxy.SupervisedProcess()
+	if !ok {
+		responseDisabled(w, "HAProxy is not supervised by Bamboo, use the supervise reload strategy")
+		return
+	}
+	responseJSON(w, status)
+}
+
+/*
+	Returns the rendered HAProxy configuration of this instance, as is
+	or with format=annotated split into sections annotated with the
+	apps they were rendered from
+*/
+func (h *HAProxyAPI) GetConfig(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "raw" && format != "annotated" {
+		responseError(w, "Unknown format "+format+", use raw or annotated")
+		return
+	}
+
+	path := h.Config.HAProxy.EffectiveOutputPath()
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		responseNotFound(w, err.Error())
+		return
+	}
+	if format != "annotated" {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write(content)
+		return
+	}
+
+	mappings := haproxy.GetTemplateData(h.Config, h.Zookeeper).Mapping()
+	sections := haproxy.AnnotateConfig(string(content), mappings)
+	annotated := AnnotatedConfig{Path: path, Hash: hashContent(content), Sections: sections}
+	if len(sections) > 0 {
+		annotated.Lines = sections[len(sections)-1].EndLine
+	}
+	responseNegotiated(w, r, annotated)
+}
+
+/*
+	Compares the configuration rendered in shadow (no-reload) mode with
+	the active configuration, fetched from HAProxy.ShadowCompareEndpoint
+	or read from HAProxy.OutputPath
+*/
+func (h *HAProxyAPI) ShadowDiff(w http.ResponseWriter, r *http.Request) {
+	if !h.Config.HAProxy.NoReload {
+		responseDisabled(w, "Bamboo is not running in shadow (no-reload) mode")
+		return
+	}
+
+	shadow, err := ioutil.ReadFile(h.Config.HAProxy.ShadowOutputPath)
+	if err != nil {
+		responseErrorCode(w, http.StatusServiceUnavailable, CodeUnavailable, "Unable to read shadow configuration: "+err.Error(), nil)
+		return
+	}
+
+	active, err := h.activeConfig()
+	if err != nil {
+		responseErrorCode(w, http.StatusBadGateway, CodeUnavailable, "Unable to read active configuration: "+err.Error(), nil)
+		return
+	}
+
+	lines := diff.Lines(diff.SplitLines(string(active)), diff.SplitLines(string(shadow)))
+	result := ShadowDiff{
+		Identical:  string(active) == string(shadow),
+		ActiveHash: hashContent(active),
+		ShadowHash: hashContent(shadow),
+		Diff:       diff.Unified(lines, "active", "shadow", 3),
+	}
+	for _, line := range lines {
+		switch line.Op {
+		case diff.Insert:
+			result.Added++
+		case diff.Delete:
+			result.Removed++
+		}
+	}
+	responseNegotiated(w, r, result)
+}
+
+func (h *HAProxyAPI) activeConfig() ([]byte, error) {
+	endpoint := h.Config.HAProxy.ShadowCompareEndpoint
+	if len(endpoint) == 0 {
+		return ioutil.ReadFile(h.Config.HAProxy.OutputPath)
+	}
+
+	response, err := http.Get(endpoint + "/api/haproxy/config")
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, errors.New(endpoint + " responded " + response.Status)
+	}
+	return ioutil.ReadAll(response.Body)
+}
+
+func hashContent(content []byte) string {
+	sum := sha1.Sum(content)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/history"
+)
+
+type HistoryAPI struct {
+	Config   *conf.Configuration
+	Recorder *history.Recorder
+}
+
+/*
+	Responds with the backend membership changes of ?app, all apps when
+	not given, between ?from and ?to (RFC 3339), the last 24 hours by
+	default, and the tasks in the backends at ?from
+*/
+func (h *HistoryAPI) Backends(w http.ResponseWriter, r *http.Request) {
+	if h.Recorder == nil {
+		responseDisabled(w, "Backend history is not recorded, enable HAProxy.History")
+		return
+	}
+
+	query := r.URL.Query()
+	to := time.Now()
+	if value := query.Get("to"); len(value) > 0 {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			responseError(w, "to must be an RFC 3339 time, e.g. 2016-05-24T12:00:00Z")
+			return
+		}
+		to = parsed
+	}
+	from := to.Add(-24 * time.Hour)
+	if value := query.Get("from"); len(value) > 0 {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			responseError(w, "from must be an RFC 3339 time, e.g. 2016-05-24T11:00:00Z")
+			return
+		}
+		from = parsed
+	}
+	if from.After(to) {
+		responseError(w, "from must not be after to")
+		return
+	}
+
+	responseNegotiated(w, r, h.Recorder.Timeline(query.Get("app"), from, to))
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	zk "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/samuel/go-zookeeper/zk"
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/zenazn/goji/web"
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/exclusion"
+)
+
+type HostAPI struct {
+	Config    *conf.Configuration
+	Zookeeper *zk.Conn
+}
+
+func (d *HostAPI) All(w http.ResponseWriter, r *http.Request) {
+	hosts, err := exclusion.Hosts(d.Zookeeper, d.Config.Bamboo.Zookeeper)
+	if err != nil {
+		responseStorageError(w, err)
+		return
+	}
+
+	responseNegotiated(w, r, hosts)
+}
+
+/*
+	Excludes all tasks of the host from the rendered backends, the body
+	may give a reason: {"Reason": "disk failure"}
+*/
+func (d *HostAPI) Disable(c web.C, w http.ResponseWriter, r *http.Request) {
+	host := exclusion.Host{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responseError(w, err.Error())
+		return
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &host); err != nil {
+			responseError(w, err.Error())
+			return
+		}
+	}
+
+	host.Host, _ = url.QueryUnescape(c.URLParams["host"])
+	host.Disabled = time.Now()
+	err = exclusion.DisableHost(d.Zookeeper, d.Config.Bamboo.Zookeeper, host)
+	if err != nil {
+		responseStorageError(w, err)
+		return
+	}
+
+	d.Config.StatsD.Increment(1.0, "hosts.disabled", 1)
+	responseJSON(w, host)
+}
+
+func (d *HostAPI) Enable(c web.C, w http.ResponseWriter, r *http.Request) {
+	host, _ := url.QueryUnescape(c.URLParams["host"])
+	err := exclusion.EnableHost(d.Zookeeper, d.Config.Bamboo.Zookeeper, host)
+	if err == zk.ErrNoNode {
+		responseNotFound(w, "Host "+host+" is not disabled")
+		return
+	}
+	if err != nil {
+		responseStorageError(w, err)
+		return
+	}
+
+	d.Config.StatsD.Increment(1.0, "hosts.enabled", 1)
+	responseJSON(w, new(map[string]string))
+}
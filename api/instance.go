@@ -0,0 +1,27 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/samuel/go-zookeeper/zk"
+	"github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/instance"
+)
+
+type InstanceAPI struct {
+	Config    *configuration.Configuration
+	Zookeeper *zk.Conn
+}
+
+/*
+	Lists the running Bamboo instances with their latest reload and
+	config applied lag
+*/
+func (i *InstanceAPI) All(w http.ResponseWriter, r *http.Request) {
+	instances, err := instance.All(i.Zookeeper, i.Config.Bamboo.Zookeeper)
+	if err != nil {
+		responseStorageError(w, err)
+		return
+	}
+	responseNegotiated(w, r, instances)
+}
@@ -0,0 +1,18 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/QubitProducts/bamboo/qzk"
+	eb "github.com/QubitProducts/bamboo/services/event_bus"
+)
+
+/*
+	Responds with the counters of the event bus, the update loop and
+	the Zookeeper watches, for external watchdogs
+*/
+func HandleInternalStats(w http.ResponseWriter, r *http.Request) {
+	stats := eb.PipelineStats()
+	stats.WatchesReestablished, stats.WatchesFailed = qzk.Watches()
+	responseJSON(w, stats)
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	zk "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/samuel/go-zookeeper/zk"
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/zenazn/goji/web"
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/limits"
+)
+
+// Overrides expire after an hour unless a TTL is given
+const defaultOverrideTTL = 3600
+
+type LimitAPI struct {
+	Config    *conf.Configuration
+	Zookeeper *zk.Conn
+}
+
+// Body of an override request
+type overrideRequest struct {
+	MaxConn  int
+	MaxQueue int
+	Reason   string
+	// Seconds until the service limits apply again, 0 for the default
+	TTL int64
+}
+
+func (l *LimitAPI) All(w http.ResponseWriter, r *http.Request) {
+	overrides, err := limits.Overrides(l.Zookeeper, l.Config.Bamboo.Zookeeper)
+	if err != nil {
+		responseStorageError(w, err)
+		return
+	}
+
+	responseNegotiated(w, r, overrides)
+}
+
+/*
+	Overrides the server limits of an app, e.g.
+	{"MaxConn": 500, "MaxQueue": 100, "Reason": "incident", "TTL": 1800}
+*/
+func (l *LimitAPI) Set(c web.C, w http.ResponseWriter, r *http.Request) {
+	request, err := extractOverrideRequest(r)
+	if err != nil {
+		responseError(w, err.Error())
+		return
+	}
+
+	appId, _ := url.QueryUnescape(c.URLParams["id"])
+	now := time.Now()
+	override := limits.Override{
+		AppId:    appId,
+		MaxConn:  request.MaxConn,
+		MaxQueue: request.MaxQueue,
+		Reason:   request.Reason,
+		Set:      now,
+		Expires:  now.Add(time.Duration(request.TTL) * time.Second),
+	}
+	if err := override.Validate(); err != nil {
+		responseError(w, err.Error())
+		return
+	}
+
+	err = limits.SetOverride(l.Zookeeper, l.Config.Bamboo.Zookeeper, override)
+	if err != nil {
+		responseStorageError(w, err)
+		return
+	}
+
+	l.Config.StatsD.Increment(1.0, "limits.overridden", 1)
+	responseJSON(w, override)
+}
+
+func (l *LimitAPI) Clear(c web.C, w http.ResponseWriter, r *http.Request) {
+	appId, _ := url.QueryUnescape(c.URLParams["id"])
+	err := limits.ClearOverride(l.Zookeeper, l.Config.Bamboo.Zookeeper, appId)
+	if err == zk.ErrNoNode {
+		responseNotFound(w, "Limits of "+appId+" are not overridden")
+		return
+	}
+	if err != nil {
+		responseStorageError(w, err)
+		return
+	}
+
+	l.Config.StatsD.Increment(1.0, "limits.cleared", 1)
+	responseJSON(w, new(map[string]string))
+}
+
+func extractOverrideRequest(r *http.Request) (overrideRequest, error) {
+	request := overrideRequest{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return request, err
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return request, err
+	}
+
+	if request.TTL < 0 {
+		return request, errors.New("TTL must not be negative")
+	}
+	if request.TTL == 0 {
+		request.TTL = defaultOverrideTTL
+	}
+	return request, nil
+}
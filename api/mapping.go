@@ -0,0 +1,18 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/samuel/go-zookeeper/zk"
+	"github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/haproxy"
+)
+
+type MappingAPI struct {
+	Config    *configuration.Configuration
+	Zookeeper *zk.Conn
+}
+
+func (m *MappingAPI) Get(w http.ResponseWriter, r *http.Request) {
+	responseNegotiated(w, r, haproxy.GetTemplateData(m.Config, m.Zookeeper).Mapping())
+}
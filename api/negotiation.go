@@ -0,0 +1,132 @@
+package api
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+const (
+	formatJSON = "json"
+	formatYAML = "yaml"
+	formatCSV  = "csv"
+)
+
+var mediaTypeFormats = map[string]string{
+	"application/json":   formatJSON,
+	"application/yaml":   formatYAML,
+	"application/x-yaml": formatYAML,
+	"text/yaml":          formatYAML,
+	"text/csv":           formatCSV,
+}
+
+/*
+	Returns the first supported format of the Accept header,
+	JSON when nothing else is requested
+*/
+func negotiateFormat(r *http.Request) string {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.Split(accepted, ";")[0])
+		if format, ok := mediaTypeFormats[mediaType]; ok {
+			return format
+		}
+	}
+	return formatJSON
+}
+
+/*
+	Writes data as JSON, YAML or CSV depending on the Accept header.
+	CSV is only available for lists and maps of records.
+*/
+func responseNegotiated(w http.ResponseWriter, r *http.Request, data interface{}) {
+	switch negotiateFormat(r) {
+	case formatYAML:
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(marshalYAML(data))
+	case formatCSV:
+		content, err := marshalCSV(data)
+		if err != nil {
+			responseErrorCode(w, http.StatusNotAcceptable, CodeNotAcceptable, err.Error(), nil)
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		w.Write(content)
+	default:
+		responseJSON(w, data)
+	}
+}
+
+/*
+	Encodes a slice or map of records as CSV with a header row. Map
+	records are sorted by key. Nested values are written as JSON.
+*/
+func marshalCSV(data interface{}) ([]byte, error) {
+	v := indirect(reflect.ValueOf(data))
+	records := []reflect.Value{}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			records = append(records, indirect(v.Index(i)))
+		}
+	case reflect.Map:
+		for _, entry := range yamlEntries(v) {
+			records = append(records, indirect(entry.value))
+		}
+	default:
+		return nil, errors.New("CSV is only available for lists")
+	}
+
+	buffer := new(bytes.Buffer)
+	writer := csv.NewWriter(buffer)
+
+	if len(records) > 0 && records[0].Kind() == reflect.Struct {
+		fields := exportedFields(records[0].Type())
+		header := []string{}
+		for _, field := range fields {
+			header = append(header, field.name)
+		}
+		writer.Write(header)
+
+		for _, record := range records {
+			row := []string{}
+			for _, field := range fields {
+				row = append(row, csvCell(record.FieldByIndex(field.index)))
+			}
+			writer.Write(row)
+		}
+	} else {
+		writer.Write([]string{"value"})
+		for _, record := range records {
+			writer.Write([]string{csvCell(record)})
+		}
+	}
+
+	writer.Flush()
+	return buffer.Bytes(), writer.Error()
+}
+
+func csvCell(v reflect.Value) string {
+	v = indirect(v)
+	if !v.IsValid() {
+		return ""
+	}
+	if marshaler, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, _ := marshaler.MarshalText()
+		return string(text)
+	}
+	if isYAMLScalar(v) {
+		if v.Kind() == reflect.String {
+			return v.String()
+		}
+		return fmt.Sprint(v.Interface())
+	}
+	content, _ := json.Marshal(v.Interface())
+	return string(content)
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"testing"
+
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+func TestNegotiation(t *testing.T) {
+	services := map[string]service.Service{
+		"/b": service.Service{Id: "/b", Acl: "hdr(host) -i b.example.com"},
+		"/a": service.Service{Id: "/a", Acl: "true"},
+	}
+
+	Convey("#negotiateFormat", t, func() {
+		r, _ := http.NewRequest("GET", "/api/services", nil)
+
+		Convey("should default to JSON", func() {
+			So(negotiateFormat(r), ShouldEqual, formatJSON)
+		})
+
+		Convey("should pick the first supported media type", func() {
+			r.Header.Set("Accept", "text/html, text/csv;q=0.9, application/yaml")
+			So(negotiateFormat(r), ShouldEqual, formatCSV)
+		})
+	})
+
+	Convey("#marshalYAML", t, func() {
+		Convey("should render sorted maps of records", func() {
+			So(string(marshalYAML(services)), ShouldEqual,
+				"/a:\n  Id: /a\n  Acl: \"true\"\n/b:\n  Id: /b\n  Acl: \"hdr(host) -i b.example.com\"\n")
+		})
+
+		Convey("should render sequences", func() {
+			So(string(marshalYAML([]string{"a", "::b"})), ShouldEqual, "- a\n- \"::b\"\n")
+		})
+	})
+
+	Convey("#marshalCSV", t, func() {
+		type route struct {
+			Id  string
+			Acl string
+		}
+
+		Convey("should render a header and one row per record", func() {
+			content, err := marshalCSV(map[string]route{
+				"/b": route{Id: "/b", Acl: "hdr(host) -i b.example.com"},
+				"/a": route{Id: "/a", Acl: "true"},
+			})
+			So(err, ShouldBeNil)
+			So(string(content), ShouldEqual, "Id,Acl\n/a,true\n/b,hdr(host) -i b.example.com\n")
+		})
+
+		Convey("should render a column per field of services", func() {
+			content, err := marshalCSV(services)
+			So(err, ShouldBeNil)
+			So(string(content), ShouldStartWith, "Id,Acl,HealthCheck")
+		})
+
+		Convey("should refuse non list data", func() {
+			_, err := marshalCSV(service.Service{})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
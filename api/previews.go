@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	zk "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/samuel/go-zookeeper/zk"
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/zenazn/goji/web"
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/policy"
+	"github.com/QubitProducts/bamboo/services/preview"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+type PreviewAPI struct {
+	Config    *conf.Configuration
+	Zookeeper *zk.Conn
+}
+
+// Body of a preview registration
+type previewRequest struct {
+	Branch string
+	AppId  string
+	// Seconds the route lives, 0 for Bamboo.Previews.DefaultTTL
+	TTL int64
+}
+
+func (p *PreviewAPI) All(w http.ResponseWriter, r *http.Request) {
+	services, err := service.All(p.Zookeeper, p.Config.Bamboo.Zookeeper)
+	if err != nil {
+		responseStorageError(w, err)
+		return
+	}
+
+	responseNegotiated(w, r, preview.Routes(services))
+}
+
+/*
+	Routes a subdomain generated from the branch name to the app, e.g.
+	{"Branch": "feature/login", "AppId": "/review/login", "TTL": 86400}.
+	Registering a branch again renews its route.
+*/
+func (p *PreviewAPI) Register(w http.ResponseWriter, r *http.Request) {
+	if !p.enabled(w) {
+		return
+	}
+	request, err := extractPreviewRequest(r)
+	if err != nil {
+		responseError(w, err.Error())
+		return
+	}
+
+	services, err := service.All(p.Zookeeper, p.Config.Bamboo.Zookeeper)
+	if err != nil {
+		responseStorageError(w, err)
+		return
+	}
+	existing, exists := services[request.AppId]
+	if exists && existing.Preview == nil {
+		responseErrorCode(w, http.StatusConflict, CodeServiceConflict, request.AppId+" has a service which is not a preview route", nil)
+		return
+	}
+
+	now := time.Now()
+	serviceModel, err := preview.NewService(p.Config.Bamboo.Previews, request.Branch, request.AppId, request.TTL, now)
+	if err != nil {
+		responseError(w, err.Error())
+		return
+	}
+	if exists && existing.Preview.Branch == request.Branch {
+		serviceModel.Preview.Created = existing.Preview.Created
+	}
+	if conflicts := service.ConflictsWith(serviceModel, services); len(conflicts) > 0 {
+		responseErrorCode(w, http.StatusConflict, CodeServiceConflict, "The preview hostname is routed by other services", conflicts)
+		return
+	}
+
+	input := policy.Input{Action: policy.ActionCreate, ServiceId: request.AppId, Service: &serviceModel}
+	if exists {
+		input.Action = policy.ActionUpdate
+		input.Previous = &existing
+	}
+	if rejectByPolicy(p.Config, w, r, input) {
+		return
+	}
+
+	if exists {
+		_, err = service.Put(p.Zookeeper, p.Config.Bamboo.Zookeeper, request.AppId, serviceModel)
+	} else {
+		_, err = service.Create(p.Zookeeper, p.Config.Bamboo.Zookeeper, serviceModel)
+	}
+	if err != nil {
+		responseStorageError(w, err)
+		return
+	}
+
+	p.Config.StatsD.Increment(1.0, "previews.registered", 1)
+	responseJSON(w, preview.Routes(map[string]service.Service{serviceModel.Id: serviceModel})[0])
+}
+
+func (p *PreviewAPI) Delete(c web.C, w http.ResponseWriter, r *http.Request) {
+	branch, _ := url.QueryUnescape(c.URLParams["branch"])
+	services, err := service.All(p.Zookeeper, p.Config.Bamboo.Zookeeper)
+	if err != nil {
+		responseStorageError(w, err)
+		return
+	}
+
+	for _, route := range preview.Routes(services) {
+		if route.Branch != branch {
+			continue
+		}
+		previous := services[route.AppId]
+		if rejectByPolicy(p.Config, w, r, policy.Input{Action: policy.ActionDelete, ServiceId: route.AppId, Previous: &previous}) {
+			return
+		}
+		if err := service.Delete(p.Zookeeper, p.Config.Bamboo.Zookeeper, route.AppId); err != nil {
+			responseStorageError(w, err)
+			return
+		}
+		responseJSON(w, new(map[string]string))
+		return
+	}
+	responseNotFound(w, "No preview route of branch "+branch)
+}
+
+func (p *PreviewAPI) enabled(w http.ResponseWriter) bool {
+	if !p.Config.Bamboo.Previews.Enabled() {
+		responseDisabled(w, "Preview routes are disabled, set Bamboo.Previews.Domain")
+		return false
+	}
+	return true
+}
+
+func extractPreviewRequest(r *http.Request) (previewRequest, error) {
+	request := previewRequest{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return request, err
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return request, err
+	}
+
+	if len(request.Branch) == 0 {
+		return request, errors.New("Branch is required")
+	}
+	if !strings.HasPrefix(request.AppId, "/") {
+		return request, errors.New("AppId must be an absolute Marathon app id, e.g. /review/login")
+	}
+	if request.TTL < 0 {
+		return request, errors.New("TTL must not be negative")
+	}
+	return request, nil
+}
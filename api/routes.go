@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/samuel/go-zookeeper/zk"
+	"github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/haproxy"
+)
+
+type RoutesAPI struct {
+	Config    *configuration.Configuration
+	Zookeeper *zk.Conn
+}
+
+/*
+	Returns the routes in their effective use_backend order
+*/
+func (a *RoutesAPI) Get(w http.ResponseWriter, r *http.Request) {
+	responseNegotiated(w, r, haproxy.GetTemplateData(a.Config, a.Zookeeper).Routes())
+}
+
+/*
+	Reports which backend a request would be routed to and why, e.g.
+	/api/debug/route?host=app.example.com&path=/api
+*/
+func (a *RoutesAPI) Debug(w http.ResponseWriter, r *http.Request) {
+	host := r.URL.Query().Get("host")
+	path := r.URL.Query().Get("path")
+	if len(host) == 0 {
+		responseError(w, "host is required")
+		return
+	}
+	if len(path) == 0 {
+		path = "/"
+	}
+
+	responseNegotiated(w, r, haproxy.GetTemplateData(a.Config, a.Zookeeper).ResolveRoute(host, path))
+}
@@ -4,29 +4,41 @@ import (
 	"encoding/json"
 	"errors"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 
 	zk "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/samuel/go-zookeeper/zk"
 	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/zenazn/goji/web"
 	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/notify"
+	"github.com/QubitProducts/bamboo/services/ownership"
+	"github.com/QubitProducts/bamboo/services/policy"
 	"github.com/QubitProducts/bamboo/services/service"
+	"github.com/QubitProducts/bamboo/services/state"
 )
 
 type ServiceAPI struct {
-	Config    *conf.Configuration
-	Zookeeper *zk.Conn
+	Config        *conf.Configuration
+	Zookeeper     *zk.Conn
+	State         *state.Tracker
+	Notifications *notify.Dispatcher
 }
 
 func (d *ServiceAPI) All(w http.ResponseWriter, r *http.Request) {
 	services, err := service.All(d.Zookeeper, d.Config.Bamboo.Zookeeper)
 
 	if err != nil {
-		responseError(w, err.Error())
+		responseStorageError(w, err)
 		return
 	}
 
-	responseJSON(w, services)
+	setRevisionHeader(w, d.State.Revision())
+	responseNegotiated(w, r, services)
 }
 
 func (d *ServiceAPI) Create(w http.ResponseWriter, r *http.Request) {
@@ -37,12 +49,24 @@ func (d *ServiceAPI) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err2 := service.Create(d.Zookeeper, d.Config.Bamboo.Zookeeper, serviceModel.Id, serviceModel.Acl)
+	if d.rejectConflicts(w, r, serviceModel) || d.rejectUnownedDomains(w, r, serviceModel) {
+		return
+	}
+	if rejectByPolicy(d.Config, w, r, policy.Input{Action: policy.ActionCreate, ServiceId: serviceModel.Id, Service: &serviceModel}) {
+		return
+	}
+
+	_, err2 := service.Create(d.Zookeeper, d.Config.Bamboo.Zookeeper, serviceModel)
+	if err2 == zk.ErrNodeExists {
+		responseErrorCode(w, http.StatusBadRequest, CodeServiceExists, "Marathon ID might already exist", nil)
+		return
+	}
 	if err2 != nil {
-		responseError(w, "Marathon ID might already exist")
+		responseStorageError(w, err2)
 		return
 	}
 
+	d.Notifications.Notify(serviceModel, notify.EventServiceCreated, "Service "+serviceModel.Id+" created with ACL "+serviceModel.Acl)
 	responseJSON(w, serviceModel)
 }
 
@@ -54,44 +78,285 @@ func (d *ServiceAPI) Put(c web.C, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err1 := service.Put(d.Zookeeper, d.Config.Bamboo.Zookeeper, identifier, serviceModel.Acl)
-	if err1 != nil {
-		responseError(w, err1.Error())
+	serviceModel.Id = identifier
+	if d.rejectConflicts(w, r, serviceModel) || d.rejectUnownedDomains(w, r, serviceModel) {
 		return
 	}
 
+	previous, err := service.Get(d.Zookeeper, d.Config.Bamboo.Zookeeper, identifier)
+	if err == nil && previous.Deleted != nil {
+		err = service.ErrDeleted
+	}
+	if d.rejectUpdate(w, identifier, err) {
+		return
+	}
+	input := policy.Input{Action: policy.ActionUpdate, ServiceId: identifier, Service: &serviceModel, Previous: &previous}
+	if rejectByPolicy(d.Config, w, r, input) {
+		return
+	}
+
+	// a service deleted meanwhile is not brought back
+	serviceModel, err = service.Update(d.Zookeeper, d.Config.Bamboo.Zookeeper, identifier, serviceModel)
+	if d.rejectUpdate(w, identifier, err) {
+		return
+	}
+
+	message := "Service " + identifier + " updated, ACL " + serviceModel.Acl
+	d.Notifications.Notify(serviceModel, notify.EventServiceUpdated, message)
+	// an owner handing the service over is told as well
+	if previous.Owner != nil && (serviceModel.Owner == nil || *previous.Owner != *serviceModel.Owner) {
+		d.Notifications.Notify(previous, notify.EventServiceUpdated, message)
+	}
 	responseJSON(w, serviceModel)
 }
 
+/*
+	Responds 404 when the service to update does not exist and 409 when
+	it is deleted, so that an update does not restore it
+*/
+func (d *ServiceAPI) rejectUpdate(w http.ResponseWriter, identifier string, err error) bool {
+	switch err {
+	case nil:
+		return false
+	case zk.ErrNoNode:
+		responseNotFound(w, "No service "+identifier)
+	case service.ErrDeleted:
+		responseErrorCode(w, http.StatusConflict, CodeServiceDeleted, "Service "+identifier+" is deleted, restore it before updating it", nil)
+	default:
+		responseStorageError(w, err)
+	}
+	return true
+}
+
+/*
+	Marks the service deleted, restorable until
+	Bamboo.DeletedServiceRetention has passed. ?purge=true removes it
+	for good.
+*/
 func (d *ServiceAPI) Delete(c web.C, w http.ResponseWriter, r *http.Request) {
 	identifier, _ := url.QueryUnescape(c.URLParams["id"])
-	err := service.Delete(d.Zookeeper, d.Config.Bamboo.Zookeeper, identifier)
+	purge, _ := strconv.ParseBool(r.URL.Query().Get("purge"))
+	previous, err := service.Get(d.Zookeeper, d.Config.Bamboo.Zookeeper, identifier)
+	if err == zk.ErrNoNode {
+		responseNotFound(w, "No service "+identifier)
+		return
+	}
 	if err != nil {
-		responseError(w, err.Error())
+		responseStorageError(w, err)
+		return
+	}
+	input := policy.Input{Action: policy.ActionDelete, ServiceId: identifier, Previous: &previous}
+	if purge {
+		input.Action = policy.ActionPurge
+	}
+	if rejectByPolicy(d.Config, w, r, input) {
+		return
+	}
+
+	if purge {
+		err := service.Delete(d.Zookeeper, d.Config.Bamboo.Zookeeper, identifier)
+		if err == zk.ErrNoNode {
+			responseNotFound(w, "No service "+identifier)
+			return
+		}
+		if err != nil {
+			responseStorageError(w, err)
+			return
+		}
+		d.Notifications.Notify(previous, notify.EventServiceDeleted, "Service "+identifier+" deleted for good")
+		responseJSON(w, new(map[string]string))
+		return
+	}
+
+	serviceModel, err := service.SoftDelete(d.Zookeeper, d.Config.Bamboo.Zookeeper, identifier, d.Config.Bamboo.DeletedServiceRetentionDuration(), time.Now())
+	if err == zk.ErrNoNode {
+		responseNotFound(w, "No service "+identifier)
+		return
+	}
+	if err != nil {
+		responseStorageError(w, err)
+		return
+	}
+
+	d.Notifications.Notify(serviceModel, notify.EventServiceDeleted, "Service "+identifier+" deleted, it can be restored until "+serviceModel.Deleted.Purge.Format(time.RFC3339))
+	responseJSON(w, serviceModel)
+}
+
+/*
+	Lists the deleted services which can still be restored
+*/
+func (d *ServiceAPI) Deleted(w http.ResponseWriter, r *http.Request) {
+	services, err := service.AllDeleted(d.Zookeeper, d.Config.Bamboo.Zookeeper)
+	if err != nil {
+		responseStorageError(w, err)
+		return
+	}
+	responseNegotiated(w, r, services)
+}
+
+/*
+	Restores a deleted service. Responds 409 when its ACL now overlaps
+	other services, unless ?force=true
+*/
+func (d *ServiceAPI) Restore(c web.C, w http.ResponseWriter, r *http.Request) {
+	identifier, _ := url.QueryUnescape(c.URLParams["id"])
+	deleted, err := service.AllDeleted(d.Zookeeper, d.Config.Bamboo.Zookeeper)
+	if err != nil {
+		responseStorageError(w, err)
+		return
+	}
+	serviceModel, ok := deleted[identifier]
+	if !ok {
+		responseNotFound(w, "No deleted service "+identifier)
+		return
+	}
+	if d.rejectConflicts(w, r, serviceModel) {
 		return
 	}
+	if rejectByPolicy(d.Config, w, r, policy.Input{Action: policy.ActionRestore, ServiceId: identifier, Service: &serviceModel}) {
+		return
+	}
+
+	serviceModel, err = service.Restore(d.Zookeeper, d.Config.Bamboo.Zookeeper, identifier)
+	if err == zk.ErrNoNode {
+		responseNotFound(w, "No deleted service "+identifier)
+		return
+	}
+	if err != nil {
+		responseStorageError(w, err)
+		return
+	}
+	d.Notifications.Notify(serviceModel, notify.EventServiceRestored, "Service "+identifier+" restored")
+
+	responseJSON(w, serviceModel)
+}
+
+/*
+	Lists the services whose ACLs overlap, rendering order decides which
+	one receives the matching requests
+*/
+func (d *ServiceAPI) Conflicts(w http.ResponseWriter, r *http.Request) {
+	services, err := service.All(d.Zookeeper, d.Config.Bamboo.Zookeeper)
+	if err != nil {
+		responseStorageError(w, err)
+		return
+	}
+	responseNegotiated(w, r, service.Conflicts(services))
+}
+
+/*
+	Responds 409 when the service overlaps the ACLs of other services,
+	unless ?force=true
+*/
+func (d *ServiceAPI) rejectConflicts(w http.ResponseWriter, r *http.Request, serviceModel service.Service) bool {
+	if force, _ := strconv.ParseBool(r.URL.Query().Get("force")); force {
+		return false
+	}
+
+	services, err := service.All(d.Zookeeper, d.Config.Bamboo.Zookeeper)
+	if err != nil {
+		responseStorageError(w, err)
+		return true
+	}
 
-	responseJSON(w, new(map[string]string))
+	conflicts := service.ConflictsWith(serviceModel, services)
+	if len(conflicts) == 0 {
+		return false
+	}
+	responseErrorCode(w, http.StatusConflict, CodeServiceConflict, "ACL overlaps other services, retry with ?force=true to store it anyway", conflicts)
+	return true
+}
+
+/*
+	Responds 403 unless the team named by the request owns the domains
+	the service ACL routes, when Bamboo.DomainOwnership is enabled
+*/
+func (d *ServiceAPI) rejectUnownedDomains(w http.ResponseWriter, r *http.Request, serviceModel service.Service) bool {
+	config := d.Config.Bamboo.DomainOwnership
+	if !config.Enabled() {
+		return false
+	}
+
+	domains, ok := service.Domains(serviceModel.Acl)
+	if !ok {
+		responseErrorCode(w, http.StatusForbidden, CodeDomainNotOwned, "Domain ownership can only be checked for ACLs made of a single rule on exact hostnames, domains or paths", nil)
+		return true
+	}
+	if len(domains) == 0 {
+		return false
+	}
+	team := r.Header.Get(config.TeamHeader)
+	if len(team) == 0 {
+		responseError(w, "The "+config.TeamHeader+" header must name the team owning "+strings.Join(domains, ", "))
+		return true
+	}
+	if err := ownership.Check(config, team, serviceModel.Id, domains); err != nil {
+		d.Config.StatsD.Increment(1.0, "services.domain_rejected", 1)
+		responseErrorCode(w, http.StatusForbidden, CodeDomainNotOwned, err.Error(), domains)
+		return true
+	}
+	return false
+}
+
+/*
+	Responds 403 with the violations when the policies do not allow the
+	mutation of a service or of a preview route, when Bamboo.Policy is
+	enabled. Every decision is logged for audits.
+*/
+func rejectByPolicy(config *conf.Configuration, w http.ResponseWriter, r *http.Request, input policy.Input) bool {
+	policyConfig := config.Bamboo.Policy
+	if !policyConfig.Enabled() {
+		return false
+	}
+
+	input.Team = r.Header.Get(config.Bamboo.DomainOwnership.TeamHeader)
+	decision, err := policy.Evaluate(policyConfig, input)
+	if err != nil {
+		config.StatsD.Increment(1.0, "services.policy_failed", 1)
+		if policyConfig.FailOpen {
+			log.Printf("Policy: %s of %s allowed, the policy could not be evaluated: %s\n", input.Action, input.ServiceId, err)
+			return false
+		}
+		log.Printf("Policy: %s of %s refused, the policy could not be evaluated: %s\n", input.Action, input.ServiceId, err)
+		responseErrorCode(w, http.StatusServiceUnavailable, CodeUnavailable, "Unable to evaluate the policy: "+err.Error(), nil)
+		return true
+	}
+	if decision.Allowed {
+		log.Printf("Policy: %s of %s by team %q allowed\n", input.Action, input.ServiceId, input.Team)
+		return false
+	}
+
+	log.Printf("Policy: %s of %s by team %q denied: %s\n", input.Action, input.ServiceId, input.Team, strings.Join(decision.Violations, "; "))
+	config.StatsD.Increment(1.0, "services.policy_denied", 1)
+	message := "The " + input.Action + " of " + input.ServiceId + " violates policies"
+	if len(decision.Violations) > 0 {
+		message += ": " + strings.Join(decision.Violations, "; ")
+	}
+	responseErrorCode(w, http.StatusForbidden, CodePolicyViolation, message, decision.Violations)
+	return true
 }
 
 func extractServiceModel(r *http.Request) (service.Service, error) {
-	var serviceModel service.Service
 	payload, _ := ioutil.ReadAll(r.Body)
+	return decodeServiceModel(payload)
+}
 
+// Decodes and validates a service as written through the API
+func decodeServiceModel(payload []byte) (service.Service, error) {
+	var serviceModel service.Service
 	err := json.Unmarshal(payload, &serviceModel)
 	if err != nil {
 		return serviceModel, errors.New("Unable to decode JSON request")
 	}
 
-	return serviceModel, nil
-}
-
-func responseError(w http.ResponseWriter, message string) {
-	http.Error(w, message, http.StatusBadRequest)
+	return serviceModel, service.Normalize(&serviceModel, time.Now())
 }
 
 func responseJSON(w http.ResponseWriter, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
+	if isV2(w) {
+		data = toV2(reflect.ValueOf(data))
+	}
 	bites, _ := json.Marshal(data)
 	w.Write(bites)
 }
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/samuel/go-zookeeper/zk"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+func TestServiceUpdate(t *testing.T) {
+	Convey("#rejectUpdate", t, func() {
+		api := &ServiceAPI{}
+		recorder := httptest.NewRecorder()
+
+		Convey("should let existing services be updated", func() {
+			So(api.rejectUpdate(recorder, "/app-1", nil), ShouldBeFalse)
+		})
+
+		Convey("should respond 404 for unknown services", func() {
+			So(api.rejectUpdate(recorder, "/app-1", zk.ErrNoNode), ShouldBeTrue)
+			So(recorder.Code, ShouldEqual, http.StatusNotFound)
+		})
+
+		Convey("should respond 409 for deleted services", func() {
+			So(api.rejectUpdate(recorder, "/app-1", service.ErrDeleted), ShouldBeTrue)
+			So(recorder.Code, ShouldEqual, http.StatusConflict)
+			So(recorder.Body.String(), ShouldContainSubstring, CodeServiceDeleted)
+		})
+
+		Convey("should report storage failures", func() {
+			So(api.rejectUpdate(recorder, "/app-1", errors.New("connection closed")), ShouldBeTrue)
+			So(recorder.Body.String(), ShouldContainSubstring, CodeStorageFailed)
+		})
+	})
+}
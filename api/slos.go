@@ -0,0 +1,22 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/samuel/go-zookeeper/zk"
+	"github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/haproxy"
+)
+
+type SloAPI struct {
+	Config    *configuration.Configuration
+	Zookeeper *zk.Conn
+}
+
+/*
+	Returns the service level objectives of the apps with their
+	backends, the feed consumed by alerting
+*/
+func (a *SloAPI) Get(w http.ResponseWriter, r *http.Request) {
+	responseNegotiated(w, r, haproxy.GetTemplateData(a.Config, a.Zookeeper).Slos())
+}
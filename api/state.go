@@ -1,21 +1,159 @@
 package api
 
 import (
-	"encoding/json"
-	"io"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/samuel/go-zookeeper/zk"
 	"github.com/QubitProducts/bamboo/configuration"
 	"github.com/QubitProducts/bamboo/services/haproxy"
+	"github.com/QubitProducts/bamboo/services/state"
 )
 
+const (
+	defaultWatchTimeout = 30 * time.Second
+	maxWatchTimeout     = 5 * time.Minute
+)
+
+// Full state with the outcome of the latest render and reload
+type stateResponse struct {
+	haproxy.TemplateData
+	LastReload *state.Reload
+	// When the tasks of each app last changed, by app id
+	BackendChanges map[string]time.Time
+}
+
 type StateAPI struct {
 	Config    *configuration.Configuration
 	Zookeeper *zk.Conn
+	State     *state.Tracker
+}
+
+/*
+	Returns the template data, or only the changes after revision
+	?since. With ?watch=true the request is held until the state
+	revision is greater than ?since (the current revision by default)
+	or ?timeout seconds expire.
+*/
+func (s *StateAPI) Get(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	revision := s.State.Revision()
+
+	since := revision
+	hasSince := len(query.Get("since")) > 0
+	if hasSince {
+		parsed, err := strconv.ParseInt(query.Get("since"), 10, 64)
+		if err != nil {
+			responseError(w, "since must be a revision number")
+			return
+		}
+		since = parsed
+	}
+
+	if watch, _ := strconv.ParseBool(query.Get("watch")); watch {
+		timeout, err := watchTimeout(query.Get("timeout"))
+		if err != nil {
+			responseError(w, err.Error())
+			return
+		}
+		revision = s.State.Wait(since, timeout)
+	}
+
+	if hasSince {
+		delta := s.State.DeltaSince(since)
+		setRevisionHeader(w, delta.Revision)
+		responseNegotiated(w, r, delta)
+		return
+	}
+
+	data := haproxy.GetTemplateData(s.Config, s.Zookeeper)
+	data.Revision = revision
+	setRevisionHeader(w, revision)
+
+	// The state itself is not a list, its apps are
+	if negotiateFormat(r) == formatCSV {
+		responseNegotiated(w, r, data.Apps)
+		return
+	}
+	responseNegotiated(w, r, stateResponse{data, s.State.LastReload(), s.State.BackendChanges()})
+}
+
+/*
+	Returns the change feed after ?since, 0 by default
+*/
+func (s *StateAPI) Changes(w http.ResponseWriter, r *http.Request) {
+	var since int64
+	if value := r.URL.Query().Get("since"); len(value) > 0 {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			responseError(w, "since must be a revision number")
+			return
+		}
+		since = parsed
+	}
+
+	feed := s.State.ChangesSince(since)
+	setRevisionHeader(w, feed.Revision)
+	responseNegotiated(w, r, feed)
+}
+
+/*
+	Returns the latest render and reload outcomes, newest first,
+	including configurations rejected by the validation hook
+*/
+func (s *StateAPI) Reloads(w http.ResponseWriter, r *http.Request) {
+	responseNegotiated(w, r, s.State.Reloads())
+}
+
+/*
+	Returns the apps joined with their services and the latest reload,
+	as maintained by the update loop. With ?watch=true the request is
+	held until the view version is greater than ?since or ?timeout
+	seconds expire, so that the webapp is pushed changes without
+	polling.
+*/
+func (s *StateAPI) View(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	watch, _ := strconv.ParseBool(query.Get("watch"))
+	if !watch {
+		responseJSON(w, s.State.View())
+		return
+	}
+
+	var since int64
+	if value := query.Get("since"); len(value) > 0 {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			responseError(w, "since must be a view version")
+			return
+		}
+		since = parsed
+	}
+	timeout, err := watchTimeout(query.Get("timeout"))
+	if err != nil {
+		responseError(w, err.Error())
+		return
+	}
+	responseJSON(w, s.State.WaitView(since, timeout))
+}
+
+func setRevisionHeader(w http.ResponseWriter, revision int64) {
+	w.Header().Set("X-Bamboo-Revision", strconv.FormatInt(revision, 10))
 }
 
-func (state *StateAPI) Get(w http.ResponseWriter, r *http.Request) {
-	payload, _ := json.Marshal(haproxy.GetTemplateData(state.Config, state.Zookeeper))
-	io.WriteString(w, string(payload))
+func watchTimeout(value string) (time.Duration, error) {
+	if len(value) == 0 {
+		return defaultWatchTimeout, nil
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		return 0, errors.New("timeout must be a positive number of seconds")
+	}
+	timeout := time.Duration(seconds) * time.Second
+	if timeout > maxWatchTimeout {
+		timeout = maxWatchTimeout
+	}
+	return timeout, nil
 }
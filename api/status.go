@@ -1,11 +1,42 @@
 package api
 
 import(
+	"encoding/json"
 	"io"
 	"net/http"
+	"strings"
+
+	"github.com/QubitProducts/bamboo/services/marathon"
+	"github.com/QubitProducts/bamboo/services/template"
 )
 
-// Status Handler
+/*
+	Status Handler, reporting DEGRADED while the template does not
+	parse. The status code stays 200 so that the instance is not
+	restarted by health checks while it waits for a fixed template.
+*/
 func HandleStatus(w http.ResponseWriter, r *http.Request) {
-	io.WriteString(w, "OK")
+	templateStatus := template.CurrentStatus()
+	summary := "OK"
+	if !templateStatus.Valid {
+		summary = "DEGRADED"
+	}
+
+	if !strings.Contains(r.Header.Get("Accept"), "application/json") {
+		if !templateStatus.Valid {
+			summary += ": template " + templateStatus.Path + ": " + templateStatus.Error.Error()
+		}
+		io.WriteString(w, summary)
+		return
+	}
+
+	// details for dashboards, load balancer checks keep the plain body
+	status := struct {
+		Status   string
+		Marathon marathon.SubscriptionHealth
+		Template template.Status
+	}{summary, marathon.Subscription(), templateStatus}
+	w.Header().Set("Content-Type", "application/json")
+	bites, _ := json.Marshal(status)
+	w.Write(bites)
 }
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/samuel/go-zookeeper/zk"
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/haproxy"
+	"github.com/QubitProducts/bamboo/services/instance"
+	"github.com/QubitProducts/bamboo/services/marathon"
+	"github.com/QubitProducts/bamboo/services/state"
+	bambooTemplate "github.com/QubitProducts/bamboo/services/template"
+)
+
+// Reloads and failed renders listed by the status page
+const statuszReloads = 10
+
+type StatuszAPI struct {
+	Config    *conf.Configuration
+	Zookeeper *zk.Conn
+	State     *state.Tracker
+}
+
+// Health of a dependency of the instance
+type statuszCheck struct {
+	Name    string
+	Healthy bool
+	Detail  string
+}
+
+type statuszInstance struct {
+	instance.Instance
+	Self    bool
+	Drifted bool
+}
+
+type statuszPage struct {
+	Status    string
+	Instance  string
+	Generated time.Time
+	Checks    []statuszCheck
+	Fleet     []statuszInstance
+	// Why the fleet could not be listed
+	FleetError string
+	Reloads    []state.Reload
+	Failures   []state.Reload
+}
+
+/*
+	Responds with an HTML page summarizing the health of this instance
+	and its dependencies, the drift of the fleet and the recent reloads
+	and failures, failed smoke checks included. The page is rendered by
+	Bamboo itself so that it is available when the webapp is broken.
+*/
+func (s *StatuszAPI) Get(w http.ResponseWriter, r *http.Request) {
+	page := statuszPage{
+		Instance:  instance.SelfId(s.Config),
+		Generated: time.Now(),
+		Checks:    s.checks(),
+	}
+
+	page.Status = "OK"
+	for _, check := range page.Checks {
+		if !check.Healthy {
+			page.Status = "DEGRADED"
+		}
+	}
+
+	instances, err := instance.All(s.Zookeeper, s.Config.Bamboo.Zookeeper)
+	if err != nil {
+		page.FleetError = err.Error()
+	}
+	drifted := instance.Drifted(instances)
+	for _, member := range instances {
+		page.Fleet = append(page.Fleet, statuszInstance{
+			Instance: member,
+			Self:     member.Id == page.Instance,
+			Drifted:  drifted[member.Id],
+		})
+	}
+
+	for _, reload := range s.State.Reloads() {
+		if len(page.Reloads) < statuszReloads {
+			page.Reloads = append(page.Reloads, reload)
+		}
+		if (!reload.Success || reload.SmokeFailed) && len(page.Failures) < statuszReloads {
+			page.Failures = append(page.Failures, reload)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := renderStatusz(w, page); err != nil {
+		log.Println("Unable to render the status page:", err)
+	}
+}
+
+// Returns the health of the dependencies of this instance
+func (s *StatuszAPI) checks() []statuszCheck {
+	checks := []statuszCheck{}
+
+	templateStatus := bambooTemplate.CurrentStatus()
+	check := statuszCheck{Name: "Template", Healthy: templateStatus.Valid, Detail: templateStatus.Path}
+	if !templateStatus.Valid {
+		check.Detail = templateStatus.Path + ": " + templateStatus.Error.Error()
+	}
+	checks = append(checks, check)
+
+	zkState := s.Zookeeper.State()
+	checks = append(checks, statuszCheck{
+		Name:    "Zookeeper",
+		Healthy: zkState == zk.StateHasSession,
+		Detail:  zkState.String(),
+	})
+
+	subscription := marathon.Subscription()
+	check = statuszCheck{Name: "Marathon events", Healthy: subscription.Subscribed}
+	switch {
+	case subscription.LastChecked.IsZero():
+		// not known before the first check
+		check.Healthy = true
+		check.Detail = "subscription not checked yet"
+	case len(subscription.CheckError) > 0:
+		check.Detail = subscription.CheckError
+	case !subscription.Subscribed:
+		check.Detail = "callback not subscribed"
+	case subscription.LastEvent.IsZero():
+		check.Detail = "no event received"
+	default:
+		check.Detail = fmt.Sprintf("%d events received, last %s at %s", subscription.EventsReceived,
+			subscription.LastEventType, subscription.LastEvent.Format(time.RFC3339))
+	}
+	checks = append(checks, check)
+
+	if process, supervised := haproxy.SupervisedProcess(); supervised {
+		check = statuszCheck{Name: "HAProxy process", Healthy: process.Running}
+		switch {
+		case process.Running:
+			check.Detail = fmt.Sprintf("pid %d, %d restarts", process.Pid, process.Restarts)
+		case process.LastExit != nil:
+			check.Detail = "exited: " + process.LastExit.Reason
+		default:
+			check.Detail = "not started yet"
+		}
+		checks = append(checks, check)
+	}
+
+	if last := s.State.LastReload(); last != nil {
+		check = statuszCheck{Name: "Last render", Healthy: last.Success, Detail: fmt.Sprintf("revision %d", last.Revision)}
+		switch {
+		case !last.Success:
+			check.Detail = last.Error
+		case last.SmokeFailed:
+			check.Healthy = false
+			check.Detail = fmt.Sprintf("revision %d applied, smoke check failed", last.Revision)
+		}
+		checks = append(checks, check)
+	}
+
+	for _, remote := range haproxy.RemoteStatuses() {
+		check = statuszCheck{Name: "Remote " + remote.Target, Healthy: remote.Success, Detail: remote.Error}
+		if remote.Success {
+			check.Detail = "pushed at " + remote.Time.Format(time.RFC3339)
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+func renderStatusz(w io.Writer, page statuszPage) error {
+	return statuszTemplate.Execute(w, page)
+}
+
+var statuszTemplate = template.Must(template.New("statusz").Funcs(template.FuncMap{
+	"time": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.Format(time.RFC3339)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="30">
+<title>Bamboo {{.Status}} - {{.Instance}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+.ok { color: #2a7d2a; }
+.bad { color: #c0392b; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>Bamboo <span class="{{if eq .Status "OK"}}ok{{else}}bad{{end}}">{{.Status}}</span></h1>
+<p>Instance {{.Instance}}, generated at {{time .Generated}}</p>
+
+<h2>Dependencies</h2>
+<table>
+<tr><th>Check</th><th>Status</th><th>Detail</th></tr>
+{{range .Checks}}<tr><td>{{.Name}}</td><td class="{{if .Healthy}}ok{{else}}bad{{end}}">{{if .Healthy}}OK{{else}}FAILING{{end}}</td><td>{{.Detail}}</td></tr>
+{{end}}</table>
+
+<h2>Fleet</h2>
+{{if .FleetError}}<p class="bad">Unable to list the instances: {{.FleetError}}</p>
+{{else}}<table>
+<tr><th>Instance</th><th>Revision</th><th>Config</th><th>Updated</th><th>Applied lag</th><th>Drift</th></tr>
+{{range .Fleet}}<tr><td>{{.Id}}{{if .Self}} (this instance){{end}}</td><td>{{.Revision}}</td><td>{{with .LastReload}}{{printf "%.12s" .ConfigHash}}{{end}}</td><td>{{time .Updated}}</td><td>{{.ConfigAppliedLagMs}} ms</td><td class="{{if .Drifted}}bad{{else}}ok{{end}}">{{if .Drifted}}DRIFTED{{else}}in sync{{end}}</td></tr>
+{{else}}<tr><td colspan="6">No instance registered</td></tr>
+{{end}}</table>
+{{end}}
+<h2>Recent reloads</h2>
+<table>
+<tr><th>Time</th><th>Revision</th><th>Outcome</th><th>Duration</th><th>Config</th></tr>
+{{range .Reloads}}<tr><td>{{time .Timestamp}}</td><td>{{.Revision}}</td><td class="{{if and .Success (not .SmokeFailed)}}ok{{else}}bad{{end}}">{{if not .Success}}{{if .Rejected}}rejected{{else}}failed{{end}}{{else if .Reloaded}}reloaded{{else if .RuntimeUpdate}}runtime update{{else}}unchanged{{end}}{{if .SmokeFailed}}, smoke check failed{{end}}</td><td>{{.DurationMs}} ms</td><td>{{printf "%.12s" .ConfigHash}}</td></tr>
+{{else}}<tr><td colspan="5">No render yet</td></tr>
+{{end}}</table>
+
+<h2>Recent failures</h2>
+<table>
+<tr><th>Time</th><th>Revision</th><th>Render</th><th>Error</th></tr>
+{{range .Failures}}<tr><td>{{time .Timestamp}}</td><td>{{.Revision}}</td><td>{{.RenderId}}</td><td>{{.Error}}{{range .SmokeCheck}}{{if not .Passed}} smoke probe {{.Url}}: {{.Error}}{{end}}{{end}}</td></tr>
+{{else}}<tr><td colspan="4">No failure</td></tr>
+{{end}}</table>
+
+<p><a href="/status">/status</a> <a href="/api/reloads">/api/reloads</a> <a href="/api/instances">/api/instances</a> <a href="/api/internal/stats">/api/internal/stats</a></p>
+</body>
+</html>
+`))
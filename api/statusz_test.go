@@ -0,0 +1,43 @@
+package api
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"github.com/QubitProducts/bamboo/services/instance"
+	"github.com/QubitProducts/bamboo/services/state"
+)
+
+func TestStatusz(t *testing.T) {
+	Convey("#renderStatusz", t, func() {
+		failed := state.Reload{Revision: 7, Timestamp: time.Now(), Error: "<script>alert(1)</script>"}
+		page := statuszPage{
+			Status:    "DEGRADED",
+			Instance:  "bamboo-1:8000",
+			Generated: time.Now(),
+			Checks:    []statuszCheck{{Name: "Zookeeper", Healthy: false, Detail: "StateDisconnected"}},
+			Fleet: []statuszInstance{
+				{Instance: instance.Instance{Id: "bamboo-1:8000", Revision: 7}, Self: true},
+				{Instance: instance.Instance{Id: "bamboo-2:8000", Revision: 6}, Drifted: true},
+			},
+			Reloads:  []state.Reload{failed},
+			Failures: []state.Reload{failed},
+		}
+		content := new(bytes.Buffer)
+		So(renderStatusz(content, page), ShouldBeNil)
+
+		Convey("should summarize the checks and the fleet", func() {
+			So(content.String(), ShouldContainSubstring, "<title>Bamboo DEGRADED - bamboo-1:8000</title>")
+			So(content.String(), ShouldContainSubstring, "StateDisconnected")
+			So(content.String(), ShouldContainSubstring, "bamboo-1:8000 (this instance)")
+			So(content.String(), ShouldContainSubstring, "DRIFTED")
+		})
+
+		Convey("should escape the errors", func() {
+			So(content.String(), ShouldNotContainSubstring, "<script>")
+			So(content.String(), ShouldContainSubstring, "&lt;script&gt;")
+		})
+	})
+}
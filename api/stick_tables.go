@@ -0,0 +1,23 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/samuel/go-zookeeper/zk"
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/haproxy"
+)
+
+type StickTableAPI struct {
+	Config    *conf.Configuration
+	Zookeeper *zk.Conn
+}
+
+/*
+	Responds with the stick tables of the current state, their
+	estimated memory and the configured budget
+*/
+func (s *StickTableAPI) Get(w http.ResponseWriter, r *http.Request) {
+	data := haproxy.GetTemplateData(s.Config, s.Zookeeper)
+	responseJSON(w, haproxy.EstimateStickTables(data.StickTables(), s.Config.HAProxy.StickTables.MemoryBudget))
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	zk "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/samuel/go-zookeeper/zk"
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/zenazn/goji/web"
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/exclusion"
+)
+
+// Exclusions expire after an hour unless a TTL is given
+const defaultExclusionTTL = 3600
+
+type TaskAPI struct {
+	Config    *conf.Configuration
+	Zookeeper *zk.Conn
+}
+
+// Body of an exclusion request
+type exclusionRequest struct {
+	Reason string
+	// Seconds until the task is included again, 0 for the default
+	TTL int64
+}
+
+func (d *TaskAPI) Excluded(w http.ResponseWriter, r *http.Request) {
+	tasks, err := exclusion.Tasks(d.Zookeeper, d.Config.Bamboo.Zookeeper)
+	if err != nil {
+		responseStorageError(w, err)
+		return
+	}
+
+	responseNegotiated(w, r, tasks)
+}
+
+/*
+	Excludes a task from its backends, the body may give a reason and
+	a TTL in seconds: {"Reason": "slow responses", "TTL": 600}
+*/
+func (d *TaskAPI) Exclude(c web.C, w http.ResponseWriter, r *http.Request) {
+	request, err := extractExclusionRequest(r)
+	if err != nil {
+		responseError(w, err.Error())
+		return
+	}
+
+	taskId, _ := url.QueryUnescape(c.URLParams["id"])
+	now := time.Now()
+	task := exclusion.Task{
+		TaskId:   taskId,
+		Reason:   request.Reason,
+		Excluded: now,
+		Expires:  now.Add(time.Duration(request.TTL) * time.Second),
+	}
+	err = exclusion.ExcludeTask(d.Zookeeper, d.Config.Bamboo.Zookeeper, task)
+	if err != nil {
+		responseStorageError(w, err)
+		return
+	}
+
+	d.Config.StatsD.Increment(1.0, "tasks.excluded", 1)
+	responseJSON(w, task)
+}
+
+func (d *TaskAPI) Include(c web.C, w http.ResponseWriter, r *http.Request) {
+	taskId, _ := url.QueryUnescape(c.URLParams["id"])
+	err := exclusion.IncludeTask(d.Zookeeper, d.Config.Bamboo.Zookeeper, taskId)
+	if err == zk.ErrNoNode {
+		responseNotFound(w, "Task "+taskId+" is not excluded")
+		return
+	}
+	if err != nil {
+		responseStorageError(w, err)
+		return
+	}
+
+	d.Config.StatsD.Increment(1.0, "tasks.included", 1)
+	responseJSON(w, new(map[string]string))
+}
+
+func extractExclusionRequest(r *http.Request) (exclusionRequest, error) {
+	request := exclusionRequest{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return request, err
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &request); err != nil {
+			return request, err
+		}
+	}
+
+	if request.TTL < 0 {
+		return request, errors.New("TTL must not be negative")
+	}
+	if request.TTL == 0 {
+		request.TTL = defaultExclusionTTL
+	}
+	return request, nil
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/samuel/go-zookeeper/zk"
+	"github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/haproxy"
+	"github.com/QubitProducts/bamboo/services/lint"
+	"github.com/QubitProducts/bamboo/services/state"
+	"github.com/QubitProducts/bamboo/services/template"
+)
+
+const (
+	maxPreviewTemplateSize = 1 << 20
+	previewTimeout         = 5 * time.Second
+	previewMaxOutputSize   = 10 << 20
+)
+
+type TemplateAPI struct {
+	Config    *configuration.Configuration
+	Zookeeper *zk.Conn
+	State     *state.Tracker
+}
+
+// Preview render result, Error is set instead of Output on failure
+type TemplatePreview struct {
+	Output string
+	Error  *template.RenderError
+	// Lint findings of the rendered output
+	Lint lint.Issues
+}
+
+/*
+	Renders the posted template body against the current state without
+	writing or reloading anything
+*/
+func (t *TemplateAPI) Preview(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxPreviewTemplateSize+1))
+	if err != nil {
+		responseError(w, "Unable to read template")
+		return
+	}
+	if len(body) > maxPreviewTemplateSize {
+		responseError(w, "Template is too large")
+		return
+	}
+
+	data := haproxy.GetTemplateData(t.Config, t.Zookeeper)
+	data.LuaScripts, _ = haproxy.ReadLuaScripts(t.Config.HAProxy.Lua)
+	limits := template.Limits{Timeout: previewTimeout, MaxOutputSize: previewMaxOutputSize}
+	output, err := template.RenderTemplateWithLimits("preview", string(body), data, limits)
+
+	preview := TemplatePreview{Output: output, Lint: lint.Issues{}}
+	if err != nil {
+		preview.Error = err.(*template.RenderError)
+	} else {
+		preview.Lint = lint.Lint(output, t.Config.HAProxy.Lint)
+	}
+	responseJSON(w, preview)
+}
+
+// Template data with the names of the helper functions
+type TemplateDataExport struct {
+	Data      haproxy.TemplateData
+	Functions []string
+}
+
+/*
+	Returns the data of the latest render as passed to the template,
+	the current state when nothing has been rendered yet
+*/
+func (t *TemplateAPI) Data(w http.ResponseWriter, r *http.Request) {
+	revision, data := t.State.Data()
+	if revision == 0 {
+		data = haproxy.GetTemplateData(t.Config, t.Zookeeper)
+	}
+	data.Revision = revision
+	data.LuaScripts, _ = haproxy.ReadLuaScripts(t.Config.HAProxy.Lua)
+
+	responseJSON(w, TemplateDataExport{Data: data, Functions: template.FunctionNames()})
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/usage"
+)
+
+type UsageAPI struct {
+	Config   *conf.Configuration
+	Recorder *usage.Recorder
+}
+
+/*
+	Responds with the usage of every backend over the last hours, 24
+	unless given with ?hours=, broken down per hour with ?hourly=true
+*/
+func (u *UsageAPI) Get(w http.ResponseWriter, r *http.Request) {
+	if u.Recorder == nil {
+		responseDisabled(w, "Backend usage is not recorded, enable HAProxy.Usage")
+		return
+	}
+
+	hours := 24
+	if value := r.URL.Query().Get("hours"); len(value) > 0 {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			responseError(w, "hours must be a positive number")
+			return
+		}
+		hours = parsed
+	}
+	hourly := r.URL.Query().Get("hourly") == "true"
+
+	// the current hour counts as one of the hours
+	since := time.Now().Add(-time.Duration(hours-1) * time.Hour)
+	responseJSON(w, u.Recorder.Summary(since, hourly))
+}
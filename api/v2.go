@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Marks responses written in the v2 format
+type v2ResponseWriter struct {
+	http.ResponseWriter
+}
+
+/*
+	Serves /api/v2/* and /api/v1/* from the /api/* routes, writing JSON
+	in the v2 format for /api/v2/*. Unversioned paths use the version
+	configured by Bamboo.APIVersion.
+*/
+func APIVersion(config *conf.Configuration) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// already negotiated by the admin listener falling back to
+			// the public endpoints
+			if isV2(w) {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			version := config.Bamboo.APIVersion
+			for _, prefix := range []string{"/api/v1/", "/api/v2/"} {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					version = int(prefix[len("/api/v")] - '0')
+					r.URL.Path = "/api/" + strings.TrimPrefix(r.URL.Path, prefix)
+				}
+			}
+
+			if version == 2 && strings.HasPrefix(r.URL.Path, "/api/") {
+				w = &v2ResponseWriter{w}
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+func isV2(w http.ResponseWriter) bool {
+	_, ok := w.(*v2ResponseWriter)
+	return ok
+}
+
+/*
+	Converts data to the v2 format: camelCase field names, RFC 3339
+	timestamps in UTC and no empty collections in records. Map keys
+	are data and kept as they are.
+*/
+func toV2(v reflect.Value) interface{} {
+	v = indirect(v)
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).UTC().Format(time.RFC3339)
+	}
+	if marshaler, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, _ := marshaler.MarshalText()
+		return string(text)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		record := map[string]interface{}{}
+		for _, field := range exportedFields(v.Type()) {
+			value := v.FieldByIndex(field.index)
+			if isEmptyCollection(indirect(value)) || (field.omitEmpty && isEmptyValue(value)) {
+				continue
+			}
+			record[camelCase(field.name)] = toV2(value)
+		}
+		return record
+	case reflect.Map:
+		entries := map[string]interface{}{}
+		for _, entry := range yamlEntries(v) {
+			entries[entry.key] = toV2(entry.value)
+		}
+		return entries
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// byte slices stay base64 encoded
+			return v.Interface()
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = toV2(v.Index(i))
+		}
+		return items
+	}
+	return v.Interface()
+}
+
+/*
+	Lower cases the leading word of a field name, keeping acronyms
+	together: Id => id, AppId => appId, HAProxy => haProxy, TTL => ttl
+*/
+func camelCase(name string) string {
+	runes := []rune(name)
+	upper := 0
+	for upper < len(runes) && unicode.IsUpper(runes[upper]) {
+		upper++
+	}
+	if upper > 1 && upper < len(runes) && unicode.IsLower(runes[upper]) {
+		// the last capital starts the next word
+		upper--
+	}
+	for i := 0; i < upper; i++ {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+type v2Record struct {
+	AppId     string
+	HAProxy   string
+	TTL       int
+	Tags      []string
+	Labels    map[string]string
+	Note      string `json:",omitempty"`
+	Timestamp time.Time
+}
+
+func TestV2(t *testing.T) {
+	Convey("#camelCase", t, func() {
+		So(camelCase("Id"), ShouldEqual, "id")
+		So(camelCase("AppId"), ShouldEqual, "appId")
+		So(camelCase("HAProxy"), ShouldEqual, "haProxy")
+		So(camelCase("TTL"), ShouldEqual, "ttl")
+		So(camelCase("id"), ShouldEqual, "id")
+	})
+
+	Convey("#toV2", t, func() {
+		Convey("should rename fields, format timestamps and omit empty collections", func() {
+			record := v2Record{
+				AppId:     "/app",
+				HAProxy:   "1.8",
+				Tags:      []string{},
+				Labels:    map[string]string{"Team": "web"},
+				Timestamp: time.Date(2016, 5, 24, 12, 0, 0, 0, time.FixedZone("CEST", 7200)),
+			}
+			content, _ := json.Marshal(toV2(reflect.ValueOf(record)))
+			So(string(content), ShouldEqual,
+				`{"appId":"/app","haProxy":"1.8","labels":{"Team":"web"},"timestamp":"2016-05-24T10:00:00Z","ttl":0}`)
+		})
+	})
+
+	Convey("#APIVersion", t, func() {
+		config := &conf.Configuration{}
+		config.Bamboo.APIVersion = 1
+		var served *http.Request
+		var v2, nested bool
+		handler := APIVersion(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			served, v2 = r, isV2(w)
+			if writer, ok := w.(*v2ResponseWriter); ok {
+				nested = isV2(writer.ResponseWriter)
+			}
+		}))
+
+		Convey("should serve versioned paths from the unversioned routes", func() {
+			r, _ := http.NewRequest("GET", "/api/v2/services", nil)
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+			So(served.URL.Path, ShouldEqual, "/api/services")
+			So(v2, ShouldBeTrue)
+		})
+
+		Convey("should use the configured version for unversioned paths", func() {
+			config.Bamboo.APIVersion = 2
+			r, _ := http.NewRequest("GET", "/api/services", nil)
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+			So(v2, ShouldBeTrue)
+
+			r, _ = http.NewRequest("GET", "/api/v1/services", nil)
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+			So(v2, ShouldBeFalse)
+		})
+
+		Convey("should convert once when a listener falls back to another", func() {
+			config.Bamboo.APIVersion = 2
+			r, _ := http.NewRequest("GET", "/api/services", nil)
+			APIVersion(config)(handler).ServeHTTP(httptest.NewRecorder(), r)
+			So(v2, ShouldBeTrue)
+			So(nested, ShouldBeFalse)
+		})
+	})
+}
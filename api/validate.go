@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/haproxy"
+	"github.com/QubitProducts/bamboo/services/marathon"
+	"github.com/QubitProducts/bamboo/services/ownership"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+// Checks a service of a batch can fail
+const (
+	CheckSyntax   = "syntax"
+	CheckConflict = "conflict"
+	CheckDomain   = "domain"
+	CheckQuota    = "quota"
+)
+
+type ValidationError struct {
+	Check   string
+	Message string
+	Details interface{} `json:",omitempty"`
+}
+
+// Validation of a service of a batch, by its position in the batch
+type ServiceValidation struct {
+	Index  int
+	Id     string
+	Valid  bool
+	Errors []ValidationError
+}
+
+type BatchValidation struct {
+	Valid    bool
+	Services []ServiceValidation
+}
+
+/*
+	Validates a full set of services, e.g. of a GitOps repository, as
+	it would be stored, without storing anything. Responds 200 with the
+	result of every service unless the body is not a JSON array.
+*/
+func (d *ServiceAPI) Validate(w http.ResponseWriter, r *http.Request) {
+	payload, _ := ioutil.ReadAll(r.Body)
+	entries := []json.RawMessage{}
+	if err := json.Unmarshal(payload, &entries); err != nil {
+		responseError(w, "Unable to decode JSON request, expected an array of services")
+		return
+	}
+
+	team := r.Header.Get(d.Config.Bamboo.DomainOwnership.TeamHeader)
+	validation := validateServices(entries, d.Config.HAProxy.StickTables, func(serviceModel service.Service) error {
+		return checkDomainOwnership(d.Config.Bamboo.DomainOwnership, team, serviceModel)
+	})
+	responseJSON(w, validation)
+}
+
+/*
+	Validates every service on its own, then its ACL against the other
+	services of the set, the ownership of its domains and the memory
+	budget of the stick tables of the set
+*/
+func validateServices(entries []json.RawMessage, stickTables conf.StickTables, checkDomains func(service.Service) error) BatchValidation {
+	validations := make([]ServiceValidation, len(entries))
+	services := map[string]service.Service{}
+	for i, entry := range entries {
+		validations[i] = ServiceValidation{Index: i, Errors: []ValidationError{}}
+		serviceModel, err := decodeServiceModel(entry)
+		validations[i].Id = serviceModel.Id
+		if err != nil {
+			validations[i].fail(CheckSyntax, err.Error(), nil)
+			continue
+		}
+		if _, exists := services[serviceModel.Id]; exists {
+			validations[i].fail(CheckConflict, "Service "+serviceModel.Id+" is defined more than once", nil)
+			continue
+		}
+		services[serviceModel.Id] = serviceModel
+	}
+
+	usage := haproxy.EstimateStickTables(stickTablesOf(services, stickTables), stickTables.MemoryBudget)
+	for i := range validations {
+		serviceModel, ok := services[validations[i].Id]
+		if !ok || len(validations[i].Errors) > 0 {
+			continue
+		}
+		if conflicts := service.ConflictsWith(serviceModel, services); len(conflicts) > 0 {
+			validations[i].fail(CheckConflict, "ACL overlaps other services of the set", conflicts)
+		}
+		if err := checkDomains(serviceModel); err != nil {
+			validations[i].fail(CheckDomain, err.Error(), nil)
+		}
+		if usage.OverBudget && (serviceModel.RateLimit != nil || serviceModel.Sticky != nil) {
+			message := fmt.Sprintf("Stick tables of the set need an estimated %d MB, over the budget of %d MB", usage.TotalBytes>>20, stickTables.MemoryBudget)
+			validations[i].fail(CheckQuota, message, nil)
+		}
+	}
+
+	batch := BatchValidation{Valid: true, Services: validations}
+	for i := range validations {
+		validations[i].Valid = len(validations[i].Errors) == 0
+		batch.Valid = batch.Valid && validations[i].Valid
+	}
+	return batch
+}
+
+func (v *ServiceValidation) fail(check string, message string, details interface{}) {
+	v.Errors = append(v.Errors, ValidationError{Check: check, Message: message, Details: details})
+}
+
+// Stick tables of the services, as if each of them had an app
+func stickTablesOf(services map[string]service.Service, defaults conf.StickTables) []haproxy.StickTable {
+	data := haproxy.TemplateData{Services: services, StickTableDefaults: defaults}
+	for id := range services {
+		data.Apps = append(data.Apps, marathon.App{Id: id})
+	}
+	return data.StickTables()
+}
+
+/*
+	Returns why the team may not route the domains of the service ACL,
+	nil when Bamboo.DomainOwnership is disabled
+*/
+func checkDomainOwnership(config conf.DomainOwnership, team string, serviceModel service.Service) error {
+	if !config.Enabled() {
+		return nil
+	}
+	domains, ok := service.Domains(serviceModel.Acl)
+	if !ok {
+		return errors.New("Domain ownership can only be checked for ACLs made of a single rule on exact hostnames, domains or paths")
+	}
+	if len(domains) == 0 {
+		return nil
+	}
+	if len(team) == 0 {
+		return errors.New("The " + config.TeamHeader + " header must name the team owning " + strings.Join(domains, ", "))
+	}
+	return ownership.Check(config, team, serviceModel.Id, domains)
+}
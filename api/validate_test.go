@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+func batch(body string) []json.RawMessage {
+	entries := []json.RawMessage{}
+	json.Unmarshal([]byte(body), &entries)
+	return entries
+}
+
+func ownedDomains(serviceModel service.Service) error {
+	return nil
+}
+
+func TestValidateServices(t *testing.T) {
+	Convey("#validateServices", t, func() {
+		stickTables := conf.StickTables{DefaultSize: 100000}
+
+		Convey("should accept a valid set", func() {
+			validation := validateServices(batch(`[
+				{"id": "/app-1", "acl": "hdr(host) -i app-1.example.com"},
+				{"id": "/app-2", "acl": "hdr(host) -i app-2.example.com"}
+			]`), stickTables, ownedDomains)
+			So(validation.Valid, ShouldBeTrue)
+			So(validation.Services[1].Id, ShouldEqual, "/app-2")
+			So(validation.Services[1].Errors, ShouldBeEmpty)
+		})
+
+		Convey("should report invalid services", func() {
+			validation := validateServices(batch(`[{"id": "/app-1", "ttl": -1}, "app-2"]`), stickTables, ownedDomains)
+			So(validation.Valid, ShouldBeFalse)
+			So(validation.Services[0].Errors[0].Check, ShouldEqual, CheckSyntax)
+			So(validation.Services[1].Errors[0].Check, ShouldEqual, CheckSyntax)
+		})
+
+		Convey("should report conflicts within the set", func() {
+			validation := validateServices(batch(`[
+				{"id": "/app-1", "acl": "hdr(host) -i app.example.com"},
+				{"id": "/app-2", "acl": "hdr(host) -i app.example.com"},
+				{"id": "/app-1", "acl": "path_beg /app-1"}
+			]`), stickTables, ownedDomains)
+			So(validation.Services[0].Errors[0].Check, ShouldEqual, CheckConflict)
+			So(validation.Services[1].Errors[0].Check, ShouldEqual, CheckConflict)
+			So(validation.Services[2].Errors[0].Message, ShouldEqual, "Service /app-1 is defined more than once")
+		})
+
+		Convey("should report domains not owned", func() {
+			validation := validateServices(batch(`[{"id": "/app-1", "acl": "hdr(host) -i app-1.example.com"}]`), stickTables, func(service.Service) error {
+				return errors.New("example.com is owned by another team")
+			})
+			So(validation.Services[0].Errors[0].Check, ShouldEqual, CheckDomain)
+		})
+
+		Convey("should report stick tables over the memory budget", func() {
+			stickTables.MemoryBudget = 1
+			validation := validateServices(batch(`[
+				{"id": "/app-1", "acl": "path_beg /app-1", "rateLimit": {"requests": 100, "tableSize": 1000000}},
+				{"id": "/app-2", "acl": "path_beg /app-2"}
+			]`), stickTables, ownedDomains)
+			So(validation.Services[0].Errors[0].Check, ShouldEqual, CheckQuota)
+			So(validation.Services[1].Valid, ShouldBeTrue)
+		})
+	})
+}
+
+func TestCheckDomainOwnership(t *testing.T) {
+	Convey("#checkDomainOwnership", t, func() {
+		config := conf.DomainOwnership{Method: "webhook", TeamHeader: "X-Bamboo-Team"}
+
+		Convey("should reject ACLs matching hosts by other criteria", func() {
+			for _, acl := range []string{"hdr(host,1) victim.com", "ssl_fc_sni victim.com", "base_beg victim.com/"} {
+				err := checkDomainOwnership(config, "attackers", service.Service{Id: "/app", Acl: acl})
+				So(err, ShouldNotBeNil)
+			}
+		})
+
+		Convey("should not check path rules", func() {
+			So(checkDomainOwnership(config, "", service.Service{Id: "/app", Acl: "path_beg /app"}), ShouldBeNil)
+		})
+	})
+}
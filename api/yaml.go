@@ -0,0 +1,243 @@
+package api
+
+import (
+	"bytes"
+	"encoding"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+	Minimal block style YAML encoder for API responses. Field names and
+	omitempty follow the json struct tags, so YAML and JSON responses
+	share the same shape.
+*/
+func marshalYAML(data interface{}) []byte {
+	buffer := new(bytes.Buffer)
+	v := indirect(reflect.ValueOf(data))
+
+	switch {
+	case isYAMLScalar(v) || isEmptyCollection(v):
+		buffer.WriteString(yamlScalar(v) + "\n")
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		writeYAMLSequence(buffer, v, 0)
+	default:
+		writeYAMLMapping(buffer, v, 0)
+	}
+	return buffer.Bytes()
+}
+
+var plainYAMLString = regexp.MustCompile(`^[A-Za-z_/][A-Za-z0-9_./ -]*$`)
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		if v.Type().Implements(textMarshalerType) {
+			return v
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func isYAMLScalar(v reflect.Value) bool {
+	if !v.IsValid() || v.Type().Implements(textMarshalerType) {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Map, reflect.Struct, reflect.Slice, reflect.Array:
+		return false
+	}
+	return true
+}
+
+func isEmptyCollection(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array:
+		return v.Len() == 0
+	}
+	return false
+}
+
+func yamlScalar(v reflect.Value) string {
+	if !v.IsValid() {
+		return "null"
+	}
+	if marshaler, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, err := marshaler.MarshalText()
+		if err != nil {
+			return "null"
+		}
+		return yamlString(string(text))
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		return "{}"
+	case reflect.Slice, reflect.Array:
+		return "[]"
+	case reflect.String:
+		return yamlString(v.String())
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	}
+	return yamlString(fmt.Sprint(v.Interface()))
+}
+
+func yamlString(s string) string {
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "null", "~":
+		return strconv.Quote(s)
+	}
+	if plainYAMLString.MatchString(s) && !strings.HasSuffix(s, " ") {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+type yamlEntry struct {
+	key   string
+	value reflect.Value
+}
+
+func yamlEntries(v reflect.Value) []yamlEntry {
+	entries := []yamlEntry{}
+	if !v.IsValid() {
+		return entries
+	}
+
+	if v.Kind() == reflect.Map {
+		for _, key := range v.MapKeys() {
+			entries = append(entries, yamlEntry{fmt.Sprint(key.Interface()), v.MapIndex(key)})
+		}
+		sort.Sort(yamlEntriesByKey(entries))
+		return entries
+	}
+
+	for _, field := range exportedFields(v.Type()) {
+		value := v.FieldByIndex(field.index)
+		if field.omitEmpty && isEmptyValue(value) {
+			continue
+		}
+		entries = append(entries, yamlEntry{field.name, value})
+	}
+	return entries
+}
+
+type yamlEntriesByKey []yamlEntry
+
+func (e yamlEntriesByKey) Len() int           { return len(e) }
+func (e yamlEntriesByKey) Less(i, j int) bool { return e[i].key < e[j].key }
+func (e yamlEntriesByKey) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+
+func writeYAMLMapping(buffer *bytes.Buffer, v reflect.Value, indent int) {
+	for _, entry := range yamlEntries(v) {
+		value := indirect(entry.value)
+		buffer.WriteString(strings.Repeat(" ", indent) + yamlString(entry.key) + ":")
+
+		switch {
+		case isYAMLScalar(value) || isEmptyCollection(value):
+			buffer.WriteString(" " + yamlScalar(value) + "\n")
+		case value.Kind() == reflect.Slice || value.Kind() == reflect.Array:
+			buffer.WriteString("\n")
+			writeYAMLSequence(buffer, value, indent+2)
+		default:
+			buffer.WriteString("\n")
+			writeYAMLMapping(buffer, value, indent+2)
+		}
+	}
+}
+
+func writeYAMLSequence(buffer *bytes.Buffer, v reflect.Value, indent int) {
+	for i := 0; i < v.Len(); i++ {
+		value := indirect(v.Index(i))
+		buffer.WriteString(strings.Repeat(" ", indent) + "-")
+
+		switch {
+		case isYAMLScalar(value) || isEmptyCollection(value):
+			buffer.WriteString(" " + yamlScalar(value) + "\n")
+		case value.Kind() == reflect.Slice || value.Kind() == reflect.Array:
+			buffer.WriteString("\n")
+			writeYAMLSequence(buffer, value, indent+2)
+		default:
+			// first mapping entry continues on the dash line
+			item := new(bytes.Buffer)
+			writeYAMLMapping(item, value, indent+2)
+			buffer.WriteString(" " + strings.TrimPrefix(item.String(), strings.Repeat(" ", indent+2)))
+		}
+	}
+}
+
+type structField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// Exported struct fields named after their json tags, fields of
+// embedded structs are promoted like encoding/json does
+func exportedFields(t reflect.Type) []structField {
+	fields := []structField{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && len(field.Tag.Get("json")) == 0 {
+			for _, promoted := range exportedFields(field.Type) {
+				promoted.index = append([]int{i}, promoted.index...)
+				fields = append(fields, promoted)
+			}
+			continue
+		}
+		if len(field.PkgPath) > 0 {
+			continue
+		}
+
+		name := field.Name
+		omitEmpty := false
+		if tag := field.Tag.Get("json"); len(tag) > 0 {
+			if tag == "-" {
+				continue
+			}
+			parts := strings.Split(tag, ",")
+			if len(parts[0]) > 0 {
+				name = parts[0]
+			}
+			for _, option := range parts[1:] {
+				omitEmpty = omitEmpty || option == "omitempty"
+			}
+		}
+		fields = append(fields, structField{name, field.Index, omitEmpty})
+	}
+	return fields
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
@@ -1,12 +1,45 @@
 package configuration
 
+import (
+	"time"
+)
+
 type Bamboo struct {
 	// Service host
 	Endpoint string
 	
 	// Service socket binding
 	Bind	 string
+	// Optional separate binding of the mutating and admin endpoints,
+	// e.g. 127.0.0.1:8001. Bind then only serves read-only endpoints.
+	AdminBind string
+	// Token of the admin endpoints
+	Admin Admin
+
+	// Timeouts and connection limit of the HTTP server
+	Server Server
 
 	// Routing configuration storage
 	Zookeeper Zookeeper
+
+	// Domain ownership check of service ACLs
+	DomainOwnership DomainOwnership
+
+	// Policy evaluation of service mutations
+	Policy Policy
+
+	// Routes of preview environments
+	Previews Previews
+
+	// Seconds deleted services can be restored before they are purged,
+	// defaults to a day
+	DeletedServiceRetention int64
+
+	// Format of unversioned /api responses: 1 (default) or 2 for
+	// camelCase fields, RFC 3339 timestamps and no empty collections
+	APIVersion int
+}
+
+func (b Bamboo) DeletedServiceRetentionDuration() time.Duration {
+	return time.Duration(b.DeletedServiceRetention) * time.Second
 }
@@ -0,0 +1,24 @@
+package configuration
+
+import (
+	"time"
+)
+
+/*
+	Adaptive load balancing, server weights are lowered for tasks
+	responding slower or failing more often than the other tasks of
+	their backend. Requires HAProxy.RuntimeSocket.
+*/
+type AdaptiveWeights struct {
+	Enabled bool
+
+	// Seconds between weight adjustments, defaults to 10
+	Interval int64
+
+	// Lowest weight in percent of the configured weight, defaults to 10
+	MinWeight int
+}
+
+func (a AdaptiveWeights) IntervalDuration() time.Duration {
+	return time.Duration(a.Interval) * time.Second
+}
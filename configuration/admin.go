@@ -0,0 +1,8 @@
+package configuration
+
+// Access to the admin endpoints, e.g. /api/admin/config
+type Admin struct {
+	// Required in the X-Bamboo-Admin-Token header, the admin endpoints
+	// are refused when empty
+	Token string
+}
@@ -0,0 +1,56 @@
+package configuration
+
+import (
+	"time"
+)
+
+/*
+	Periodic upload of state snapshots and rendered configurations to
+	S3 or Google Cloud Storage, both through the S3 compatible API
+*/
+type Archive struct {
+	Enabled bool
+
+	// s3 or gcs, selects the default endpoint
+	Provider string
+	// Storage endpoint, e.g. https://s3.eu-west-1.amazonaws.com
+	Endpoint string
+	Region   string
+	Bucket   string
+	// Key prefix of the snapshots
+	Prefix string
+
+	// Access keys, GCS requires HMAC keys of a service account
+	AccessKey string
+	SecretKey string
+
+	// Seconds between two snapshots, unchanged states are not uploaded
+	Interval int64
+	// Days snapshots are kept, 0 keeps them forever
+	RetentionDays int
+}
+
+func (a Archive) IntervalDuration() time.Duration {
+	return time.Duration(a.Interval) * time.Second
+}
+
+func (a Archive) Retention() time.Duration {
+	return time.Duration(a.RetentionDays) * 24 * time.Hour
+}
+
+func (a Archive) EndpointURL() string {
+	if len(a.Endpoint) > 0 {
+		return a.Endpoint
+	}
+	if a.Provider == "gcs" {
+		return "https://storage.googleapis.com"
+	}
+	return "https://s3." + a.Region + ".amazonaws.com"
+}
+
+func (a Archive) SigningRegion() string {
+	if a.Provider == "gcs" {
+		return "auto"
+	}
+	return a.Region
+}
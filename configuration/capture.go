@@ -0,0 +1,16 @@
+package configuration
+
+/*
+	Recording of the raw Marathon and Zookeeper responses of every state
+	fetch, replayed with `bamboo replay` to reproduce renders offline
+*/
+type Capture struct {
+	// Directory the responses are recorded to, empty to not record
+	Directory string
+	// Renders recorded before recording stops, defaults to 1000
+	MaxRenders int
+}
+
+func (c Capture) Enabled() bool {
+	return len(c.Directory) > 0
+}
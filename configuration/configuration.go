@@ -17,6 +17,9 @@ type Configuration struct {
 	// Marathon configuration
 	Marathon Marathon
 
+	// Mesos master configuration
+	Mesos Mesos
+
 	// Bamboo specific configuration
 	Bamboo Bamboo
 
@@ -25,6 +28,30 @@ type Configuration struct {
 
 	// StatsD configuration
 	StatsD StatsD
+
+	// Log rate limiting configuration
+	Logging Logging
+
+	// Snapshot archive configuration
+	Archive Archive
+
+	// External DNS configuration
+	DNS DNS
+
+	// Consul registration configuration
+	Consul Consul
+
+	// Fault injection for resilience testing
+	FaultInjection FaultInjection
+
+	// Recording of state fetches for replay
+	Capture Capture
+
+	// Notifications to service owners
+	Notifications Notifications
+
+	// Feature flags by name, see KnownFeatures
+	Features map[string]bool
 }
 
 /*
@@ -42,28 +69,161 @@ func (config *Configuration) FromFile(filePath string) error {
 }
 
 func FromFile(filePath string) (Configuration, error) {
+	return FromFiles(filePath)
+}
+
+/*
+	Returns the configuration of a base file merged with overlay files,
+	with environment overrides and defaults applied to the result.
+	Unknown fields are rejected, Validate checks the values.
+*/
+func FromFiles(filePath string, overlayPaths ...string) (Configuration, error) {
 	conf := &Configuration{}
-	err := conf.FromFile(filePath)
+	err := conf.FromFiles(filePath, overlayPaths...)
 	setValueFromEnv(&conf.Marathon.Endpoint, "MARATHON_ENDPOINT")
+	setBoolValueFromEnv(&conf.Marathon.DeploymentBatching, "MARATHON_DEPLOYMENT_BATCHING")
+	setDefaultInt64Value(&conf.Marathon.DeploymentMaxWait, 300)
+	setBoolValueFromEnv(&conf.Marathon.DeploymentGating, "MARATHON_DEPLOYMENT_GATING")
+	setBoolValueFromEnv(&conf.Marathon.RestartBatching, "MARATHON_RESTART_BATCHING")
+	setDefaultInt64Value(&conf.Marathon.SubscriptionCheckInterval, 60)
+	setValueFromEnv(&conf.Mesos.Endpoint, "MESOS_ENDPOINT")
+	setBoolValueFromEnv(&conf.Mesos.DrainMaintenance, "MESOS_DRAIN_MAINTENANCE")
 
 	setValueFromEnv(&conf.Bamboo.Endpoint, "BAMBOO_ENDPOINT")
 	setValueFromEnv(&conf.Bamboo.Bind, "BAMBOO_BIND")
 	setDefaultValue(&conf.Bamboo.Bind, ":8000")
+	setValueFromEnv(&conf.Bamboo.AdminBind, "BAMBOO_ADMIN_BIND")
+	setSecretValueFromEnv(&conf.Bamboo.Admin.Token, "BAMBOO_ADMIN_TOKEN")
+	setDefaultInt64Value(&conf.Bamboo.Server.ReadTimeout, 60)
+	setDefaultInt64Value(&conf.Bamboo.Server.IdleTimeout, 120)
+	setDefaultIntValue(&conf.Bamboo.APIVersion, 1)
+	setValueFromEnv(&conf.Bamboo.DomainOwnership.Method, "BAMBOO_DOMAIN_OWNERSHIP")
+	setValueFromEnv(&conf.Bamboo.DomainOwnership.WebhookUrl, "BAMBOO_DOMAIN_OWNERSHIP_WEBHOOK")
+	setDefaultValue(&conf.Bamboo.DomainOwnership.TeamHeader, "X-Bamboo-Team")
+	setDefaultValue(&conf.Bamboo.DomainOwnership.TxtPrefix, "_bamboo")
+	setDefaultInt64Value(&conf.Bamboo.DomainOwnership.Timeout, 5)
+	setValueFromEnv(&conf.Bamboo.Policy.Url, "BAMBOO_POLICY_URL")
+	setDefaultInt64Value(&conf.Bamboo.Policy.Timeout, 5)
+	setValueFromEnv(&conf.Bamboo.Policy.Directory, "BAMBOO_POLICY_DIRECTORY")
+	setValueFromEnv(&conf.Bamboo.Policy.BundleUrl, "BAMBOO_POLICY_BUNDLE_URL")
+	setDefaultInt64Value(&conf.Bamboo.Policy.LoadInterval, 60)
+	setValueFromEnv(&conf.Bamboo.Previews.Domain, "BAMBOO_PREVIEW_DOMAIN")
+	setDefaultInt64Value(&conf.Bamboo.Previews.DefaultTTL, 7*24*3600)
+	setDefaultInt64Value(&conf.Bamboo.Previews.AppGracePeriod, 600)
+	setDefaultInt64Value(&conf.Bamboo.DeletedServiceRetention, 24*3600)
 	setValueFromEnv(&conf.Bamboo.Zookeeper.Host, "BAMBOO_ZK_HOST")
 	setValueFromEnv(&conf.Bamboo.Zookeeper.Path, "BAMBOO_ZK_PATH")
 
 	setValueFromEnv(&conf.HAProxy.TemplatePath, "HAPROXY_TEMPLATE_PATH")
 	setValueFromEnv(&conf.HAProxy.OutputPath, "HAPROXY_OUTPUT_PATH")
 	setValueFromEnv(&conf.HAProxy.ReloadCommand, "HAPROXY_RELOAD_CMD")
+	setValueFromEnv(&conf.HAProxy.Reload.Strategy, "HAPROXY_RELOAD_STRATEGY")
+	setDefaultValue(&conf.HAProxy.Reload.Strategy, "exec")
+	setValueFromEnv(&conf.HAProxy.Reload.PidFile, "HAPROXY_PID_FILE")
+	setDefaultValue(&conf.HAProxy.Reload.Signal, "USR2")
+	setValueFromEnv(&conf.HAProxy.Reload.Url, "HAPROXY_RELOAD_URL")
+	setDefaultValue(&conf.HAProxy.Reload.Method, "POST")
+	setDefaultIntValue(&conf.HAProxy.Reload.Timeout, 30)
+	setDefaultIntValue(&conf.HAProxy.Reload.Supervisor.MinBackoff, 1)
+	setDefaultIntValue(&conf.HAProxy.Reload.Supervisor.MaxBackoff, 60)
+	setDefaultIntValue(&conf.HAProxy.Reload.Supervisor.StopTimeout, 30)
+	setSecretValueFromEnv(&conf.HAProxy.Remote.Token, "HAPROXY_REMOTE_TOKEN")
+	setDefaultIntValue(&conf.HAProxy.Remote.Timeout, 60)
+	setValueFromEnv(&conf.HAProxy.BinaryPath, "HAPROXY_BIN")
+	setBoolValueFromEnv(&conf.HAProxy.NoReload, "HAPROXY_NO_RELOAD")
+	setValueFromEnv(&conf.HAProxy.RuntimeSocket, "HAPROXY_RUNTIME_SOCKET")
+	setDefaultValue(&conf.HAProxy.ShadowOutputPath, conf.HAProxy.OutputPath+".shadow")
+	setDefaultValue(&conf.HAProxy.BinaryPath, "haproxy")
+	setDefaultInt64Value(&conf.HAProxy.RenderTimeout, 30)
+	setDefaultIntValue(&conf.HAProxy.MaxConfigSize, 50<<20)
+	setBoolValueFromEnv(&conf.HAProxy.StartOnTemplateError, "HAPROXY_START_ON_TEMPLATE_ERROR")
+	setDefaultValue(&conf.HAProxy.Naming.Backend, DefaultBackendName)
+	setDefaultValue(&conf.HAProxy.Naming.Frontend, DefaultFrontendName)
+	setDefaultValue(&conf.HAProxy.Naming.Acl, DefaultAclName)
+	setDefaultValue(&conf.HAProxy.Resolvers.Name, "bamboo")
+	setDefaultValue(&conf.HAProxy.Resolvers.Domain, "marathon.mesos")
+	setDefaultValue(&conf.HAProxy.Resolvers.HoldValid, "10s")
+	setDefaultIntValue(&conf.HAProxy.Resolvers.ServerSlots, 10)
+	setDefaultIntValue(&conf.HAProxy.Resolvers.ResolveRetries, 3)
+	setBoolValueFromEnv(&conf.HAProxy.RouteHeader.Enabled, "HAPROXY_ROUTE_HEADER")
+	setDefaultValue(&conf.HAProxy.RouteHeader.Name, "X-Bamboo-Route")
+	setDefaultValue(&conf.HAProxy.Mirror.SpoeConfigPath, "/etc/haproxy/mirror.spoe.cfg")
+	setDefaultIntValue(&conf.HAProxy.StickTables.DefaultSize, 100000)
+	setDefaultValue(&conf.HAProxy.Spoe.ConfigPath, "/etc/haproxy/agents.spoe.cfg")
+	setDefaultValue(&conf.HAProxy.Jwt.KeyDirectory, "/etc/haproxy/jwt")
+	setDefaultInt64Value(&conf.HAProxy.Jwt.KeySetTTL, 300)
+	setDefaultValue(&conf.HAProxy.Lua.Directory, "/etc/haproxy/lua")
+	setBoolValueFromEnv(&conf.HAProxy.AdaptiveWeights.Enabled, "HAPROXY_ADAPTIVE_WEIGHTS")
+	setDefaultInt64Value(&conf.HAProxy.AdaptiveWeights.Interval, 10)
+	setDefaultIntValue(&conf.HAProxy.AdaptiveWeights.MinWeight, 10)
+	setBoolValueFromEnv(&conf.HAProxy.Usage.Enabled, "HAPROXY_USAGE")
+	setValueFromEnv(&conf.HAProxy.Usage.Path, "HAPROXY_USAGE_PATH")
+	setDefaultInt64Value(&conf.HAProxy.Usage.Interval, 60)
+	setDefaultIntValue(&conf.HAProxy.Usage.RetentionHours, 168)
+	setBoolValueFromEnv(&conf.HAProxy.History.Enabled, "HAPROXY_HISTORY")
+	setValueFromEnv(&conf.HAProxy.History.Path, "HAPROXY_HISTORY_PATH")
+	setDefaultIntValue(&conf.HAProxy.History.RetentionHours, 168)
+	setBoolValueFromEnv(&conf.HAProxy.SmokeCheck.Enabled, "HAPROXY_SMOKE_CHECK")
+	setValueFromEnv(&conf.HAProxy.SmokeCheck.Address, "HAPROXY_SMOKE_CHECK_ADDRESS")
+	setDefaultInt64Value(&conf.HAProxy.SmokeCheck.Delay, 2)
+	setDefaultInt64Value(&conf.HAProxy.SmokeCheck.Timeout, 5)
+	setDefaultIntValue(&conf.HAProxy.Lint.MaxAcls, 10000)
+	setDefaultIntValue(&conf.HAProxy.Lint.MaxFrontends, 1000)
+	setDefaultIntValue(&conf.HAProxy.Lint.MaxServersPerBackend, 1000)
+	setValueFromEnv(&conf.HAProxy.ValidationHook.Url, "HAPROXY_VALIDATION_HOOK_URL")
+	setDefaultIntValue(&conf.HAProxy.ValidationHook.Timeout, 10)
 	setValueFromEnv(&conf.StatsD.Host, "STATSD_HOST")
 	setValueFromEnv(&conf.StatsD.Prefix, "STATSD_PREFIX")
 	setBoolValueFromEnv(&conf.StatsD.Enabled, "STATSD_ENABLED")
+	setBoolValueFromEnv(&conf.StatsD.AppMetrics.Enabled, "STATSD_APP_METRICS")
+	setDefaultIntValue(&conf.StatsD.AppMetrics.MaxApps, 100)
+	setBoolValueFromEnv(&conf.Logging.RateLimit, "BAMBOO_LOG_RATE_LIMIT")
+	setDefaultInt64Value(&conf.Logging.Interval, 60)
+	setDefaultIntValue(&conf.Logging.Burst, 10)
+	setValueFromEnv(&conf.Capture.Directory, "CAPTURE_DIRECTORY")
+	setDefaultIntValue(&conf.Capture.MaxRenders, 1000)
+	setValueFromEnv(&conf.Notifications.SmtpHost, "NOTIFICATIONS_SMTP_HOST")
+	setValueFromEnv(&conf.Notifications.From, "NOTIFICATIONS_FROM")
+	setDefaultValue(&conf.Notifications.From, "bamboo@localhost")
+	setDefaultInt64Value(&conf.Notifications.Timeout, 5)
+	setBoolValueFromEnv(&conf.Archive.Enabled, "ARCHIVE_ENABLED")
+	setValueFromEnv(&conf.Archive.Bucket, "ARCHIVE_BUCKET")
+	setSecretValueFromEnv(&conf.Archive.AccessKey, "ARCHIVE_ACCESS_KEY")
+	setSecretValueFromEnv(&conf.Archive.SecretKey, "ARCHIVE_SECRET_KEY")
+	setDefaultValue(&conf.Archive.Provider, "s3")
+	setDefaultValue(&conf.Archive.Region, "us-east-1")
+	setDefaultValue(&conf.Archive.Prefix, "bamboo/")
+	setDefaultInt64Value(&conf.Archive.Interval, 3600)
+	setValueFromEnv(&conf.DNS.Provider, "DNS_PROVIDER")
+	setValueFromEnv(&conf.DNS.Target, "DNS_TARGET")
+	setDefaultIntValue(&conf.DNS.TTL, 60)
+	setSecretValueFromEnv(&conf.DNS.Route53.AccessKey, "DNS_ROUTE53_ACCESS_KEY")
+	setSecretValueFromEnv(&conf.DNS.Route53.SecretKey, "DNS_ROUTE53_SECRET_KEY")
+	setDefaultValue(&conf.DNS.CoreDNS.Prefix, "/skydns")
+	setValueFromEnv(&conf.Consul.Endpoint, "CONSUL_ENDPOINT")
+	setValueFromEnv(&conf.Consul.Address, "CONSUL_ADDRESS")
+	setSecretValueFromEnv(&conf.Consul.Token, "CONSUL_TOKEN")
+	setDefaultValue(&conf.Consul.CheckInterval, "10s")
+	setBoolValueFromEnv(&conf.FaultInjection.Enabled, "BAMBOO_FAULT_INJECTION")
+	setSecretValueFromEnv(&conf.FaultInjection.Token, "BAMBOO_FAULT_INJECTION_TOKEN")
 	return *conf, err
 }
 
 func setDefaultValue(field *string, value string) {
-	if field == nil {
-		field = &value
+	if len(*field) == 0 {
+		*field = value
+	}
+}
+
+func setDefaultIntValue(field *int, value int) {
+	if *field == 0 {
+		*field = value
+	}
+}
+
+func setDefaultInt64Value(field *int64, value int64) {
+	if *field == 0 {
+		*field = value
 	}
 }
 
@@ -75,10 +235,19 @@ func setValueFromEnv(field *string, envVar string) {
 	}
 }
 
+// Like setValueFromEnv, without logging the value
+func setSecretValueFromEnv(field *string, envVar string) {
+	env := os.Getenv(envVar)
+	if len(env) > 0 {
+		log.Printf("Using environment override %s", envVar)
+		*field = env
+	}
+}
+
 func setBoolValueFromEnv(field *bool, envVar string) {
 env := os.Getenv(envVar)
 if len(env) > 0 {
-	log.Printf("Using environment override %s=%t", envVar, env)
+	log.Printf("Using environment override %s=%s", envVar, env)
 	x, err := strconv.ParseBool(env)
 	if err != nil {
 		log.Printf("Error converting boolean value: %s\n", err)
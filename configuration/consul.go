@@ -0,0 +1,22 @@
+package configuration
+
+/*
+	Registration of the frontends rendered for Marathon apps in the
+	Consul catalog
+*/
+type Consul struct {
+	// Consul agent HTTP endpoint, e.g. http://localhost:8500,
+	// leave empty to disable registration
+	Endpoint string
+	// Load balancer address registered for the services
+	Address string
+	// ACL token of the agent API
+	Token string
+	// Interval of the TCP checks through the load balancer,
+	// "none" disables them
+	CheckInterval string
+}
+
+func (c Consul) Enabled() bool {
+	return len(c.Endpoint) > 0
+}
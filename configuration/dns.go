@@ -0,0 +1,38 @@
+package configuration
+
+/*
+	Publishing of service hostnames to an external DNS, pointing them
+	at the load balancer
+*/
+type DNS struct {
+	// route53 or coredns, empty disables publishing
+	Provider string
+	// Load balancer VIP the records point to, IP addresses are published
+	// as A records and names as CNAME records
+	Target string
+	// Record TTL in seconds
+	TTL int
+
+	Route53 Route53
+	CoreDNS CoreDNS
+}
+
+func (d DNS) Enabled() bool {
+	return len(d.Provider) > 0
+}
+
+type Route53 struct {
+	HostedZoneId string
+	AccessKey    string
+	SecretKey    string
+}
+
+/*
+	CoreDNS serving records from etcd with the etcd plugin
+*/
+type CoreDNS struct {
+	// etcd v3 HTTP endpoint, e.g. http://etcd:2379
+	EtcdEndpoint string
+	// Path of the etcd plugin configuration
+	Prefix string
+}
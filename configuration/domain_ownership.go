@@ -0,0 +1,33 @@
+package configuration
+
+import (
+	"time"
+)
+
+/*
+	Check that the team writing a service owns the domains its ACL
+	routes, so that teams sharing the proxy can not take over each
+	other's hostnames
+*/
+type DomainOwnership struct {
+	// txt or webhook, empty to not check
+	Method string
+	// Request header naming the team, defaults to X-Bamboo-Team
+	TeamHeader string
+	// txt: a TXT record of <TxtPrefix>.<domain>, or of a parent domain,
+	// must be the team name; defaults to _bamboo
+	TxtPrefix string
+	// webhook: receives a POST of {"Domain", "Team", "ServiceId"} per
+	// domain and confirms ownership with a 2xx response
+	WebhookUrl string
+	// Seconds to wait for the webhook, defaults to 5
+	Timeout int64
+}
+
+func (d DomainOwnership) Enabled() bool {
+	return len(d.Method) > 0
+}
+
+func (d DomainOwnership) TimeoutDuration() time.Duration {
+	return time.Duration(d.Timeout) * time.Second
+}
@@ -0,0 +1,23 @@
+package configuration
+
+/*
+	Settings of the calls registering and checking the Marathon event
+	subscription, e.g. for a gateway in front of Marathon
+*/
+type EventSubscription struct {
+	// Headers added to the calls, e.g. {"Authorization": "Bearer ..."}
+	Headers map[string]string
+	TLS     TLS
+}
+
+// TLS settings of an HTTPS client
+type TLS struct {
+	// PEM encoded CA certificates the server is verified with, the
+	// system roots when empty
+	CaFile string
+	// PEM encoded client certificate and key for mutual TLS
+	CertFile string
+	KeyFile  string
+	// Accept any server certificate, only for testing
+	InsecureSkipVerify bool
+}
@@ -0,0 +1,12 @@
+package configuration
+
+/*
+	Admin endpoints injecting faults for resilience testing, never
+	enable them in production
+*/
+type FaultInjection struct {
+	Enabled bool
+	// Required in the X-Bamboo-Admin-Token header of the fault
+	// endpoints, defaults to Bamboo.Admin.Token
+	Token string
+}
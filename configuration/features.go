@@ -0,0 +1,39 @@
+package configuration
+
+// Names of the feature flags
+const (
+	FeatureRuntimeUpdates = "runtime-updates"
+)
+
+/*
+	Experimental behavior shipped dark and enabled per fleet with the
+	Features section of the configuration, e.g.
+	"Features": {"runtime-updates": false}
+*/
+type Feature struct {
+	Name        string
+	Description string
+	// Whether the flag is on when the configuration does not set it
+	Default bool
+	// Whether the flag can be toggled through the API without a
+	// restart, only for behaviors that are safe to switch any time
+	Runtime bool
+}
+
+var KnownFeatures = []Feature{
+	{
+		Name:        FeatureRuntimeUpdates,
+		Description: "Update relocated tasks over the HAProxy runtime socket instead of reloading",
+		Default:     true,
+		Runtime:     true,
+	},
+}
+
+func LookupFeature(name string) (Feature, bool) {
+	for _, feature := range KnownFeatures {
+		if feature.Name == name {
+			return feature, true
+		}
+	}
+	return Feature{}, false
+}
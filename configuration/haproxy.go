@@ -1,7 +1,105 @@
 package configuration
 
+import (
+	"time"
+)
+
 type HAProxy struct {
 	TemplatePath  string
 	OutputPath    string
 	ReloadCommand string
+
+	// Strategy applying the written configuration, running
+	// ReloadCommand by default
+	Reload Reload
+	// Proxy hosts managed by the remote reload strategy
+	Remote Remote
+
+	// haproxy executable used to detect the installed version,
+	// defaults to "haproxy" looked up from PATH
+	BinaryPath string
+
+	// Optional minimum supported version, e.g. "1.5" or "2.0".
+	// Bamboo refuses to start when the detected version is older.
+	MinimumVersion string
+
+	// Render and write the configuration without ever reloading HAProxy,
+	// e.g. for a shadow Bamboo running next to production
+	NoReload bool
+	// Output path used when NoReload is set, defaults to OutputPath.shadow
+	ShadowOutputPath string
+	// Bamboo endpoint of the active instance the shadow configuration is
+	// compared with, the local OutputPath is used when empty
+	ShadowCompareEndpoint string
+
+	// Admin stats socket of the running HAProxy, e.g. /run/haproxy/admin.sock.
+	// When set, tasks moving to another host or port are updated with
+	// `set server addr` instead of reloading HAProxy (1.8+)
+	RuntimeSocket string
+
+	// Abort rendering after n seconds and keep the current configuration
+	RenderTimeout int64
+	// Maximum size of the rendered configuration in bytes
+	MaxConfigSize int
+	// Start degraded instead of refusing to start when the template
+	// does not parse, leaving the running configuration alone until
+	// the template is fixed
+	StartOnTemplateError bool
+
+	// Backend, frontend and ACL naming scheme
+	Naming Naming
+
+	// DNS resolvers section and server-template generation
+	Resolvers Resolvers
+
+	// Limits the rendered configuration is checked against
+	Lint Lint
+
+	// External validation of rendered configurations
+	ValidationHook ValidationHook
+
+	// Test traffic routing by request header
+	RouteHeader RouteHeader
+
+	// Traffic mirroring to shadow backends
+	Mirror Mirror
+
+	// SPOE agents requests are sent to
+	Spoe Spoe
+
+	// Lua scripts loaded by HAProxy
+	Lua Lua
+
+	// Bearer token validation of services
+	Jwt Jwt
+
+	// Stick table sizing of rate limits and sticky sessions
+	StickTables StickTables
+
+	// Default maxconn and maxqueue of servers
+	ServerLimits ServerLimits
+
+	// Server weights adjusted from response times and error rates
+	AdaptiveWeights AdaptiveWeights
+
+	// Traffic usage report per backend
+	Usage Usage
+
+	// Backend membership changes kept for postmortems
+	History History
+
+	// Probes sent through HAProxy after reloads
+	SmokeCheck SmokeCheck
+}
+
+func (h HAProxy) RenderTimeoutDuration() time.Duration {
+	return time.Duration(h.RenderTimeout) * time.Second
+}
+
+// Path the rendered configuration is written to
+func (h HAProxy) EffectiveOutputPath() string {
+	if h.NoReload {
+		return h.ShadowOutputPath
+	}
+	return h.OutputPath
 }
@@ -0,0 +1,23 @@
+package configuration
+
+import (
+	"time"
+)
+
+/*
+	Log of tasks entering and leaving the backends of apps, and of
+	their health transitions, for postmortems
+*/
+type History struct {
+	Enabled bool
+
+	// Hours of changes kept, defaults to 168
+	RetentionHours int
+
+	// File the log is kept in across restarts, in memory only when empty
+	Path string
+}
+
+func (h History) Retention() time.Duration {
+	return time.Duration(h.RetentionHours) * time.Hour
+}
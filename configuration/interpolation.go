@@ -0,0 +1,105 @@
+package configuration
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ${NAME}, ${NAME:-default} or ${file:/path}; $$ escapes a dollar
+var placeholderPattern = regexp.MustCompile(`\$\$|\$\{([^}]*)\}`)
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+/*
+	Keys of the shell commands, which are run as written so that the
+	shell expands their variables; JSON keys match case insensitively
+*/
+var uninterpolatedKeys = map[string]bool{
+	"reloadcommand": true,
+}
+
+/*
+	Replaces the placeholders of a configuration value: ${NAME} with the
+	environment variable, ${NAME:-default} with the default when it is
+	unset or empty, and ${file:/path} with the content of the file
+	without trailing line breaks, e.g. a mounted secret
+*/
+func Interpolate(value string) (string, error) {
+	var err error
+	result := placeholderPattern.ReplaceAllStringFunc(value, func(placeholder string) string {
+		if placeholder == "$$" {
+			return "$"
+		}
+		replacement, placeholderErr := resolvePlaceholder(placeholder[2 : len(placeholder)-1])
+		if placeholderErr != nil && err == nil {
+			err = placeholderErr
+		}
+		return replacement
+	})
+	return result, err
+}
+
+func resolvePlaceholder(expression string) (string, error) {
+	if strings.HasPrefix(expression, "file:") {
+		path := strings.TrimPrefix(expression, "file:")
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	}
+
+	name, defaultValue, hasDefault := expression, "", false
+	if i := strings.Index(expression, ":-"); i >= 0 {
+		name, defaultValue, hasDefault = expression[:i], expression[i+2:], true
+	}
+	if !envNamePattern.MatchString(name) {
+		return "", errors.New("invalid placeholder ${" + expression + "}")
+	}
+	value := os.Getenv(name)
+	if len(value) == 0 {
+		if hasDefault {
+			return defaultValue, nil
+		}
+		return "", errors.New("environment variable " + name + " is not set")
+	}
+	return value, nil
+}
+
+/*
+	Interpolates the string values of a decoded JSON document, keys and
+	shell commands are left alone
+*/
+func interpolateDocument(value interface{}, path string) (interface{}, FieldErrors) {
+	errs := FieldErrors{}
+	switch typed := value.(type) {
+	case string:
+		interpolated, err := Interpolate(typed)
+		if err != nil {
+			errs = append(errs, FieldError{Path: path, Message: err.Error()})
+		}
+		return interpolated, errs
+	case map[string]interface{}:
+		for key, item := range typed {
+			if _, isString := item.(string); isString && uninterpolatedKeys[strings.ToLower(key)] {
+				continue
+			}
+			interpolated, itemErrs := interpolateDocument(item, joinPath(path, key))
+			typed[key] = interpolated
+			errs = append(errs, itemErrs...)
+		}
+	case []interface{}:
+		for i, item := range typed {
+			interpolated, itemErrs := interpolateDocument(item, path+"["+strconv.Itoa(i)+"]")
+			typed[i] = interpolated
+			errs = append(errs, itemErrs...)
+		}
+	}
+	sort.Sort(fieldErrorsByPath(errs))
+	return value, errs
+}
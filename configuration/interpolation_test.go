@@ -0,0 +1,73 @@
+package configuration
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestInterpolate(t *testing.T) {
+	Convey("#Interpolate", t, func() {
+		os.Setenv("BAMBOO_TEST_HOST", "marathon-prod")
+		defer os.Unsetenv("BAMBOO_TEST_HOST")
+
+		Convey("should replace environment variables", func() {
+			value, err := Interpolate("http://${BAMBOO_TEST_HOST}:8080")
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, "http://marathon-prod:8080")
+		})
+
+		Convey("should use defaults of unset variables", func() {
+			value, err := Interpolate("${BAMBOO_TEST_PORT:-8080}")
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, "8080")
+		})
+
+		Convey("should fail on unset variables without default", func() {
+			_, err := Interpolate("${BAMBOO_TEST_PORT}")
+			So(err.Error(), ShouldEqual, "environment variable BAMBOO_TEST_PORT is not set")
+		})
+
+		Convey("should read files without the trailing line break", func() {
+			dir, _ := ioutil.TempDir("", "bamboo-config")
+			defer os.RemoveAll(dir)
+			ioutil.WriteFile(filepath.Join(dir, "token"), []byte("s3cret\n"), 0600)
+			value, err := Interpolate("${file:" + filepath.Join(dir, "token") + "}")
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, "s3cret")
+		})
+
+		Convey("should keep escaped dollars", func() {
+			value, err := Interpolate("read PIDS; kill $$PIDS ${BAMBOO_TEST_HOST}")
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, "read PIDS; kill $PIDS marathon-prod")
+		})
+	})
+
+	Convey("#interpolateDocument", t, func() {
+		os.Setenv("BAMBOO_TEST_HOST", "marathon-prod")
+		defer os.Unsetenv("BAMBOO_TEST_HOST")
+		document := map[string]interface{}{
+			"Marathon": map[string]interface{}{"Endpoint": "http://${BAMBOO_TEST_HOST}:8080"},
+			"HAProxy": map[string]interface{}{
+				"reloadCommand": "kill -USR2 ${PID:-$(cat /run/haproxy.pid)}",
+				"Remote": map[string]interface{}{
+					"Targets": []interface{}{map[string]interface{}{"ReloadCommand": "kill -USR2 $$"}},
+				},
+			},
+		}
+
+		Convey("should leave the shell commands as written", func() {
+			_, errs := interpolateDocument(document, "")
+			So(errs, ShouldBeEmpty)
+			So(document["Marathon"].(map[string]interface{})["Endpoint"], ShouldEqual, "http://marathon-prod:8080")
+			haproxy := document["HAProxy"].(map[string]interface{})
+			So(haproxy["reloadCommand"], ShouldEqual, "kill -USR2 ${PID:-$(cat /run/haproxy.pid)}")
+			target := haproxy["Remote"].(map[string]interface{})["Targets"].([]interface{})[0]
+			So(target.(map[string]interface{})["ReloadCommand"], ShouldEqual, "kill -USR2 $$")
+		})
+	})
+}
@@ -0,0 +1,20 @@
+package configuration
+
+import "time"
+
+/*
+	Bearer token validation of services declaring a Jwt requirement.
+	Keys fetched from JSON Web Key Sets are written to KeyDirectory,
+	which must be readable by HAProxy.
+*/
+type Jwt struct {
+	// Defaults to /etc/haproxy/jwt
+	KeyDirectory string
+	// Seconds a fetched key set is used before it is refreshed in the
+	// background, defaults to 300
+	KeySetTTL int64
+}
+
+func (j Jwt) KeySetTTLDuration() time.Duration {
+	return time.Duration(j.KeySetTTL) * time.Second
+}
@@ -0,0 +1,15 @@
+package configuration
+
+/*
+	Practical limits the rendered HAProxy configuration is checked
+	against, zero values disable the corresponding check
+*/
+type Lint struct {
+	MaxAcls              int
+	MaxFrontends         int
+	MaxServersPerBackend int
+
+	// Keep the current configuration when the rendered one has lint
+	// errors, otherwise they are only logged
+	Block bool
+}
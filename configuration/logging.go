@@ -0,0 +1,16 @@
+package configuration
+
+/*
+	Rate limiting of repeated log messages, e.g. Marathon being
+	unreachable during an incident
+*/
+type Logging struct {
+	RateLimit bool
+
+	// Window in seconds in which at most Burst messages of a class are logged
+	Interval int64
+	Burst    int
+
+	// Log every SampleRate-th message above the burst, 0 suppresses them all
+	SampleRate int
+}
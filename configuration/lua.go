@@ -0,0 +1,20 @@
+package configuration
+
+/*
+	Lua scripts shipped with the rendered configuration. Scripts are
+	copied to Directory and loaded with `lua-load`; services invoke
+	the actions they register through their Lua hooks.
+*/
+type Lua struct {
+	// Defaults to /etc/haproxy/lua
+	Directory string
+
+	Scripts []LuaScript
+}
+
+type LuaScript struct {
+	// Unique name, letters, digits, dashes and underscores
+	Name string
+	// Script file on the Bamboo host
+	Source string
+}
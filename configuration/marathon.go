@@ -2,6 +2,7 @@ package configuration
 
 import (
 	"strings"
+	"time"
 )
 
 /*
@@ -10,6 +11,30 @@ import (
 type Marathon struct {
 	// comma separated marathon http endpoints including port number
 	Endpoint string
+
+	// Hold events while Marathon deployments are running and render
+	// once they completed, instead of once per app
+	DeploymentBatching bool
+	// Maximum number of seconds events are held for a deployment
+	DeploymentMaxWait int64
+	// Only render on completed deployments and health changes,
+	// ignoring task status updates in between
+	DeploymentGating bool
+	// Hold events while a deployment step restarts apps and render
+	// once per step, instead of on every health flap of the restart
+	RestartBatching bool
+	// Seconds between checks of the event subscription, defaults to 60
+	SubscriptionCheckInterval int64
+	// Headers and TLS settings of the event subscription calls
+	EventSubscription EventSubscription
+}
+
+func (m Marathon) DeploymentMaxWaitDuration() time.Duration {
+	return time.Duration(m.DeploymentMaxWait) * time.Second
+}
+
+func (m Marathon) SubscriptionCheckIntervalDuration() time.Duration {
+	return time.Duration(m.SubscriptionCheckInterval) * time.Second
 }
 
 func (m Marathon) Endpoints() []string {
@@ -0,0 +1,31 @@
+package configuration
+
+import (
+	"strings"
+	"time"
+)
+
+/*
+	Mesos master configuration, used to look up agent attributes
+*/
+type Mesos struct {
+	// comma separated mesos master http endpoints including port number,
+	// leave empty to disable agent lookups
+	Endpoint string
+	// Drain tasks on agents in Mesos maintenance windows
+	DrainMaintenance bool
+	// Seconds before a maintenance window tasks are drained
+	DrainBefore int64
+}
+
+func (m Mesos) DrainBeforeDuration() time.Duration {
+	return time.Duration(m.DrainBefore) * time.Second
+}
+
+func (m Mesos) Enabled() bool {
+	return len(m.Endpoint) > 0
+}
+
+func (m Mesos) Endpoints() []string {
+	return strings.Split(m.Endpoint, ",")
+}
@@ -0,0 +1,13 @@
+package configuration
+
+/*
+	Traffic mirroring through SPOE, services with a Mirror send a share
+	of their requests to spoa-mirror agents (HAProxy 1.9+)
+*/
+type Mirror struct {
+	Enabled bool
+
+	// Path of the generated SPOE engines configuration referenced by
+	// the `filter spoe` lines of the template
+	SpoeConfigPath string
+}
@@ -0,0 +1,24 @@
+package configuration
+
+/*
+	Naming scheme of rendered HAProxy sections, each value is a Go
+	template evaluated per app service port with the fields
+	Id, EscapedId, Name, Group, Labels, PortIndex, PortName and
+	ServicePort
+*/
+// Defaults keep the names of the first service port compatible with
+// templates written before service port naming
+const (
+	DefaultBackendName  = "{{ .EscapedId }}-cluster{{ if .PortIndex }}-{{ .PortName }}{{ end }}"
+	DefaultFrontendName = "{{ .EscapedId }}_{{ .ServicePort }}"
+	DefaultAclName      = "{{ .EscapedId }}-aclrule{{ if .PortIndex }}-{{ .PortName }}{{ end }}"
+)
+
+type Naming struct {
+	Backend  string
+	Frontend string
+	Acl      string
+	// Hostname of every app, e.g. {{ .Name }}.{{ .Group }}.example.com,
+	// routed to apps without service; empty for none
+	Domain string
+}
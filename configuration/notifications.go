@@ -0,0 +1,27 @@
+package configuration
+
+import (
+	"time"
+)
+
+/*
+	Delivery of notifications to the owners of services. Webhooks of
+	owners are always called, emails need an SMTP relay.
+*/
+type Notifications struct {
+	// SMTP relay emails are sent through, e.g. localhost:25; owners
+	// are not emailed when empty
+	SmtpHost string
+	// Sender address of the emails
+	From string
+	// Seconds to wait for a webhook or the SMTP relay, defaults to 5
+	Timeout int64
+}
+
+func (n Notifications) EmailEnabled() bool {
+	return len(n.SmtpHost) > 0
+}
+
+func (n Notifications) TimeoutDuration() time.Duration {
+	return time.Duration(n.Timeout) * time.Second
+}
@@ -0,0 +1,112 @@
+package configuration
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+/*
+	Merges overlay documents into a base configuration document.
+	Objects are merged key by key, matching keys case-insensitively like
+	the JSON decoding of the configuration does; arrays and values
+	replace the base value and null removes it. Overlays are applied in
+	the given order, later overlays winning.
+*/
+func MergeDocuments(base []byte, overlays ...[]byte) ([]byte, error) {
+	merged := map[string]interface{}{}
+	if err := json.Unmarshal(base, &merged); err != nil {
+		return nil, err
+	}
+	for _, overlay := range overlays {
+		document := map[string]interface{}{}
+		if err := json.Unmarshal(overlay, &document); err != nil {
+			return nil, err
+		}
+		mergeObjects(merged, document)
+	}
+	return json.Marshal(merged)
+}
+
+func mergeObjects(base map[string]interface{}, overlay map[string]interface{}) {
+	for key, value := range overlay {
+		baseKey := key
+		for existing := range base {
+			if strings.EqualFold(existing, key) {
+				baseKey = existing
+				break
+			}
+		}
+
+		if value == nil {
+			delete(base, baseKey)
+			continue
+		}
+		baseObject, baseIsObject := base[baseKey].(map[string]interface{})
+		overlayObject, overlayIsObject := value.(map[string]interface{})
+		if baseIsObject && overlayIsObject {
+			mergeObjects(baseObject, overlayObject)
+			continue
+		}
+		base[baseKey] = value
+	}
+}
+
+func readOverlays(paths []string) ([][]byte, error) {
+	overlays := [][]byte{}
+	for _, path := range paths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		overlays = append(overlays, content)
+	}
+	return overlays, nil
+}
+
+/*
+	Parses the configuration of a base file with overlay files, e.g. a
+	shared base.json with prod.json holding what differs in production.
+	Syntax errors are reported with their line and column, and fields
+	the configuration does not have are rejected. Placeholders of string
+	values are interpolated last.
+*/
+func (config *Configuration) FromFiles(filePath string, overlayPaths ...string) error {
+	base, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	overlays, err := readOverlays(overlayPaths)
+	if err != nil {
+		return err
+	}
+	paths := append([]string{filePath}, overlayPaths...)
+	for i, document := range append([][]byte{base}, overlays...) {
+		var value interface{}
+		if err := json.Unmarshal(document, &value); err != nil {
+			return describeSyntaxError(paths[i], document, err)
+		}
+	}
+
+	merged, err := MergeDocuments(base, overlays...)
+	if err != nil {
+		return fmt.Errorf("unable to merge %s: %s", strings.Join(paths, ", "), err)
+	}
+	if unknown := UnknownFields(merged); len(unknown) > 0 {
+		sort.Sort(fieldErrorsByPath(unknown))
+		return unknown
+	}
+
+	document := map[string]interface{}{}
+	json.Unmarshal(merged, &document)
+	if _, errs := interpolateDocument(document, ""); len(errs) > 0 {
+		return errs
+	}
+	interpolated, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(interpolated, config)
+}
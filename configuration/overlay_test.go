@@ -0,0 +1,52 @@
+package configuration
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func merge(base string, overlays ...string) map[string]interface{} {
+	documents := [][]byte{}
+	for _, overlay := range overlays {
+		documents = append(documents, []byte(overlay))
+	}
+	merged, err := MergeDocuments([]byte(base), documents...)
+	So(err, ShouldBeNil)
+	result := map[string]interface{}{}
+	json.Unmarshal(merged, &result)
+	return result
+}
+
+func TestMergeDocuments(t *testing.T) {
+	Convey("#MergeDocuments", t, func() {
+		base := `{"Marathon": {"Endpoint": "http://dev:8080", "DeploymentBatching": true}, "HAProxy": {"Lua": {"Scripts": [{"Name": "a"}]}}}`
+
+		Convey("should merge objects and replace values", func() {
+			merged := merge(base, `{"Marathon": {"Endpoint": "http://prod:8080"}}`)
+			So(merged["Marathon"], ShouldResemble, map[string]interface{}{"Endpoint": "http://prod:8080", "DeploymentBatching": true})
+		})
+
+		Convey("should replace arrays", func() {
+			merged := merge(base, `{"HAProxy": {"Lua": {"Scripts": []}}}`)
+			So(merged["HAProxy"], ShouldResemble, map[string]interface{}{"Lua": map[string]interface{}{"Scripts": []interface{}{}}})
+		})
+
+		Convey("should match keys case-insensitively", func() {
+			merged := merge(base, `{"marathon": {"endpoint": "http://prod:8080"}}`)
+			So(merged["Marathon"], ShouldResemble, map[string]interface{}{"Endpoint": "http://prod:8080", "DeploymentBatching": true})
+			So(merged["marathon"], ShouldBeNil)
+		})
+
+		Convey("should remove values set to null", func() {
+			merged := merge(base, `{"Marathon": {"DeploymentBatching": null}}`)
+			So(merged["Marathon"], ShouldResemble, map[string]interface{}{"Endpoint": "http://dev:8080"})
+		})
+
+		Convey("should apply later overlays last", func() {
+			merged := merge(base, `{"Marathon": {"Endpoint": "http://stage:8080"}}`, `{"Marathon": {"Endpoint": "http://prod:8080"}}`)
+			So(merged["Marathon"].(map[string]interface{})["Endpoint"], ShouldEqual, "http://prod:8080")
+		})
+	})
+}
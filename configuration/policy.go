@@ -0,0 +1,47 @@
+package configuration
+
+import (
+	"time"
+)
+
+/*
+	Policies service mutations are evaluated against by an OPA server
+	next to Bamboo. Bamboo uploads the Rego policies of Directory and of
+	the bundle at BundleUrl to that server, which can also load its own.
+*/
+type Policy struct {
+	// Data API endpoint of the decision, e.g.
+	// http://localhost:8181/v1/data/bamboo/services; not evaluated when
+	// empty
+	Url string
+	// Seconds to wait for the decision, defaults to 5
+	Timeout int64
+	// Allow mutations when the policy can not be evaluated, instead of
+	// refusing them
+	FailOpen bool
+	// Directory of .rego files uploaded to the policy API of the OPA
+	// server of Url
+	Directory string
+	// URL of a bundle, a .tar.gz archive whose .rego files are uploaded
+	// to the policy API of the OPA server of Url
+	BundleUrl string
+	// Seconds between two uploads of changed policies, defaults to 60
+	LoadInterval int64
+}
+
+func (p Policy) Enabled() bool {
+	return len(p.Url) > 0
+}
+
+func (p Policy) TimeoutDuration() time.Duration {
+	return time.Duration(p.Timeout) * time.Second
+}
+
+// Whether Bamboo uploads policies to the OPA server
+func (p Policy) Loads() bool {
+	return p.Enabled() && (len(p.Directory) > 0 || len(p.BundleUrl) > 0)
+}
+
+func (p Policy) LoadIntervalDuration() time.Duration {
+	return time.Duration(p.LoadInterval) * time.Second
+}
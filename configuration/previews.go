@@ -0,0 +1,29 @@
+package configuration
+
+import (
+	"time"
+)
+
+/*
+	Routes of per-branch preview environments, registered through
+	/api/previews
+*/
+type Previews struct {
+	// Domain the subdomains of previews are generated under, e.g.
+	// preview.example.com; empty disables the endpoints
+	Domain string
+	// Seconds a preview route lives unless the request gives a TTL,
+	// defaults to 7 days
+	DefaultTTL int64
+	// Seconds a preview route may exist without its Marathon app,
+	// defaults to 600
+	AppGracePeriod int64
+}
+
+func (p Previews) Enabled() bool {
+	return len(p.Domain) > 0
+}
+
+func (p Previews) AppGracePeriodDuration() time.Duration {
+	return time.Duration(p.AppGracePeriod) * time.Second
+}
@@ -0,0 +1,86 @@
+package configuration
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Replaces secrets in the configuration shown by the admin API
+const RedactedValue = "REDACTED"
+
+/*
+	Returns a copy of the configuration with tokens and keys replaced
+	by RedactedValue and passwords removed from endpoint URLs, safe to
+	show to operators
+*/
+func (config Configuration) Redacted() Configuration {
+	redacted := config
+	for _, secret := range []*string{
+		&redacted.HAProxy.Remote.Token,
+		&redacted.Archive.AccessKey,
+		&redacted.Archive.SecretKey,
+		&redacted.DNS.Route53.AccessKey,
+		&redacted.DNS.Route53.SecretKey,
+		&redacted.Consul.Token,
+		&redacted.FaultInjection.Token,
+		&redacted.Bamboo.Admin.Token,
+		// webhook URLs usually carry their credentials in the path
+		&redacted.Bamboo.DomainOwnership.WebhookUrl,
+	} {
+		if len(*secret) > 0 {
+			*secret = RedactedValue
+		}
+	}
+
+	for _, endpoints := range []*string{
+		&redacted.Marathon.Endpoint,
+		&redacted.Mesos.Endpoint,
+		&redacted.Bamboo.Endpoint,
+		&redacted.Bamboo.Policy.Url,
+		&redacted.Bamboo.Policy.BundleUrl,
+		&redacted.HAProxy.Reload.Url,
+		&redacted.HAProxy.ValidationHook.Url,
+		&redacted.DNS.CoreDNS.EtcdEndpoint,
+		&redacted.Consul.Endpoint,
+	} {
+		*endpoints = redactPasswords(*endpoints)
+	}
+
+	// header values may be credentials, e.g. Authorization of a gateway
+	if headers := config.Marathon.EventSubscription.Headers; headers != nil {
+		redacted.Marathon.EventSubscription.Headers = map[string]string{}
+		for name := range headers {
+			redacted.Marathon.EventSubscription.Headers[name] = RedactedValue
+		}
+	}
+
+	if headers := config.HAProxy.ValidationHook.Headers; headers != nil {
+		redacted.HAProxy.ValidationHook.Headers = map[string]string{}
+		for name := range headers {
+			redacted.HAProxy.ValidationHook.Headers[name] = RedactedValue
+		}
+	}
+
+	// the client is no configuration
+	redacted.StatsD.Client = nil
+	return redacted
+}
+
+// Redacts the passwords of comma separated URLs
+func redactPasswords(endpoints string) string {
+	if !strings.Contains(endpoints, "@") {
+		return endpoints
+	}
+	redacted := []string{}
+	for _, endpoint := range strings.Split(endpoints, ",") {
+		parsed, err := url.Parse(endpoint)
+		if err == nil && parsed.User != nil {
+			if _, hasPassword := parsed.User.Password(); hasPassword {
+				parsed.User = url.UserPassword(parsed.User.Username(), RedactedValue)
+				endpoint = parsed.String()
+			}
+		}
+		redacted = append(redacted, endpoint)
+	}
+	return strings.Join(redacted, ",")
+}
@@ -0,0 +1,60 @@
+package configuration
+
+import (
+	"time"
+)
+
+/*
+	How a written configuration is applied, for environments where
+	Bamboo can not run a command next to HAProxy
+*/
+type Reload struct {
+	// exec runs ReloadCommand, signal signals the process of PidFile,
+	// http calls a sidecar at Url, remote pushes to the hosts of
+	// HAProxy.Remote, supervise runs HAProxy as a child of Bamboo and
+	// none only writes the configuration
+	Strategy string
+	// Pid file of the running HAProxy master
+	PidFile string
+	// Signal sent to it, defaults to USR2 reloading a master-worker HAProxy
+	Signal string
+	// Endpoint reloading the proxy, called with Method (POST by default)
+	Url    string
+	Method string
+	// Seconds the sidecar may take to reload, defaults to 30
+	Timeout int
+	// HAProxy process of the supervise strategy
+	Supervisor Supervisor
+}
+
+/*
+	HAProxy master process started and restarted by Bamboo, e.g. in a
+	container without an init system
+*/
+type Supervisor struct {
+	// Arguments added to "-W -db -f <OutputPath>", e.g. ["-L", "proxy-1"]
+	Args []string
+	// Seconds to wait before restarting HAProxy once it exited, doubled
+	// for every exit in a row up to MaxBackoff; defaults to 1 and 60
+	MinBackoff int
+	MaxBackoff int
+	// Seconds HAProxy is given to finish its connections when Bamboo
+	// stops, before it is killed; defaults to 30
+	StopTimeout int
+}
+
+func (s Supervisor) MinBackoffDuration() time.Duration {
+	return time.Duration(s.MinBackoff) * time.Second
+}
+
+func (s Supervisor) MaxBackoffDuration() time.Duration {
+	return time.Duration(s.MaxBackoff) * time.Second
+}
+
+func (s Supervisor) StopTimeoutDuration() time.Duration {
+	return time.Duration(s.StopTimeout) * time.Second
+}
+
+func (r Reload) TimeoutDuration() time.Duration {
+	return time.Duration(r.Timeout) * time.Second
+}
@@ -0,0 +1,62 @@
+package configuration
+
+import (
+	"errors"
+	"time"
+)
+
+/*
+	Proxy hosts the written configuration is pushed to and reloaded on
+	by the "remote" reload strategy, so that one Bamboo manages a pool
+	of proxy hosts
+*/
+type Remote struct {
+	Targets []RemoteTarget
+	// Bearer token Bamboo agents require and pushes are sent with
+	Token string
+	// Seconds a push and reload may take per target, defaults to 60
+	Timeout int
+	// Agents apply pushed configurations without checking them with
+	// `haproxy -c`, e.g. when the binary is not in their container
+	SkipValidation bool
+}
+
+func (r Remote) TimeoutDuration() time.Duration {
+	return time.Duration(r.Timeout) * time.Second
+}
+
+/*
+	Proxy host reached either with the ssh command or through a Bamboo
+	agent, started with `bamboo agent` on the host
+*/
+type RemoteTarget struct {
+	// Defaults to the ssh destination or the agent URL
+	Name string
+	// ssh destination, e.g. haproxy@proxy-1
+	Ssh string
+	// Options of the ssh command, e.g. ["-i", "/etc/bamboo/id_ed25519"]
+	SshOptions []string
+	// Configuration path and reload command on the host, defaulting to
+	// OutputPath and ReloadCommand
+	ConfigPath    string
+	ReloadCommand string
+	// Bamboo agent endpoint, e.g. http://proxy-1:8000
+	Agent string
+}
+
+func (t RemoteTarget) EffectiveName() string {
+	if len(t.Name) > 0 {
+		return t.Name
+	}
+	if len(t.Ssh) > 0 {
+		return t.Ssh
+	}
+	return t.Agent
+}
+
+func (t RemoteTarget) Validate() error {
+	if (len(t.Ssh) > 0) == (len(t.Agent) > 0) {
+		return errors.New("remote target " + t.EffectiveName() + " must set either Ssh or Agent")
+	}
+	return nil
+}
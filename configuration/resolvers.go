@@ -0,0 +1,35 @@
+package configuration
+
+import (
+	"strings"
+)
+
+/*
+	HAProxy DNS resolvers used by apps flagged for DNS based resolution
+	(Marathon env BAMBOO_DNS_RESOLUTION), e.g. Mesos-DNS
+*/
+type Resolvers struct {
+	Enabled bool
+
+	// Name of the rendered resolvers section
+	Name string
+
+	// comma separated nameserver host:port set
+	Nameserver string
+
+	// DNS domain apps are published under, e.g. marathon.mesos
+	Domain string
+
+	// Default number of server-template slots per app, can be
+	// overridden with Marathon env BAMBOO_DNS_SLOTS
+	ServerSlots int
+
+	ResolveRetries int
+
+	// HAProxy time format, e.g. "10s"
+	HoldValid string
+}
+
+func (r Resolvers) Nameservers() []string {
+	return strings.Split(r.Nameserver, ",")
+}
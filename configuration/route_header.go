@@ -0,0 +1,13 @@
+package configuration
+
+/*
+	Request header routing to an app regardless of the Host, e.g.
+	`X-Bamboo-Route: /group/app` to test apps before their cutover.
+	Only enable it in environments where clients may pick backends.
+*/
+type RouteHeader struct {
+	Enabled bool
+
+	// Header name, defaults to X-Bamboo-Route
+	Name string
+}
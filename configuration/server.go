@@ -0,0 +1,35 @@
+package configuration
+
+import (
+	"time"
+)
+
+/*
+	Limits of the Bamboo HTTP server, protecting the listener from slow
+	or idle clients holding on to connections
+*/
+type Server struct {
+	// Seconds to read a request including its body, defaults to 60
+	ReadTimeout int64
+	// Seconds to write a response, 0 for no limit. Must exceed the
+	// ?timeout of /api/state watches (at most 300) when set.
+	WriteTimeout int64
+	// Seconds a keep-alive connection may wait for its next request,
+	// defaults to 120
+	IdleTimeout int64
+	// Connections served at once, further clients wait to be accepted.
+	// 0 for no limit.
+	MaxConnections int
+}
+
+func (s Server) ReadTimeoutDuration() time.Duration {
+	return time.Duration(s.ReadTimeout) * time.Second
+}
+
+func (s Server) WriteTimeoutDuration() time.Duration {
+	return time.Duration(s.WriteTimeout) * time.Second
+}
+
+func (s Server) IdleTimeoutDuration() time.Duration {
+	return time.Duration(s.IdleTimeout) * time.Second
+}
@@ -0,0 +1,13 @@
+package configuration
+
+/*
+	Default connection limits of every server, overridden by the Limits
+	of a service and temporary overrides set through the API. Zero
+	leaves the HAProxy default.
+*/
+type ServerLimits struct {
+	// Concurrent connections per server, further requests are queued
+	MaxConn int
+	// Queued requests per server, further requests are redispatched
+	MaxQueue int
+}
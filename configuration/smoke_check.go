@@ -0,0 +1,85 @@
+package configuration
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+/*
+	HTTP requests sent through HAProxy once a configuration is applied,
+	catching configurations which load but break the traffic
+*/
+type SmokeCheck struct {
+	Enabled bool
+	// Base URL of HAProxy probes with a path are sent to, e.g.
+	// http://127.0.0.1:80
+	Address string
+	// Canary probes sent after every reload, besides the probes of
+	// services
+	Probes []SmokeProbe
+	// Seconds to wait after a reload before probing, defaults to 2
+	Delay int64
+	// Seconds to wait for each response, defaults to 5
+	Timeout int64
+}
+
+func (s SmokeCheck) DelayDuration() time.Duration {
+	return time.Duration(s.Delay) * time.Second
+}
+
+func (s SmokeCheck) TimeoutDuration() time.Duration {
+	return time.Duration(s.Timeout) * time.Second
+}
+
+// HTTP request checking a route of HAProxy
+type SmokeProbe struct {
+	// Path sent to SmokeCheck.Address, or absolute URL for canary
+	// probes
+	Url string
+	// Host header, the host of the URL when empty; the probe of a
+	// service defaults to the first hostname of its ACL
+	Host string `json:",omitempty"`
+	// Status code expected, any 2xx or 3xx status when 0
+	ExpectStatus int `json:",omitempty"`
+}
+
+func (p SmokeProbe) Validate() error {
+	if strings.HasPrefix(p.Url, "/") {
+		return p.validateStatus()
+	}
+	parsed, err := url.Parse(p.Url)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || len(parsed.Host) == 0 {
+		return errors.New("smoke probe URL " + p.Url + " must be a path or an http(s) URL")
+	}
+	return p.validateStatus()
+}
+
+/*
+	Validates the probe of a service, which must be a path: services are
+	written through the API, and an absolute URL would have Bamboo send
+	requests anywhere its network reaches
+*/
+func (p SmokeProbe) ValidatePath() error {
+	if !strings.HasPrefix(p.Url, "/") || strings.HasPrefix(p.Url, "//") {
+		return errors.New("smoke probe URL " + p.Url + " must be a path, e.g. /health")
+	}
+	return p.validateStatus()
+}
+
+func (p SmokeProbe) validateStatus() error {
+	if p.ExpectStatus != 0 && (p.ExpectStatus < 100 || p.ExpectStatus > 599) {
+		return fmt.Errorf("smoke probe status %d must be between 100 and 599", p.ExpectStatus)
+	}
+	return nil
+}
+
+// Returns whether the probe passes with a response status
+func (p SmokeProbe) Passes(status int) bool {
+	if p.ExpectStatus != 0 {
+		return status == p.ExpectStatus
+	}
+	return status >= 200 && status < 400
+}
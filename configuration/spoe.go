@@ -0,0 +1,93 @@
+package configuration
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var agentNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+var agentVarPattern = regexp.MustCompile(`^(proc|sess|txn|req|res)\.[A-Za-z0-9_.]+$`)
+
+/*
+	SPOE agents, e.g. WAF or authentication sidecars, requests are sent
+	to before being forwarded (HAProxy 1.9+). Agents declared here run
+	for every service, services may declare their own.
+*/
+type Spoe struct {
+	// Path of the generated SPOE engines configuration, defaults to
+	// /etc/haproxy/agents.spoe.cfg
+	ConfigPath string
+
+	Agents []SpoeAgent
+}
+
+type SpoeAgent struct {
+	// Name of the agent, letters, digits, dashes and underscores
+	Name string
+	// comma separated host:port of the agent servers
+	Servers string
+	// Arguments of the SPOE message, defaults to the client address,
+	// method, path, version and headers of the request
+	Args string
+	// Prefix of the variables set by the agent, defaults to Name
+	VarPrefix string
+	// Milliseconds to wait for the agent, defaults to 100
+	ProcessingTimeout int
+	// Variable set by the agent to reject the request, e.g.
+	// txn.waf.block; requests are rejected when it is greater than 0
+	DenyVar string
+	// Status of rejected requests, defaults to 403
+	DenyStatus int
+}
+
+func (a SpoeAgent) Validate() error {
+	if !agentNamePattern.MatchString(a.Name) {
+		return errors.New("SPOE agent names must only contain letters, digits, dashes and underscores")
+	}
+	if len(a.ServerList()) == 0 {
+		return errors.New("SPOE agent " + a.Name + " must list at least one server")
+	}
+	if len(a.DenyVar) > 0 && !agentVarPattern.MatchString(a.DenyVar) {
+		return errors.New("SPOE agent " + a.Name + " DenyVar must be a variable name like txn.waf.block")
+	}
+	return nil
+}
+
+func (a SpoeAgent) ServerList() []string {
+	servers := []string{}
+	for _, server := range strings.Split(a.Servers, ",") {
+		if server = strings.TrimSpace(server); len(server) > 0 {
+			servers = append(servers, server)
+		}
+	}
+	return servers
+}
+
+func (a SpoeAgent) EffectiveArgs() string {
+	if len(a.Args) == 0 {
+		return "src=src method=method path=path ver=req.ver hdrs=req.hdrs_bin"
+	}
+	return a.Args
+}
+
+func (a SpoeAgent) EffectiveVarPrefix() string {
+	if len(a.VarPrefix) == 0 {
+		return a.Name
+	}
+	return a.VarPrefix
+}
+
+func (a SpoeAgent) EffectiveProcessingTimeout() int {
+	if a.ProcessingTimeout <= 0 {
+		return 100
+	}
+	return a.ProcessingTimeout
+}
+
+func (a SpoeAgent) EffectiveDenyStatus() int {
+	if a.DenyStatus <= 0 {
+		return 403
+	}
+	return a.DenyStatus
+}
@@ -12,19 +12,45 @@ type StatsD struct {
 	Host    string
 	Prefix  string
 
+	// Per-app metrics
+	AppMetrics AppMetrics
+
 	Client g2s.Statter
 }
 
+/*
+	Opt-in of apps to per-app metrics, bounding the number of buckets
+	sent for large clusters
+*/
+type AppMetrics struct {
+	Enabled bool
+	// Maximum number of apps with metrics, further apps are left out
+	MaxApps int
+	// App id patterns (path.Match syntax, e.g. /prod/*) opted in,
+	// all apps when empty
+	Include []string
+	// App id patterns opted out, taking precedence over Include
+	Exclude []string
+}
+
+/*
+	Creates the client sending metrics in the background. It connects
+	lazily, so that an unresolvable or unreachable host only drops
+	metrics instead of stopping Bamboo.
+*/
 func (s *StatsD) CreateClient() {
 	if s.Enabled && s.Client == nil {
 		log.Println("StatsD is enabled")
-		client, err := g2s.Dial("udp", s.Host)
-		if err != nil {
-			log.Fatalf("Cannot connect to statsd server %v: %v ", s.Host, err)
-		}
-		s.Client = client
+		s.Client = newStatsdSender(s.Host, s.Prefix)
 	}
+}
 
+// Number of metrics dropped while StatsD was unreachable or slow
+func (s *StatsD) Dropped() int64 {
+	if sender, ok := s.Client.(*statsdSender); ok {
+		return sender.Dropped()
+	}
+	return 0
 }
 
 func (s *StatsD) Increment(sampleRate float32, bucket string, n int) {
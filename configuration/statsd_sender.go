@@ -0,0 +1,125 @@
+package configuration
+
+import (
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/peterbourgon/g2s"
+)
+
+const (
+	// Metrics waiting to be sent, further metrics are dropped
+	statsdQueueSize = 1000
+	// Least time between two attempts to connect
+	statsdRedialInterval = 10 * time.Second
+)
+
+type statsdMetric func(g2s.Statter)
+
+/*
+	Sends metrics from a queue in the background, so that emitting a
+	metric never blocks on name resolution or an unreachable StatsD.
+	The connection is dialed with the first metric and again after a
+	failed write, at most every statsdRedialInterval. Metrics arriving
+	while disconnected or with a full queue are dropped and counted.
+*/
+type statsdSender struct {
+	// accessed atomically
+	dropped int64
+
+	prefix   string
+	dial     func() (net.Conn, error)
+	queue    chan statsdMetric
+	reported int64
+}
+
+func newStatsdSender(host string, prefix string) *statsdSender {
+	sender := &statsdSender{
+		prefix: prefix,
+		dial: func() (net.Conn, error) {
+			return net.DialTimeout("udp", host, 2*time.Second)
+		},
+		queue: make(chan statsdMetric, statsdQueueSize),
+	}
+	go sender.run()
+	return sender
+}
+
+func (s *statsdSender) Counter(sampleRate float32, bucket string, n ...int) {
+	s.enqueue(func(client g2s.Statter) { client.Counter(sampleRate, bucket, n...) })
+}
+
+func (s *statsdSender) Timing(sampleRate float32, bucket string, d ...time.Duration) {
+	s.enqueue(func(client g2s.Statter) { client.Timing(sampleRate, bucket, d...) })
+}
+
+func (s *statsdSender) Gauge(sampleRate float32, bucket string, value ...string) {
+	s.enqueue(func(client g2s.Statter) { client.Gauge(sampleRate, bucket, value...) })
+}
+
+// Number of metrics dropped since the start
+func (s *statsdSender) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+func (s *statsdSender) enqueue(metric statsdMetric) {
+	select {
+	case s.queue <- metric:
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+	}
+}
+
+func (s *statsdSender) run() {
+	var writer *statsdWriter
+	var client g2s.Statter
+	var dialed time.Time
+
+	for metric := range s.queue {
+		if client == nil {
+			if !dialed.IsZero() && time.Since(dialed) < statsdRedialInterval {
+				atomic.AddInt64(&s.dropped, 1)
+				continue
+			}
+			dialed = time.Now()
+			conn, err := s.dial()
+			if err != nil {
+				log.Printf("Unable to connect to StatsD, dropping metrics: %s", err)
+				atomic.AddInt64(&s.dropped, 1)
+				continue
+			}
+			writer = &statsdWriter{conn: conn}
+			client, _ = g2s.New(writer)
+		}
+
+		metric(client)
+		if writer.failed {
+			writer.conn.Close()
+			client = nil
+			atomic.AddInt64(&s.dropped, 1)
+			continue
+		}
+
+		// reported once the metrics flow again
+		if dropped := s.Dropped(); dropped > s.reported {
+			client.Counter(1.0, fullBucket(s.prefix, "statsd.dropped"), int(dropped-s.reported))
+			s.reported = dropped
+		}
+	}
+}
+
+// Connection remembering whether a write failed
+type statsdWriter struct {
+	conn   net.Conn
+	failed bool
+}
+
+func (w *statsdWriter) Write(data []byte) (int, error) {
+	n, err := w.conn.Write(data)
+	if err != nil {
+		w.failed = true
+	}
+	return n, err
+}
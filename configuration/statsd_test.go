@@ -0,0 +1,71 @@
+package configuration
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestStatsdSender(t *testing.T) {
+	Convey("#statsdSender", t, func() {
+		Convey("should drop metrics without blocking when the queue is full", func() {
+			sender := &statsdSender{queue: make(chan statsdMetric, 1)}
+			sender.Counter(1.0, "a", 1)
+			sender.Counter(1.0, "b", 1)
+			sender.Gauge(1.0, "c", "1")
+			So(sender.Dropped(), ShouldEqual, 2)
+		})
+
+		Convey("should drop metrics while StatsD is unreachable", func() {
+			sender := &statsdSender{
+				dial:  func() (net.Conn, error) { return nil, errors.New("no such host") },
+				queue: make(chan statsdMetric, 10),
+			}
+			go sender.run()
+			sender.Counter(1.0, "a", 1)
+			sender.Counter(1.0, "b", 1)
+			So(waitFor(func() bool { return sender.Dropped() == 2 }), ShouldBeTrue)
+		})
+
+		Convey("should send metrics and report dropped ones once connected", func() {
+			listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+			So(err, ShouldBeNil)
+			defer listener.Close()
+
+			sender := &statsdSender{
+				dropped: 3,
+				prefix:  "bamboo",
+				dial:    func() (net.Conn, error) { return net.Dial("udp", listener.LocalAddr().String()) },
+				queue:   make(chan statsdMetric, 10),
+			}
+			go sender.run()
+			sender.Counter(1.0, "bamboo.reload", 1)
+
+			received := []string{}
+			buffer := make([]byte, 1024)
+			listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+			for len(received) < 2 {
+				n, _, err := listener.ReadFrom(buffer)
+				if err != nil {
+					break
+				}
+				received = append(received, strings.TrimSpace(string(buffer[:n])))
+			}
+			So(received, ShouldResemble, []string{"bamboo.reload:1|c", "bamboo.statsd.dropped:3|c"})
+		})
+	})
+}
+
+func waitFor(condition func() bool) bool {
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); {
+		if condition() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
@@ -0,0 +1,13 @@
+package configuration
+
+/*
+	Stick tables of services with rate limits or sticky sessions. The
+	memory HAProxy allocates for them is estimated on every render and
+	checked against MemoryBudget.
+*/
+type StickTables struct {
+	// Entries of tables without a size of their own, defaults to 100000
+	DefaultSize int
+	// Memory budget of all tables in megabytes, 0 disables the check
+	MemoryBudget int64
+}
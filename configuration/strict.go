@@ -0,0 +1,289 @@
+package configuration
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Problem with a configuration value, e.g. HAProxy.Reload.Strategy
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+type FieldErrors []FieldError
+
+type fieldErrorsByPath FieldErrors
+
+func (f fieldErrorsByPath) Len() int           { return len(f) }
+func (f fieldErrorsByPath) Less(i, j int) bool { return f[i].Path < f[j].Path }
+func (f fieldErrorsByPath) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+
+func (e FieldErrors) Error() string {
+	lines := []string{}
+	for _, fieldError := range e {
+		lines = append(lines, fieldError.Error())
+	}
+	return "invalid configuration:\n  " + strings.Join(lines, "\n  ")
+}
+
+/*
+	Returns the keys of a JSON document without a matching field in
+	the configuration, matched case-insensitively like encoding/json
+	does, with the closest field name as suggestion
+*/
+func UnknownFields(document []byte) FieldErrors {
+	var value interface{}
+	if err := json.Unmarshal(document, &value); err != nil {
+		return nil
+	}
+	return unknownFields(value, reflect.TypeOf(Configuration{}), "")
+}
+
+func unknownFields(value interface{}, t reflect.Type, path string) FieldErrors {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	errors := FieldErrors{}
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return errors
+		}
+		fields := jsonFields(t)
+		for key, fieldValue := range object {
+			field, ok := fields[strings.ToLower(key)]
+			if !ok {
+				message := "unknown field"
+				if suggestion := closestField(key, fields); len(suggestion) > 0 {
+					message += ", did you mean " + suggestion + "?"
+				}
+				errors = append(errors, FieldError{Path: joinPath(path, key), Message: message})
+				continue
+			}
+			errors = append(errors, unknownFields(fieldValue, field.Type, joinPath(path, field.Name))...)
+		}
+	case reflect.Slice, reflect.Array:
+		if items, ok := value.([]interface{}); ok {
+			for i, item := range items {
+				errors = append(errors, unknownFields(item, t.Elem(), path+"["+strconv.Itoa(i)+"]")...)
+			}
+		}
+	case reflect.Map:
+		if object, ok := value.(map[string]interface{}); ok {
+			for key, item := range object {
+				errors = append(errors, unknownFields(item, t.Elem(), joinPath(path, key))...)
+			}
+		}
+	}
+	return errors
+}
+
+// Exported fields of a struct by lower case JSON name
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if len(field.PkgPath) > 0 {
+			continue
+		}
+		name := field.Name
+		if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if len(tag) > 0 {
+			name = tag
+		}
+		field.Name = name
+		fields[strings.ToLower(name)] = field
+	}
+	return fields
+}
+
+// Field within two edits of the key, ignoring case
+func closestField(key string, fields map[string]reflect.StructField) string {
+	best, bestDistance := "", 3
+	for lower, field := range fields {
+		if distance := editDistance(strings.ToLower(key), lower); distance < bestDistance || (distance == bestDistance && field.Name < best) {
+			best, bestDistance = field.Name, distance
+		}
+	}
+	return best
+}
+
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minOf(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func minOf(values ...int) int {
+	min := values[0]
+	for _, value := range values[1:] {
+		if value < min {
+			min = value
+		}
+	}
+	return min
+}
+
+func sortedKeys(flags map[string]bool) []string {
+	keys := []string{}
+	for key := range flags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinPath(path string, key string) string {
+	if len(path) == 0 {
+		return key
+	}
+	return path + "." + key
+}
+
+/*
+	Describes a JSON syntax error by line and column of the file, rather
+	than the byte offset
+*/
+func describeSyntaxError(filePath string, content []byte, err error) error {
+	syntaxError, ok := err.(*json.SyntaxError)
+	if !ok {
+		return fmt.Errorf("%s: %s", filePath, err)
+	}
+	line, column := 1, 1
+	for _, c := range content[:syntaxError.Offset] {
+		if c == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return fmt.Errorf("%s:%d:%d: %s", filePath, line, column, err)
+}
+
+var reloadStrategies = map[string]bool{"exec": true, "signal": true, "http": true, "none": true, "remote": true, "supervise": true}
+
+/*
+	Checks the fields Bamboo can not run without and the ranges of
+	values, after defaults were applied. All problems are reported
+	together.
+*/
+func (c Configuration) Validate() error {
+	errors := FieldErrors{}
+	check := func(ok bool, path string, message string) {
+		if !ok {
+			errors = append(errors, FieldError{Path: path, Message: message})
+		}
+	}
+
+	check(len(c.Marathon.Endpoint) > 0, "Marathon.Endpoint", "required, e.g. http://marathon:8080 (or MARATHON_ENDPOINT)")
+	for _, endpoint := range c.Marathon.Endpoints() {
+		if len(c.Marathon.Endpoint) == 0 {
+			break
+		}
+		parsed, err := url.Parse(endpoint)
+		check(err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && len(parsed.Host) > 0,
+			"Marathon.Endpoint", "\""+endpoint+"\" must be an http(s) URL with host, endpoints are separated by commas")
+	}
+	check(c.Marathon.DeploymentMaxWait > 0, "Marathon.DeploymentMaxWait", "must be a positive number of seconds")
+	check(c.Marathon.SubscriptionCheckInterval > 0, "Marathon.SubscriptionCheckInterval", "must be a positive number of seconds")
+	subscriptionTLS := c.Marathon.EventSubscription.TLS
+	check((len(subscriptionTLS.CertFile) > 0) == (len(subscriptionTLS.KeyFile) > 0), "Marathon.EventSubscription.TLS", "CertFile and KeyFile must be set together")
+
+	check(len(c.Bamboo.Zookeeper.Host) > 0, "Bamboo.Zookeeper.Host", "required, e.g. zk1:2181,zk2:2181 (or BAMBOO_ZK_HOST)")
+	check(strings.HasPrefix(c.Bamboo.Zookeeper.Path, "/") && len(c.Bamboo.Zookeeper.Path) > 1, "Bamboo.Zookeeper.Path", "must be an absolute znode path, e.g. /bamboo (or BAMBOO_ZK_PATH)")
+	check(c.Bamboo.Zookeeper.ReportingDelay >= 0, "Bamboo.Zookeeper.ReportingDelay", "must not be negative")
+	check(c.Bamboo.APIVersion == 1 || c.Bamboo.APIVersion == 2, "Bamboo.APIVersion", "must be 1 or 2")
+	check(c.Bamboo.AdminBind != c.Bamboo.Bind, "Bamboo.AdminBind", "must differ from Bamboo.Bind, leave it empty to serve everything on Bind")
+	check(c.Bamboo.Server.ReadTimeout > 0, "Bamboo.Server.ReadTimeout", "must be a positive number of seconds")
+	check(c.Bamboo.Server.WriteTimeout >= 0, "Bamboo.Server.WriteTimeout", "must not be negative, 0 disables it")
+	check(c.Bamboo.Server.IdleTimeout > 0, "Bamboo.Server.IdleTimeout", "must be a positive number of seconds")
+	check(c.Bamboo.Server.MaxConnections >= 0, "Bamboo.Server.MaxConnections", "must not be negative, 0 disables it")
+	ownership := c.Bamboo.DomainOwnership
+	check(!ownership.Enabled() || ownership.Method == "txt" || ownership.Method == "webhook", "Bamboo.DomainOwnership.Method", "must be txt or webhook, leave it empty to not check")
+	check(ownership.Method != "webhook" || strings.HasPrefix(ownership.WebhookUrl, "http"), "Bamboo.DomainOwnership.WebhookUrl", "required by the webhook method, e.g. https://teams.example.com/domains/verify")
+	check(ownership.Timeout > 0, "Bamboo.DomainOwnership.Timeout", "must be a positive number of seconds")
+	check(c.Bamboo.Previews.DefaultTTL > 0, "Bamboo.Previews.DefaultTTL", "must be a positive number of seconds")
+	check(c.Bamboo.Previews.AppGracePeriod >= 0, "Bamboo.Previews.AppGracePeriod", "must not be negative")
+	check(!c.Bamboo.Policy.Enabled() || strings.HasPrefix(c.Bamboo.Policy.Url, "http"), "Bamboo.Policy.Url", "must be an http(s) URL, e.g. http://localhost:8181/v1/data/bamboo/services")
+	check(c.Bamboo.Policy.Timeout > 0, "Bamboo.Policy.Timeout", "must be a positive number of seconds")
+	check(len(c.Bamboo.Policy.BundleUrl) == 0 || strings.HasPrefix(c.Bamboo.Policy.BundleUrl, "http"), "Bamboo.Policy.BundleUrl", "must be an http(s) URL")
+	check(c.Bamboo.Policy.LoadInterval > 0, "Bamboo.Policy.LoadInterval", "must be a positive number of seconds")
+	check(c.Notifications.Timeout > 0, "Notifications.Timeout", "must be a positive number of seconds")
+	check(!c.Notifications.EmailEnabled() || strings.Contains(c.Notifications.From, "@"), "Notifications.From", "must be an email address")
+	check(c.Capture.MaxRenders > 0, "Capture.MaxRenders", "must be a positive number of renders")
+	check(c.Bamboo.DeletedServiceRetention > 0, "Bamboo.DeletedServiceRetention", "must be a positive number of seconds")
+
+	check(len(c.HAProxy.TemplatePath) > 0, "HAProxy.TemplatePath", "required (or HAPROXY_TEMPLATE_PATH)")
+	check(len(c.HAProxy.OutputPath) > 0, "HAProxy.OutputPath", "required (or HAPROXY_OUTPUT_PATH)")
+	check(reloadStrategies[c.HAProxy.Reload.Strategy], "HAProxy.Reload.Strategy", "must be exec, signal, http, none, remote or supervise")
+	check(c.HAProxy.Reload.Supervisor.MinBackoff > 0, "HAProxy.Reload.Supervisor.MinBackoff", "must be a positive number of seconds")
+	check(c.HAProxy.Reload.Supervisor.MaxBackoff >= c.HAProxy.Reload.Supervisor.MinBackoff, "HAProxy.Reload.Supervisor.MaxBackoff", "must not be less than MinBackoff")
+	check(c.HAProxy.Reload.Supervisor.StopTimeout > 0, "HAProxy.Reload.Supervisor.StopTimeout", "must be positive")
+	check(c.HAProxy.Reload.Strategy != "exec" || len(c.HAProxy.ReloadCommand) > 0 || c.HAProxy.NoReload, "HAProxy.ReloadCommand", "required by the exec reload strategy (or HAPROXY_RELOAD_CMD)")
+	check(c.HAProxy.RenderTimeout > 0, "HAProxy.RenderTimeout", "must be a positive number of seconds")
+	check(c.HAProxy.MaxConfigSize > 0, "HAProxy.MaxConfigSize", "must be a positive number of bytes")
+	check(c.HAProxy.AdaptiveWeights.MinWeight > 0 && c.HAProxy.AdaptiveWeights.MinWeight <= 100, "HAProxy.AdaptiveWeights.MinWeight", "must be a percentage between 1 and 100")
+	check(!c.HAProxy.ValidationHook.Enabled() || strings.HasPrefix(c.HAProxy.ValidationHook.Url, "http"), "HAProxy.ValidationHook.Url", "must be an http(s) URL, e.g. http://opa:8181/v1/data/bamboo/config")
+	check(c.HAProxy.ValidationHook.Timeout > 0, "HAProxy.ValidationHook.Timeout", "must be a positive number of seconds")
+	check(c.HAProxy.StickTables.MemoryBudget >= 0, "HAProxy.StickTables.MemoryBudget", "must not be negative")
+	check(c.HAProxy.Jwt.KeySetTTL > 0, "HAProxy.Jwt.KeySetTTL", "must be a positive number of seconds")
+	check(c.HAProxy.Usage.Interval > 0, "HAProxy.Usage.Interval", "must be a positive number of seconds")
+	check(c.HAProxy.Usage.RetentionHours > 0, "HAProxy.Usage.RetentionHours", "must be a positive number of hours")
+	check(c.HAProxy.History.RetentionHours > 0, "HAProxy.History.RetentionHours", "must be a positive number of hours")
+	smokeCheck := c.HAProxy.SmokeCheck
+	if len(smokeCheck.Address) > 0 {
+		parsed, err := url.Parse(smokeCheck.Address)
+		check(err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && len(parsed.Host) > 0,
+			"HAProxy.SmokeCheck.Address", "must be an http(s) URL of HAProxy, e.g. http://127.0.0.1:80")
+	}
+	check(smokeCheck.Delay >= 0, "HAProxy.SmokeCheck.Delay", "must not be negative")
+	check(smokeCheck.Timeout > 0, "HAProxy.SmokeCheck.Timeout", "must be a positive number of seconds")
+	for i, probe := range smokeCheck.Probes {
+		path := fmt.Sprintf("HAProxy.SmokeCheck.Probes[%d]", i)
+		if err := probe.Validate(); err != nil {
+			check(false, path, err.Error())
+			continue
+		}
+		check(!strings.HasPrefix(probe.Url, "/") || len(smokeCheck.Address) > 0, path, "a path requires HAProxy.SmokeCheck.Address")
+	}
+
+	check(!c.StatsD.Enabled || len(c.StatsD.Host) > 0, "StatsD.Host", "required when StatsD is enabled, e.g. localhost:8125")
+	check(len(c.DNS.Provider) == 0 || c.DNS.Provider == "route53" || c.DNS.Provider == "coredns", "DNS.Provider", "must be route53 or coredns")
+	check(c.DNS.TTL > 0, "DNS.TTL", "must be a positive number of seconds")
+	for _, name := range sortedKeys(c.Features) {
+		_, known := LookupFeature(name)
+		check(known, "Features."+name, "unknown feature flag")
+	}
+
+	if len(errors) > 0 {
+		return errors
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package configuration
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnknownFields(t *testing.T) {
+	Convey("#UnknownFields", t, func() {
+		Convey("should accept known fields in any case", func() {
+			So(UnknownFields([]byte(`{"marathon": {"endpoint": "http://m:8080"}, "HAProxy": {"Lua": {"Scripts": [{"Name": "a"}]}}}`)), ShouldBeEmpty)
+		})
+
+		Convey("should report unknown fields with their path and a suggestion", func() {
+			unknown := UnknownFields([]byte(`{"HAProxy": {"Lua": {"Scripts": [{"Name": "a", "Sorce": "b"}]}}}`))
+			So(len(unknown), ShouldEqual, 1)
+			So(unknown[0].Error(), ShouldEqual, "HAProxy.Lua.Scripts[0].Sorce: unknown field, did you mean Source?")
+		})
+
+		Convey("should not suggest distant fields", func() {
+			unknown := UnknownFields([]byte(`{"Kubernetes": {}}`))
+			So(unknown[0].Message, ShouldEqual, "unknown field")
+		})
+	})
+}
+
+func TestValidate(t *testing.T) {
+	Convey("#Validate", t, func() {
+		conf, err := FromFile("../config/development.json")
+		So(err, ShouldBeNil)
+
+		Convey("should accept the development configuration", func() {
+			So(conf.Validate(), ShouldBeNil)
+		})
+
+		Convey("should report every invalid field", func() {
+			conf.Marathon.Endpoint = "localhost:8080"
+			conf.Bamboo.APIVersion = 3
+			err := conf.Validate()
+			So(err, ShouldNotBeNil)
+			So(len(err.(FieldErrors)), ShouldEqual, 2)
+			So(strings.Contains(err.Error(), "Bamboo.APIVersion: must be 1 or 2"), ShouldBeTrue)
+		})
+
+		Convey("should report unknown feature flags", func() {
+			conf.Features = map[string]bool{"runtime-updates": false, "sse-events": true}
+			So(conf.Validate().Error(), ShouldEqual, "invalid configuration:\n  Features.sse-events: unknown feature flag")
+		})
+
+		Convey("should require the address of HAProxy for smoke probe paths", func() {
+			conf.HAProxy.SmokeCheck.Probes = []SmokeProbe{{Url: "/ping"}, {Url: "http://127.0.0.1/ping", ExpectStatus: 1000}}
+			So(conf.Validate().Error(), ShouldEqual, "invalid configuration:\n"+
+				"  HAProxy.SmokeCheck.Probes[0]: a path requires HAProxy.SmokeCheck.Address\n"+
+				"  HAProxy.SmokeCheck.Probes[1]: smoke probe status 1000 must be between 100 and 599")
+		})
+	})
+}
+
+func TestDescribeSyntaxError(t *testing.T) {
+	Convey("#describeSyntaxError", t, func() {
+		Convey("should report the line and column of syntax errors", func() {
+			content := []byte("{\n  \"Marathon\": {\n    \"Endpoint\": \"x\",\n  }\n}")
+			var value interface{}
+			err := describeSyntaxError("base.json", content, json.Unmarshal(content, &value))
+			So(err.Error(), ShouldStartWith, "base.json:4:4: ")
+		})
+	})
+}
@@ -0,0 +1,30 @@
+package configuration
+
+import (
+	"time"
+)
+
+/*
+	Traffic usage of every backend, aggregated from `show stat` samples
+	into hourly buckets. Requires HAProxy.RuntimeSocket.
+*/
+type Usage struct {
+	Enabled bool
+
+	// Seconds between samples, defaults to 60
+	Interval int64
+
+	// Hours of usage kept, defaults to 168
+	RetentionHours int
+
+	// File the usage is kept in across restarts, in memory only when empty
+	Path string
+}
+
+func (u Usage) IntervalDuration() time.Duration {
+	return time.Duration(u.Interval) * time.Second
+}
+
+func (u Usage) Retention() time.Duration {
+	return time.Duration(u.RetentionHours) * time.Hour
+}
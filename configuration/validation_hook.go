@@ -0,0 +1,29 @@
+package configuration
+
+import (
+	"time"
+)
+
+/*
+	External service, e.g. a policy engine, asked whether a rendered
+	configuration may be applied before it is written
+*/
+type ValidationHook struct {
+	// Endpoint the configuration is POSTed to, disabled when empty
+	Url string
+	// Headers sent with the request, e.g. Authorization
+	Headers map[string]string
+	// Seconds to wait for a decision, defaults to 10
+	Timeout int
+	// Apply the configuration when the hook fails or can not be
+	// reached, instead of keeping the current configuration
+	FailOpen bool
+}
+
+func (v ValidationHook) Enabled() bool {
+	return len(v.Url) > 0
+}
+
+func (v ValidationHook) TimeoutDuration() time.Duration {
+	return time.Duration(v.Timeout) * time.Second
+}
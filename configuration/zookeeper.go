@@ -23,6 +23,26 @@ func (zk Zookeeper) Delay() time.Duration {
 	return time.Duration(zk.ReportingDelay) * time.Second
 }
 
+// Path of the ephemeral nodes of running Bamboo instances
+func (zk Zookeeper) InstancesPath() string {
+	return zk.Path + "-instances"
+}
+
+// Path of the hosts excluded from all backends
+func (zk Zookeeper) HostsPath() string {
+	return zk.Path + "-hosts"
+}
+
+// Path of the tasks excluded from their backends
+func (zk Zookeeper) TasksPath() string {
+	return zk.Path + "-tasks"
+}
+
+// Path of the temporary server limit overrides
+func (zk Zookeeper) LimitsPath() string {
+	return zk.Path + "-limits"
+}
+
 func (zk Zookeeper) ConnectionString() []string {
 	return strings.Split(zk.Host, ",")
 }
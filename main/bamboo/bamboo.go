@@ -2,13 +2,15 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
-	"os/signal"
 	"path"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"syscall"
 	"time"
@@ -19,91 +21,519 @@ import (
 	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/zenazn/goji"
 	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/zenazn/goji/bind"
 	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/zenazn/goji/graceful"
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/zenazn/goji/web"
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/zenazn/goji/web/middleware"
 	"github.com/QubitProducts/bamboo/api"
 	"github.com/QubitProducts/bamboo/configuration"
 	"github.com/QubitProducts/bamboo/qzk"
+	"github.com/QubitProducts/bamboo/services/archive"
+	"github.com/QubitProducts/bamboo/services/capture"
+	"github.com/QubitProducts/bamboo/services/consul"
+	"github.com/QubitProducts/bamboo/services/dns"
+	"github.com/QubitProducts/bamboo/services/doctor"
 	"github.com/QubitProducts/bamboo/services/event_bus"
+	"github.com/QubitProducts/bamboo/services/exclusion"
+	"github.com/QubitProducts/bamboo/services/features"
+	"github.com/QubitProducts/bamboo/services/haproxy"
+	"github.com/QubitProducts/bamboo/services/history"
+	"github.com/QubitProducts/bamboo/services/instance"
+	"github.com/QubitProducts/bamboo/services/jwt"
+	"github.com/QubitProducts/bamboo/services/limits"
+	"github.com/QubitProducts/bamboo/services/logging"
+	"github.com/QubitProducts/bamboo/services/marathon"
+	"github.com/QubitProducts/bamboo/services/metrics"
+	"github.com/QubitProducts/bamboo/services/notify"
+	"github.com/QubitProducts/bamboo/services/pid1"
+	"github.com/QubitProducts/bamboo/services/policy"
+	"github.com/QubitProducts/bamboo/services/server"
+	"github.com/QubitProducts/bamboo/services/service"
+	"github.com/QubitProducts/bamboo/services/state"
+	"github.com/QubitProducts/bamboo/services/template"
+	"github.com/QubitProducts/bamboo/services/usage"
 )
 
 /*
 	Commandline arguments
 */
 var configFilePath string
+var overlayFilePaths overlayFlag
 var logPath string
+var noReload bool
+var bootstrapPath string
+
+// Repeatable -overlay flag, applied in the given order
+type overlayFlag []string
+
+func (o *overlayFlag) String() string {
+	return strings.Join(*o, ",")
+}
+
+func (o *overlayFlag) Set(value string) error {
+	*o = append(*o, value)
+	return nil
+}
 
 func init() {
 	flag.StringVar(&configFilePath, "config", "config/development.json", "Full path of the configuration JSON file")
+	flag.Var(&overlayFilePaths, "overlay", "Configuration JSON file merged over -config, e.g. per environment; repeatable")
 	flag.StringVar(&logPath, "log", "", "Log path to a file. Default logs to stdout")
+	flag.BoolVar(&noReload, "no-reload", false, "Render and write the configuration to HAProxy.ShadowOutputPath without reloading HAProxy")
+	flag.StringVar(&bootstrapPath, "bootstrap", "", "Services JSON file stored on start when Zookeeper holds no service yet")
 }
 
 func main() {
 	flag.Parse()
+
+	// As the entrypoint of a container Bamboo runs itself under an init
+	if pid1.Required() {
+		os.Exit(pid1.Run())
+	}
+
 	configureLog()
 
+	// bamboo [-config path] doctor
+	if flag.Arg(0) == "doctor" {
+		runDoctor()
+		return
+	}
+
+	// bamboo [-config path] agent
+	if flag.Arg(0) == "agent" {
+		runAgent()
+		return
+	}
+
+	// bamboo [-config path] replay recording [output directory]
+	if flag.Arg(0) == "replay" {
+		runReplay(flag.Arg(1), flag.Arg(2))
+		return
+	}
+
 	// Load configuration
-	conf, err := configuration.FromFile(configFilePath)
+	conf, err := configuration.FromFiles(configFilePath, overlayFilePaths...)
 	if err != nil {
 		log.Fatal(err)
 	}
+	logging.Configure(conf.Logging)
+	if noReload {
+		conf.HAProxy.NoReload = true
+	}
+	if err := conf.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	features.Configure(conf.Features)
+	if conf.HAProxy.NoReload {
+		log.Printf("No-reload mode: writing configuration to %s, HAProxy is never reloaded", conf.HAProxy.ShadowOutputPath)
+	}
 
-	eventBus := event_bus.New()
+	// Detect installed HAProxy version and its available features
+	err = haproxy.CheckVersion(conf.HAProxy)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// Wait for died children to avoid zombies
-	signalChannel := make(chan os.Signal, 2)
-	signal.Notify(signalChannel, os.Interrupt, syscall.SIGCHLD)
-	go func() {
-		for {
-			sig := <-signalChannel
-			if sig == syscall.SIGCHLD {
-				r := syscall.Rusage{}
-				syscall.Wait4(-1, nil, 0, &r)
-			}
+	err = haproxy.ValidateNaming(conf.HAProxy.Naming)
+	if err != nil {
+		log.Fatalf("Invalid HAProxy naming scheme: %s", err)
+	}
+
+	// A broken template would otherwise only surface on the first event
+	if status := template.CheckTemplate(conf.HAProxy.TemplatePath); !status.Valid {
+		if !conf.HAProxy.StartOnTemplateError {
+			log.Fatalf("Invalid template %s: %s", status.Path, status.Error)
 		}
-	}()
+		log.Printf("Starting degraded, the HAProxy configuration is not updated until the template %s parses: %s", status.Path, status.Error)
+	}
+
+	for _, agent := range conf.HAProxy.Spoe.Agents {
+		if err := agent.Validate(); err != nil {
+			log.Fatalf("Invalid SPOE agent: %s", err)
+		}
+	}
+
+	eventBus := event_bus.New()
 
 	// Create StatsD client
 	conf.StatsD.CreateClient()
 
+	// Record the responses of state fetches for replay
+	if conf.Capture.Enabled() {
+		recording, err := capture.Record(conf.Capture.Directory, conf.Capture.MaxRenders)
+		if err != nil {
+			log.Fatalf("Unable to record state fetches: %s", err)
+		}
+		log.Printf("Recording state fetches to %s", recording)
+	}
+
 	// Create Zookeeper connection
 	zkConn := listenToZookeeper(conf, eventBus)
 
+	// Seed the services of a fresh environment
+	if len(bootstrapPath) > 0 {
+		bootstrapServices(&conf, zkConn, bootstrapPath)
+	}
+
+	// Remove expired and purged services, expired task exclusions and
+	// limit overrides from Zookeeper, which a shadow Bamboo leaves to
+	// the active one
+	if !conf.HAProxy.NoReload {
+		go service.RunCleanup(zkConn, conf.Bamboo.Zookeeper)
+		go exclusion.RunCleanup(zkConn, conf.Bamboo.Zookeeper)
+		go limits.RunCleanup(zkConn, conf.Bamboo.Zookeeper)
+	}
+
+	// Upload the service policies to the OPA server evaluating them
+	if conf.Bamboo.Policy.Loads() {
+		go policy.NewLoader(conf.Bamboo.Policy).Run()
+	}
+
+	// Tracks the revision of the state rendered into the template
+	stateTracker := state.NewTracker()
+
+	// Upload state snapshots to object storage
+	if conf.Archive.Enabled {
+		go archive.NewArchiver(&conf, stateTracker).Run()
+	}
+
+	// Adjust server weights from response times and error rates
+	if conf.HAProxy.AdaptiveWeights.Enabled {
+		if len(conf.HAProxy.RuntimeSocket) == 0 {
+			log.Fatalf("HAProxy.AdaptiveWeights requires HAProxy.RuntimeSocket")
+		}
+		go haproxy.NewWeightTuner(&conf).Run()
+	}
+
+	// Aggregate traffic usage per backend
+	var usageRecorder *usage.Recorder
+	if conf.HAProxy.Usage.Enabled {
+		if len(conf.HAProxy.RuntimeSocket) == 0 {
+			log.Fatalf("HAProxy.Usage requires HAProxy.RuntimeSocket")
+		}
+		usageRecorder = usage.NewRecorder(&conf)
+		go usageRecorder.Run()
+	}
+
+	// Log backend membership changes
+	var historyRecorder *history.Recorder
+	if conf.HAProxy.History.Enabled {
+		historyRecorder = history.NewRecorder(&conf)
+		if err := historyRecorder.Load(); err != nil {
+			log.Printf("Unable to load backend history: %s\n", err)
+		}
+	}
+
+	// Publish the status of this instance to Zookeeper
+	instances := instance.NewRegistry(zkConn, &conf)
+	err = instances.Register()
+	if err != nil {
+		log.Printf("Unable to register instance in Zookeeper: %s", err)
+	}
+
+	// Publish service hostnames to an external DNS
+	var dnsPublisher *dns.Publisher
+	if conf.DNS.Enabled() {
+		dnsPublisher, err = dns.NewPublisher(conf.DNS)
+		if err != nil {
+			log.Fatalf("Unable to publish to DNS: %s", err)
+		}
+	}
+
+	// Register rendered frontends in Consul
+	var consulRegistrar *consul.Registrar
+	if conf.Consul.Enabled() {
+		consulRegistrar = consul.NewRegistrar(conf.Consul)
+	}
+
+	// Apply configurations with the configured reload strategy
+	reloader, err := haproxy.NewReloader(conf.HAProxy)
+	if err != nil && !conf.HAProxy.NoReload {
+		log.Fatalf("Invalid reload strategy: %s", err)
+	}
+	// a configuration left unchanged by the first render is not reloaded
+	if err := haproxy.StartSupervised(); err != nil {
+		log.Printf("Unable to start the supervised HAProxy with the written configuration: %s", err)
+	}
+
+	// Tell service owners about changes and failures affecting them
+	notifications := notify.NewDispatcher(&conf)
+
 	// Register handlers
-	handlers := event_bus.Handlers{Conf: &conf, Zookeeper: zkConn}
+	handlers := event_bus.Handlers{Conf: &conf, Zookeeper: zkConn, State: stateTracker, Instances: instances, DNS: dnsPublisher, Consul: consulRegistrar, Reloader: reloader, Notifications: notifications, ValidationHook: haproxy.NewValidationHook(conf.HAProxy.ValidationHook), History: historyRecorder}
+	if conf.StatsD.AppMetrics.Enabled {
+		handlers.AppMetrics = metrics.NewGuard(conf.StatsD.AppMetrics)
+	}
 	eventBus.Register(handlers.MarathonEventHandler)
 	eventBus.Register(handlers.ServiceEventHandler)
+	jwt.OnChange(handlers.JwtKeysHandler)
 	eventBus.Publish(event_bus.MarathonEvent { EventType: "bamboo_startup", Timestamp: time.Now().Format(time.RFC3339) })
 
 	// Start server
-	initServer(&conf, zkConn, eventBus)
+	initServer(&conf, zkConn, eventBus, stateTracker, usageRecorder, historyRecorder, notifications)
 }
 
-func initServer(conf *configuration.Configuration, conn *zk.Conn, eventBus *event_bus.EventBus) {
-	stateAPI := api.StateAPI{Config: conf, Zookeeper: conn}
-	serviceAPI := api.ServiceAPI{Config: conf, Zookeeper: conn}
+/*
+	Stores the services of the bootstrap file unless Zookeeper already
+	holds services. An invalid file stops Bamboo, which would otherwise
+	start without the expected routes.
+*/
+func bootstrapServices(conf *configuration.Configuration, conn *zk.Conn, path string) {
+	services, err := service.ReadBootstrap(path)
+	if err != nil {
+		log.Fatalf("Invalid bootstrap file %s: %s", path, err)
+	}
+	byId := map[string]service.Service{}
+	for _, serviceModel := range services {
+		byId[serviceModel.Id] = serviceModel
+	}
+	for _, conflict := range service.Conflicts(byId) {
+		log.Printf("Bootstrap file %s: %s\n", path, conflict.Reason)
+	}
+
+	created, err := service.Bootstrap(conn, conf.Bamboo.Zookeeper, services)
+	if err != nil {
+		log.Fatalf("Unable to bootstrap services from %s: %s", path, err)
+	}
+	if created == 0 {
+		log.Printf("Services already stored, bootstrap file %s ignored\n", path)
+		return
+	}
+	log.Printf("Bootstrapped %d of %d services from %s\n", created, len(services), path)
+}
+
+func runDoctor() {
+	report := doctor.Run(configFilePath, overlayFilePaths...)
+	report.Print(os.Stdout)
+	if !report.Ok() {
+		os.Exit(1)
+	}
+}
+
+/*
+	Renders the template once for every recorded Marathon fetch of a
+	recording, writing the configurations to the output directory
+*/
+func runReplay(recording string, output string) {
+	if len(recording) == 0 {
+		log.Fatal("Usage: bamboo [-config path] replay recording [output directory]")
+	}
+	if len(output) == 0 {
+		output = filepath.Join(recording, "rendered")
+	}
+	conf, err := configuration.FromFiles(configFilePath, overlayFilePaths...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	templateContent, err := ioutil.ReadFile(conf.HAProxy.TemplatePath)
+	if err != nil {
+		log.Fatalf("Unable to read template: %s", err)
+	}
+	if err := os.MkdirAll(output, 0755); err != nil {
+		log.Fatal(err)
+	}
+
+	fetches := capture.Recorded(recording, "marathon")
+	if fetches == 0 {
+		log.Fatalf("No recorded Marathon responses in %s", recording)
+	}
+	capture.Replay(recording)
+	tracker := state.NewTracker()
+	failed := 0
+	for i := 1; i <= fetches; i++ {
+		data := haproxy.GetRenderData(&conf, nil, capture.NewRender())
+		data.Revision, _ = tracker.Update(data)
+		data.LuaScripts, _ = haproxy.ReadLuaScripts(conf.HAProxy.Lua)
+		rendered, err := template.RenderTemplate(conf.HAProxy.TemplatePath, string(templateContent), data)
+		if err != nil {
+			log.Printf("Fetch %d: unable to render template: %s", i, err)
+			failed++
+			continue
+		}
+		path := filepath.Join(output, fmt.Sprintf("haproxy-%06d.cfg", i))
+		if err := ioutil.WriteFile(path, []byte(rendered), 0644); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Fetch %d: rendered revision %d to %s", i, data.Revision, path)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+/*
+	Serves the agent endpoint only, applying configurations pushed by a
+	central Bamboo with the reload strategy of this configuration
+*/
+func runAgent() {
+	conf, err := configuration.FromFiles(configFilePath, overlayFilePaths...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logging.Configure(conf.Logging)
+	if conf.HAProxy.Reload.Strategy == "remote" {
+		log.Fatalf("Agents can not use the remote reload strategy")
+	}
+	if len(conf.HAProxy.Remote.Token) == 0 {
+		log.Fatalf("Agents require HAProxy.Remote.Token (or HAPROXY_REMOTE_TOKEN)")
+	}
+	reloader, err := haproxy.NewReloader(conf.HAProxy)
+	if err != nil {
+		log.Fatalf("Invalid reload strategy: %s", err)
+	}
+	conf.StatsD.CreateClient()
+
+	agentAPI := &api.AgentAPI{Config: &conf, Reloader: reloader}
+	goji.Use(api.Correlation)
+	goji.Get("/status", api.HandleStatus)
+	goji.Get("/api/internal/stats", api.HandleInternalStats)
+	goji.Put("/api/agent/config", agentAPI.PutConfig)
+	log.Printf("Agent writing pushed configurations to %s\n", conf.HAProxy.OutputPath)
+	serve(&conf)
+}
+
+func initServer(conf *configuration.Configuration, conn *zk.Conn, eventBus *event_bus.EventBus, stateTracker *state.Tracker, usageRecorder *usage.Recorder, historyRecorder *history.Recorder, notifications *notify.Dispatcher) {
+	stateAPI := api.StateAPI{Config: conf, Zookeeper: conn, State: stateTracker}
+	statuszAPI := api.StatuszAPI{Config: conf, Zookeeper: conn, State: stateTracker}
+	serviceAPI := api.ServiceAPI{Config: conf, Zookeeper: conn, State: stateTracker, Notifications: notifications}
+	previewAPI := api.PreviewAPI{Config: conf, Zookeeper: conn}
+	mappingAPI := api.MappingAPI{Config: conf, Zookeeper: conn}
+	routesAPI := api.RoutesAPI{Config: conf, Zookeeper: conn}
+	domainAPI := api.DomainAPI{Config: conf, Zookeeper: conn}
+	templateAPI := api.TemplateAPI{Config: conf, Zookeeper: conn, State: stateTracker}
+	haproxyAPI := api.HAProxyAPI{Config: conf, Zookeeper: conn}
+	instanceAPI := api.InstanceAPI{Config: conf, Zookeeper: conn}
+	hostAPI := api.HostAPI{Config: conf, Zookeeper: conn}
+	taskAPI := api.TaskAPI{Config: conf, Zookeeper: conn}
+	limitAPI := api.LimitAPI{Config: conf, Zookeeper: conn}
+	stickTableAPI := api.StickTableAPI{Config: conf, Zookeeper: conn}
+	usageAPI := api.UsageAPI{Config: conf, Recorder: usageRecorder}
+	historyAPI := api.HistoryAPI{Config: conf, Recorder: historyRecorder}
+	sloAPI := api.SloAPI{Config: conf, Zookeeper: conn}
+	adminAPI := api.AdminAPI{Config: conf}
+	featureAPI := api.FeatureAPI{Config: conf}
 	eventSubAPI := api.EventSubscriptionAPI{Conf: conf, EventBus: eventBus}
 
 	conf.StatsD.Increment(1.0, "restart", 1)
+
+	// Versioned API paths, errors referring to the logged request id
+	goji.Use(api.APIVersion(conf))
+	goji.Use(api.Correlation)
+
+	// Mutating and admin endpoints, only served on Bamboo.AdminBind when set
+	admin := goji.DefaultMux
+	if len(conf.Bamboo.AdminBind) > 0 {
+		admin = web.New()
+		admin.Use(middleware.RequestID)
+		admin.Use(middleware.Logger)
+		admin.Use(middleware.Recoverer)
+		admin.Use(api.APIVersion(conf))
+		admin.Use(api.Correlation)
+	}
+
 	// Status live information
 	goji.Get("/status", api.HandleStatus)
+	goji.Get("/statusz", statuszAPI.Get)
+	goji.Get("/api/internal/stats", api.HandleInternalStats)
 
 	// State API
 	goji.Get("/api/state", stateAPI.Get)
+	goji.Get("/api/changes", stateAPI.Changes)
+	goji.Get("/api/reloads", stateAPI.Reloads)
+	goji.Get("/api/view", stateAPI.View)
+	goji.Get("/api/mapping", mappingAPI.Get)
+	goji.Get("/api/routes", routesAPI.Get)
+	goji.Get("/api/debug/route", routesAPI.Debug)
+	goji.Get("/api/domains", domainAPI.All)
+	goji.Get("/api/slos", sloAPI.Get)
+	goji.Get("/api/instances", instanceAPI.All)
+
+	// HAProxy API
+	goji.Get("/api/haproxy/config", haproxyAPI.GetConfig)
+	goji.Get("/api/shadow/diff", haproxyAPI.ShadowDiff)
+	goji.Get("/api/haproxy/sticktables", stickTableAPI.Get)
+	goji.Get("/api/usage", usageAPI.Get)
+	goji.Get("/api/history/backends", historyAPI.Backends)
+	goji.Get("/api/haproxy/remote", haproxyAPI.Remote)
+	goji.Get("/api/haproxy/process", haproxyAPI.Process)
+
+	// Template API
+	goji.Post("/api/template/preview", templateAPI.Preview)
+	goji.Get("/api/template/data", templateAPI.Data)
 
 	// Service API
 	goji.Get("/api/services", serviceAPI.All)
-	goji.Post("/api/services", serviceAPI.Create)
-	goji.Put("/api/services/:id", serviceAPI.Put)
-	goji.Delete("/api/services/:id", serviceAPI.Delete)
-	goji.Post("/api/marathon/event_callback", eventSubAPI.Callback)
+	goji.Get("/api/services/deleted", serviceAPI.Deleted)
+	goji.Post(regexp.MustCompile(`^/api/services:validate$`), serviceAPI.Validate)
+	admin.Post("/api/services", serviceAPI.Create)
+	admin.Put("/api/services/:id", serviceAPI.Put)
+	admin.Delete("/api/services/:id", serviceAPI.Delete)
+	admin.Post("/api/services/:id/restore", serviceAPI.Restore)
+	goji.Get("/api/conflicts", serviceAPI.Conflicts)
+	goji.Get("/api/previews", previewAPI.All)
+	admin.Post("/api/previews", previewAPI.Register)
+	admin.Delete("/api/previews/:branch", previewAPI.Delete)
+
+	// Host API
+	goji.Get("/api/hosts", hostAPI.All)
+	admin.Post("/api/hosts/:host/disable", hostAPI.Disable)
+	admin.Post("/api/hosts/:host/enable", hostAPI.Enable)
+
+	// Task API
+	goji.Get("/api/tasks/excluded", taskAPI.Excluded)
+	admin.Post("/api/tasks/:id/exclude", taskAPI.Exclude)
+	admin.Post("/api/tasks/:id/include", taskAPI.Include)
+
+	// Limit API
+	goji.Get("/api/limits", limitAPI.All)
+	admin.Put("/api/limits/:id", limitAPI.Set)
+	admin.Delete("/api/limits/:id", limitAPI.Clear)
+	goji.Post(marathon.CallbackPath, eventSubAPI.Callback)
+
+	// Admin API
+	admin.Get("/api/admin/config", adminAPI.GetConfig)
+	goji.Get("/api/features", featureAPI.All)
+	admin.Put("/api/features/:name", featureAPI.Set)
+
+	// Fault injection API, only for resilience testing
+	if conf.FaultInjection.Enabled {
+		log.Println("Fault injection enabled")
+		faultAPI := api.FaultAPI{Config: conf}
+		admin.Get("/api/faults", faultAPI.Get)
+		admin.Put("/api/faults", faultAPI.Set)
+		admin.Delete("/api/faults", faultAPI.Clear)
+	}
 
 	// Static pages
 	goji.Get("/*", http.FileServer(http.Dir(path.Join(executableFolder(), "webapp"))))
 
-	registerMarathonEvent(conf)
+	subscriptions, err := marathon.NewSubscriptionClient(conf.Marathon.EventSubscription)
+	if err != nil {
+		log.Fatalf("Invalid Marathon.EventSubscription settings: %s", err)
+	}
+	registerMarathonEvent(conf, subscriptions)
+	go marathon.MonitorSubscription(conf, subscriptions, conf.Marathon.SubscriptionCheckIntervalDuration())
 
+	if admin != goji.DefaultMux {
+		serveAdmin(conf, admin)
+	}
 	serve(conf)
 }
 
+/*
+	Serves the admin endpoints on their own listener, falling back to
+	the public endpoints so that the webapp works in full there
+*/
+func serveAdmin(conf *configuration.Configuration, admin *web.Mux) {
+	admin.Handle("/*", goji.DefaultMux)
+	admin.Compile()
+	listener := bind.Socket(conf.Bamboo.AdminBind)
+	log.Println("Serving the admin API on", listener.Addr())
+	go func() {
+		if err := server.Serve(listener, admin, conf.Bamboo.Server); err != nil {
+			log.Fatal(err)
+		}
+	}()
+}
+
 // Get current executable folder path
 func executableFolder() string {
 	folderPath, err := osext.ExecutableFolder()
@@ -113,27 +543,15 @@ func executableFolder() string {
 	return folderPath
 }
 
-func registerMarathonEvent(conf *configuration.Configuration) {
-
-	client := &http.Client{}
+func registerMarathonEvent(conf *configuration.Configuration, client *marathon.SubscriptionClient) {
 	// it's safe to register with multiple marathon nodes
-	for _, marathon := range conf.Marathon.Endpoints() {
-		url := marathon + "/v2/eventSubscriptions?callbackUrl=" + conf.Bamboo.Endpoint + "/api/marathon/event_callback"
-		req, _ := http.NewRequest("POST", url, nil)
-		req.Header.Add("Content-Type", "application/json")
-		resp, err := client.Do(req)
+	for _, endpoint := range conf.Marathon.Endpoints() {
+		body, err := client.Subscribe(endpoint, conf.Bamboo.Endpoint+marathon.CallbackPath)
 		if err != nil {
 			errorMsg := "An error occurred while accessing Marathon callback system: %s\n"
 			log.Printf(errorMsg, err)
 			return
 		}
-		bodyBytes, err := ioutil.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			log.Fatal(err)
-			return
-		}
-		body := string(bodyBytes)
 		if strings.HasPrefix(body, "{\"message") {
 			warningMsg := "Access to the callback system of Marathon seems to be failed, response: %s\n"
 			log.Printf(warningMsg, body)
@@ -154,12 +572,21 @@ func createAndListen(conf configuration.Zookeeper) (chan zk.Event, *zk.Conn) {
 
 func listenToZookeeper(conf configuration.Configuration, eventBus *event_bus.EventBus) *zk.Conn {
 	serviceCh, serviceConn := createAndListen(conf.Bamboo.Zookeeper)
+	hostsCh, _ := qzk.ListenToConn(serviceConn, conf.Bamboo.Zookeeper.HostsPath(), true, conf.Bamboo.Zookeeper.Delay())
+	tasksCh, _ := qzk.ListenToConn(serviceConn, conf.Bamboo.Zookeeper.TasksPath(), true, conf.Bamboo.Zookeeper.Delay())
+	limitsCh, _ := qzk.ListenToConn(serviceConn, conf.Bamboo.Zookeeper.LimitsPath(), true, conf.Bamboo.Zookeeper.Delay())
 
 	go func() {
 		for {
 			select {
 			case _ = <-serviceCh:
 				eventBus.Publish(event_bus.ServiceEvent{EventType: "change"})
+			case _ = <-hostsCh:
+				eventBus.Publish(event_bus.ServiceEvent{EventType: "hosts"})
+			case _ = <-tasksCh:
+				eventBus.Publish(event_bus.ServiceEvent{EventType: "tasks"})
+			case _ = <-limitsCh:
+				eventBus.Publish(event_bus.ServiceEvent{EventType: "limits"})
 			}
 		}
 	}()
@@ -185,10 +612,14 @@ func serve(conf *configuration.Configuration){
 	listener := bind.Socket(conf.Bamboo.Bind)
 	log.Println("Starting Bamboo backend listen on", listener.Addr())
 	graceful.HandleSignals()
+	// sent by container runtimes to stop
+	graceful.AddSignal(syscall.SIGTERM)
 	bind.Ready()
 	graceful.PreHook(func() { log.Printf("Goji received signal, gracefully stopping") })
 	graceful.PostHook(func() { log.Printf("Goji stopped") })
-	err := graceful.Serve(listener, http.DefaultServeMux)
+	// HAProxy supervised by Bamboo stops once requests to Bamboo completed
+	graceful.PostHook(haproxy.StopSupervised)
+	err := server.Serve(listener, http.DefaultServeMux, conf.Bamboo.Server)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/samuel/go-zookeeper/zk"
@@ -13,6 +14,25 @@ import (
 
 var logger = log.New(os.Stdout, "", log.Ldate|log.Ltime|log.Lshortfile)
 
+// Watches set again after they fired, and failures to
+var watchesReestablished, watchesFailed int64
+
+/*
+	Returns how many watches were set again after they fired and how
+	many could not be
+*/
+func Watches() (int64, int64) {
+	return atomic.LoadInt64(&watchesReestablished), atomic.LoadInt64(&watchesFailed)
+}
+
+func countWatch(err error) {
+	if err != nil {
+		atomic.AddInt64(&watchesFailed, 1)
+	} else {
+		atomic.AddInt64(&watchesReestablished, 1)
+	}
+}
+
 func pollZooKeeper(conn *zk.Conn, path string, evts chan zk.Event, quit chan bool) {
 
 	children, _, err := conn.Children(path)
@@ -90,6 +110,7 @@ func sinkSelfEvents(conn *zk.Conn, path string, sink chan<- zk.Event) chan<- boo
 			case ev := <-selfCh:
 				sink <- ev
 				_, _, selfCh, err = conn.GetW(path)
+				countWatch(err)
 				if err != nil {
 					logger.Printf("failed to set listener on path: %s\n", err.Error())
 				}
@@ -114,6 +135,7 @@ func sinkChildEvents(conn *zk.Conn, path string, sink chan<- zk.Event) chan<- bo
 			case ev := <-selfCh:
 				sink <- ev
 				_, _, selfCh, err = conn.ChildrenW(path)
+				countWatch(err)
 				if err != nil {
 					logger.Panic("failed to set listener on path")
 				}
@@ -0,0 +1,170 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/haproxy"
+	"github.com/QubitProducts/bamboo/services/state"
+)
+
+const keyTimeFormat = "20060102T150405Z"
+
+// Object storage holding the snapshots
+type Store interface {
+	Put(key string, content []byte) error
+	List(prefix string) ([]string, error)
+	Delete(key string) error
+}
+
+// Contents of state.json in a snapshot
+type Snapshot struct {
+	Revision   int64
+	Archived   time.Time
+	State      haproxy.TemplateData
+	LastReload *state.Reload
+}
+
+/*
+	Uploads the tracked state and the rendered configuration as
+	gzipped tar archives and deletes snapshots past the retention
+*/
+type Archiver struct {
+	Store  Store
+	Config *conf.Configuration
+	State  *state.Tracker
+
+	// Revision and configuration hash of the latest upload
+	revision   int64
+	configHash string
+}
+
+func NewArchiver(config *conf.Configuration, tracker *state.Tracker) *Archiver {
+	store := &S3Store{
+		Endpoint:  config.Archive.EndpointURL(),
+		Region:    config.Archive.SigningRegion(),
+		Bucket:    config.Archive.Bucket,
+		AccessKey: config.Archive.AccessKey,
+		SecretKey: config.Archive.SecretKey,
+		Client:    &http.Client{Timeout: time.Minute},
+	}
+	return &Archiver{Store: store, Config: config, State: tracker}
+}
+
+// Archives every interval, never returns
+func (a *Archiver) Run() {
+	for {
+		time.Sleep(a.Config.Archive.IntervalDuration())
+		if err := a.Archive(time.Now()); err != nil {
+			log.Printf("Unable to archive state snapshot: %s\n", err)
+			a.Config.StatsD.Increment(1.0, "archive.failed", 1)
+		}
+	}
+}
+
+/*
+	Uploads a snapshot unless neither the state nor the configuration
+	changed since the previous one, then applies the retention
+*/
+func (a *Archiver) Archive(now time.Time) error {
+	revision, data := a.State.Data()
+	config, err := ioutil.ReadFile(a.Config.HAProxy.EffectiveOutputPath())
+	if err != nil {
+		return err
+	}
+	configHash := state.HashConfig(string(config))
+
+	if revision != a.revision || configHash != a.configHash {
+		snapshot := Snapshot{Revision: revision, Archived: now, State: data, LastReload: a.State.LastReload()}
+		content, err := compress(snapshot, config)
+		if err != nil {
+			return err
+		}
+
+		key := snapshotKey(a.Config.Archive.Prefix, revision, now)
+		if err := a.Store.Put(key, content); err != nil {
+			return err
+		}
+		a.revision, a.configHash = revision, configHash
+		a.Config.StatsD.Increment(1.0, "archive.uploaded", 1)
+		log.Printf("Archived revision %d to %s\n", revision, key)
+	}
+
+	if a.Config.Archive.RetentionDays <= 0 {
+		return nil
+	}
+	keys, err := a.Store.List(a.Config.Archive.Prefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range expiredKeys(keys, now.Add(-a.Config.Archive.Retention())) {
+		if err := a.Store.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Snapshots are grouped by day, e.g. bamboo/2016/05/24/20160524T120000Z-r42.tar.gz
+func snapshotKey(prefix string, revision int64, at time.Time) string {
+	at = at.UTC()
+	return fmt.Sprintf("%s%s/%s-r%d.tar.gz", prefix, at.Format("2006/01/02"), at.Format(keyTimeFormat), revision)
+}
+
+// Snapshot keys archived before the cutoff, other keys are kept
+func expiredKeys(keys []string, cutoff time.Time) []string {
+	expired := []string{}
+	for _, key := range keys {
+		name := path.Base(key)
+		if !strings.HasSuffix(name, ".tar.gz") || len(name) < len(keyTimeFormat) {
+			continue
+		}
+		archived, err := time.Parse(keyTimeFormat, name[:len(keyTimeFormat)])
+		if err == nil && archived.Before(cutoff) {
+			expired = append(expired, key)
+		}
+	}
+	return expired
+}
+
+func compress(snapshot Snapshot, config []byte) ([]byte, error) {
+	stateContent, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := new(bytes.Buffer)
+	zipper := gzip.NewWriter(buffer)
+	archive := tar.NewWriter(zipper)
+	files := []struct {
+		name    string
+		content []byte
+	}{{"state.json", stateContent}, {"haproxy.cfg", config}}
+
+	for _, file := range files {
+		header := &tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.content)), ModTime: snapshot.Archived}
+		if err := archive.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := archive.Write(file.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	if err := zipper.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,29 @@
+package archive
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestSnapshotKeys(t *testing.T) {
+	Convey("#snapshotKey", t, func() {
+		Convey("should group snapshots by day", func() {
+			key := snapshotKey("bamboo/", 42, time.Date(2016, 5, 24, 12, 0, 0, 0, time.UTC))
+			So(key, ShouldEqual, "bamboo/2016/05/24/20160524T120000Z-r42.tar.gz")
+		})
+	})
+
+	Convey("#expiredKeys", t, func() {
+		Convey("should return snapshots archived before the cutoff", func() {
+			keys := []string{
+				"bamboo/2016/05/20/20160520T120000Z-r40.tar.gz",
+				"bamboo/2016/05/24/20160524T120000Z-r42.tar.gz",
+				"bamboo/README",
+			}
+			expired := expiredKeys(keys, time.Date(2016, 5, 22, 0, 0, 0, 0, time.UTC))
+			So(expired, ShouldResemble, []string{"bamboo/2016/05/20/20160520T120000Z-r40.tar.gz"})
+		})
+	})
+}
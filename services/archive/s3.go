@@ -0,0 +1,112 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/QubitProducts/bamboo/services/sigv4"
+)
+
+/*
+	Object store speaking the S3 API with path style URLs and AWS
+	signature version 4, which Google Cloud Storage accepts as well
+*/
+type S3Store struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Client    *http.Client
+}
+
+func (s *S3Store) Put(key string, content []byte) error {
+	response, err := s.do("PUT", "/"+key, nil, content)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
+
+func (s *S3Store) Delete(key string) error {
+	response, err := s.do("DELETE", "/"+key, nil, nil)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func (s *S3Store) List(prefix string) ([]string, error) {
+	keys := []string{}
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		response, err := s.do("GET", "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(response.Body).Decode(&result)
+		response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Contents {
+			keys = append(keys, object.Key)
+		}
+		if !result.IsTruncated {
+			return keys, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+// Sends a signed request for the object path, failing on error statuses
+func (s *S3Store) do(method string, objectPath string, query url.Values, content []byte) (*http.Response, error) {
+	target := strings.TrimSuffix(s.Endpoint, "/") + "/" + s.Bucket + sigv4.EncodePath(objectPath)
+	if len(query) > 0 {
+		target += "?" + sigv4.EncodeQuery(query)
+	}
+
+	var body io.Reader
+	if content != nil {
+		body = bytes.NewReader(content)
+	}
+	request, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	sigv4.Sign(request, content, sigv4.Credentials{AccessKey: s.AccessKey, SecretKey: s.SecretKey}, s.Region, "s3", time.Now())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		response.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s %s", method, objectPath, response.Status, message)
+	}
+	return response, nil
+}
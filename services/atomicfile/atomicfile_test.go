@@ -0,0 +1,35 @@
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestWriteFile(t *testing.T) {
+	Convey("#WriteFile", t, func() {
+		dir, _ := ioutil.TempDir("", "bamboo-atomicfile")
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "state", "history.json")
+
+		Convey("should create the directory and write the content", func() {
+			So(WriteFile(path, []byte("first"), 0600), ShouldBeNil)
+			content, _ := ioutil.ReadFile(path)
+			So(string(content), ShouldEqual, "first")
+			info, _ := os.Stat(path)
+			So(info.Mode().Perm(), ShouldEqual, os.FileMode(0600))
+		})
+
+		Convey("should replace the content without leaving temporary files", func() {
+			WriteFile(path, []byte("first"), 0644)
+			So(WriteFile(path, []byte("second"), 0644), ShouldBeNil)
+			content, _ := ioutil.ReadFile(path)
+			So(string(content), ShouldEqual, "second")
+			files, _ := ioutil.ReadDir(filepath.Dir(path))
+			So(len(files), ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,212 @@
+package capture
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	lock      sync.Mutex
+	directory string
+	replaying bool
+	// Renders recorded or replayed so far
+	renders int
+	// Renders recorded before recording stops, 0 for no limit
+	maxRenders int
+)
+
+/*
+	State fetches of a render, recorded or replayed together under the
+	sequence number of the render. A nil Render fetches without
+	recording, as API reads do.
+*/
+type Render struct {
+	Sequence int
+	dir      string
+	replay   bool
+}
+
+/*
+	Records the fetches of every following render to a new directory
+	below the given one, named after the current time, and returns it.
+	Recording stops after max renders, unless max is 0.
+*/
+func Record(parent string, max int) (string, error) {
+	recording := filepath.Join(parent, time.Now().UTC().Format("20060102T150405Z"))
+	if err := os.MkdirAll(recording, 0755); err != nil {
+		return "", err
+	}
+	start(recording, false, max)
+	return recording, nil
+}
+
+/*
+	Replays the fetches recorded to a directory: the fetches of the n-th
+	render return the responses recorded by the n-th recorded render
+	without fetching anything
+*/
+func Replay(recording string) {
+	start(recording, true, 0)
+}
+
+// Stops recording or replaying
+func Stop() {
+	start("", false, 0)
+}
+
+func start(dir string, replay bool, max int) {
+	lock.Lock()
+	defer lock.Unlock()
+	directory = dir
+	replaying = replay
+	renders = 0
+	maxRenders = max
+}
+
+/*
+	Starts the fetches of a render, returning nil when neither recording
+	nor replaying, or once the recording is full
+*/
+func NewRender() *Render {
+	lock.Lock()
+	defer lock.Unlock()
+	if len(directory) == 0 {
+		return nil
+	}
+	if !replaying && maxRenders > 0 && renders >= maxRenders {
+		if renders == maxRenders {
+			log.Printf("Recorded %d renders to %s, recording stopped\n", maxRenders, directory)
+			renders++
+		}
+		return nil
+	}
+	renders++
+	return &Render{Sequence: renders, dir: directory, replay: replaying}
+}
+
+/*
+	Fetches value from a source, e.g. "zookeeper-services". value must
+	be a pointer filled by fetch. While recording, the fetched value is
+	written as JSON, or the error when the fetch failed; while
+	replaying, the recorded one is returned instead and fetch is not
+	called.
+*/
+func (r *Render) Fetch(source string, value interface{}, fetch func() error) error {
+	bodies, err := r.FetchBodies(source, func() (map[string][]byte, error) {
+		if err := fetch(); err != nil {
+			return nil, err
+		}
+		body, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		return map[string][]byte{"": body}, nil
+	})
+	if err != nil || r == nil || !r.replay {
+		return err
+	}
+	return json.Unmarshal(bodies[""], value)
+}
+
+/*
+	Fetches the response bodies of a source, e.g. "marathon", by name.
+	While recording, every body is written as received, one file per
+	body, or the error when the fetch failed; while replaying, the
+	recorded bodies are returned instead and fetch is not called.
+*/
+func (r *Render) FetchBodies(source string, fetch func() (map[string][]byte, error)) (map[string][]byte, error) {
+	if r == nil {
+		return fetch()
+	}
+	if r.replay {
+		return replayFetch(r.dir, source, r.Sequence)
+	}
+
+	bodies, err := fetch()
+	if recordErr := recordFetch(r.dir, source, r.Sequence, bodies, err); recordErr != nil {
+		log.Printf("Unable to record %s response: %s\n", source, recordErr)
+	}
+	return bodies, err
+}
+
+/*
+	Returns the number of renders which recorded fetches of a source
+*/
+func Recorded(recording string, source string) int {
+	count := 0
+	for len(fetchPaths(recording, source, count+1)) > 0 {
+		count++
+	}
+	return count
+}
+
+// Prefix of the files of a fetch, followed by the body name if any
+func fetchPrefix(dir string, source string, sequence int) string {
+	return filepath.Join(dir, fmt.Sprintf("%s-%06d", source, sequence))
+}
+
+func fetchPaths(dir string, source string, sequence int) []string {
+	prefix := fetchPrefix(dir, source, sequence)
+	paths, _ := filepath.Glob(prefix + ".*")
+	return paths
+}
+
+// Path of a body, e.g. marathon-000042.tasks.json
+func bodyPath(dir string, source string, sequence int, name string) string {
+	if len(name) == 0 {
+		return fetchPrefix(dir, source, sequence) + ".json"
+	}
+	return fetchPrefix(dir, source, sequence) + "." + name + ".json"
+}
+
+func errorPath(dir string, source string, sequence int) string {
+	return fetchPrefix(dir, source, sequence) + ".error"
+}
+
+func recordFetch(dir string, source string, sequence int, bodies map[string][]byte, fetchErr error) error {
+	if fetchErr != nil {
+		return ioutil.WriteFile(errorPath(dir, source, sequence), []byte(fetchErr.Error()), 0644)
+	}
+	names := []string{}
+	for name := range bodies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := ioutil.WriteFile(bodyPath(dir, source, sequence, name), bodies[name], 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func replayFetch(dir string, source string, sequence int) (map[string][]byte, error) {
+	paths := fetchPaths(dir, source, sequence)
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no recorded %s response %d", source, sequence)
+	}
+	if fetchErr, err := ioutil.ReadFile(errorPath(dir, source, sequence)); err == nil {
+		return nil, errors.New(string(fetchErr))
+	}
+
+	prefix := filepath.Base(fetchPrefix(dir, source, sequence))
+	bodies := map[string][]byte{}
+	for _, path := range paths {
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), prefix), ".json")
+		body, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unreadable recorded %s response %d: %s", source, sequence, err)
+		}
+		bodies[strings.TrimPrefix(name, ".")] = body
+	}
+	return bodies, nil
+}
@@ -0,0 +1,110 @@
+package capture
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestCapture(t *testing.T) {
+	Convey("#Fetch", t, func() {
+		parent, _ := ioutil.TempDir("", "bamboo-capture")
+		defer os.RemoveAll(parent)
+		defer Stop()
+
+		recording, err := Record(parent, 0)
+		So(err, ShouldBeNil)
+
+		values := []string{"first", "second"}
+		for _, value := range values {
+			fetched := ""
+			NewRender().Fetch("source", &fetched, func() error {
+				fetched = value
+				return nil
+			})
+		}
+		NewRender().Fetch("source", new(string), func() error { return errors.New("unreachable") })
+		So(Recorded(recording, "source"), ShouldEqual, 3)
+
+		Convey("Should replay the recorded responses in order", func() {
+			Replay(recording)
+			for _, value := range values {
+				replayed := ""
+				err := NewRender().Fetch("source", &replayed, func() error { panic("fetched while replaying") })
+				So(err, ShouldBeNil)
+				So(replayed, ShouldEqual, value)
+			}
+			err := NewRender().Fetch("source", new(string), nil)
+			So(err.Error(), ShouldEqual, "unreachable")
+		})
+
+		Convey("Should fail once the recorded responses are exhausted", func() {
+			Replay(recording)
+			for i := 0; i < 3; i++ {
+				NewRender().Fetch("source", new(string), nil)
+			}
+			So(NewRender().Fetch("source", new(string), nil), ShouldNotBeNil)
+		})
+
+		Convey("Should not record fetches outside renders", func() {
+			var render *Render
+			fetched := ""
+			err := render.Fetch("source", &fetched, func() error {
+				fetched = "read"
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(fetched, ShouldEqual, "read")
+			So(Recorded(recording, "source"), ShouldEqual, 3)
+		})
+	})
+
+	Convey("#FetchBodies", t, func() {
+		parent, _ := ioutil.TempDir("", "bamboo-capture")
+		defer os.RemoveAll(parent)
+		defer Stop()
+
+		recording, _ := Record(parent, 0)
+		body := []byte("{\"apps\": [ ]}\n")
+		NewRender().FetchBodies("marathon", func() (map[string][]byte, error) {
+			return map[string][]byte{"apps": body, "tasks": []byte("{}")}, nil
+		})
+
+		Convey("Should record the bodies as received", func() {
+			recorded, err := ioutil.ReadFile(filepath.Join(recording, "marathon-000001.apps.json"))
+			So(err, ShouldBeNil)
+			So(string(recorded), ShouldEqual, string(body))
+		})
+
+		Convey("Should replay the bodies by name", func() {
+			Replay(recording)
+			bodies, err := NewRender().FetchBodies("marathon", nil)
+			So(err, ShouldBeNil)
+			So(string(bodies["apps"]), ShouldEqual, string(body))
+			So(string(bodies["tasks"]), ShouldEqual, "{}")
+		})
+	})
+
+	Convey("#NewRender", t, func() {
+		parent, _ := ioutil.TempDir("", "bamboo-capture")
+		defer os.RemoveAll(parent)
+		defer Stop()
+
+		Convey("Should not record when not started", func() {
+			So(NewRender(), ShouldBeNil)
+		})
+
+		Convey("Should stop recording after the maximum renders", func() {
+			recording, _ := Record(parent, 2)
+			for i := 0; i < 3; i++ {
+				NewRender().Fetch("source", new(string), func() error { return nil })
+			}
+			So(Recorded(recording, "source"), ShouldEqual, 2)
+			So(NewRender(), ShouldBeNil)
+		})
+	})
+}
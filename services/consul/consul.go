@@ -0,0 +1,227 @@
+package consul
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/marathon"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+// Tag of the services registered by Bamboo
+const Tag = "bamboo"
+
+// Service definition of the Consul agent API
+type Registration struct {
+	ID      string
+	Name    string
+	Tags    []string
+	Address string
+	Port    int
+	Check   *Check `json:",omitempty"`
+}
+
+type Check struct {
+	TCP      string
+	Interval string
+}
+
+/*
+	Returns a registration for every service port of the apps, pointing
+	at the load balancer. Hostnames of the app's service are added as
+	tags.
+*/
+func Registrations(apps marathon.AppList, services map[string]service.Service, config conf.Consul) map[string]Registration {
+	registrations := map[string]Registration{}
+	for _, app := range apps {
+		hostnames := []string{}
+		if serviceModel, ok := services[app.Id]; ok {
+			hostnames = service.Hostnames(serviceModel.Acl)
+		}
+
+		for _, port := range app.ServicePorts {
+			if port.Port == 0 {
+				continue
+			}
+			name := ServiceName(app.Id)
+			if port.Index > 0 {
+				name += "-" + strings.ToLower(port.Name)
+			}
+
+			registration := Registration{
+				ID:      Tag + "-" + port.Frontend,
+				Name:    name,
+				Tags:    append([]string{Tag}, hostnames...),
+				Address: config.Address,
+				Port:    port.Port,
+			}
+			if config.CheckInterval != "none" {
+				registration.Check = &Check{
+					TCP:      net.JoinHostPort(config.Address, strconv.Itoa(port.Port)),
+					Interval: config.CheckInterval,
+				}
+			}
+			registrations[registration.ID] = registration
+		}
+	}
+	return registrations
+}
+
+// Consul service name of an app, e.g. /group/app => group-app
+func ServiceName(appId string) string {
+	name := strings.ToLower(strings.Trim(appId, "/"))
+	return strings.Replace(name, "/", "-", -1)
+}
+
+/*
+	Keeps the registrations of the local Consul agent in line with the
+	rendered apps. Updates are applied in the background, only the
+	latest apps are registered.
+*/
+type Registrar struct {
+	config conf.Consul
+	client *http.Client
+
+	lock    sync.Mutex
+	desired map[string]Registration
+	pending chan struct{}
+	// nil until the services registered earlier were listed
+	registered map[string]Registration
+}
+
+func NewRegistrar(config conf.Consul) *Registrar {
+	r := &Registrar{
+		config:  config,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		pending: make(chan struct{}, 1),
+	}
+	go r.run()
+	return r
+}
+
+// Schedules registering the apps
+func (r *Registrar) Update(apps marathon.AppList, services map[string]service.Service) {
+	r.lock.Lock()
+	r.desired = Registrations(apps, services, r.config)
+	r.lock.Unlock()
+
+	select {
+	case r.pending <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Registrar) run() {
+	for range r.pending {
+		r.lock.Lock()
+		desired := r.desired
+		r.lock.Unlock()
+
+		if err := r.sync(desired); err != nil {
+			log.Printf("Unable to register services in Consul: %s\n", err)
+		}
+	}
+}
+
+func (r *Registrar) sync(desired map[string]Registration) error {
+	if r.registered == nil {
+		// services of an earlier run are deregistered when gone
+		registered, err := r.listRegistered()
+		if err != nil {
+			return err
+		}
+		r.registered = registered
+	}
+
+	ids := []string{}
+	for id := range desired {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if current, ok := r.registered[id]; ok && reflect.DeepEqual(current, desired[id]) {
+			continue
+		}
+		if err := r.request("PUT", "/v1/agent/service/register", desired[id], nil); err != nil {
+			return err
+		}
+		r.registered[id] = desired[id]
+	}
+
+	for id := range r.registered {
+		if _, ok := desired[id]; ok {
+			continue
+		}
+		if err := r.request("PUT", "/v1/agent/service/deregister/"+id, nil, nil); err != nil {
+			return err
+		}
+		delete(r.registered, id)
+	}
+	return nil
+}
+
+// Services of the agent tagged by Bamboo. Names and checks are not
+// listed, so they are registered once more after a restart.
+func (r *Registrar) listRegistered() (map[string]Registration, error) {
+	services := map[string]Registration{}
+	err := r.request("GET", "/v1/agent/services", nil, &services)
+	if err != nil {
+		return nil, err
+	}
+
+	registered := map[string]Registration{}
+	for id, registration := range services {
+		for _, tag := range registration.Tags {
+			if tag == Tag {
+				registered[id] = registration
+			}
+		}
+	}
+	return registered, nil
+}
+
+func (r *Registrar) request(method string, path string, body interface{}, result interface{}) error {
+	var content io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(encoded)
+	}
+
+	request, err := http.NewRequest(method, strings.TrimSuffix(r.config.Endpoint, "/")+path, content)
+	if err != nil {
+		return err
+	}
+	if len(r.config.Token) > 0 {
+		request.Header.Set("X-Consul-Token", r.config.Token)
+	}
+
+	response, err := r.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("%s %s: %s %s", method, path, response.Status, message)
+	}
+	if result != nil {
+		return json.NewDecoder(response.Body).Decode(result)
+	}
+	return nil
+}
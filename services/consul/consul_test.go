@@ -0,0 +1,42 @@
+package consul
+
+import (
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/marathon"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+func TestRegistrations(t *testing.T) {
+	Convey("#Registrations", t, func() {
+		apps := marathon.AppList{{
+			Id: "/shop/web",
+			ServicePorts: []marathon.ServicePort{
+				{Index: 0, Port: 10000, Name: "http", Frontend: "shop-web-frontend"},
+				{Index: 1, Port: 10001, Name: "Admin", Frontend: "shop-web-1-frontend"},
+			},
+		}}
+		services := map[string]service.Service{"/shop/web": {Id: "/shop/web", Acl: "hdr(host) shop.example.com"}}
+		config := conf.Consul{Address: "10.0.0.100", CheckInterval: "10s"}
+
+		Convey("should register every service port at the load balancer", func() {
+			registrations := Registrations(apps, services, config)
+			So(registrations["bamboo-shop-web-frontend"], ShouldResemble, Registration{
+				ID:      "bamboo-shop-web-frontend",
+				Name:    "shop-web",
+				Tags:    []string{"bamboo", "shop.example.com"},
+				Address: "10.0.0.100",
+				Port:    10000,
+				Check:   &Check{TCP: "10.0.0.100:10000", Interval: "10s"},
+			})
+			So(registrations["bamboo-shop-web-1-frontend"].Name, ShouldEqual, "shop-web-admin")
+		})
+
+		Convey("should not register checks when disabled", func() {
+			config.CheckInterval = "none"
+			So(Registrations(apps, services, config)["bamboo-shop-web-frontend"].Check, ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,216 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const (
+	Equal  = ' '
+	Insert = '+'
+	Delete = '-'
+)
+
+// Above this number of differing lines, files are reported as
+// completely replaced instead of computing the shortest edit script
+const maxEditDistance = 5000
+
+type Line struct {
+	Op   byte
+	Text string
+}
+
+/*
+	Returns the line diff turning a into b (Myers' algorithm)
+*/
+func Lines(a []string, b []string) []Line {
+	// common prefix and suffix are cheap to strip
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	result := []Line{}
+	for _, text := range a[:prefix] {
+		result = append(result, Line{Equal, text})
+	}
+	result = append(result, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, text := range a[len(a)-suffix:] {
+		result = append(result, Line{Equal, text})
+	}
+	return result
+}
+
+func myers(a []string, b []string) []Line {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return replaced(a, b)
+	}
+
+	// trace[d] holds v[-d-1..d+1] before step d, the range step d reads
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	trace := [][]int{}
+
+	for d := 0; d <= n+m; d++ {
+		if d > maxEditDistance {
+			return replaced(a, b)
+		}
+		trace = append(trace, append([]int{}, v[offset-d-1:offset+d+2]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(trace, a, b)
+			}
+		}
+	}
+	return replaced(a, b)
+}
+
+func backtrack(trace [][]int, a []string, b []string) []Line {
+	reversed := []Line{}
+	x, y := len(a), len(b)
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		// v[0] is k = -d-1
+		at := func(k int) int { return v[k+d+1] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			reversed = append(reversed, Line{Equal, a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, Line{Insert, b[y-1]})
+			} else {
+				reversed = append(reversed, Line{Delete, a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	lines := make([]Line, len(reversed))
+	for i, line := range reversed {
+		lines[len(reversed)-1-i] = line
+	}
+	return lines
+}
+
+func replaced(a []string, b []string) []Line {
+	lines := []Line{}
+	for _, text := range a {
+		lines = append(lines, Line{Delete, text})
+	}
+	for _, text := range b {
+		lines = append(lines, Line{Insert, text})
+	}
+	return lines
+}
+
+/*
+	Splits content into lines, without the trailing empty line
+*/
+func SplitLines(content string) []string {
+	if len(content) == 0 {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+/*
+	Formats a line diff as unified diff with the given context lines
+*/
+func Unified(lines []Line, fromName string, toName string, context int) string {
+	changed := []int{}
+	for i, line := range lines {
+		if line.Op != Equal {
+			changed = append(changed, i)
+		}
+	}
+	if len(changed) == 0 {
+		return ""
+	}
+
+	buffer := new(bytes.Buffer)
+	fmt.Fprintf(buffer, "--- %s\n+++ %s\n", fromName, toName)
+
+	for i := 0; i < len(changed); {
+		// extend the hunk while changes are close enough to share context
+		start, end := changed[i], changed[i]
+		for i++; i < len(changed) && changed[i]-end <= 2*context; i++ {
+			end = changed[i]
+		}
+		start = maxInt(0, start-context)
+		end = minInt(len(lines)-1, end+context)
+
+		aStart, bStart := 1, 1
+		for _, line := range lines[:start] {
+			if line.Op != Insert {
+				aStart++
+			}
+			if line.Op != Delete {
+				bStart++
+			}
+		}
+		aLength, bLength := 0, 0
+		for _, line := range lines[start : end+1] {
+			if line.Op != Insert {
+				aLength++
+			}
+			if line.Op != Delete {
+				bLength++
+			}
+		}
+
+		fmt.Fprintf(buffer, "@@ -%d,%d +%d,%d @@\n", aStart, aLength, bStart, bLength)
+		for _, line := range lines[start : end+1] {
+			buffer.WriteByte(line.Op)
+			buffer.WriteString(line.Text + "\n")
+		}
+	}
+	return buffer.String()
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,32 @@
+package diff
+
+import (
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	Convey("#Lines", t, func() {
+		Convey("should keep identical content equal", func() {
+			lines := Lines([]string{"a", "b"}, []string{"a", "b"})
+			So(lines, ShouldResemble, []Line{{Equal, "a"}, {Equal, "b"}})
+		})
+
+		Convey("should report inserted and deleted lines", func() {
+			lines := Lines([]string{"a", "b", "c"}, []string{"a", "c", "d"})
+			So(lines, ShouldResemble, []Line{{Equal, "a"}, {Delete, "b"}, {Equal, "c"}, {Insert, "d"}})
+		})
+	})
+
+	Convey("#Unified", t, func() {
+		Convey("should be empty without changes", func() {
+			So(Unified(Lines([]string{"a"}, []string{"a"}), "a", "b", 3), ShouldEqual, "")
+		})
+
+		Convey("should format hunks with context", func() {
+			lines := Lines(SplitLines("a\nb\nc\n"), SplitLines("a\nx\nc\n"))
+			So(Unified(lines, "active", "shadow", 1), ShouldEqual,
+				"--- active\n+++ shadow\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n")
+		})
+	})
+}
@@ -0,0 +1,83 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+/*
+	CoreDNS etcd plugin records, written through the etcd v3 JSON
+	gateway in the SkyDNS format
+*/
+type CoreDNS struct {
+	Config conf.CoreDNS
+	Client *http.Client
+}
+
+type skydnsRecord struct {
+	Host string `json:"host"`
+	TTL  int    `json:"ttl"`
+}
+
+func (c *CoreDNS) Apply(changes []Change) error {
+	for _, change := range changes {
+		key := base64.StdEncoding.EncodeToString([]byte(SkyDNSKey(c.Config.Prefix, change.Record.Name)))
+		var body interface{}
+		var method string
+
+		if change.Action == Delete {
+			method = "deleterange"
+			body = map[string]string{"key": key}
+		} else {
+			value, err := json.Marshal(skydnsRecord{change.Record.Value, change.Record.TTL})
+			if err != nil {
+				return err
+			}
+			method = "put"
+			body = map[string]string{"key": key, "value": base64.StdEncoding.EncodeToString(value)}
+		}
+
+		if err := c.post(method, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *CoreDNS) post(method string, body interface{}) error {
+	content, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	url := strings.TrimSuffix(c.Config.EtcdEndpoint, "/") + "/v3/kv/" + method
+	response, err := client.Post(url, "application/json", bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("etcd responded %s to %s", response.Status, method)
+	}
+	return nil
+}
+
+// Reversed labels under the prefix, e.g. /skydns/com/example/www
+func SkyDNSKey(prefix string, name string) string {
+	labels := strings.Split(strings.ToLower(name), ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return strings.TrimSuffix(prefix, "/") + "/" + strings.Join(labels, "/")
+}
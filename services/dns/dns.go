@@ -0,0 +1,165 @@
+package dns
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+const (
+	Upsert = "UPSERT"
+	Delete = "DELETE"
+)
+
+type Record struct {
+	Name string
+	// A or CNAME
+	Type  string
+	Value string
+	TTL   int
+}
+
+type Change struct {
+	Action string
+	Record Record
+}
+
+// DNS service records are published to
+type Provider interface {
+	Apply(changes []Change) error
+}
+
+func NewProvider(config conf.DNS) (Provider, error) {
+	switch config.Provider {
+	case "route53":
+		return &Route53{Config: config.Route53}, nil
+	case "coredns":
+		return &CoreDNS{Config: config.CoreDNS}, nil
+	}
+	return nil, fmt.Errorf("unknown DNS provider %s", config.Provider)
+}
+
+/*
+	Publishes the hostnames of services to a DNS provider. Updates are
+	applied in the background, only the latest services are published.
+*/
+type Publisher struct {
+	provider Provider
+	target   string
+	ttl      int
+
+	lock      sync.Mutex
+	desired   map[string]service.Service
+	published map[string]Record
+	pending   chan struct{}
+}
+
+func NewPublisher(config conf.DNS) (*Publisher, error) {
+	provider, err := NewProvider(config)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Target) == 0 {
+		return nil, fmt.Errorf("DNS.Target is required")
+	}
+
+	p := &Publisher{
+		provider:  provider,
+		target:    config.Target,
+		ttl:       config.TTL,
+		published: map[string]Record{},
+		pending:   make(chan struct{}, 1),
+	}
+	go p.run()
+	return p, nil
+}
+
+// Schedules publishing the hostnames of the services
+func (p *Publisher) Update(services map[string]service.Service) {
+	p.lock.Lock()
+	p.desired = services
+	p.lock.Unlock()
+
+	select {
+	case p.pending <- struct{}{}:
+	default:
+	}
+}
+
+func (p *Publisher) run() {
+	for range p.pending {
+		p.lock.Lock()
+		desired := p.desired
+		p.lock.Unlock()
+
+		records := Records(desired, p.target, p.ttl)
+		changes := Changes(p.published, records)
+		if len(changes) == 0 {
+			continue
+		}
+		if err := p.provider.Apply(changes); err != nil {
+			log.Printf("Unable to publish %d DNS changes: %s\n", len(changes), err)
+			continue
+		}
+		p.published = records
+		log.Printf("Published %d DNS changes\n", len(changes))
+	}
+}
+
+/*
+	Returns the records of the hostnames matched by the service ACLs,
+	pointing at the target
+*/
+func Records(services map[string]service.Service, target string, ttl int) map[string]Record {
+	recordType := "CNAME"
+	if net.ParseIP(target) != nil {
+		recordType = "A"
+	}
+
+	records := map[string]Record{}
+	for _, serviceModel := range services {
+		for _, hostname := range service.Hostnames(serviceModel.Acl) {
+			// the port is not part of the DNS name
+			if host, _, err := net.SplitHostPort(hostname); err == nil {
+				hostname = host
+			}
+			hostname = strings.TrimSuffix(hostname, ".")
+			if len(hostname) > 0 {
+				records[hostname] = Record{Name: hostname, Type: recordType, Value: target, TTL: ttl}
+			}
+		}
+	}
+	return records
+}
+
+/*
+	Returns the changes turning the published records into the desired
+	ones, sorted by name
+*/
+func Changes(published map[string]Record, desired map[string]Record) []Change {
+	changes := []Change{}
+	for name, record := range desired {
+		if current, ok := published[name]; !ok || current != record {
+			changes = append(changes, Change{Upsert, record})
+		}
+	}
+	for name, record := range published {
+		if _, ok := desired[name]; !ok {
+			changes = append(changes, Change{Delete, record})
+		}
+	}
+	sort.Sort(changesByName(changes))
+	return changes
+}
+
+type changesByName []Change
+
+func (c changesByName) Len() int           { return len(c) }
+func (c changesByName) Less(i, j int) bool { return c[i].Record.Name < c[j].Record.Name }
+func (c changesByName) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
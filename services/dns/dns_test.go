@@ -0,0 +1,53 @@
+package dns
+
+import (
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+func TestRecords(t *testing.T) {
+	Convey("#Records", t, func() {
+		services := map[string]service.Service{
+			"/web":  {Id: "/web", Acl: "hdr(host) -i www.example.com"},
+			"/api":  {Id: "/api", Acl: "hdr_dom(host) api.example.com:80"},
+			"/path": {Id: "/path", Acl: "path_beg /static"},
+		}
+
+		Convey("should publish exact hostnames of host rules", func() {
+			records := Records(services, "10.0.0.100", 60)
+			So(records, ShouldResemble, map[string]Record{
+				"www.example.com": {"www.example.com", "A", "10.0.0.100", 60},
+				"api.example.com": {"api.example.com", "A", "10.0.0.100", 60},
+			})
+		})
+
+		Convey("should point CNAME records at named targets", func() {
+			records := Records(services, "lb.example.com", 60)
+			So(records["www.example.com"].Type, ShouldEqual, "CNAME")
+		})
+	})
+}
+
+func TestChanges(t *testing.T) {
+	Convey("#Changes", t, func() {
+		a := Record{"a.example.com", "A", "10.0.0.100", 60}
+		b := Record{"b.example.com", "A", "10.0.0.100", 60}
+
+		Convey("should upsert new records and delete removed ones", func() {
+			changes := Changes(map[string]Record{"a.example.com": a}, map[string]Record{"b.example.com": b})
+			So(changes, ShouldResemble, []Change{{Delete, a}, {Upsert, b}})
+		})
+
+		Convey("should not change published records", func() {
+			So(Changes(map[string]Record{"a.example.com": a}, map[string]Record{"a.example.com": a}), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestSkyDNSKey(t *testing.T) {
+	Convey("#SkyDNSKey", t, func() {
+		So(SkyDNSKey("/skydns", "www.Example.com"), ShouldEqual, "/skydns/com/example/www")
+	})
+}
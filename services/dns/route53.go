@@ -0,0 +1,77 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/sigv4"
+)
+
+const route53Endpoint = "https://route53.amazonaws.com/2013-04-01/hostedzone/"
+
+// Route53 hosted zone, changed through its REST API
+type Route53 struct {
+	Config conf.Route53
+	Client *http.Client
+}
+
+type changeResourceRecordSetsRequest struct {
+	XMLName xml.Name        `xml:"https://route53.amazonaws.com/doc/2013-04-01/ ChangeResourceRecordSetsRequest"`
+	Changes []route53Change `xml:"ChangeBatch>Changes>Change"`
+}
+
+type route53Change struct {
+	Action string
+	Name   string   `xml:"ResourceRecordSet>Name"`
+	Type   string   `xml:"ResourceRecordSet>Type"`
+	TTL    int      `xml:"ResourceRecordSet>TTL"`
+	Values []string `xml:"ResourceRecordSet>ResourceRecords>ResourceRecord>Value"`
+}
+
+// Applies all changes in one batch, Route53 applies them atomically
+func (r *Route53) Apply(changes []Change) error {
+	request := changeResourceRecordSetsRequest{}
+	for _, change := range changes {
+		request.Changes = append(request.Changes, route53Change{
+			Action: change.Action,
+			Name:   change.Record.Name,
+			Type:   change.Record.Type,
+			TTL:    change.Record.TTL,
+			Values: []string{change.Record.Value},
+		})
+	}
+	content, err := xml.Marshal(request)
+	if err != nil {
+		return err
+	}
+	content = append([]byte(xml.Header), content...)
+
+	httpRequest, err := http.NewRequest("POST", route53Endpoint+r.Config.HostedZoneId+"/rrset", bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	httpRequest.Header.Set("Content-Type", "text/xml")
+	credentials := sigv4.Credentials{AccessKey: r.Config.AccessKey, SecretKey: r.Config.SecretKey}
+	sigv4.Sign(httpRequest, content, credentials, "us-east-1", "route53", time.Now())
+
+	client := r.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	response, err := client.Do(httpRequest)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("Route53 responded %s: %s", response.Status, message)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package doctor
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/samuel/go-zookeeper/zk"
+	"github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/haproxy"
+	"github.com/QubitProducts/bamboo/services/template"
+)
+
+const checkTimeout = 10 * time.Second
+
+// Outcome of a single diagnostic check
+type Check struct {
+	Name    string
+	Ok      bool
+	Message string
+	// Remediation hint for failed checks
+	Hint string
+}
+
+type Report []Check
+
+func (r Report) Ok() bool {
+	for _, check := range r {
+		if !check.Ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (r Report) Print(w io.Writer) {
+	for _, check := range r {
+		status := "OK  "
+		if !check.Ok {
+			status = "FAIL"
+		}
+		fmt.Fprintf(w, "[%s] %s: %s\n", status, check.Name, check.Message)
+		if !check.Ok && len(check.Hint) > 0 {
+			fmt.Fprintf(w, "       hint: %s\n", check.Hint)
+		}
+	}
+}
+
+/*
+	Runs every startup check against the configuration file. Checks
+	depending on a readable configuration are skipped when it fails.
+*/
+func Run(configPath string, overlayPaths ...string) Report {
+	report := Report{}
+
+	conf, check := checkConfiguration(configPath, overlayPaths)
+	report = append(report, check)
+	if !check.Ok {
+		return report
+	}
+
+	return append(report,
+		checkTemplate(conf.HAProxy),
+		checkZookeeper(conf.Bamboo.Zookeeper),
+		checkMarathon(conf.Marathon),
+		checkHAProxyVersion(conf.HAProxy),
+		checkHAProxyConfig(conf.HAProxy),
+		checkBind(conf.Bamboo.Bind),
+	)
+}
+
+func pass(name string, message string) Check {
+	return Check{Name: name, Ok: true, Message: message}
+}
+
+func fail(name string, message string, hint string) Check {
+	return Check{Name: name, Ok: false, Message: message, Hint: hint}
+}
+
+func checkConfiguration(configPath string, overlayPaths []string) (configuration.Configuration, Check) {
+	name := "configuration"
+	if _, err := os.Stat(configPath); err != nil {
+		return configuration.Configuration{}, fail(name, err.Error(), "pass the configuration file with -config")
+	}
+	for _, overlayPath := range overlayPaths {
+		if _, err := os.Stat(overlayPath); err != nil {
+			return configuration.Configuration{}, fail(name, err.Error(), "check the overlay files passed with -overlay")
+		}
+	}
+
+	conf, err := configuration.FromFiles(configPath, overlayPaths...)
+	if err != nil {
+		return conf, fail(name, err.Error(), "fix the JSON of "+strings.Join(append([]string{configPath}, overlayPaths...), ", "))
+	}
+	if err := conf.Validate(); err != nil {
+		return conf, fail(name, err.Error(), "fix the listed fields or set them through environment variables")
+	}
+	if len(overlayPaths) > 0 {
+		return conf, pass(name, configPath+" parsed with overlays "+strings.Join(overlayPaths, ", "))
+	}
+	return conf, pass(name, configPath+" parsed")
+}
+
+func checkTemplate(conf configuration.HAProxy) Check {
+	name := "template"
+	content, err := ioutil.ReadFile(conf.TemplatePath)
+	if err != nil {
+		return fail(name, err.Error(), "check HAProxy.TemplatePath")
+	}
+
+	err = template.ValidateTemplate(conf.TemplatePath, string(content))
+	if err != nil {
+		return fail(name, err.Error(), "preview the template with POST /api/template/preview to locate the error")
+	}
+	return pass(name, conf.TemplatePath+" parsed")
+}
+
+func checkZookeeper(conf configuration.Zookeeper) Check {
+	name := "zookeeper"
+	hint := "check Bamboo.Zookeeper.Host and that the path is writable by Bamboo"
+
+	conn, _, err := zk.Connect(conf.ConnectionString(), checkTimeout)
+	if err != nil {
+		return fail(name, err.Error(), hint)
+	}
+	defer conn.Close()
+
+	result := make(chan error, 1)
+	go func() {
+		// an ephemeral probe next to the storage path proves write permission
+		// without showing up as a service of running instances
+		probe := conf.Path + "-bamboo-doctor"
+		_, err := conn.Create(probe, []byte{}, zk.FlagEphemeral, zk.WorldACL(zk.PermAll))
+		if err == nil || err == zk.ErrNodeExists {
+			err = conn.Delete(probe, -1)
+		}
+		result <- err
+	}()
+
+	select {
+	case err = <-result:
+	case <-time.After(checkTimeout):
+		err = fmt.Errorf("no response from %s within %s", conf.Host, checkTimeout)
+	}
+	if err != nil {
+		return fail(name, err.Error(), hint)
+	}
+	return pass(name, conf.Host+" reachable and writable")
+}
+
+func checkMarathon(conf configuration.Marathon) Check {
+	name := "marathon"
+	client := &http.Client{Timeout: checkTimeout}
+
+	for _, endpoint := range conf.Endpoints() {
+		response, err := client.Get(endpoint + "/v2/info")
+		if err != nil {
+			return fail(name, err.Error(), "check Marathon.Endpoint and network access to Marathon")
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			return fail(name, endpoint+" responded "+response.Status, "check Marathon.Endpoint and Marathon authentication")
+		}
+	}
+	return pass(name, conf.Endpoint+" reachable")
+}
+
+func checkHAProxyVersion(conf configuration.HAProxy) Check {
+	name := "haproxy version"
+	version, err := haproxy.DetectVersion(conf)
+	if err != nil {
+		return fail(name, err.Error(), "install HAProxy or set HAProxy.BinaryPath")
+	}
+
+	err = haproxy.CheckVersion(conf)
+	if err != nil {
+		return fail(name, err.Error(), "upgrade HAProxy or adjust HAProxy.MinimumVersion")
+	}
+	return pass(name, version.String())
+}
+
+func checkHAProxyConfig(conf configuration.HAProxy) Check {
+	name := "haproxy config"
+	if _, err := os.Stat(conf.OutputPath); err != nil {
+		return pass(name, conf.OutputPath+" not rendered yet")
+	}
+
+	output, err := exec.Command(conf.BinaryPath, "-c", "-f", conf.OutputPath).CombinedOutput()
+	if err != nil {
+		return fail(name, err.Error()+": "+string(output), "fix the template or run haproxy -c -f "+conf.OutputPath)
+	}
+	return pass(name, conf.OutputPath+" valid")
+}
+
+func checkBind(bind string) Check {
+	name := "bind"
+	listener, err := net.Listen("tcp", bind)
+	if err != nil {
+		return fail(name, err.Error(), "stop the process using "+bind+" or change Bamboo.Bind")
+	}
+	listener.Close()
+	return pass(name, bind+" available")
+}
@@ -0,0 +1,140 @@
+package doctor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"github.com/QubitProducts/bamboo/configuration"
+)
+
+const validConfig = `{
+	"Marathon": {"Endpoint": "http://marathon:8080"},
+	"Bamboo": {"Bind": "127.0.0.1:8000", "Zookeeper": {"Host": "zk:2181", "Path": "/bamboo"}},
+	"HAProxy": {"TemplatePath": "haproxy_template.cfg", "OutputPath": "haproxy.cfg", "ReloadCommand": "true"}
+}`
+
+func writeFile(dir string, name string, content string) string {
+	path := filepath.Join(dir, name)
+	So(ioutil.WriteFile(path, []byte(content), 0644), ShouldBeNil)
+	return path
+}
+
+func TestReport(t *testing.T) {
+	Convey("#Report", t, func() {
+		report := Report{pass("template", "parsed"), fail("bind", "address in use", "change Bamboo.Bind")}
+
+		Convey("should fail when any check fails", func() {
+			So(report.Ok(), ShouldBeFalse)
+			So(report[:1].Ok(), ShouldBeTrue)
+		})
+
+		Convey("should print the hints of failed checks", func() {
+			output := new(bytes.Buffer)
+			report.Print(output)
+			So(output.String(), ShouldEqual, "[OK  ] template: parsed\n[FAIL] bind: address in use\n       hint: change Bamboo.Bind\n")
+		})
+	})
+}
+
+func TestChecks(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "bamboo-doctor")
+	defer os.RemoveAll(dir)
+
+	Convey("#checkConfiguration", t, func() {
+		Convey("should fail when the file is missing", func() {
+			_, check := checkConfiguration(filepath.Join(dir, "missing.json"), nil)
+			So(check.Ok, ShouldBeFalse)
+			So(check.Hint, ShouldContainSubstring, "-config")
+		})
+
+		Convey("should fail on invalid JSON", func() {
+			_, check := checkConfiguration(writeFile(dir, "invalid.json", "{"), nil)
+			So(check.Ok, ShouldBeFalse)
+		})
+
+		Convey("should fail when required fields are missing", func() {
+			_, check := checkConfiguration(writeFile(dir, "empty.json", "{}"), nil)
+			So(check.Ok, ShouldBeFalse)
+			So(check.Message, ShouldContainSubstring, "Marathon.Endpoint")
+		})
+
+		Convey("should pass a valid configuration", func() {
+			conf, check := checkConfiguration(writeFile(dir, "config.json", validConfig), nil)
+			So(check.Ok, ShouldBeTrue)
+			So(conf.Marathon.Endpoint, ShouldEqual, "http://marathon:8080")
+		})
+
+		Convey("should fail when an overlay is missing", func() {
+			_, check := checkConfiguration(writeFile(dir, "config.json", validConfig), []string{filepath.Join(dir, "missing.json")})
+			So(check.Ok, ShouldBeFalse)
+			So(check.Hint, ShouldContainSubstring, "-overlay")
+		})
+	})
+
+	Convey("#checkTemplate", t, func() {
+		Convey("should fail when the template is missing", func() {
+			check := checkTemplate(configuration.HAProxy{TemplatePath: filepath.Join(dir, "missing.cfg")})
+			So(check.Ok, ShouldBeFalse)
+		})
+
+		Convey("should fail when the template does not parse", func() {
+			check := checkTemplate(configuration.HAProxy{TemplatePath: writeFile(dir, "broken.cfg", "{{ range .Apps }")})
+			So(check.Ok, ShouldBeFalse)
+		})
+
+		Convey("should pass a parsing template", func() {
+			check := checkTemplate(configuration.HAProxy{TemplatePath: writeFile(dir, "template.cfg", "{{ range .Apps }}{{ .Id }}{{ end }}")})
+			So(check.Ok, ShouldBeTrue)
+		})
+	})
+
+	Convey("#checkMarathon", t, func() {
+		Convey("should pass when every endpoint responds", func() {
+			requested := ""
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requested = r.URL.Path
+			}))
+			defer server.Close()
+			So(checkMarathon(configuration.Marathon{Endpoint: server.URL}).Ok, ShouldBeTrue)
+			So(requested, ShouldEqual, "/v2/info")
+		})
+
+		Convey("should fail when an endpoint responds with an error", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+			}))
+			defer server.Close()
+			check := checkMarathon(configuration.Marathon{Endpoint: server.URL})
+			So(check.Ok, ShouldBeFalse)
+			So(check.Hint, ShouldContainSubstring, "authentication")
+		})
+	})
+
+	Convey("#checkHAProxyConfig", t, func() {
+		Convey("should pass before the first render", func() {
+			check := checkHAProxyConfig(configuration.HAProxy{OutputPath: filepath.Join(dir, "haproxy.cfg")})
+			So(check.Ok, ShouldBeTrue)
+			So(check.Message, ShouldContainSubstring, "not rendered yet")
+		})
+	})
+
+	Convey("#checkBind", t, func() {
+		Convey("should fail when the address is in use", func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			So(err, ShouldBeNil)
+			defer listener.Close()
+			So(checkBind(listener.Addr().String()).Ok, ShouldBeFalse)
+		})
+
+		Convey("should pass when the address is available", func() {
+			So(checkBind("127.0.0.1:0").Ok, ShouldBeTrue)
+		})
+	})
+}
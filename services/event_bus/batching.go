@@ -0,0 +1,150 @@
+package event_bus
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	Holds the events of running Marathon deployments, identified by the
+	plan ids of deployment_info events, and queues a single update once
+	every deployment succeeded or failed, or the maximum wait expired.
+	Only the events of the deployments and of the apps their steps act
+	on are held, other apps keep rendering right away. With
+	restartsOnly, only steps restarting apps are held and each step is
+	released on its own, so that the health flaps of a rolling restart
+	are rendered once per step.
+*/
+type deploymentBatcher struct {
+	lock sync.Mutex
+	// Apps of the running deployments by plan id
+	active  map[string]map[string]bool
+	held    []Trigger
+	timeout *time.Timer
+	// Queues the held events as one update
+	flush        func(triggers []Trigger)
+	restartsOnly bool
+}
+
+func newDeploymentBatcher(flush func(triggers []Trigger)) *deploymentBatcher {
+	return &deploymentBatcher{active: map[string]map[string]bool{}, flush: flush}
+}
+
+/*
+	Returns whether the event is held for a running deployment
+*/
+func (b *deploymentBatcher) hold(event MarathonEvent, trigger Trigger, maxWait time.Duration) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch event.EventType {
+	case "deployment_info":
+		if len(event.Plan.Id) == 0 {
+			return false
+		}
+		apps := event.CurrentStep.Apps()
+		if b.restartsOnly {
+			apps = event.CurrentStep.Restarts()
+			if len(apps) == 0 {
+				return b.holdWhileActive(event, trigger)
+			}
+		}
+		if len(b.active) == 0 && b.timeout == nil {
+			b.timeout = time.AfterFunc(maxWait, b.expire)
+		}
+		if b.active[event.Plan.Id] == nil {
+			b.active[event.Plan.Id] = map[string]bool{}
+		}
+		for _, app := range apps {
+			b.active[event.Plan.Id][app] = true
+		}
+	case "deployment_success", "deployment_failed":
+		id := event.DeploymentId()
+		if b.active[id] == nil {
+			return false
+		}
+		delete(b.active, id)
+		b.held = append(b.held, trigger)
+		if len(b.active) == 0 {
+			log.Printf("%s: Deployment %s completed, rendering %d held events\n", trigger.Id, id, len(b.held))
+			b.release()
+		}
+		return true
+	case "deployment_step_success", "deployment_step_failure":
+		id := event.DeploymentId()
+		if !b.restartsOnly || b.active[id] == nil {
+			return b.holdWhileActive(event, trigger)
+		}
+		delete(b.active, id)
+		b.held = append(b.held, trigger)
+		if len(b.active) == 0 {
+			log.Printf("%s: Restart step of deployment %s completed, rendering %d held events\n", trigger.Id, id, len(b.held))
+			b.release()
+		}
+		return true
+	}
+
+	return b.holdWhileActive(event, trigger)
+}
+
+/*
+	Holds the events of running deployments and of the apps they act
+	on. Called with the lock held.
+*/
+func (b *deploymentBatcher) holdWhileActive(event MarathonEvent, trigger Trigger) bool {
+	if !b.deploying(event) {
+		return false
+	}
+	b.held = append(b.held, trigger)
+	return true
+}
+
+// Called with the lock held
+func (b *deploymentBatcher) deploying(event MarathonEvent) bool {
+	if id := event.DeploymentId(); len(id) > 0 && b.active[id] != nil {
+		return true
+	}
+	if len(event.AppId) == 0 {
+		return false
+	}
+	for _, apps := range b.active {
+		if apps[event.AppId] {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *deploymentBatcher) expire() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if len(b.active) == 0 {
+		return
+	}
+
+	ids := []string{}
+	for id := range b.active {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	log.Printf("Deployments %s still running, rendering %d held events\n", strings.Join(ids, ","), len(b.held))
+	b.active = map[string]map[string]bool{}
+	b.release()
+}
+
+// Called with the lock held
+func (b *deploymentBatcher) release() {
+	if b.timeout != nil {
+		b.timeout.Stop()
+		b.timeout = nil
+	}
+	held := b.held
+	b.held = nil
+	if len(held) > 0 {
+		// queueing may block on a running update
+		go b.flush(held)
+	}
+}
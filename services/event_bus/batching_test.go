@@ -0,0 +1,73 @@
+package event_bus
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func restartEvent(eventType string, action string) MarathonEvent {
+	event := MarathonEvent{}
+	json.Unmarshal([]byte(`{
+		"eventType": "`+eventType+`",
+		"plan": {"id": "plan-1"},
+		"currentStep": {"actions": [{"action": "`+action+`", "app": "/app"}]}
+	}`), &event)
+	return event
+}
+
+func TestDeploymentBatching(t *testing.T) {
+	Convey("#hold", t, func() {
+		flushed := make(chan []Trigger, 1)
+		batcher := newDeploymentBatcher(func(triggers []Trigger) { flushed <- triggers })
+
+		Convey("Should hold the events of the deployed apps until the deployment completes", func() {
+			So(batcher.hold(restartEvent("deployment_info", "ScaleApplication"), Trigger{Id: "1"}, time.Minute), ShouldBeTrue)
+			So(batcher.hold(MarathonEvent{EventType: "status_update_event", AppId: "/app"}, Trigger{Id: "2"}, time.Minute), ShouldBeTrue)
+			So(batcher.hold(MarathonEvent{EventType: "status_update_event", AppId: "/other"}, Trigger{Id: "3"}, time.Minute), ShouldBeFalse)
+			So(batcher.hold(MarathonEvent{EventType: "deployment_success", Id: "plan-1"}, Trigger{Id: "4"}, time.Minute), ShouldBeTrue)
+
+			triggers := <-flushed
+			So(len(triggers), ShouldEqual, 3)
+			So(triggers[0].Id, ShouldEqual, "1")
+			So(triggers[2].Id, ShouldEqual, "4")
+		})
+	})
+}
+
+func TestRestartBatching(t *testing.T) {
+	Convey("#hold with restartsOnly", t, func() {
+		flushed := make(chan []Trigger, 1)
+		batcher := newDeploymentBatcher(func(triggers []Trigger) { flushed <- triggers })
+		batcher.restartsOnly = true
+
+		Convey("Should not hold deployments without restarts", func() {
+			So(batcher.hold(restartEvent("deployment_info", "ScaleApplication"), Trigger{Id: "1"}, time.Minute), ShouldBeFalse)
+			So(batcher.hold(MarathonEvent{EventType: "status_update_event"}, Trigger{Id: "2"}, time.Minute), ShouldBeFalse)
+		})
+
+		Convey("Should render a restart step once", func() {
+			So(batcher.hold(restartEvent("deployment_info", "RestartApplication"), Trigger{Id: "1"}, time.Minute), ShouldBeTrue)
+			So(batcher.hold(MarathonEvent{EventType: "health_status_changed_event", AppId: "/app"}, Trigger{Id: "2"}, time.Minute), ShouldBeTrue)
+			So(batcher.hold(MarathonEvent{EventType: "status_update_event", AppId: "/app"}, Trigger{Id: "3"}, time.Minute), ShouldBeTrue)
+			So(batcher.hold(restartEvent("deployment_step_success", "RestartApplication"), Trigger{Id: "4"}, time.Minute), ShouldBeTrue)
+
+			triggers := <-flushed
+			So(len(triggers), ShouldEqual, 4)
+			So(batcher.hold(MarathonEvent{EventType: "status_update_event", AppId: "/app"}, Trigger{Id: "5"}, time.Minute), ShouldBeFalse)
+		})
+
+		Convey("Should not hold the events of other apps", func() {
+			So(batcher.hold(restartEvent("deployment_info", "RestartApplication"), Trigger{Id: "1"}, time.Minute), ShouldBeTrue)
+			So(batcher.hold(MarathonEvent{EventType: "status_update_event", AppId: "/other"}, Trigger{Id: "2"}, time.Minute), ShouldBeFalse)
+			So(batcher.hold(MarathonEvent{EventType: "api_post_event"}, Trigger{Id: "3"}, time.Minute), ShouldBeFalse)
+		})
+
+		Convey("Should detect restarts of older Marathon versions", func() {
+			event := MarathonEvent{CurrentStep: DeploymentStep{Actions: []DeploymentAction{{Type: "RestartApplication", App: "/app"}}}}
+			So(event.CurrentStep.Restarts(), ShouldResemble, []string{"/app"})
+		})
+	})
+}
@@ -0,0 +1,66 @@
+package event_bus
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var eventSequence, renderSequence, reloadSequence int64
+
+func nextId(prefix string, sequence *int64) string {
+	return prefix + "-" + strconv.FormatInt(atomic.AddInt64(sequence, 1), 10)
+}
+
+// Bus event which triggered an update
+type Trigger struct {
+	Id       string
+	Type     string
+	Received time.Time
+	// Whether the event was sent by Marathon
+	Marathon bool
+}
+
+func newTrigger(eventType string, marathon bool) Trigger {
+	countEvent(eventType)
+	return Trigger{Id: nextId("event", &eventSequence), Type: eventType, Received: time.Now(), Marathon: marathon}
+}
+
+// Update request of the update loop with the events it coalesces
+type update struct {
+	handlers *Handlers
+	triggers []Trigger
+}
+
+func (u update) eventIds() string {
+	ids := []string{}
+	for _, trigger := range u.triggers {
+		ids = append(ids, trigger.Id)
+	}
+	return strings.Join(ids, ",")
+}
+
+// Receive time of the oldest Marathon event of the update
+func (u update) firstMarathonEvent() (time.Time, bool) {
+	var first time.Time
+	found := false
+	for _, trigger := range u.triggers {
+		if trigger.Marathon && (!found || trigger.Received.Before(first)) {
+			first = trigger.Received
+			found = true
+		}
+	}
+	return first, found
+}
+
+// Receive time of the oldest event of the update
+func (u update) firstReceived() time.Time {
+	first := time.Now()
+	for _, trigger := range u.triggers {
+		if trigger.Received.Before(first) {
+			first = trigger.Received
+		}
+	}
+	return first
+}
@@ -64,6 +64,7 @@ func (ebus *EventBus) Publish(event interface {}) error {
 	args := [...]reflect.Value{reflect.ValueOf(event)}
 	for _, fn := range handlers {
 		fn.Call(args[:])
+		countStats(func(s *Stats) { s.HandlersExecuted++ })
 	}
 	return nil
 }
@@ -1,20 +1,98 @@
 package event_bus
 
 import (
+	"errors"
 	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/samuel/go-zookeeper/zk"
 	"github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/capture"
+	"github.com/QubitProducts/bamboo/services/consul"
+	"github.com/QubitProducts/bamboo/services/dns"
+	"github.com/QubitProducts/bamboo/services/faults"
+	"github.com/QubitProducts/bamboo/services/features"
 	"github.com/QubitProducts/bamboo/services/haproxy"
+	"github.com/QubitProducts/bamboo/services/history"
+	"github.com/QubitProducts/bamboo/services/instance"
+	"github.com/QubitProducts/bamboo/services/jwt"
+	"github.com/QubitProducts/bamboo/services/lint"
+	"github.com/QubitProducts/bamboo/services/logging"
+	"github.com/QubitProducts/bamboo/services/marathon"
+	"github.com/QubitProducts/bamboo/services/metrics"
+	"github.com/QubitProducts/bamboo/services/notify"
+	"github.com/QubitProducts/bamboo/services/preview"
+	"github.com/QubitProducts/bamboo/services/service"
+	"github.com/QubitProducts/bamboo/services/state"
 	"github.com/QubitProducts/bamboo/services/template"
 	"io/ioutil"
 	"log"
-	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 type MarathonEvent struct {
 	// EventType can be
-	// api_post_event, status_update_event, subscribe_event
+	// api_post_event, status_update_event, subscribe_event,
+	// deployment_info, deployment_success, deployment_failed
 	EventType string
 	Timestamp string
+	// Deployment id of deployment_success and deployment_failed events
+	Id   string
+	Plan DeploymentPlan
+	// Step of deployment_info and deployment_step_* events
+	CurrentStep DeploymentStep
+	// Task of health_status_changed_event and whether it is healthy
+	AppId  string
+	TaskId string
+	Alive  *bool
+	// State of the task of status_update_event, e.g. TASK_RUNNING
+	TaskStatus string
+}
+
+type DeploymentPlan struct {
+	Id string
+}
+
+type DeploymentStep struct {
+	Actions []DeploymentAction
+}
+
+type DeploymentAction struct {
+	// e.g. StartApplication, ScaleApplication, RestartApplication.
+	// Marathon before 0.15 names it Type.
+	Action string
+	Type   string
+	App    string
+}
+
+// Ids of the apps the step restarts
+func (s DeploymentStep) Restarts() []string {
+	apps := []string{}
+	for _, action := range s.Actions {
+		if action.Action == "RestartApplication" || action.Type == "RestartApplication" {
+			apps = append(apps, action.App)
+		}
+	}
+	return apps
+}
+
+// Ids of the apps the step acts on
+func (s DeploymentStep) Apps() []string {
+	apps := []string{}
+	for _, action := range s.Actions {
+		if len(action.App) > 0 {
+			apps = append(apps, action.App)
+		}
+	}
+	return apps
+}
+
+// Id of the deployment a deployment event belongs to
+func (e MarathonEvent) DeploymentId() string {
+	if len(e.Id) > 0 {
+		return e.Id
+	}
+	return e.Plan.Id
 }
 
 type ZookeeperEvent struct {
@@ -29,90 +107,528 @@ type ServiceEvent struct {
 type Handlers struct {
 	Conf      *configuration.Configuration
 	Zookeeper *zk.Conn
+	State     *state.Tracker
+	Instances *instance.Registry
+	DNS       *dns.Publisher
+	Consul    *consul.Registrar
+	// Applies written configurations
+	Reloader haproxy.Reloader
+	// Apps with per-app metrics, nil when disabled
+	AppMetrics *metrics.Guard
+	// Notifications to service owners
+	Notifications *notify.Dispatcher
+	// Asked before applying a configuration, nil when not configured
+	ValidationHook *haproxy.ValidationHook
+	// Backend membership log, nil when disabled
+	History *history.Recorder
+
+	deployments     *deploymentBatcher
+	deploymentsOnce sync.Once
+	gate            deploymentGate
+}
+
+func (h *Handlers) batcher() *deploymentBatcher {
+	h.deploymentsOnce.Do(func() {
+		h.deployments = newDeploymentBatcher(func(triggers []Trigger) {
+			queueUpdate(h, triggers...)
+		})
+		h.deployments.restartsOnly = !h.Conf.Marathon.DeploymentBatching
+	})
+	return h.deployments
 }
 
 func (h *Handlers) MarathonEventHandler(event MarathonEvent) {
-	log.Printf("%s => %s\n", event.EventType, event.Timestamp)
-	queueUpdate(h)
+	trigger := newTrigger(event.EventType, true)
+	logging.Logf("marathon.event."+event.EventType, "%s: %s => %s\n", trigger.Id, event.EventType, event.Timestamp)
+	if faults.DropEvent() {
+		log.Printf("%s: Dropped by fault injection\n", trigger.Id)
+		return
+	}
+	if h.History != nil && event.EventType == "health_status_changed_event" && event.Alive != nil {
+		if err := h.History.RecordHealth(event.AppId, event.TaskId, *event.Alive, time.Now()); err != nil {
+			log.Printf("%s: Unable to save backend history: %s\n", trigger.Id, err)
+		}
+	}
+	if h.Conf.Marathon.DeploymentGating && !h.gate.passes(event, h.Conf.Marathon.DeploymentMaxWaitDuration(), time.Now()) {
+		logging.Logf("update.gated", "%s: Ignored until the deployment completes\n", trigger.Id)
+		h.Conf.StatsD.Increment(1.0, "callback.marathon.gated", 1)
+		return
+	}
+	batching := h.Conf.Marathon.DeploymentBatching || h.Conf.Marathon.RestartBatching
+	if batching && h.batcher().hold(event, trigger, h.Conf.Marathon.DeploymentMaxWaitDuration()) {
+		logging.Logf("update.held", "%s: Held until running deployments complete\n", trigger.Id)
+		return
+	}
+	queueUpdate(h, trigger)
 	h.Conf.StatsD.Increment(1.0, "callback.marathon", 1)
 }
 
+// Renders the keys of a JSON Web Key Set refreshed in the background
+func (h *Handlers) JwtKeysHandler(url string) {
+	trigger := newTrigger("jwks_refresh", false)
+	log.Printf("%s: Keys of %s changed\n", trigger.Id, url)
+	queueUpdate(h, trigger)
+}
+
 func (h *Handlers) ServiceEventHandler(event ServiceEvent) {
-	log.Println("Domain mapping: Stated changed")
-	queueUpdate(h)
+	trigger := newTrigger("service_"+event.EventType, false)
+	log.Printf("%s: Domain mapping: Stated changed\n", trigger.Id)
+	if faults.DropEvent() {
+		log.Printf("%s: Dropped by fault injection\n", trigger.Id)
+		return
+	}
+	queueUpdate(h, trigger)
 	h.Conf.StatsD.Increment(1.0, "reload.domain", 1)
 }
 
-var updateChan = make(chan *Handlers, 1)
+var updateChan = make(chan update, 1)
+
+// Template data of the configuration HAProxy currently runs with,
+// only accessed by the update loop
+var appliedData *haproxy.TemplateData
+
+// Services whose owners were told their app is gone, only accessed
+// by the update loop
+var orphanedServices = map[string]bool{}
 
 func init() {
 	go func() {
 		log.Println("Starting update loop")
 		for {
-			h := <-updateChan
-			handleHAPUpdate(h.Conf, h.Zookeeper)
+			u := <-updateChan
+			handleHAPUpdate(u)
 		}
 	}()
 }
 
 var queueUpdateSem = make(chan int, 1)
 
-func queueUpdate(h *Handlers) {
+func queueUpdate(h *Handlers, triggers ...Trigger) {
 	queueUpdateSem <- 1
 
+	u := update{handlers: h, triggers: triggers}
 	select {
-	case _ = <-updateChan:
-		log.Println("Found pending update request. Don't start another one.")
+	case pending := <-updateChan:
+		// the pending update now also renders for these events
+		u.triggers = append(pending.triggers, triggers...)
+		countStats(func(s *Stats) { s.RendersSkipped++ })
+		logging.Logf("update.pending", "%s: Found pending update request for %s. Don't start another one.\n", u.eventIds(), pending.eventIds())
 	default:
-		log.Println("Queuing an haproxy update.")
+		logging.Logf("update.queued", "%s: Queuing an haproxy update.\n", u.eventIds())
 	}
-	updateChan <- h
+	updateChan <- u
 
 	<-queueUpdateSem
 }
 
-func handleHAPUpdate(conf *configuration.Configuration, conn *zk.Conn) bool {
-	currentContent, _ := ioutil.ReadFile(conf.HAProxy.OutputPath)
+/*
+	Renders the configuration and reloads HAProxy, logging the chain of
+	event ids, render id and reload id with the time spent in each stage
+*/
+func handleHAPUpdate(u update) bool {
+	h := u.handlers
+	conf := h.Conf
+	eventIds := u.eventIds()
+	renderId := nextId("render", &renderSequence)
+	started := time.Now()
+	log.Printf("%s: Rendering for events %s, queued for %s\n", renderId, eventIds, started.Sub(u.firstReceived()))
+
+	result := state.Reload{RenderId: renderId, Timestamp: started}
+	// apps of the render, recorded by the backend history once applied
+	var renderedApps marathon.AppList
+	defer func() {
+		result.DurationMs = int64(time.Since(started) / time.Millisecond)
+		if marathonEvent, ok := u.firstMarathonEvent(); ok && result.Success {
+			lag := time.Since(marathonEvent)
+			result.AppliedLagMs = int64(lag / time.Millisecond)
+			conf.StatsD.Gauge(1.0, "config.applied_lag_ms", strconv.FormatInt(result.AppliedLagMs, 10))
+		}
+		countRender(result.Success, time.Since(u.firstReceived()))
+		h.State.RecordReload(result)
+		// appliedData holds the configuration HAProxy was just given
+		if conf.HAProxy.SmokeCheck.Enabled && result.Success && (result.Reloaded || result.RuntimeUpdate) {
+			scheduleSmokeCheck(h, renderId, *appliedData)
+		}
+		if h.History != nil && result.Success && renderedApps != nil {
+			if err := h.History.Update(renderedApps, result.Revision, time.Now()); err != nil {
+				log.Printf("%s: Unable to save backend history: %s\n", renderId, err)
+			}
+		}
+		if h.Instances != nil {
+			if err := h.Instances.Update(result); err != nil {
+				logging.Logf("zookeeper.instances", "Unable to publish instance status: %s\n", err)
+			}
+		}
+	}()
+
+	outputPath := conf.HAProxy.EffectiveOutputPath()
+	currentContent, _ := ioutil.ReadFile(outputPath)
 
 	templateContent, err := ioutil.ReadFile(conf.HAProxy.TemplatePath)
 	if err != nil {
 		log.Panicf("Cannot read template file: %s", err)
 	}
 
-	templateData := haproxy.GetTemplateData(conf, conn)
+	templateData := haproxy.GetRenderData(conf, h.Zookeeper, capture.NewRender())
+	removeOrphanedPreviews(h, templateData)
+	notifyOrphanedServices(h, templateData)
+	if conf.Mesos.DrainMaintenance {
+		scheduleMaintenanceUpdate(h, templateData.Maintenance)
+	}
+	scheduleExclusionUpdate(h, templateData.ExcludedTasks)
+	scheduleLimitsUpdate(h, templateData.LimitOverrides)
+	scheduleServicesUpdate(h, templateData.Services)
+	// services are nil when Zookeeper could not be read; a shadow
+	// Bamboo leaves the records to the active one
+	if h.DNS != nil && templateData.Services != nil && !conf.HAProxy.NoReload {
+		h.DNS.Update(templateData.Services)
+	}
+	// apps are nil when Marathon could not be reached; a shadow Bamboo
+	// leaves the registrations to the active one
+	if h.Consul != nil && templateData.Apps != nil && !conf.HAProxy.NoReload {
+		h.Consul.Update(templateData.Apps, templateData.Services)
+	}
+	checkStickTables(conf, templateData)
+	revision, bumped := h.State.Update(templateData)
+	if bumped {
+		log.Printf("State revision %d\n", revision)
+	}
+	renderedApps = templateData.Apps
+	if h.AppMetrics != nil && templateData.Apps != nil {
+		metrics.ReportApps(&conf.StatsD, h.AppMetrics, templateData.Apps, templateData.Services, h.State.BackendChanges())
+	}
+	templateData.Revision = revision
+	result.Revision = revision
+
+	templateData.LuaScripts, err = haproxy.ReadLuaScripts(conf.HAProxy.Lua)
+	if err != nil {
+		logging.Logf("render.failed", "%s: HAProxy: %s, configuration not updated\n", renderId, err)
+		conf.StatsD.Increment(1.0, "render.failed", 1)
+		result.Error = err.Error()
+		return false
+	}
 
-	newContent, err := template.RenderTemplate(conf.HAProxy.TemplatePath, string(templateContent), templateData)
+	limits := template.Limits{
+		Timeout:       conf.HAProxy.RenderTimeoutDuration(),
+		MaxOutputSize: conf.HAProxy.MaxConfigSize,
+	}
+	newContent, err := template.RenderTemplateWithLimits(conf.HAProxy.TemplatePath, string(templateContent), templateData, limits)
+	wasValid := template.CurrentStatus().Valid
+	if status := template.RecordParse(conf.HAProxy.TemplatePath, err); status.Valid && !wasValid {
+		log.Printf("%s: HAProxy: Template parses again, leaving degraded mode\n", renderId)
+	}
+	if err == nil && faults.FailRender() {
+		err = errors.New("render failed by fault injection")
+	}
 
 	if err != nil {
-		log.Fatalf("Template syntax error: \n %s", err)
+		// Keep the current configuration running
+		logging.Logf("render.failed", "%s: HAProxy: Unable to render template, configuration not updated: %s\n", renderId, err)
+		conf.StatsD.Increment(1.0, "render.failed", 1)
+		result.Error = err.Error()
+		return false
+	}
+	result.ConfigHash = state.HashConfig(newContent)
+
+	issues := lint.Lint(newContent, conf.HAProxy.Lint)
+	for _, issue := range issues {
+		logging.Logf("lint."+issue.Severity, "%s: HAProxy configuration lint %s\n", renderId, issue)
+	}
+	if len(issues) > 0 {
+		conf.StatsD.Increment(1.0, "lint.issues", len(issues))
 	}
+	if issues.HasErrors() && conf.HAProxy.Lint.Block {
+		log.Printf("%s: HAProxy: Lint errors in rendered configuration, configuration not updated\n", renderId)
+		conf.StatsD.Increment(1.0, "lint.blocked", 1)
+		result.Error = "lint errors in rendered configuration"
+		return false
+	}
+
+	log.Printf("%s: Rendered revision %d in %s\n", renderId, revision, time.Since(started))
+
+	// key files are read by HAProxy when it loads the configuration
+	keysChanged := !conf.HAProxy.NoReload && jwt.KeysChanged(templateData.JwtKeys)
+	if currentContent == nil || string(currentContent) != newContent || keysChanged {
+		if !validateRender(h, renderId, revision, currentContent, newContent, &result) {
+			return false
+		}
+
+		// SPOE engines referenced by the configuration must exist first
+		if conf.HAProxy.Mirror.Enabled && !conf.HAProxy.NoReload {
+			err := ioutil.WriteFile(conf.HAProxy.Mirror.SpoeConfigPath, []byte(haproxy.SpoeConfig(templateData)), 0666)
+			if err != nil {
+				log.Printf("%s: HAProxy: Unable to write SPOE configuration, configuration not updated: %s\n", renderId, err)
+				result.Error = err.Error()
+				return false
+			}
+		}
 
-	if currentContent == nil || string(currentContent) != newContent {
-		err := ioutil.WriteFile(conf.HAProxy.OutputPath, []byte(newContent), 0666)
+		// as well as SPOE agents, token verification keys and Lua scripts
+		if !conf.HAProxy.NoReload {
+			if len(templateData.SpoeEngines()) > 0 {
+				err := ioutil.WriteFile(conf.HAProxy.Spoe.ConfigPath, []byte(haproxy.AgentsSpoeConfig(templateData)), 0666)
+				if err != nil {
+					log.Printf("%s: HAProxy: Unable to write SPOE agents configuration, configuration not updated: %s\n", renderId, err)
+					result.Error = err.Error()
+					return false
+				}
+			}
+			if err := jwt.WriteKeys(templateData.JwtKeys); err != nil {
+				log.Printf("%s: HAProxy: Unable to write JWT keys, configuration not updated: %s\n", renderId, err)
+				result.Error = err.Error()
+				return false
+			}
+			if err := haproxy.WriteLuaScripts(templateData.LuaScripts); err != nil {
+				log.Printf("%s: HAProxy: Unable to write Lua scripts, configuration not updated: %s\n", renderId, err)
+				result.Error = err.Error()
+				return false
+			}
+		}
+
+		err := ioutil.WriteFile(outputPath, []byte(newContent), 0666)
 		if err != nil {
 			log.Fatalf("Failed to write template on path: %s", err)
 		}
 
-		err = execCommand(conf.HAProxy.ReloadCommand)
+		if conf.HAProxy.NoReload {
+			result.Success = true
+			conf.StatsD.Increment(1.0, "reload.skipped", 1)
+			log.Printf("%s: HAProxy: Configuration written to %s, reload skipped (no-reload mode)\n", renderId, outputPath)
+			return true
+		}
+
+		if !keysChanged && applyRuntimeUpdate(conf, templateData, renderId) {
+			result.RuntimeUpdate = true
+			countStats(func(s *Stats) { s.RuntimeUpdates++ })
+			result.Success = true
+			appliedData = &templateData
+			return true
+		}
+
+		if conf.HAProxy.Reload.Strategy == "none" {
+			result.Success = true
+			appliedData = &templateData
+			conf.StatsD.Increment(1.0, "reload.external", 1)
+			log.Printf("%s: HAProxy: Configuration written to %s, reload left to external tooling\n", renderId, outputPath)
+			return true
+		}
+
+		reloadId := nextId("reload", &reloadSequence)
+		reloadStarted := time.Now()
+		if delay := faults.ReloadDelay(); delay > 0 {
+			log.Printf("%s: Reload delayed by fault injection for %s\n", reloadId, delay)
+			time.Sleep(delay)
+		}
+		log.Printf("%s: Reloading HAProxy with %s (events %s)\n", reloadId, renderId, eventIds)
+		result.ReloadId = reloadId
+		result.Reloaded = true
+		countStats(func(s *Stats) { s.Reloads++ })
+		err = h.Reloader.Reload()
+		scheduleRemoteRetry(h)
 		if err != nil {
-			log.Fatalf("HAProxy: update failed\n")
+			result.Error = err.Error()
+			notifyReloadFailure(h, templateData, err)
+			if _, remote := h.Reloader.(*haproxy.RemoteReloader); !remote {
+				log.Fatalf("%s: HAProxy: update failed\n", reloadId)
+			}
+			// the local configuration is written, stale targets are retried
+			log.Printf("%s: HAProxy: Remote update failed: %s\n", reloadId, err)
 		} else {
+			result.Success = true
+			appliedData = &templateData
 			conf.StatsD.Increment(1.0, "reload.marathon", 1)
-			log.Println("HAProxy: Configuration updated")
+			log.Printf("%s: HAProxy: Configuration updated in %s, %s after events %s\n", reloadId, time.Since(reloadStarted), time.Since(u.firstReceived()), eventIds)
 		}
 		return true
 	} else {
-		log.Println("HAProxy: Same content, no need to reload")
+		result.Success = true
+		appliedData = &templateData
+		logging.Logf("reload.unchanged", "%s: HAProxy: Same content, no need to reload\n", renderId)
+		retryRemoteTargets(h, renderId)
 		return false
 	}
 }
 
-func execCommand(cmd string) error {
-	log.Printf("Exec cmd: %s \n", cmd)
-	output, err := exec.Command("sh", "-c", cmd).CombinedOutput()
+/*
+	Sends the smoke probes through HAProxy once the delay after a reload
+	passed, adding the results to the reload history and telling the
+	owners of services whose probe failed
+*/
+func scheduleSmokeCheck(h *Handlers, renderId string, templateData haproxy.TemplateData) {
+	conf := h.Conf
+	targets := haproxy.SmokeTargets(conf.HAProxy.SmokeCheck, templateData)
+	if len(targets) == 0 {
+		return
+	}
+	time.AfterFunc(conf.HAProxy.SmokeCheck.DelayDuration(), func() {
+		results := haproxy.RunSmokeCheck(conf.HAProxy.SmokeCheck, targets)
+		failed := 0
+		for _, result := range results {
+			if result.Passed {
+				continue
+			}
+			failed++
+			logging.Logf("smoke.failed", "%s: Smoke probe %s with Host %q failed: %s\n", renderId, result.Url, result.Host, result.Error)
+			if serviceModel, ok := templateData.Services[result.ServiceId]; ok {
+				h.Notifications.Notify(serviceModel, notify.EventSmokeFailed, "The smoke probe "+result.Url+" failed after HAProxy applied a new configuration: "+result.Error)
+			}
+		}
+		if failed > 0 {
+			conf.StatsD.Increment(1.0, "smoke.failed", failed)
+		} else {
+			log.Printf("%s: Smoke check passed, %d probes\n", renderId, len(results))
+		}
+		conf.StatsD.Gauge(1.0, "smoke.failing", strconv.Itoa(failed))
+		h.State.RecordSmokeCheck(renderId, results)
+	})
+}
+
+/*
+	Asks the validation hook whether the rendered configuration may be
+	applied, recording a rejection and its reason in the result. A
+	failing hook keeps the current configuration unless it fails open.
+*/
+func validateRender(h *Handlers, renderId string, revision int64, currentContent []byte, newContent string, result *state.Reload) bool {
+	if h.ValidationHook == nil {
+		return true
+	}
+	conf := h.Conf
+	request := haproxy.ValidationRequest{
+		RenderId:   renderId,
+		Revision:   revision,
+		ConfigHash: result.ConfigHash,
+		Config:     newContent,
+	}
+	if currentContent != nil {
+		request.PreviousHash = state.HashConfig(string(currentContent))
+	}
+
+	decision, err := h.ValidationHook.Validate(request)
 	if err != nil {
-		log.Println(err.Error())
-		log.Println("Output:\n" + string(output[:]))
+		conf.StatsD.Increment(1.0, "validation.failed", 1)
+		if conf.HAProxy.ValidationHook.FailOpen {
+			log.Printf("%s: HAProxy: Validation hook failed, applying the configuration anyway: %s\n", renderId, err)
+			return true
+		}
+		log.Printf("%s: HAProxy: Validation hook failed, configuration not updated: %s\n", renderId, err)
+		result.Error = "validation hook failed: " + err.Error()
+		return false
+	}
+	if !decision.Allowed {
+		conf.StatsD.Increment(1.0, "validation.rejected", 1)
+		log.Printf("%s: HAProxy: Configuration rejected by the validation hook, not updated: %s\n", renderId, decision.Reason)
+		result.Rejected = true
+		result.Error = "rejected by validation hook: " + decision.Reason
+		return false
+	}
+	return true
+}
+
+/*
+	Updates the addresses of relocated tasks over the HAProxy runtime API
+	when nothing else changed since the running configuration and the
+	runtime-updates feature is on. Returns false when HAProxy must be
+	reloaded instead.
+*/
+func applyRuntimeUpdate(conf *configuration.Configuration, templateData haproxy.TemplateData, renderId string) bool {
+	if len(conf.HAProxy.RuntimeSocket) == 0 || appliedData == nil || !features.Enabled(configuration.FeatureRuntimeUpdates) {
+		return false
+	}
+	info := haproxy.CurrentInfo()
+	if info.Version.Known() && !info.Features.RuntimeServerAddr {
+		return false
+	}
+
+	relocations, ok := haproxy.Relocations(*appliedData, templateData)
+	if !ok || len(relocations) == 0 {
+		return false
+	}
+
+	err := haproxy.ApplyRelocations(haproxy.RuntimeAPI{SocketPath: conf.HAProxy.RuntimeSocket}, relocations)
+	if err != nil {
+		log.Printf("%s: HAProxy: Runtime update failed, reloading instead: %s\n", renderId, err)
+		conf.StatsD.Increment(1.0, "runtime.failed", 1)
+		return false
+	}
+
+	conf.StatsD.Increment(1.0, "runtime.updated", 1)
+	log.Printf("%s: HAProxy: %d relocated task endpoints updated through the runtime API, no reload\n", renderId, len(relocations))
+	return true
+}
+
+/*
+	Removes the preview routes of apps which no longer exist. Apps are
+	nil when Marathon could not be reached, services when Zookeeper
+	could not be read. A shadow Bamboo leaves the removal to the active
+	one.
+*/
+func removeOrphanedPreviews(h *Handlers, templateData haproxy.TemplateData) {
+	previews := h.Conf.Bamboo.Previews
+	if !previews.Enabled() || h.Conf.HAProxy.NoReload || templateData.Apps == nil || templateData.Services == nil {
+		return
+	}
+	for _, id := range preview.Orphaned(templateData.Apps, templateData.Services, previews.AppGracePeriodDuration(), time.Now()) {
+		err := service.Delete(h.Zookeeper, h.Conf.Bamboo.Zookeeper, id)
+		if err != nil && err != zk.ErrNoNode {
+			logging.Logf("zookeeper.previews", "Unable to remove preview route of %s: %s\n", id, err)
+			continue
+		}
+		log.Printf("Removed preview route of %s, its Marathon app is gone\n", id)
+		h.Conf.StatsD.Increment(1.0, "previews.removed", 1)
+		delete(templateData.Services, id)
+	}
+}
+
+/*
+	Tells the owners of services once that the Marathon app of their
+	service is gone. Preview routes are removed instead.
+*/
+func notifyOrphanedServices(h *Handlers, templateData haproxy.TemplateData) {
+	if templateData.Apps == nil || templateData.Services == nil {
+		return
+	}
+	apps := map[string]bool{}
+	for _, app := range templateData.Apps {
+		apps[app.Id] = true
+	}
+
+	for id := range orphanedServices {
+		if _, exists := templateData.Services[id]; !exists || apps[id] {
+			delete(orphanedServices, id)
+		}
+	}
+	for id, serviceModel := range templateData.Services {
+		if apps[id] || orphanedServices[id] || serviceModel.Preview != nil {
+			continue
+		}
+		orphanedServices[id] = true
+		h.Notifications.Notify(serviceModel, notify.EventServiceOrphaned, "The Marathon app "+id+" is gone, its service routes to no backend")
+	}
+}
+
+/*
+	Tells the owners of services whose backend is named in the error of
+	a failed reload, waiting for the notifications since Bamboo exits
+*/
+func notifyReloadFailure(h *Handlers, templateData haproxy.TemplateData, err error) {
+	for _, app := range templateData.Apps {
+		serviceModel, ok := templateData.Services[app.Id]
+		if !ok || len(app.Backend) == 0 || !strings.Contains(err.Error(), app.Backend) {
+			continue
+		}
+		h.Notifications.Notify(serviceModel, notify.EventReloadFailed, "HAProxy failed to reload a configuration with the backend "+app.Backend+": "+err.Error())
+	}
+	h.Notifications.Wait(h.Conf.Notifications.TimeoutDuration())
+}
+
+/*
+	Warns when the estimated memory of the stick tables exceeds the
+	configured budget
+*/
+func checkStickTables(conf *configuration.Configuration, templateData haproxy.TemplateData) {
+	usage := haproxy.EstimateStickTables(templateData.StickTables(), conf.HAProxy.StickTables.MemoryBudget)
+	conf.StatsD.Gauge(1.0, "sticktables.bytes", strconv.FormatInt(usage.TotalBytes, 10))
+	if usage.OverBudget {
+		logging.Logf("sticktables.budget", "Stick tables need an estimated %d MB, over the budget of %d MB\n", usage.TotalBytes>>20, conf.HAProxy.StickTables.MemoryBudget)
 	}
-	return err
 }
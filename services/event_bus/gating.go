@@ -0,0 +1,88 @@
+package event_bus
+
+import (
+	"sync"
+	"time"
+)
+
+// Marathon events still rendering in deployment gating mode
+var gatedEvents = map[string]bool{
+	"bamboo_startup":              true,
+	"deployment_success":          true,
+	"deployment_failed":           true,
+	"health_status_changed_event": true,
+}
+
+// Task states after which Marathon no longer runs the task
+var terminalTaskStatuses = map[string]bool{
+	"TASK_FINISHED":         true,
+	"TASK_FAILED":           true,
+	"TASK_KILLED":           true,
+	"TASK_LOST":             true,
+	"TASK_ERROR":            true,
+	"TASK_DROPPED":          true,
+	"TASK_GONE":             true,
+	"TASK_GONE_BY_OPERATOR": true,
+}
+
+/*
+	Tracks the apps of running deployments in deployment gating mode,
+	so that tasks ending outside deployments, e.g. a crashed task, are
+	still removed from HAProxy. Deployments which sent no completion
+	event within the maximum wait are considered complete.
+*/
+type deploymentGate struct {
+	lock    sync.Mutex
+	running map[string]gatedDeployment
+}
+
+type gatedDeployment struct {
+	started time.Time
+	apps    map[string]bool
+}
+
+/*
+	Returns whether the event renders in deployment gating mode
+*/
+func (g *deploymentGate) passes(event MarathonEvent, maxWait time.Duration, now time.Time) bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.running == nil {
+		g.running = map[string]gatedDeployment{}
+	}
+
+	switch event.EventType {
+	case "deployment_info":
+		deployment, found := g.running[event.Plan.Id]
+		if !found {
+			deployment = gatedDeployment{started: now, apps: map[string]bool{}}
+		}
+		for _, app := range event.CurrentStep.Apps() {
+			deployment.apps[app] = true
+		}
+		if len(event.Plan.Id) > 0 {
+			g.running[event.Plan.Id] = deployment
+		}
+	case "deployment_success", "deployment_failed":
+		delete(g.running, event.DeploymentId())
+	case "status_update_event":
+		if terminalTaskStatuses[event.TaskStatus] {
+			return !g.deploying(event.AppId, maxWait, now)
+		}
+	}
+	return gatedEvents[event.EventType]
+}
+
+// Called with the lock held
+func (g *deploymentGate) deploying(appId string, maxWait time.Duration, now time.Time) bool {
+	for id, deployment := range g.running {
+		if now.Sub(deployment.started) >= maxWait {
+			delete(g.running, id)
+			continue
+		}
+		if deployment.apps[appId] {
+			return true
+		}
+	}
+	return false
+}
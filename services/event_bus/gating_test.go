@@ -0,0 +1,47 @@
+package event_bus
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestDeploymentGate(t *testing.T) {
+	Convey("#passes", t, func() {
+		gate := &deploymentGate{}
+		now := time.Unix(1000, 0)
+		terminated := MarathonEvent{EventType: "status_update_event", AppId: "/app", TaskStatus: "TASK_KILLED"}
+
+		Convey("should render the startup, deployment completion and health events", func() {
+			So(gate.passes(MarathonEvent{EventType: "bamboo_startup"}, time.Minute, now), ShouldBeTrue)
+			So(gate.passes(MarathonEvent{EventType: "deployment_success", Id: "plan-1"}, time.Minute, now), ShouldBeTrue)
+			So(gate.passes(MarathonEvent{EventType: "health_status_changed_event"}, time.Minute, now), ShouldBeTrue)
+		})
+
+		Convey("should ignore task updates of running tasks", func() {
+			running := MarathonEvent{EventType: "status_update_event", AppId: "/app", TaskStatus: "TASK_RUNNING"}
+			So(gate.passes(running, time.Minute, now), ShouldBeFalse)
+		})
+
+		Convey("should render tasks ending outside deployments", func() {
+			So(gate.passes(terminated, time.Minute, now), ShouldBeTrue)
+		})
+
+		Convey("should ignore tasks of deployed apps ending during the deployment", func() {
+			So(gate.passes(restartEvent("deployment_info", "RestartApplication"), time.Minute, now), ShouldBeFalse)
+			So(gate.passes(terminated, time.Minute, now), ShouldBeFalse)
+
+			other := MarathonEvent{EventType: "status_update_event", AppId: "/other", TaskStatus: "TASK_FAILED"}
+			So(gate.passes(other, time.Minute, now), ShouldBeTrue)
+
+			So(gate.passes(MarathonEvent{EventType: "deployment_success", Id: "plan-1"}, time.Minute, now), ShouldBeTrue)
+			So(gate.passes(terminated, time.Minute, now), ShouldBeTrue)
+		})
+
+		Convey("should forget deployments past the maximum wait", func() {
+			gate.passes(restartEvent("deployment_info", "RestartApplication"), time.Minute, now)
+			So(gate.passes(terminated, time.Minute, now.Add(2*time.Minute)), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,101 @@
+package event_bus
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/QubitProducts/bamboo/services/exclusion"
+	"github.com/QubitProducts/bamboo/services/haproxy"
+	"github.com/QubitProducts/bamboo/services/limits"
+	"github.com/QubitProducts/bamboo/services/mesos"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+/*
+	Queues an update at a scheduled time, so that changes depending on
+	the clock are rendered without an event
+*/
+type updateTimer struct {
+	lock      sync.Mutex
+	timer     *time.Timer
+	eventType string
+}
+
+// Replaces the scheduled update, none is scheduled unless ok
+func (t *updateTimer) schedule(h *Handlers, at time.Time, ok bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	if !ok {
+		return
+	}
+
+	log.Printf("Next %s update at %s\n", t.eventType, at.Format(time.RFC3339))
+	t.timer = time.AfterFunc(at.Sub(time.Now()), func() {
+		trigger := newTrigger(t.eventType, false)
+		log.Printf("%s: Scheduled %s update\n", trigger.Id, t.eventType)
+		queueUpdate(h, trigger)
+	})
+}
+
+var maintenanceUpdate = &updateTimer{eventType: "mesos_maintenance"}
+var exclusionUpdate = &updateTimer{eventType: "exclusion_expiry"}
+var limitsUpdate = &updateTimer{eventType: "limits_expiry"}
+var servicesUpdate = &updateTimer{eventType: "service_expiry"}
+var remoteRetry = &updateTimer{eventType: "remote_retry"}
+
+// Interval at which remote targets which did not apply the
+// configuration are retried
+const remoteRetryInterval = 30 * time.Second
+
+// Renders when the next Mesos maintenance window starts or ends
+func scheduleMaintenanceUpdate(h *Handlers, windows []mesos.Window) {
+	at, ok := mesos.NextTransition(windows, time.Now(), h.Conf.Mesos.DrainBeforeDuration())
+	maintenanceUpdate.schedule(h, at, ok)
+}
+
+// Renders when the next task exclusion expires
+func scheduleExclusionUpdate(h *Handlers, tasks []exclusion.Task) {
+	at, ok := exclusion.NextExpiry(tasks)
+	exclusionUpdate.schedule(h, at, ok)
+}
+
+// Renders when the next server limit override expires
+func scheduleLimitsUpdate(h *Handlers, overrides []limits.Override) {
+	at, ok := limits.NextExpiry(overrides)
+	limitsUpdate.schedule(h, at, ok)
+}
+
+// Renders when the next service with a TTL expires
+func scheduleServicesUpdate(h *Handlers, services map[string]service.Service) {
+	at, ok := service.NextExpiry(services)
+	servicesUpdate.schedule(h, at, ok)
+}
+
+/*
+	Pushes the written configuration again to the remote targets which
+	did not apply it, e.g. because they were unreachable when it changed
+*/
+func retryRemoteTargets(h *Handlers, renderId string) {
+	remote, ok := h.Reloader.(*haproxy.RemoteReloader)
+	if !ok || !remote.Stale() {
+		return
+	}
+	log.Printf("%s: HAProxy: Retrying the remote targets which did not apply the configuration\n", renderId)
+	if err := remote.Reload(); err != nil {
+		log.Printf("%s: HAProxy: Remote update failed: %s\n", renderId, err)
+	}
+	scheduleRemoteRetry(h)
+}
+
+// Renders again while remote targets did not apply the configuration
+func scheduleRemoteRetry(h *Handlers) {
+	remote, ok := h.Reloader.(*haproxy.RemoteReloader)
+	stale := ok && remote.Stale()
+	remoteRetry.schedule(h, time.Now().Add(remoteRetryInterval), stale)
+}
@@ -0,0 +1,76 @@
+package event_bus
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+	Counters of the event pipeline since Bamboo started, for watchdogs
+	which would otherwise scrape the logs
+*/
+type Stats struct {
+	Started time.Time
+	// Events received by type, e.g. status_update_event or service_change
+	Events map[string]int64
+	// Calls of handlers by the event bus
+	HandlersExecuted int64
+	// Renders of the template, the failed ones included
+	Renders       int64
+	RendersFailed int64
+	// Updates left to a pending render instead of rendering again
+	RendersSkipped int64
+	// Configurations applied by reloading HAProxy or over its runtime API
+	Reloads        int64
+	RuntimeUpdates int64
+	// Milliseconds from the first event of a render until it completed
+	AverageLatencyMs float64
+	// Zookeeper watches set again once they fired, and failures to
+	WatchesReestablished int64
+	WatchesFailed        int64
+}
+
+var (
+	stats          = Stats{Started: time.Now(), Events: map[string]int64{}}
+	statsLatencyMs int64
+	statsLock      sync.Mutex
+)
+
+/*
+	Returns a copy of the counters. The watch counters are left to the
+	caller, since the event bus does not set the watches.
+*/
+func PipelineStats() Stats {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+
+	snapshot := stats
+	snapshot.Events = map[string]int64{}
+	for eventType, count := range stats.Events {
+		snapshot.Events[eventType] = count
+	}
+	if stats.Renders > 0 {
+		snapshot.AverageLatencyMs = float64(statsLatencyMs) / float64(stats.Renders)
+	}
+	return snapshot
+}
+
+func countStats(count func(*Stats)) {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+	count(&stats)
+}
+
+func countEvent(eventType string) {
+	countStats(func(s *Stats) { s.Events[eventType]++ })
+}
+
+func countRender(success bool, latency time.Duration) {
+	countStats(func(s *Stats) {
+		s.Renders++
+		if !success {
+			s.RendersFailed++
+		}
+		statsLatencyMs += int64(latency / time.Millisecond)
+	})
+}
@@ -0,0 +1,35 @@
+package event_bus
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestPipelineStats(t *testing.T) {
+	Convey("#PipelineStats", t, func() {
+		before := PipelineStats()
+
+		Convey("should count events by type", func() {
+			newTrigger("stats_test_event", false)
+			newTrigger("stats_test_event", false)
+			So(PipelineStats().Events["stats_test_event"], ShouldEqual, before.Events["stats_test_event"]+2)
+		})
+
+		Convey("should count renders and average their latency", func() {
+			countRender(true, 100*time.Millisecond)
+			countRender(false, 300*time.Millisecond)
+			after := PipelineStats()
+			So(after.Renders, ShouldEqual, before.Renders+2)
+			So(after.RendersFailed, ShouldEqual, before.RendersFailed+1)
+			So(after.AverageLatencyMs, ShouldBeGreaterThan, 0)
+		})
+
+		Convey("should return a copy of the counters", func() {
+			PipelineStats().Events["stats_test_copy"] = 1
+			_, copied := PipelineStats().Events["stats_test_copy"]
+			So(copied, ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,98 @@
+package exclusion
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/samuel/go-zookeeper/zk"
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+/*
+	Agent host whose tasks are excluded from all backends until it is
+	enabled again
+*/
+type Host struct {
+	Host     string
+	Reason   string `json:",omitempty"`
+	Disabled time.Time
+}
+
+/*
+	Stores the host in the blacklist, replacing an earlier entry
+*/
+func DisableHost(conn *zk.Conn, zkConf conf.Zookeeper, host Host) error {
+	data, err := json.Marshal(host)
+	if err != nil {
+		return err
+	}
+
+	err = ensurePathExists(conn, zkConf.HostsPath())
+	if err != nil {
+		return err
+	}
+
+	path := zkConf.HostsPath() + "/" + url.QueryEscape(host.Host)
+	_, err = conn.Create(path, data, 0, zk.WorldACL(zk.PermAll))
+	if err == zk.ErrNodeExists {
+		_, err = conn.Set(path, data, -1)
+	}
+	return err
+}
+
+/*
+	Removes the host from the blacklist, zk.ErrNoNode when it was not
+	disabled
+*/
+func EnableHost(conn *zk.Conn, zkConf conf.Zookeeper, host string) error {
+	return conn.Delete(zkConf.HostsPath()+"/"+url.QueryEscape(host), -1)
+}
+
+/*
+	Returns the disabled hosts sorted by host
+*/
+func Hosts(conn *zk.Conn, zkConf conf.Zookeeper) ([]Host, error) {
+	hosts := []Host{}
+	keys, _, err := conn.Children(zkConf.HostsPath())
+	if err == zk.ErrNoNode {
+		return hosts, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		data, _, err := conn.Get(zkConf.HostsPath() + "/" + key)
+		if err == zk.ErrNoNode {
+			// enabled meanwhile
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		host := Host{}
+		if err := json.Unmarshal(data, &host); err != nil {
+			host.Host, _ = url.QueryUnescape(key)
+		}
+		hosts = append(hosts, host)
+	}
+	sort.Sort(hostsByName(hosts))
+	return hosts, nil
+}
+
+type hostsByName []Host
+
+func (h hostsByName) Len() int           { return len(h) }
+func (h hostsByName) Less(i, j int) bool { return h[i].Host < h[j].Host }
+func (h hostsByName) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func ensurePathExists(conn *zk.Conn, path string) error {
+	_, err := conn.Create(path, []byte{}, 0, zk.WorldACL(zk.PermAll))
+	if err == zk.ErrNodeExists {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,170 @@
+package exclusion
+
+import (
+	"encoding/json"
+	"log"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/samuel/go-zookeeper/zk"
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+/*
+	Marathon task excluded from its backends until it expires or is
+	included again
+*/
+type Task struct {
+	TaskId   string
+	Reason   string `json:",omitempty"`
+	Excluded time.Time
+	// Zero when the exclusion never expires
+	Expires time.Time
+}
+
+func (t Task) Expired(at time.Time) bool {
+	return !t.Expires.IsZero() && !at.Before(t.Expires)
+}
+
+/*
+	Stores the task exclusion, replacing an earlier one of the task
+*/
+func ExcludeTask(conn *zk.Conn, zkConf conf.Zookeeper, task Task) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+
+	err = ensurePathExists(conn, zkConf.TasksPath())
+	if err != nil {
+		return err
+	}
+
+	path := zkConf.TasksPath() + "/" + url.QueryEscape(task.TaskId)
+	_, err = conn.Create(path, data, 0, zk.WorldACL(zk.PermAll))
+	if err == zk.ErrNodeExists {
+		_, err = conn.Set(path, data, -1)
+	}
+	return err
+}
+
+/*
+	Removes the task exclusion, zk.ErrNoNode when the task was not
+	excluded
+*/
+func IncludeTask(conn *zk.Conn, zkConf conf.Zookeeper, taskId string) error {
+	return conn.Delete(zkConf.TasksPath()+"/"+url.QueryEscape(taskId), -1)
+}
+
+/*
+	Returns the task exclusions in effect sorted by task id. Expired
+	exclusions are left out, CleanupTasks removes them.
+*/
+func Tasks(conn *zk.Conn, zkConf conf.Zookeeper) ([]Task, error) {
+	tasks := []Task{}
+	now := time.Now()
+	err := readTasks(conn, zkConf, func(path string, version int32, task Task) error {
+		if !task.Expired(now) {
+			tasks = append(tasks, task)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(tasksById(tasks))
+	return tasks, nil
+}
+
+// Interval of RunCleanup
+const CleanupInterval = time.Minute
+
+/*
+	Removes the expired task exclusions, returning how many were
+	removed
+*/
+func CleanupTasks(conn *zk.Conn, zkConf conf.Zookeeper, now time.Time) (int, error) {
+	removed := 0
+	err := readTasks(conn, zkConf, func(path string, version int32, task Task) error {
+		if !task.Expired(now) {
+			return nil
+		}
+		// an exclusion changed meanwhile is kept by the version check
+		err := conn.Delete(path, version)
+		if err == zk.ErrNoNode || err == zk.ErrBadVersion {
+			return nil
+		}
+		if err == nil {
+			removed++
+		}
+		return err
+	})
+	return removed, err
+}
+
+// Runs CleanupTasks every CleanupInterval
+func RunCleanup(conn *zk.Conn, zkConf conf.Zookeeper) {
+	for {
+		time.Sleep(CleanupInterval)
+		removed, err := CleanupTasks(conn, zkConf, time.Now())
+		if err != nil {
+			log.Printf("Unable to remove expired task exclusions: %s\n", err)
+		}
+		if removed > 0 {
+			log.Printf("Removed %d expired task exclusions\n", removed)
+		}
+	}
+}
+
+// Calls visit with every stored task exclusion and its node
+func readTasks(conn *zk.Conn, zkConf conf.Zookeeper, visit func(path string, version int32, task Task) error) error {
+	keys, _, err := conn.Children(zkConf.TasksPath())
+	if err == zk.ErrNoNode {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		path := zkConf.TasksPath() + "/" + key
+		data, stat, err := conn.Get(path)
+		if err == zk.ErrNoNode {
+			// included meanwhile
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		task := Task{}
+		if err := json.Unmarshal(data, &task); err != nil {
+			task.TaskId, _ = url.QueryUnescape(key)
+		}
+		if err := visit(path, stat.Version, task); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+	Returns when the next of the exclusions expires, false when none
+	of them expires
+*/
+func NextExpiry(tasks []Task) (time.Time, bool) {
+	var next time.Time
+	for _, task := range tasks {
+		if !task.Expires.IsZero() && (next.IsZero() || task.Expires.Before(next)) {
+			next = task.Expires
+		}
+	}
+	return next, !next.IsZero()
+}
+
+type tasksById []Task
+
+func (t tasksById) Len() int           { return len(t) }
+func (t tasksById) Less(i, j int) bool { return t[i].TaskId < t[j].TaskId }
+func (t tasksById) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
@@ -0,0 +1,40 @@
+package exclusion
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestTaskExpiry(t *testing.T) {
+	Convey("#Expired", t, func() {
+		task := Task{TaskId: "app.1", Expires: time.Unix(2000, 0)}
+
+		Convey("should expire once the TTL passed", func() {
+			So(task.Expired(time.Unix(1999, 0)), ShouldBeFalse)
+			So(task.Expired(time.Unix(2000, 0)), ShouldBeTrue)
+		})
+
+		Convey("should never expire without expiry time", func() {
+			So(Task{TaskId: "app.1"}.Expired(time.Unix(99999, 0)), ShouldBeFalse)
+		})
+	})
+
+	Convey("#NextExpiry", t, func() {
+		Convey("should return the earliest expiry", func() {
+			next, ok := NextExpiry([]Task{
+				{TaskId: "app.1", Expires: time.Unix(3000, 0)},
+				{TaskId: "app.2"},
+				{TaskId: "app.3", Expires: time.Unix(2000, 0)},
+			})
+			So(ok, ShouldBeTrue)
+			So(next, ShouldResemble, time.Unix(2000, 0))
+		})
+
+		Convey("should report exclusions without expiry", func() {
+			_, ok := NextExpiry([]Task{{TaskId: "app.2"}})
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
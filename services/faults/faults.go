@@ -0,0 +1,65 @@
+package faults
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+	Faults injected into the next events, renders and reloads. Every
+	injected fault is consumed once it occurred.
+*/
+type Faults struct {
+	// Number of renders to fail
+	FailRenders int
+	// Seconds the next reload is delayed
+	ReloadDelay int64
+	// Number of Marathon and Zookeeper events to drop
+	DropEvents int
+}
+
+var lock sync.Mutex
+var pending Faults
+
+func Set(faults Faults) {
+	lock.Lock()
+	defer lock.Unlock()
+	pending = faults
+}
+
+func Current() Faults {
+	lock.Lock()
+	defer lock.Unlock()
+	return pending
+}
+
+// Whether the current render must fail
+func FailRender() bool {
+	lock.Lock()
+	defer lock.Unlock()
+	if pending.FailRenders <= 0 {
+		return false
+	}
+	pending.FailRenders--
+	return true
+}
+
+// Delay of the current reload
+func ReloadDelay() time.Duration {
+	lock.Lock()
+	defer lock.Unlock()
+	delay := time.Duration(pending.ReloadDelay) * time.Second
+	pending.ReloadDelay = 0
+	return delay
+}
+
+// Whether the current event must be dropped
+func DropEvent() bool {
+	lock.Lock()
+	defer lock.Unlock()
+	if pending.DropEvents <= 0 {
+		return false
+	}
+	pending.DropEvents--
+	return true
+}
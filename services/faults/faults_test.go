@@ -0,0 +1,30 @@
+package faults
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestFaults(t *testing.T) {
+	Convey("Injected faults", t, func() {
+		Set(Faults{FailRenders: 1, ReloadDelay: 5, DropEvents: 2})
+		Reset(func() { Set(Faults{}) })
+
+		Convey("should be consumed once they occurred", func() {
+			So(FailRender(), ShouldBeTrue)
+			So(FailRender(), ShouldBeFalse)
+			So(ReloadDelay(), ShouldEqual, 5*time.Second)
+			So(ReloadDelay(), ShouldEqual, 0)
+			So(DropEvent(), ShouldBeTrue)
+			So(DropEvent(), ShouldBeTrue)
+			So(DropEvent(), ShouldBeFalse)
+		})
+
+		Convey("should report the remaining faults", func() {
+			DropEvent()
+			So(Current(), ShouldResemble, Faults{FailRenders: 1, ReloadDelay: 5, DropEvents: 1})
+		})
+	})
+}
@@ -0,0 +1,101 @@
+package features
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+// Feature flag with its current value
+type Flag struct {
+	conf.Feature
+	Enabled bool
+	// Whether the flag was toggled at runtime, away from the configuration
+	Toggled bool
+}
+
+var lock sync.RWMutex
+var configured = map[string]bool{}
+var enabled = map[string]bool{}
+
+/*
+	Sets the flags from the configuration, dropping runtime toggles.
+	Flags the configuration does not set are at their default.
+*/
+func Configure(flags map[string]bool) {
+	lock.Lock()
+	defer lock.Unlock()
+	configured = map[string]bool{}
+	for _, feature := range conf.KnownFeatures {
+		configured[feature.Name] = feature.Default
+		if value, ok := flags[feature.Name]; ok {
+			configured[feature.Name] = value
+		}
+	}
+	enabled = map[string]bool{}
+	for name, value := range configured {
+		enabled[name] = value
+	}
+}
+
+// Whether a flag is on, unknown flags are off
+func Enabled(name string) bool {
+	lock.RLock()
+	defer lock.RUnlock()
+	if value, ok := enabled[name]; ok {
+		return value
+	}
+	feature, _ := conf.LookupFeature(name)
+	return feature.Default
+}
+
+/*
+	Toggles a flag until the next start. Only flags marked Runtime can
+	be toggled.
+*/
+func Set(name string, value bool) (Flag, error) {
+	feature, ok := conf.LookupFeature(name)
+	if !ok {
+		return Flag{}, fmt.Errorf("unknown feature flag %s", name)
+	}
+	if !feature.Runtime {
+		return Flag{}, fmt.Errorf("feature flag %s can only be set in the configuration", name)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	enabled[name] = value
+	return flagOf(feature), nil
+}
+
+// Returns the known flags sorted by name
+func All() []Flag {
+	lock.RLock()
+	defer lock.RUnlock()
+	flags := []Flag{}
+	for _, feature := range conf.KnownFeatures {
+		flags = append(flags, flagOf(feature))
+	}
+	sort.Sort(flagsByName(flags))
+	return flags
+}
+
+func flagOf(feature conf.Feature) Flag {
+	value, ok := enabled[feature.Name]
+	if !ok {
+		value = feature.Default
+	}
+	initial, ok := configured[feature.Name]
+	if !ok {
+		initial = feature.Default
+	}
+	return Flag{Feature: feature, Enabled: value, Toggled: value != initial}
+}
+
+type flagsByName []Flag
+
+func (f flagsByName) Len() int           { return len(f) }
+func (f flagsByName) Less(i, j int) bool { return f[i].Name < f[j].Name }
+func (f flagsByName) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
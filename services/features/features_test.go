@@ -0,0 +1,44 @@
+package features
+
+import (
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+func TestFeatures(t *testing.T) {
+	Convey("Feature flags", t, func() {
+		Configure(map[string]bool{})
+		Reset(func() { Configure(map[string]bool{}) })
+
+		Convey("should default to the declared value", func() {
+			So(Enabled(conf.FeatureRuntimeUpdates), ShouldBeTrue)
+		})
+
+		Convey("should follow the configuration", func() {
+			Configure(map[string]bool{conf.FeatureRuntimeUpdates: false})
+			So(Enabled(conf.FeatureRuntimeUpdates), ShouldBeFalse)
+			So(All()[0].Toggled, ShouldBeFalse)
+		})
+
+		Convey("should toggle runtime flags", func() {
+			flag, err := Set(conf.FeatureRuntimeUpdates, false)
+			So(err, ShouldBeNil)
+			So(flag.Toggled, ShouldBeTrue)
+			So(Enabled(conf.FeatureRuntimeUpdates), ShouldBeFalse)
+		})
+
+		Convey("should drop runtime toggles when configured again", func() {
+			Set(conf.FeatureRuntimeUpdates, false)
+			Configure(map[string]bool{})
+			So(Enabled(conf.FeatureRuntimeUpdates), ShouldBeTrue)
+		})
+
+		Convey("should reject unknown flags", func() {
+			_, err := Set("sse-events", true)
+			So(err.Error(), ShouldEqual, "unknown feature flag sse-events")
+			So(Enabled("sse-events"), ShouldBeFalse)
+		})
+	})
+}
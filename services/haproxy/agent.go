@@ -0,0 +1,149 @@
+package haproxy
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/atomicfile"
+)
+
+const (
+	// Validates, writes and reloads
+	AgentApply = "apply"
+	// Validates and writes, leaving HAProxy alone
+	AgentWrite = "write"
+	// Only validates
+	AgentValidate = "validate"
+)
+
+// Configuration pushed by a controller Bamboo with what to do with it
+type AgentPush struct {
+	Config string
+	// apply, write or validate; apply when empty
+	Action string
+}
+
+func (p AgentPush) EffectiveAction() string {
+	if len(p.Action) == 0 {
+		return AgentApply
+	}
+	return p.Action
+}
+
+// Outcome of a push, reported back to the controller
+type AgentResult struct {
+	Host     string
+	Changed  bool
+	Valid    bool
+	Reloaded bool
+	Error    string `json:",omitempty"`
+	// Milliseconds spent validating and reloading
+	DurationMs int64
+}
+
+// Hash of the configuration the agent last reloaded HAProxy with
+var agentReloaded = struct {
+	lock sync.Mutex
+	hash string
+}{}
+
+func reloadedHash() string {
+	agentReloaded.lock.Lock()
+	defer agentReloaded.lock.Unlock()
+	return agentReloaded.hash
+}
+
+func recordReloaded(hash string) {
+	agentReloaded.lock.Lock()
+	defer agentReloaded.lock.Unlock()
+	agentReloaded.hash = hash
+}
+
+/*
+	Applies a pushed configuration on the agent host. The configuration
+	is checked with `haproxy -c` before it replaces the current one, so
+	an invalid push leaves the running configuration in place. Unchanged
+	configurations are not written, and only reloaded when the agent
+	did not reload HAProxy with them yet, e.g. after a failed reload or
+	a write.
+*/
+func ApplyPush(config conf.HAProxy, push AgentPush, reloader Reloader) (result AgentResult) {
+	started := time.Now()
+	result.Host, _ = os.Hostname()
+	defer func() {
+		result.DurationMs = int64(time.Since(started) / time.Millisecond)
+	}()
+
+	action := push.EffectiveAction()
+	if action != AgentApply && action != AgentWrite && action != AgentValidate {
+		result.Error = "unknown action " + action
+		return result
+	}
+	content := []byte(push.Config)
+	hash := configHash(content)
+	if current, err := ioutil.ReadFile(config.OutputPath); err == nil && bytes.Equal(current, content) {
+		result.Valid = true
+		if action == AgentApply && reloadedHash() != hash {
+			reload(reloader, hash, &result)
+		}
+		return result
+	}
+
+	stagedPath := config.OutputPath + ".bamboo"
+	if err := atomicfile.WriteFile(stagedPath, content, 0644); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if err := validateConfig(config, stagedPath); err != nil {
+		os.Remove(stagedPath)
+		result.Error = err.Error()
+		return result
+	}
+	result.Valid = true
+	if action == AgentValidate {
+		os.Remove(stagedPath)
+		return result
+	}
+
+	if err := os.Rename(stagedPath, config.OutputPath); err != nil {
+		os.Remove(stagedPath)
+		result.Error = err.Error()
+		return result
+	}
+	result.Changed = true
+	if action == AgentApply {
+		reload(reloader, hash, &result)
+	} else {
+		// HAProxy still runs the configuration reloaded before
+		recordReloaded("")
+	}
+	return result
+}
+
+func reload(reloader Reloader, hash string, result *AgentResult) {
+	if err := reloader.Reload(); err != nil {
+		recordReloaded("")
+		result.Error = err.Error()
+		return
+	}
+	recordReloaded(hash)
+	result.Reloaded = true
+}
+
+func validateConfig(config conf.HAProxy, path string) error {
+	if config.Remote.SkipValidation {
+		return nil
+	}
+	output, err := exec.Command(config.BinaryPath, "-c", "-f", path).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %s: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package haproxy
+
+import (
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+type countingReloader struct {
+	reloads int
+	err     error
+}
+
+func (c *countingReloader) Reload() error {
+	c.reloads++
+	return c.err
+}
+
+func TestApplyPush(t *testing.T) {
+	Convey("#ApplyPush", t, func() {
+		dir, _ := ioutil.TempDir("", "bamboo-agent")
+		defer os.RemoveAll(dir)
+		config := conf.HAProxy{OutputPath: filepath.Join(dir, "haproxy.cfg"), BinaryPath: "true"}
+		ioutil.WriteFile(config.OutputPath, []byte("global\n"), 0644)
+		reloader := &countingReloader{}
+		recordReloaded(configHash([]byte("global\n")))
+
+		Convey("should write and reload changed configurations", func() {
+			result := ApplyPush(config, AgentPush{Config: "global\n  daemon\n"}, reloader)
+			So(result.Error, ShouldBeEmpty)
+			So(result.Changed, ShouldBeTrue)
+			So(result.Reloaded, ShouldBeTrue)
+			content, _ := ioutil.ReadFile(config.OutputPath)
+			So(string(content), ShouldEqual, "global\n  daemon\n")
+			So(reloader.reloads, ShouldEqual, 1)
+		})
+
+		Convey("should leave unchanged configurations alone", func() {
+			result := ApplyPush(config, AgentPush{Config: "global\n"}, reloader)
+			So(result.Changed, ShouldBeFalse)
+			So(reloader.reloads, ShouldEqual, 0)
+		})
+
+		Convey("should reload unchanged configurations HAProxy was not reloaded with", func() {
+			reloader.err = errors.New("reload failed")
+			result := ApplyPush(config, AgentPush{Config: "global\n  daemon\n"}, reloader)
+			So(result.Error, ShouldEqual, "reload failed")
+
+			reloader.err = nil
+			result = ApplyPush(config, AgentPush{Config: "global\n  daemon\n"}, reloader)
+			So(result.Error, ShouldBeEmpty)
+			So(result.Changed, ShouldBeFalse)
+			So(result.Reloaded, ShouldBeTrue)
+			So(reloader.reloads, ShouldEqual, 2)
+
+			result = ApplyPush(config, AgentPush{Config: "global\n  daemon\n"}, reloader)
+			So(result.Reloaded, ShouldBeFalse)
+			So(reloader.reloads, ShouldEqual, 2)
+		})
+
+		Convey("should reload written configurations once applied", func() {
+			ApplyPush(config, AgentPush{Config: "global\n  daemon\n", Action: AgentWrite}, reloader)
+			result := ApplyPush(config, AgentPush{Config: "global\n  daemon\n"}, reloader)
+			So(result.Reloaded, ShouldBeTrue)
+			So(reloader.reloads, ShouldEqual, 1)
+		})
+
+		Convey("should keep the current configuration when the push is invalid", func() {
+			config.BinaryPath = "false"
+			result := ApplyPush(config, AgentPush{Config: "invalid\n"}, reloader)
+			So(result.Valid, ShouldBeFalse)
+			So(result.Error, ShouldStartWith, "invalid configuration")
+			content, _ := ioutil.ReadFile(config.OutputPath)
+			So(string(content), ShouldEqual, "global\n")
+			So(reloader.reloads, ShouldEqual, 0)
+		})
+
+		Convey("should only write or validate when asked to", func() {
+			result := ApplyPush(config, AgentPush{Config: "global\n  daemon\n", Action: AgentValidate}, reloader)
+			So(result.Valid, ShouldBeTrue)
+			So(result.Changed, ShouldBeFalse)
+			result = ApplyPush(config, AgentPush{Config: "global\n  daemon\n", Action: AgentWrite}, reloader)
+			So(result.Changed, ShouldBeTrue)
+			So(result.Reloaded, ShouldBeFalse)
+			So(reloader.reloads, ShouldEqual, 0)
+		})
+	})
+}
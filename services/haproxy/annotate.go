@@ -0,0 +1,122 @@
+package haproxy
+
+import "strings"
+
+// Kinds of configuration lines
+const (
+	LineSection   = "section"
+	LineDirective = "directive"
+	LineComment   = "comment"
+	LineBlank     = "blank"
+)
+
+// Keywords starting a section of the HAProxy configuration
+var sectionKeywords = map[string]bool{
+	"global":      true,
+	"defaults":    true,
+	"frontend":    true,
+	"backend":     true,
+	"listen":      true,
+	"userlist":    true,
+	"peers":       true,
+	"resolvers":   true,
+	"mailers":     true,
+	"cache":       true,
+	"program":     true,
+	"http-errors": true,
+	"ring":        true,
+}
+
+// Line of the rendered configuration, numbered from 1
+type ConfigLine struct {
+	Number int
+	Text   string
+	Kind   string
+	// First word of sections and directives, e.g. "backend" or "acl"
+	Keyword string `json:",omitempty"`
+	// Backend a use_backend or default_backend line routes to
+	Backend string `json:",omitempty"`
+	// App of the backend or the service ACL the line refers to
+	AppId string `json:",omitempty"`
+}
+
+/*
+	Section of the rendered configuration with its lines, from its
+	header to the line before the next section. Lines before the first
+	section are in a section of type "preamble".
+*/
+type ConfigSection struct {
+	Type      string
+	Name      string `json:",omitempty"`
+	StartLine int
+	EndLine   int
+	// App rendered into the section, for frontends and backends
+	AppId string `json:",omitempty"`
+	Lines []ConfigLine
+}
+
+/*
+	Splits a rendered configuration into sections and annotates them and
+	their lines with the apps they were rendered from, as mapped
+*/
+func AnnotateConfig(content string, mappings []Mapping) []ConfigSection {
+	backends := map[string]string{}
+	frontends := map[string]string{}
+	acls := map[string]string{}
+	for _, mapping := range mappings {
+		backends[mapping.Backend] = mapping.AppId
+		frontends[mapping.Frontend] = mapping.AppId
+		if len(mapping.AclName) > 0 {
+			acls[mapping.AclName] = mapping.AppId
+		}
+	}
+
+	sections := []ConfigSection{}
+	current := &ConfigSection{Type: "preamble", StartLine: 1}
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	for i, text := range lines {
+		line := ConfigLine{Number: i + 1, Text: text}
+		fields := strings.Fields(text)
+		switch {
+		case len(fields) == 0:
+			line.Kind = LineBlank
+		case strings.HasPrefix(fields[0], "#"):
+			line.Kind = LineComment
+		case sectionKeywords[fields[0]]:
+			line.Kind = LineSection
+			line.Keyword = fields[0]
+			if len(current.Lines) > 0 {
+				sections = append(sections, *current)
+			}
+			current = &ConfigSection{Type: fields[0], StartLine: line.Number}
+			if len(fields) > 1 {
+				current.Name = fields[1]
+				switch fields[0] {
+				case "backend":
+					current.AppId = backends[current.Name]
+				case "frontend", "listen":
+					current.AppId = frontends[current.Name]
+				}
+			}
+		default:
+			line.Kind = LineDirective
+			line.Keyword = fields[0]
+			if len(fields) > 1 {
+				switch fields[0] {
+				case "use_backend", "default_backend":
+					line.Backend = fields[1]
+					line.AppId = backends[line.Backend]
+				case "acl":
+					// route header ACLs are named after the service ACL
+					line.AppId = acls[strings.TrimSuffix(fields[1], "-route-header")]
+				}
+			}
+		}
+		current.Lines = append(current.Lines, line)
+		current.EndLine = line.Number
+	}
+	if len(current.Lines) > 0 {
+		sections = append(sections, *current)
+	}
+	return sections
+}
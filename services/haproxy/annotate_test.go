@@ -0,0 +1,65 @@
+package haproxy
+
+import (
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+const annotatedConfig = `# rendered by Bamboo
+global
+        maxconn 4096
+
+frontend http-in
+        bind *:80
+        # owner: web@example.com
+        acl ::web-aclrule hdr(host) -i web.example.com
+        acl ::web-aclrule-route-header req.hdr(X-Route) -m str /web
+        use_backend ::web-cluster if ::web-aclrule
+        default_backend fallback
+
+backend ::web-cluster
+        server web-1 10.0.0.1:31000
+`
+
+func TestAnnotateConfig(t *testing.T) {
+	Convey("#AnnotateConfig", t, func() {
+		mappings := []Mapping{{AppId: "/web", Backend: "::web-cluster", Frontend: "::web-cluster", AclName: "::web-aclrule"}}
+		sections := AnnotateConfig(annotatedConfig, mappings)
+
+		Convey("should split the configuration into sections", func() {
+			So(len(sections), ShouldEqual, 4)
+			So(sections[0].Type, ShouldEqual, "preamble")
+			So(sections[0].EndLine, ShouldEqual, 1)
+			So(sections[1].Type, ShouldEqual, "global")
+			So(sections[1].StartLine, ShouldEqual, 2)
+			So(sections[1].EndLine, ShouldEqual, 4)
+			So(sections[2].Type, ShouldEqual, "frontend")
+			So(sections[2].Name, ShouldEqual, "http-in")
+			So(sections[3].EndLine, ShouldEqual, 14)
+		})
+
+		Convey("should classify the lines", func() {
+			So(sections[1].Lines[0].Kind, ShouldEqual, LineSection)
+			So(sections[1].Lines[1].Kind, ShouldEqual, LineDirective)
+			So(sections[1].Lines[1].Keyword, ShouldEqual, "maxconn")
+			So(sections[1].Lines[2].Kind, ShouldEqual, LineBlank)
+			So(sections[2].Lines[2].Kind, ShouldEqual, LineComment)
+		})
+
+		Convey("should annotate the backend of an app", func() {
+			So(sections[3].Name, ShouldEqual, "::web-cluster")
+			So(sections[3].AppId, ShouldEqual, "/web")
+			So(sections[2].AppId, ShouldEqual, "")
+		})
+
+		Convey("should annotate the ACLs and routing of an app", func() {
+			So(sections[2].Lines[3].AppId, ShouldEqual, "/web")
+			So(sections[2].Lines[4].AppId, ShouldEqual, "/web")
+			So(sections[2].Lines[5].Backend, ShouldEqual, "::web-cluster")
+			So(sections[2].Lines[5].AppId, ShouldEqual, "/web")
+			So(sections[2].Lines[6].Backend, ShouldEqual, "fallback")
+			So(sections[2].Lines[6].AppId, ShouldEqual, "")
+		})
+	})
+}
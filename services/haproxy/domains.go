@@ -0,0 +1,42 @@
+package haproxy
+
+import (
+	"sort"
+)
+
+// Domain generated for an app by HAProxy.Naming.Domain
+type Domain struct {
+	AppId  string
+	Domain string
+	// Whether requests to the domain are routed to the app, false when
+	// the ACL of its service replaces the generated rule
+	Routed bool
+	// ACL of the service routing the app instead
+	Acl string `json:",omitempty"`
+}
+
+/*
+	Returns the generated domains of the apps, in app id order
+*/
+func (data TemplateData) Domains() []Domain {
+	domains := []Domain{}
+	for _, app := range data.Apps {
+		if len(app.Domain) == 0 {
+			continue
+		}
+		domain := Domain{AppId: app.Id, Domain: app.Domain, Routed: true}
+		if serviceModel, ok := data.Services[app.Id]; ok {
+			domain.Routed = false
+			domain.Acl = serviceModel.Acl
+		}
+		domains = append(domains, domain)
+	}
+	sort.Sort(domainsByAppId(domains))
+	return domains
+}
+
+type domainsByAppId []Domain
+
+func (d domainsByAppId) Len() int           { return len(d) }
+func (d domainsByAppId) Less(i, j int) bool { return d[i].AppId < d[j].AppId }
+func (d domainsByAppId) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
@@ -0,0 +1,52 @@
+package haproxy
+
+import (
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"testing"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/marathon"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+func TestDomains(t *testing.T) {
+	Convey("#Domains", t, func() {
+		naming := conf.Naming{
+			Backend:  conf.DefaultBackendName,
+			Frontend: conf.DefaultFrontendName,
+			Acl:      conf.DefaultAclName,
+			Domain:   "{{ .Name }}.{{ .Group }}.example.com",
+		}
+		apps := marathon.AppList{{Id: "/shop/web/api"}, {Id: "/shop/Cart"}, {Id: "/top"}}
+		applyNaming(apps, naming)
+		data := TemplateData{
+			Apps:     apps,
+			Services: map[string]service.Service{"/shop/web/api": {Id: "/shop/web/api", Acl: "path_beg /api"}},
+		}
+
+		Convey("should generate domains from the app name and groups", func() {
+			So(apps[0].Domain, ShouldEqual, "api.web.shop.example.com")
+			So(apps[1].Domain, ShouldEqual, "cart.shop.example.com")
+		})
+
+		Convey("should skip names which are not hostnames", func() {
+			So(apps[2].Domain, ShouldEqual, "")
+		})
+
+		Convey("should route apps without service to their domain", func() {
+			routes := data.Routes()
+			for _, route := range routes {
+				if route.AppId == "/shop/Cart" {
+					So(route.Acl, ShouldEqual, "hdr(host) -i cart.shop.example.com")
+				}
+			}
+
+			domains := data.Domains()
+			So(len(domains), ShouldEqual, 2)
+			So(domains[0].AppId, ShouldEqual, "/shop/Cart")
+			So(domains[0].Routed, ShouldBeTrue)
+			So(domains[1].Routed, ShouldBeFalse)
+			So(domains[1].Acl, ShouldEqual, "path_beg /api")
+		})
+	})
+}
@@ -3,19 +3,240 @@ package haproxy
 import (
 	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/samuel/go-zookeeper/zk"
 	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/capture"
+	"github.com/QubitProducts/bamboo/services/exclusion"
+	"github.com/QubitProducts/bamboo/services/jwt"
+	"github.com/QubitProducts/bamboo/services/limits"
+	"github.com/QubitProducts/bamboo/services/logging"
 	"github.com/QubitProducts/bamboo/services/marathon"
+	"github.com/QubitProducts/bamboo/services/mesos"
 	"github.com/QubitProducts/bamboo/services/service"
+	"time"
 )
 
-type templateData struct {
-	Apps     marathon.AppList
-	Services map[string]service.Service
+type TemplateData struct {
+	Apps      marathon.AppList
+	Services  map[string]service.Service
+	HAProxy   HAProxyInfo
+	Resolvers conf.Resolvers
+	// Routing of test traffic by request header
+	RouteHeader conf.RouteHeader
+	Mirror      conf.Mirror
+	// SPOE agents of every service
+	Spoe conf.Spoe
+	// Stick table size of services without their own
+	StickTableDefaults conf.StickTables
+	// Mesos maintenance windows, when draining is enabled
+	Maintenance []mesos.Window
+	// Tasks excluded through the API
+	ExcludedTasks []exclusion.Task
+	// Temporary server limits set through the API
+	LimitOverrides []limits.Override
+	// Token verification keys by app id
+	JwtKeys map[string][]jwt.Key
+	// Lua scripts to load, set when rendering
+	LuaScripts []LuaScript
+	// State revision, set once the data has been tracked
+	Revision int64
 }
 
-func GetTemplateData(config *conf.Configuration, conn *zk.Conn) interface{} {
+func GetTemplateData(config *conf.Configuration, conn *zk.Conn) TemplateData {
+	return GetRenderData(config, conn, nil)
+}
+
+/*
+	Returns the template data of a render, recording or replaying its
+	fetches with render
+*/
+func GetRenderData(config *conf.Configuration, conn *zk.Conn, render *capture.Render) TemplateData {
+
+	apps, err := marathon.FetchApps(config.Marathon, render)
+	if err != nil {
+		logging.Logf("marathon.apps", "Unable to fetch Marathon apps: %s\n", err)
+	}
+	var services map[string]service.Service
+	err = render.Fetch("zookeeper-services", &services, func() (err error) {
+		services, err = service.All(conn, config.Bamboo.Zookeeper)
+		return err
+	})
+	if err != nil {
+		logging.Logf("zookeeper.services", "Unable to read services from Zookeeper: %s\n", err)
+	}
+
+	var hosts []exclusion.Host
+	err = render.Fetch("zookeeper-hosts", &hosts, func() (err error) {
+		hosts, err = exclusion.Hosts(conn, config.Bamboo.Zookeeper)
+		return err
+	})
+	if err == nil {
+		excludeHosts(apps, hosts)
+	} else {
+		logging.Logf("zookeeper.hosts", "Unable to read disabled hosts from Zookeeper: %s\n", err)
+	}
+
+	var excludedTasks []exclusion.Task
+	err = render.Fetch("zookeeper-tasks", &excludedTasks, func() (err error) {
+		excludedTasks, err = exclusion.Tasks(conn, config.Bamboo.Zookeeper)
+		return err
+	})
+	if err == nil {
+		excludeTasks(apps, excludedTasks)
+	} else {
+		logging.Logf("zookeeper.tasks", "Unable to read excluded tasks from Zookeeper: %s\n", err)
+	}
+
+	var overrides []limits.Override
+	err = render.Fetch("zookeeper-limits", &overrides, func() (err error) {
+		overrides, err = limits.Overrides(conn, config.Bamboo.Zookeeper)
+		return err
+	})
+	if err != nil {
+		logging.Logf("zookeeper.limits", "Unable to read server limit overrides from Zookeeper: %s\n", err)
+	}
+	applyLimits(apps, config.HAProxy.ServerLimits, services, overrides)
+
+	applyServerSlots(apps, config.HAProxy.Resolvers)
+	applyNaming(apps, config.HAProxy.Naming)
+
+	if config.Mesos.Enabled() {
+		agents, err := mesos.FetchAgents(config.Mesos)
+		if err == nil {
+			applyAgentAttributes(apps, agents)
+		} else {
+			logging.Logf("mesos.agents", "Unable to fetch Mesos agents: %s\n", err)
+		}
+	}
+
+	jwtKeys := fetchJwtKeys(config.HAProxy.Jwt, apps, services)
+
+	var windows []mesos.Window
+	if config.Mesos.Enabled() && config.Mesos.DrainMaintenance {
+		windows, err = mesos.FetchMaintenance(config.Mesos)
+		if err == nil {
+			applyMaintenance(apps, windows, time.Now(), config.Mesos.DrainBeforeDuration())
+		} else {
+			logging.Logf("mesos.maintenance", "Unable to fetch Mesos maintenance schedule: %s\n", err)
+		}
+	}
+
+	return TemplateData{
+		Apps:        apps,
+		Services:    services,
+		HAProxy:     CurrentInfo(),
+		Resolvers:   config.HAProxy.Resolvers,
+		RouteHeader: config.HAProxy.RouteHeader,
+		Mirror:      config.HAProxy.Mirror,
+		Spoe:        config.HAProxy.Spoe,
+
+		StickTableDefaults: config.HAProxy.StickTables,
+		Maintenance:        windows,
+
+		ExcludedTasks:  excludedTasks,
+		LimitOverrides: overrides,
+		JwtKeys:        jwtKeys,
+	}
+}
 
-	apps, _ := marathon.FetchApps(config.Marathon)
-	services, _ := service.All(conn, config.Bamboo.Zookeeper)
+// Apps resolved through DNS get the configured default number of
+// server-template slots unless they request their own
+func applyServerSlots(apps marathon.AppList, resolvers conf.Resolvers) {
+	for i := range apps {
+		if apps[i].DnsResolution && apps[i].ServerSlots <= 0 {
+			apps[i].ServerSlots = resolvers.ServerSlots
+		}
+	}
+}
+
+// Sets the server limits of every app
+func applyLimits(apps marathon.AppList, defaults conf.ServerLimits, services map[string]service.Service, overrides []limits.Override) {
+	byAppId := map[string]*limits.Override{}
+	for i := range overrides {
+		byAppId[overrides[i].AppId] = &overrides[i]
+	}
+
+	for i := range apps {
+		effective := limits.Effective(defaults, services[apps[i].Id], byAppId[apps[i].Id])
+		apps[i].MaxConn = effective.MaxConn
+		apps[i].MaxQueue = effective.MaxQueue
+	}
+}
+
+// Returns the token verification keys of apps whose service requires a JWT
+func fetchJwtKeys(config conf.Jwt, apps marathon.AppList, services map[string]service.Service) map[string][]jwt.Key {
+	keys := map[string][]jwt.Key{}
+	for _, app := range apps {
+		serviceModel, ok := services[app.Id]
+		if !ok || serviceModel.Jwt == nil {
+			continue
+		}
+		appKeys, err := jwt.Keys(config.KeyDirectory, config.KeySetTTLDuration(), app.EscapedId, *serviceModel.Jwt)
+		if err != nil {
+			logging.Logf("jwt.keys", "Unable to fetch JSON Web Key Set of %s: %s\n", app.Id, err)
+		}
+		keys[app.Id] = appKeys
+	}
+	return keys
+}
+
+// Removes the tasks running on disabled hosts
+func excludeHosts(apps marathon.AppList, hosts []exclusion.Host) {
+	if len(hosts) == 0 {
+		return
+	}
+	disabled := map[string]bool{}
+	for _, host := range hosts {
+		disabled[host.Host] = true
+	}
+
+	for i := range apps {
+		tasks := []marathon.Task{}
+		for _, task := range apps[i].Tasks {
+			if !disabled[task.Host] {
+				tasks = append(tasks, task)
+			}
+		}
+		apps[i].Tasks = tasks
+	}
+}
+
+// Removes the excluded tasks
+func excludeTasks(apps marathon.AppList, excluded []exclusion.Task) {
+	if len(excluded) == 0 {
+		return
+	}
+	ids := map[string]bool{}
+	for _, task := range excluded {
+		ids[task.TaskId] = true
+	}
+
+	for i := range apps {
+		tasks := []marathon.Task{}
+		for _, task := range apps[i].Tasks {
+			if !ids[task.Id] {
+				tasks = append(tasks, task)
+			}
+		}
+		apps[i].Tasks = tasks
+	}
+}
+
+// Marks the tasks on agents in maintenance as draining
+func applyMaintenance(apps marathon.AppList, windows []mesos.Window, at time.Time, drainBefore time.Duration) {
+	hosts := mesos.DrainingHosts(windows, at, drainBefore)
+	for i := range apps {
+		for j := range apps[i].Tasks {
+			apps[i].Tasks[j].Draining = hosts[apps[i].Tasks[j].Host]
+		}
+	}
+}
 
-	return templateData{apps, services}
+func applyAgentAttributes(apps marathon.AppList, agents map[string]mesos.Agent) {
+	for i := range apps {
+		for j := range apps[i].Tasks {
+			task := &apps[i].Tasks[j]
+			if agent, ok := agents[task.SlaveId]; ok {
+				task.Attributes = agent.Attributes
+			}
+		}
+	}
 }
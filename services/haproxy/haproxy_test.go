@@ -0,0 +1,43 @@
+package haproxy
+
+import (
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+
+	"github.com/QubitProducts/bamboo/services/exclusion"
+	"github.com/QubitProducts/bamboo/services/marathon"
+	"github.com/QubitProducts/bamboo/services/mesos"
+)
+
+func TestExcludeHosts(t *testing.T) {
+	Convey("#excludeHosts", t, func() {
+		Convey("should remove the tasks on disabled hosts", func() {
+			apps := marathon.AppList{{Id: "/app", Tasks: []marathon.Task{{Host: "agent1", Port: 31000}, {Host: "agent2", Port: 31001}}}}
+			excludeHosts(apps, []exclusion.Host{{Host: "agent1"}})
+			So(apps[0].Tasks, ShouldResemble, []marathon.Task{{Host: "agent2", Port: 31001}})
+		})
+	})
+}
+
+func TestExcludeTasks(t *testing.T) {
+	Convey("#excludeTasks", t, func() {
+		Convey("should remove excluded tasks by id", func() {
+			apps := marathon.AppList{{Id: "/app", Tasks: []marathon.Task{{Id: "app.1", Host: "agent1"}, {Id: "app.2", Host: "agent1"}}}}
+			excludeTasks(apps, []exclusion.Task{{TaskId: "app.1"}})
+			So(apps[0].Tasks, ShouldResemble, []marathon.Task{{Id: "app.2", Host: "agent1"}})
+		})
+	})
+}
+
+func TestApplyMaintenance(t *testing.T) {
+	Convey("#applyMaintenance", t, func() {
+		Convey("should mark the tasks on agents in maintenance as draining", func() {
+			apps := marathon.AppList{{Id: "/app", Tasks: []marathon.Task{{Host: "agent1", Port: 31000}, {Host: "agent2", Port: 31001}}}}
+			windows := []mesos.Window{{Hosts: []string{"agent2"}, Start: time.Unix(1000, 0)}}
+			applyMaintenance(apps, windows, time.Unix(1500, 0), 0)
+			So(apps[0].Tasks[0].Draining, ShouldBeFalse)
+			So(apps[0].Tasks[1].Draining, ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,88 @@
+package haproxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/atomicfile"
+)
+
+var luaNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+/*
+	Lua script as loaded by HAProxy. The path contains a hash of the
+	content, so that changing a script changes the configuration and
+	HAProxy is reloaded.
+*/
+type LuaScript struct {
+	Name    string
+	Path    string
+	Content []byte `json:"-"`
+}
+
+/*
+	Reads the configured scripts. Fails when a script can not be read,
+	since the configuration would refer to actions it does not load.
+*/
+func ReadLuaScripts(config conf.Lua) ([]LuaScript, error) {
+	scripts := []LuaScript{}
+	names := map[string]bool{}
+	for _, script := range config.Scripts {
+		if !luaNamePattern.MatchString(script.Name) {
+			return nil, fmt.Errorf("invalid Lua script name %q", script.Name)
+		}
+		if names[script.Name] {
+			return nil, fmt.Errorf("Lua script %s declared twice", script.Name)
+		}
+		names[script.Name] = true
+
+		content, err := ioutil.ReadFile(script.Source)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read Lua script %s: %s", script.Name, err)
+		}
+		hash := sha256.Sum256(content)
+		scripts = append(scripts, LuaScript{
+			Name:    script.Name,
+			Path:    filepath.Join(config.Directory, script.Name+"-"+hex.EncodeToString(hash[:4])+".lua"),
+			Content: content,
+		})
+	}
+	return scripts, nil
+}
+
+/*
+	Writes the scripts to their paths through a temporary file renamed
+	into place, and removes earlier versions of the scripts
+*/
+func WriteLuaScripts(scripts []LuaScript) error {
+	for _, script := range scripts {
+		if current, err := ioutil.ReadFile(script.Path); err != nil || !bytes.Equal(current, script.Content) {
+			if err := atomicfile.WriteFile(script.Path, script.Content, 0644); err != nil {
+				return err
+			}
+		}
+
+		versions, _ := filepath.Glob(filepath.Join(filepath.Dir(script.Path), script.Name+"-*.lua"))
+		for _, version := range versions {
+			if version != script.Path && isLuaVersion(filepath.Base(version), script.Name) {
+				os.Remove(version)
+			}
+		}
+	}
+	return nil
+}
+
+// Versions of a script are named <name>-<8 hex digits>.lua
+func isLuaVersion(file string, name string) bool {
+	hash := strings.TrimSuffix(strings.TrimPrefix(file, name+"-"), ".lua")
+	_, err := hex.DecodeString(hash)
+	return len(hash) == 8 && err == nil
+}
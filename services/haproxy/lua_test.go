@@ -0,0 +1,54 @@
+package haproxy
+
+import (
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+func TestLuaScripts(t *testing.T) {
+	Convey("#ReadLuaScripts", t, func() {
+		directory, _ := ioutil.TempDir("", "bamboo-lua")
+		defer os.RemoveAll(directory)
+		source := filepath.Join(directory, "route.lua")
+		ioutil.WriteFile(source, []byte("core.register_action('route', {'http-req'}, function(txn) end)\n"), 0644)
+		config := conf.Lua{Directory: filepath.Join(directory, "loaded"), Scripts: []conf.LuaScript{{Name: "route", Source: source}}}
+
+		Convey("should name scripts after their content", func() {
+			scripts, err := ReadLuaScripts(config)
+			So(err, ShouldBeNil)
+			So(len(scripts), ShouldEqual, 1)
+			So(filepath.Dir(scripts[0].Path), ShouldEqual, config.Directory)
+			So(isLuaVersion(filepath.Base(scripts[0].Path), "route"), ShouldBeTrue)
+
+			ioutil.WriteFile(source, []byte("-- changed\n"), 0644)
+			changed, _ := ReadLuaScripts(config)
+			So(changed[0].Path, ShouldNotEqual, scripts[0].Path)
+		})
+
+		Convey("should fail when a script can not be read", func() {
+			config.Scripts[0].Source = filepath.Join(directory, "missing.lua")
+			_, err := ReadLuaScripts(config)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("should write scripts and remove earlier versions", func() {
+			scripts, _ := ReadLuaScripts(config)
+			So(WriteLuaScripts(scripts), ShouldBeNil)
+
+			ioutil.WriteFile(source, []byte("-- changed\n"), 0644)
+			changed, _ := ReadLuaScripts(config)
+			So(WriteLuaScripts(changed), ShouldBeNil)
+
+			content, err := ioutil.ReadFile(changed[0].Path)
+			So(err, ShouldBeNil)
+			So(string(content), ShouldEqual, "-- changed\n")
+			_, err = os.Stat(scripts[0].Path)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+	})
+}
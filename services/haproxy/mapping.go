@@ -0,0 +1,55 @@
+package haproxy
+
+// Translation between a Marathon app service port and rendered HAProxy names
+type Mapping struct {
+	AppId       string
+	PortIndex   int
+	PortName    string
+	ServicePort int
+	Backend     string
+	Frontend    string
+	AclName     string
+	// Service ACL rule, empty when the default rule applies
+	Acl string
+}
+
+/*
+	Returns one mapping per app service port, apps without service
+	ports are mapped by their default names
+*/
+func (data TemplateData) Mapping() []Mapping {
+	mappings := []Mapping{}
+	for _, app := range data.Apps {
+		acl := data.Services[app.Id].Acl
+
+		if len(app.ServicePorts) == 0 {
+			mappings = append(mappings, Mapping{
+				AppId:    app.Id,
+				PortName: "0",
+				Backend:  app.Backend,
+				Frontend: app.Frontend,
+				AclName:  app.AclName,
+				Acl:      acl,
+			})
+			continue
+		}
+
+		for _, port := range app.ServicePorts {
+			mapping := Mapping{
+				AppId:       app.Id,
+				PortIndex:   port.Index,
+				PortName:    port.Name,
+				ServicePort: port.Port,
+				Backend:     port.Backend,
+				Frontend:    port.Frontend,
+			}
+			// Service ACLs route to the first service port
+			if port.Index == 0 {
+				mapping.AclName = app.AclName
+				mapping.Acl = acl
+			}
+			mappings = append(mappings, mapping)
+		}
+	}
+	return mappings
+}
@@ -0,0 +1,70 @@
+package haproxy
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// Mirrored app with the names of its SPOE engine and agents backend
+type MirroredApp struct {
+	AppId        string
+	Engine       string
+	AgentBackend string
+}
+
+/*
+	Returns the apps mirroring traffic, sorted by app id
+*/
+func (data TemplateData) MirroredApps() []MirroredApp {
+	mirrored := []MirroredApp{}
+	if !data.Mirror.Enabled {
+		return mirrored
+	}
+	for _, app := range data.Apps {
+		if serviceModel, ok := data.Services[app.Id]; ok && serviceModel.Mirror != nil {
+			mirrored = append(mirrored, MirroredApp{
+				AppId:        app.Id,
+				Engine:       "mirror-" + app.EscapedId,
+				AgentBackend: "mirror-" + app.EscapedId + "-agents",
+			})
+		}
+	}
+	sort.Sort(mirroredById(mirrored))
+	return mirrored
+}
+
+type mirroredById []MirroredApp
+
+func (m mirroredById) Len() int           { return len(m) }
+func (m mirroredById) Less(i, j int) bool { return m[i].AppId < m[j].AppId }
+func (m mirroredById) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+
+/*
+	Renders the SPOE configuration with one engine per mirrored app,
+	sending the request to the app's spoa-mirror agents
+*/
+func SpoeConfig(data TemplateData) string {
+	buffer := new(bytes.Buffer)
+	buffer.WriteString("# Generated by Bamboo, do not edit\n")
+	for _, app := range data.MirroredApps() {
+		fmt.Fprintf(buffer, `
+[%s]
+spoe-agent %s
+    groups mirror
+    option var-prefix mirror
+    timeout hello 500ms
+    timeout idle 10s
+    timeout processing 100ms
+    use-backend %s
+    log global
+
+spoe-message mirror
+    args arg_method=method arg_path=url arg_ver=req.ver arg_hdrs=req.hdrs_bin arg_body=req.body
+
+spoe-group mirror
+    messages mirror
+`, app.Engine, app.Engine, app.AgentBackend)
+	}
+	return buffer.String()
+}
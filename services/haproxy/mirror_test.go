@@ -0,0 +1,34 @@
+package haproxy
+
+import (
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/marathon"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+func TestMirroredApps(t *testing.T) {
+	Convey("#MirroredApps", t, func() {
+		data := TemplateData{
+			Apps: marathon.AppList{{Id: "/a", EscapedId: "::a"}, {Id: "/b", EscapedId: "::b"}},
+			Services: map[string]service.Service{
+				"/a": {Id: "/a", Mirror: &service.Mirror{Percent: 10, Agents: "10.0.0.5:12345"}},
+				"/b": {Id: "/b"},
+			},
+		}
+
+		Convey("should be empty when mirroring is disabled", func() {
+			So(data.MirroredApps(), ShouldBeEmpty)
+		})
+
+		Convey("should list apps whose service mirrors traffic", func() {
+			data.Mirror = conf.Mirror{Enabled: true}
+			So(data.MirroredApps(), ShouldResemble, []MirroredApp{{"/a", "mirror-::a", "mirror-::a-agents"}})
+			So(strings.Contains(SpoeConfig(data), "[mirror-::a]"), ShouldBeTrue)
+			So(strings.Contains(SpoeConfig(data), "use-backend mirror-::a-agents"), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,161 @@
+package haproxy
+
+import (
+	"bytes"
+	"log"
+	"regexp"
+	"strings"
+	"text/template"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/marathon"
+)
+
+// Data available to the naming scheme templates
+type NameData struct {
+	Id        string
+	EscapedId string
+	// Last segment of the id, e.g. api for /shop/web/api
+	Name string
+	// Groups of the app innermost first, e.g. web.shop for /shop/web/api
+	Group       string
+	Labels      map[string]string
+	PortIndex   int
+	PortName    string
+	ServicePort int
+}
+
+type namer struct {
+	backend  *template.Template
+	frontend *template.Template
+	acl      *template.Template
+	// nil without domain naming
+	domain *template.Template
+}
+
+var hostnamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*$`)
+
+func newNamer(naming conf.Naming) (*namer, error) {
+	backend, err := template.New("backend").Parse(naming.Backend)
+	if err != nil {
+		return nil, err
+	}
+	frontend, err := template.New("frontend").Parse(naming.Frontend)
+	if err != nil {
+		return nil, err
+	}
+	acl, err := template.New("acl").Parse(naming.Acl)
+	if err != nil {
+		return nil, err
+	}
+	n := &namer{backend: backend, frontend: frontend, acl: acl}
+	if len(naming.Domain) > 0 {
+		n.domain, err = template.New("domain").Parse(naming.Domain)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+func defaultNamer() *namer {
+	n, _ := newNamer(conf.Naming{
+		Backend:  conf.DefaultBackendName,
+		Frontend: conf.DefaultFrontendName,
+		Acl:      conf.DefaultAclName,
+	})
+	return n
+}
+
+/*
+	Validates the configured naming scheme templates
+*/
+func ValidateNaming(naming conf.Naming) error {
+	n, err := newNamer(naming)
+	if err != nil {
+		return err
+	}
+	_, err = n.render(n.backend, NameData{})
+	if err == nil && n.domain != nil {
+		_, err = n.render(n.domain, NameData{})
+	}
+	return err
+}
+
+func (n *namer) render(tpl *template.Template, data NameData) (string, error) {
+	buffer := new(bytes.Buffer)
+	err := tpl.Execute(buffer, data)
+	return buffer.String(), err
+}
+
+func (n *namer) name(tpl *template.Template, data NameData) string {
+	name, err := n.render(tpl, data)
+	if err != nil {
+		log.Printf("Unable to render %s name of %s: %s\n", tpl.Name(), data.Id, err)
+	}
+	return name
+}
+
+/*
+	Returns the hostname of an app, empty when the rendered name is not
+	a valid hostname
+*/
+func (n *namer) hostname(data NameData) string {
+	hostname := strings.ToLower(strings.TrimSpace(n.name(n.domain, data)))
+	if !hostnamePattern.MatchString(hostname) {
+		log.Printf("Generated domain %q of %s is not a valid hostname\n", hostname, data.Id)
+		return ""
+	}
+	return hostname
+}
+
+func nameData(app marathon.App, port marathon.ServicePort) NameData {
+	segments := strings.Split(strings.Trim(app.Id, "/"), "/")
+	groups := []string{}
+	for i := len(segments) - 2; i >= 0; i-- {
+		groups = append(groups, segments[i])
+	}
+	return NameData{
+		Id:          app.Id,
+		EscapedId:   app.EscapedId,
+		Name:        segments[len(segments)-1],
+		Group:       strings.Join(groups, "."),
+		Labels:      app.Labels,
+		PortIndex:   port.Index,
+		PortName:    port.Name,
+		ServicePort: port.Port,
+	}
+}
+
+/*
+	Sets the rendered backend, frontend and ACL names of every app
+	service port. Apps without service ports are named after port 0.
+*/
+func applyNaming(apps marathon.AppList, naming conf.Naming) {
+	n, err := newNamer(naming)
+	if err != nil {
+		log.Printf("Invalid HAProxy naming scheme, using defaults: %s\n", err)
+		n = defaultNamer()
+	}
+
+	for i := range apps {
+		app := &apps[i]
+		for j := range app.ServicePorts {
+			data := nameData(*app, app.ServicePorts[j])
+			app.ServicePorts[j].Backend = n.name(n.backend, data)
+			app.ServicePorts[j].Frontend = n.name(n.frontend, data)
+		}
+
+		first := marathon.ServicePort{Name: "0"}
+		if len(app.ServicePorts) > 0 {
+			first = app.ServicePorts[0]
+		}
+		data := nameData(*app, first)
+		app.Backend = n.name(n.backend, data)
+		app.Frontend = n.name(n.frontend, data)
+		app.AclName = n.name(n.acl, data)
+		if n.domain != nil {
+			app.Domain = n.hostname(data)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package haproxy
+
+import (
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/marathon"
+)
+
+func defaultNaming() conf.Naming {
+	return conf.Naming{
+		Backend:  conf.DefaultBackendName,
+		Frontend: conf.DefaultFrontendName,
+		Acl:      conf.DefaultAclName,
+	}
+}
+
+func TestApplyNaming(t *testing.T) {
+	Convey("#applyNaming", t, func() {
+		Convey("should name the first service port after the escaped app id", func() {
+			apps := marathon.AppList{{Id: "/shop/web/api", EscapedId: "::shop::web::api",
+				ServicePorts: []marathon.ServicePort{{Index: 0, Port: 10000, Name: "0"}}}}
+			applyNaming(apps, defaultNaming())
+			So(apps[0].Backend, ShouldEqual, "::shop::web::api-cluster")
+			So(apps[0].Frontend, ShouldEqual, "::shop::web::api_10000")
+			So(apps[0].AclName, ShouldEqual, "::shop::web::api-aclrule")
+		})
+
+		Convey("should suffix the names of other service ports with the port name", func() {
+			apps := marathon.AppList{{Id: "/api", EscapedId: "::api", ServicePorts: []marathon.ServicePort{
+				{Index: 0, Port: 10000, Name: "http"},
+				{Index: 1, Port: 10001, Name: "admin"},
+			}}}
+			applyNaming(apps, defaultNaming())
+			So(apps[0].ServicePorts[0].Backend, ShouldEqual, "::api-cluster")
+			So(apps[0].ServicePorts[1].Backend, ShouldEqual, "::api-cluster-admin")
+			So(apps[0].ServicePorts[1].Frontend, ShouldEqual, "::api_10001")
+		})
+
+		Convey("should name apps without service ports after port 0", func() {
+			apps := marathon.AppList{{Id: "/api", EscapedId: "::api"}}
+			applyNaming(apps, defaultNaming())
+			So(apps[0].Backend, ShouldEqual, "::api-cluster")
+			So(apps[0].Frontend, ShouldEqual, "::api_0")
+		})
+
+		Convey("should render the name and groups of the app", func() {
+			naming := defaultNaming()
+			naming.Backend = "{{ .Name }}.{{ .Group }}"
+			naming.Domain = "{{ .Name }}.{{ .Group }}.Example.com"
+			apps := marathon.AppList{{Id: "/shop/web/api", EscapedId: "::shop::web::api"}}
+			applyNaming(apps, naming)
+			So(apps[0].Backend, ShouldEqual, "api.web.shop")
+			So(apps[0].Domain, ShouldEqual, "api.web.shop.example.com")
+		})
+
+		Convey("should leave out domains which are not hostnames", func() {
+			naming := defaultNaming()
+			naming.Domain = "{{ .EscapedId }}.example.com"
+			apps := marathon.AppList{{Id: "/api", EscapedId: "::api"}}
+			applyNaming(apps, naming)
+			So(apps[0].Domain, ShouldEqual, "")
+		})
+
+		Convey("should fall back to the default scheme when the templates are invalid", func() {
+			naming := defaultNaming()
+			naming.Backend = "{{ .Id "
+			apps := marathon.AppList{{Id: "/api", EscapedId: "::api"}}
+			applyNaming(apps, naming)
+			So(apps[0].Backend, ShouldEqual, "::api-cluster")
+		})
+	})
+
+	Convey("#ValidateNaming", t, func() {
+		Convey("should accept the default scheme", func() {
+			So(ValidateNaming(defaultNaming()), ShouldBeNil)
+		})
+
+		Convey("should refuse templates referring to unknown fields", func() {
+			naming := defaultNaming()
+			naming.Backend = "{{ .Unknown }}"
+			So(ValidateNaming(naming), ShouldNotBeNil)
+		})
+	})
+}
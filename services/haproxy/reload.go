@@ -0,0 +1,163 @@
+package haproxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+// Applies the written configuration to HAProxy
+type Reloader interface {
+	Reload() error
+}
+
+var reloadSignals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+func NewReloader(config conf.HAProxy) (Reloader, error) {
+	reload := config.Reload
+	switch reload.Strategy {
+	case "exec", "":
+		if len(config.ReloadCommand) == 0 {
+			return nil, fmt.Errorf("HAProxy.ReloadCommand is required by the exec reload strategy")
+		}
+		return &CommandReloader{Command: config.ReloadCommand}, nil
+	case "signal":
+		signal, ok := reloadSignals[strings.TrimPrefix(strings.ToUpper(reload.Signal), "SIG")]
+		if !ok {
+			return nil, fmt.Errorf("unsupported reload signal %s", reload.Signal)
+		}
+		if len(reload.PidFile) == 0 {
+			return nil, fmt.Errorf("HAProxy.Reload.PidFile is required by the signal reload strategy")
+		}
+		return &SignalReloader{PidFile: reload.PidFile, Signal: signal}, nil
+	case "http":
+		if len(reload.Url) == 0 {
+			return nil, fmt.Errorf("HAProxy.Reload.Url is required by the http reload strategy")
+		}
+		return &HttpReloader{Url: reload.Url, Method: reload.Method, Client: &http.Client{Timeout: reload.TimeoutDuration()}}, nil
+	case "none":
+		return &NoReloader{}, nil
+	case "supervise":
+		supervisor = NewSupervisor(config)
+		return supervisor, nil
+	case "remote":
+		if len(config.Remote.Targets) == 0 {
+			return nil, fmt.Errorf("HAProxy.Remote.Targets are required by the remote reload strategy")
+		}
+		for _, target := range config.Remote.Targets {
+			if err := target.Validate(); err != nil {
+				return nil, err
+			}
+		}
+		return &RemoteReloader{
+			Config:        config.Remote,
+			OutputPath:    config.OutputPath,
+			ReloadCommand: config.ReloadCommand,
+			Client:        &http.Client{Timeout: config.Remote.TimeoutDuration()},
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown reload strategy %s", reload.Strategy)
+}
+
+// Runs a shell command, e.g. starting a new HAProxy with -sf
+type CommandReloader struct {
+	Command string
+}
+
+func (c *CommandReloader) Reload() error {
+	log.Printf("Exec cmd: %s \n", c.Command)
+	output, err := exec.Command("sh", "-c", c.Command).CombinedOutput()
+	if err != nil {
+		log.Println(err.Error())
+		log.Println("Output:\n" + string(output[:]))
+		// HAProxy names the sections it fails on
+		if message := strings.TrimSpace(string(output)); len(message) > 0 {
+			return fmt.Errorf("%s: %s", err, message)
+		}
+	}
+	return err
+}
+
+/*
+	Signals the HAProxy process of a pid file, e.g. the master of a
+	master-worker HAProxy in a shared process namespace
+*/
+type SignalReloader struct {
+	PidFile string
+	Signal  syscall.Signal
+}
+
+func (s *SignalReloader) Reload() error {
+	content, err := ioutil.ReadFile(s.PidFile)
+	if err != nil {
+		return err
+	}
+	// HAProxy writes the pids of all processes, the master first
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 {
+		return fmt.Errorf("no pid in %s", s.PidFile)
+	}
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return fmt.Errorf("invalid pid in %s: %s", s.PidFile, fields[0])
+	}
+
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	log.Printf("Sending %s to HAProxy process %d\n", s.Signal, pid)
+	return process.Signal(s.Signal)
+}
+
+/*
+	Calls a sidecar reloading the proxy, e.g. next to a remote or
+	distroless HAProxy. Any 2xx response is a successful reload.
+*/
+type HttpReloader struct {
+	Url    string
+	Method string
+	Client *http.Client
+}
+
+func (h *HttpReloader) Reload() error {
+	request, err := http.NewRequest(h.Method, h.Url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := h.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(response.Body)
+		if message := strings.TrimSpace(string(body)); len(message) > 0 {
+			return fmt.Errorf("%s responded %s: %s", h.Url, response.Status, message)
+		}
+		return fmt.Errorf("%s responded %s", h.Url, response.Status)
+	}
+	return nil
+}
+
+/*
+	Leaves applying the configuration to external tooling watching
+	the output file
+*/
+type NoReloader struct{}
+
+func (n *NoReloader) Reload() error {
+	return nil
+}
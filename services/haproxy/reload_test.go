@@ -0,0 +1,101 @@
+package haproxy
+
+import (
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+func TestNewReloader(t *testing.T) {
+	Convey("#NewReloader", t, func() {
+		Convey("should run the reload command by default", func() {
+			reloader, err := NewReloader(conf.HAProxy{ReloadCommand: "true"})
+			So(err, ShouldBeNil)
+			So(reloader, ShouldHaveSameTypeAs, &CommandReloader{})
+		})
+
+		Convey("should supervise HAProxy", func() {
+			reloader, err := NewReloader(conf.HAProxy{OutputPath: "/etc/haproxy/haproxy.cfg", Reload: conf.Reload{Strategy: "supervise"}})
+			So(err, ShouldBeNil)
+			So(reloader, ShouldHaveSameTypeAs, &Supervisor{})
+			_, supervised := SupervisedProcess()
+			So(supervised, ShouldBeTrue)
+		})
+
+		Convey("should require the settings of a strategy", func() {
+			_, err := NewReloader(conf.HAProxy{Reload: conf.Reload{Strategy: "signal", Signal: "USR2"}})
+			So(err, ShouldNotBeNil)
+			_, err = NewReloader(conf.HAProxy{Reload: conf.Reload{Strategy: "http"}})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("should reject unknown strategies and signals", func() {
+			_, err := NewReloader(conf.HAProxy{Reload: conf.Reload{Strategy: "ssh"}})
+			So(err, ShouldNotBeNil)
+			_, err = NewReloader(conf.HAProxy{Reload: conf.Reload{Strategy: "signal", PidFile: "/run/haproxy.pid", Signal: "KILL"}})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestSignalReloader(t *testing.T) {
+	Convey("#Reload", t, func() {
+		dir, _ := ioutil.TempDir("", "bamboo-reload")
+		defer os.RemoveAll(dir)
+		pidFile := filepath.Join(dir, "haproxy.pid")
+
+		Convey("should signal the first pid of the pid file", func() {
+			received := make(chan os.Signal, 1)
+			signal.Notify(received, syscall.SIGUSR1)
+			defer signal.Stop(received)
+			ioutil.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n1\n"), 0644)
+
+			err := (&SignalReloader{PidFile: pidFile, Signal: syscall.SIGUSR1}).Reload()
+			So(err, ShouldBeNil)
+			select {
+			case sig := <-received:
+				So(sig, ShouldEqual, syscall.SIGUSR1)
+			case <-time.After(time.Second):
+				So("no signal received", ShouldBeEmpty)
+			}
+		})
+
+		Convey("should fail without pid", func() {
+			ioutil.WriteFile(pidFile, []byte("\n"), 0644)
+			So((&SignalReloader{PidFile: pidFile, Signal: syscall.SIGUSR1}).Reload(), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestHttpReloader(t *testing.T) {
+	Convey("#Reload", t, func() {
+		status := http.StatusOK
+		method := ""
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method = r.Method
+			w.WriteHeader(status)
+		}))
+		defer server.Close()
+		reloader := &HttpReloader{Url: server.URL, Method: "POST", Client: http.DefaultClient}
+
+		Convey("should call the sidecar", func() {
+			So(reloader.Reload(), ShouldBeNil)
+			So(method, ShouldEqual, "POST")
+		})
+
+		Convey("should fail on error responses", func() {
+			status = http.StatusInternalServerError
+			So(reloader.Reload(), ShouldNotBeNil)
+		})
+	})
+}
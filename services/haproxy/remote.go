@@ -0,0 +1,251 @@
+package haproxy
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+/*
+	Pushes the written configuration to the remote targets and reloads
+	HAProxy on them. Targets are updated in parallel and only when they
+	did not apply the written configuration yet, so that calling Reload
+	again retries the targets which failed. The reload only fails when
+	no target could be updated.
+*/
+type RemoteReloader struct {
+	Config        conf.Remote
+	OutputPath    string
+	ReloadCommand string
+	Client        *http.Client
+
+	lock sync.Mutex
+	// Hash of the configuration each target applied last, by name
+	applied map[string]string
+}
+
+func (r *RemoteReloader) Reload() error {
+	content, err := ioutil.ReadFile(r.OutputPath)
+	if err != nil {
+		return err
+	}
+	hash := configHash(content)
+	targets := r.stale(hash)
+	if len(targets) == 0 {
+		return nil
+	}
+
+	errs := make([]error, len(targets))
+	var wait sync.WaitGroup
+	for i, target := range targets {
+		wait.Add(1)
+		go func(i int, target conf.RemoteTarget) {
+			defer wait.Done()
+			status := RemoteStatus{Target: target.EffectiveName(), Time: time.Now(), ConfigHash: hash}
+			if len(target.Ssh) > 0 {
+				errs[i] = r.pushSsh(target, content)
+			} else {
+				status.Result, errs[i] = r.pushAgent(target, content)
+			}
+			status.Success = errs[i] == nil
+			if errs[i] != nil {
+				status.Error = errs[i].Error()
+			} else {
+				r.recordApplied(status.Target, hash)
+			}
+			recordRemoteStatus(status)
+		}(i, target)
+	}
+	wait.Wait()
+
+	failed := 0
+	for i, err := range errs {
+		if err != nil {
+			failed++
+			log.Printf("Remote %s: HAProxy update failed: %s\n", targets[i].EffectiveName(), err)
+		}
+	}
+	if failed == len(errs) {
+		return fmt.Errorf("all %d remote targets failed", failed)
+	}
+	log.Printf("HAProxy configuration pushed to %d of %d remote targets\n", len(errs)-failed, len(errs))
+	return nil
+}
+
+/*
+	Returns whether any target did not apply the written configuration
+	yet, e.g. because it was unreachable
+*/
+func (r *RemoteReloader) Stale() bool {
+	content, err := ioutil.ReadFile(r.OutputPath)
+	if err != nil {
+		return false
+	}
+	return len(r.stale(configHash(content))) > 0
+}
+
+func (r *RemoteReloader) stale(hash string) []conf.RemoteTarget {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	targets := []conf.RemoteTarget{}
+	for _, target := range r.Config.Targets {
+		if r.applied[target.EffectiveName()] != hash {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+func (r *RemoteReloader) recordApplied(target string, hash string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.applied == nil {
+		r.applied = map[string]string{}
+	}
+	r.applied[target] = hash
+}
+
+// Same hash as the configurations of the reload history
+func configHash(content []byte) string {
+	sum := sha1.Sum(content)
+	return hex.EncodeToString(sum[:])
+}
+
+/*
+	Streams the configuration to a temporary file next to its path,
+	moves it into place and runs the reload command, all in one ssh
+	session
+*/
+func (r *RemoteReloader) pushSsh(target conf.RemoteTarget, content []byte) error {
+	path := target.ConfigPath
+	if len(path) == 0 {
+		path = r.OutputPath
+	}
+	script := fmt.Sprintf("cat > %s && mv %s %s", shellQuote(path+".bamboo"), shellQuote(path+".bamboo"), shellQuote(path))
+	if reloadCommand := r.remoteReloadCommand(target); len(reloadCommand) > 0 {
+		script += " && (" + reloadCommand + ")"
+	}
+
+	args := append([]string{"-o", "BatchMode=yes"}, target.SshOptions...)
+	args = append(args, target.Ssh, script)
+
+	command := exec.Command("ssh", args...)
+	command.Stdin = bytes.NewReader(content)
+	var output bytes.Buffer
+	command.Stdout = &output
+	command.Stderr = &output
+	if err := command.Start(); err != nil {
+		return err
+	}
+	timer := time.AfterFunc(r.Config.TimeoutDuration(), func() { command.Process.Kill() })
+	err := command.Wait()
+	timer.Stop()
+	if err != nil {
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+func (r *RemoteReloader) remoteReloadCommand(target conf.RemoteTarget) string {
+	if len(target.ReloadCommand) > 0 {
+		return target.ReloadCommand
+	}
+	return r.ReloadCommand
+}
+
+/*
+	Sends the configuration to the agent, which validates it and applies
+	it with its own reload strategy, and returns the result it reports
+*/
+func (r *RemoteReloader) pushAgent(target conf.RemoteTarget, content []byte) (*AgentResult, error) {
+	body, err := json.Marshal(AgentPush{Config: string(content), Action: AgentApply})
+	if err != nil {
+		return nil, err
+	}
+	url := strings.TrimSuffix(target.Agent, "/") + "/api/agent/config"
+	request, err := http.NewRequest("PUT", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if len(r.Config.Token) > 0 {
+		request.Header.Set("Authorization", "Bearer "+r.Config.Token)
+	}
+
+	response, err := r.Client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	responseBody, _ := ioutil.ReadAll(response.Body)
+
+	result := &AgentResult{}
+	if err := json.Unmarshal(responseBody, result); err != nil {
+		return nil, fmt.Errorf("%s responded %s: %s", url, response.Status, strings.TrimSpace(string(responseBody)))
+	}
+	if len(result.Error) > 0 {
+		return result, errors.New(result.Error)
+	}
+	if response.StatusCode/100 != 2 {
+		return result, fmt.Errorf("%s responded %s: %s", url, response.Status, strings.TrimSpace(string(responseBody)))
+	}
+	return result, nil
+}
+
+func shellQuote(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+// Latest push to a remote target
+type RemoteStatus struct {
+	Target  string
+	Time    time.Time
+	Success bool
+	Error   string `json:",omitempty"`
+	// Configuration pushed
+	ConfigHash string `json:",omitempty"`
+	// Reported by agents
+	Result *AgentResult `json:",omitempty"`
+}
+
+var (
+	remoteStatuses     = map[string]RemoteStatus{}
+	remoteStatusesLock sync.RWMutex
+)
+
+func recordRemoteStatus(status RemoteStatus) {
+	remoteStatusesLock.Lock()
+	defer remoteStatusesLock.Unlock()
+	remoteStatuses[status.Target] = status
+}
+
+// Returns the latest push to each remote target, sorted by target
+func RemoteStatuses() []RemoteStatus {
+	remoteStatusesLock.RLock()
+	defer remoteStatusesLock.RUnlock()
+	statuses := []RemoteStatus{}
+	for _, status := range remoteStatuses {
+		statuses = append(statuses, status)
+	}
+	sort.Sort(remoteStatusesByTarget(statuses))
+	return statuses
+}
+
+type remoteStatusesByTarget []RemoteStatus
+
+func (r remoteStatusesByTarget) Len() int           { return len(r) }
+func (r remoteStatusesByTarget) Less(i, j int) bool { return r[i].Target < r[j].Target }
+func (r remoteStatusesByTarget) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
@@ -0,0 +1,104 @@
+package haproxy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+func TestRemoteReloader(t *testing.T) {
+	Convey("#Reload", t, func() {
+		dir, _ := ioutil.TempDir("", "bamboo-remote")
+		defer os.RemoveAll(dir)
+		outputPath := filepath.Join(dir, "haproxy.cfg")
+		ioutil.WriteFile(outputPath, []byte("global\n"), 0644)
+
+		received := ""
+		authorization := ""
+		agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			push := AgentPush{}
+			json.NewDecoder(r.Body).Decode(&push)
+			received = push.Config
+			authorization = r.Header.Get("Authorization")
+			w.Write([]byte(`{"Host": "proxy-1", "Changed": true, "Valid": true, "Reloaded": true}`))
+		}))
+		defer agent.Close()
+		broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"Host": "proxy-2", "Valid": true, "Error": "reload failed"}`))
+		}))
+		defer broken.Close()
+
+		reloader := &RemoteReloader{OutputPath: outputPath, Client: http.DefaultClient}
+
+		Convey("should push the configuration to agents with the token", func() {
+			reloader.Config = conf.Remote{Token: "secret", Targets: []conf.RemoteTarget{{Agent: agent.URL}}}
+			So(reloader.Reload(), ShouldBeNil)
+			So(received, ShouldEqual, "global\n")
+			So(authorization, ShouldEqual, "Bearer secret")
+		})
+
+		Convey("should succeed while a target is updated", func() {
+			reloader.Config = conf.Remote{Targets: []conf.RemoteTarget{{Name: "proxy-1", Agent: agent.URL}, {Name: "proxy-2", Agent: broken.URL}}}
+			So(reloader.Reload(), ShouldBeNil)
+		})
+
+		Convey("should record the results reported by agents", func() {
+			reloader.Config = conf.Remote{Targets: []conf.RemoteTarget{{Name: "proxy-1", Agent: agent.URL}, {Name: "proxy-2", Agent: broken.URL}}}
+			reloader.Reload()
+			statuses := RemoteStatuses()
+			So(len(statuses), ShouldBeGreaterThanOrEqualTo, 2)
+			for _, status := range statuses {
+				if status.Target == "proxy-1" {
+					So(status.Success, ShouldBeTrue)
+					So(status.Result.Reloaded, ShouldBeTrue)
+				}
+				if status.Target == "proxy-2" {
+					So(status.Success, ShouldBeFalse)
+					So(status.Error, ShouldEqual, "reload failed")
+				}
+			}
+		})
+
+		Convey("should push again to the targets which did not apply the configuration only", func() {
+			reloader.Config = conf.Remote{Targets: []conf.RemoteTarget{{Name: "proxy-1", Agent: agent.URL}, {Name: "proxy-2", Agent: broken.URL}}}
+			So(reloader.Reload(), ShouldBeNil)
+			So(reloader.Stale(), ShouldBeTrue)
+
+			received = ""
+			reloader.Config.Targets[1].Agent = agent.URL
+			So(reloader.Reload(), ShouldBeNil)
+			So(received, ShouldEqual, "global\n")
+			So(reloader.Stale(), ShouldBeFalse)
+
+			received = ""
+			So(reloader.Reload(), ShouldBeNil)
+			So(received, ShouldEqual, "")
+		})
+
+		Convey("should push changed configurations to every target", func() {
+			reloader.Config = conf.Remote{Targets: []conf.RemoteTarget{{Agent: agent.URL}}}
+			reloader.Reload()
+			ioutil.WriteFile(outputPath, []byte("global\n  maxconn 100\n"), 0644)
+			So(reloader.Stale(), ShouldBeTrue)
+			So(reloader.Reload(), ShouldBeNil)
+			So(received, ShouldEqual, "global\n  maxconn 100\n")
+		})
+
+		Convey("should fail when no target is updated", func() {
+			reloader.Config = conf.Remote{Targets: []conf.RemoteTarget{{Agent: broken.URL}}}
+			So(reloader.Reload(), ShouldNotBeNil)
+		})
+	})
+
+	Convey("#shellQuote", t, func() {
+		So(shellQuote("/etc/haproxy/it's.cfg"), ShouldEqual, `'/etc/haproxy/it'\''s.cfg'`)
+	})
+}
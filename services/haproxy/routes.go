@@ -0,0 +1,114 @@
+package haproxy
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+// Routing rule of the HTTP frontend, rendered as an acl and use_backend pair
+type Route struct {
+	AppId   string
+	AclName string
+	Acl     string
+	Backend string
+	// Service priority, higher priorities are rendered first
+	Priority int
+	// Rules of equal priority are rendered most specific first
+	Specificity int
+	// Whether the default rule applies, the app has no service: its
+	// generated domain, or the path_beg rule on its id
+	Default bool
+}
+
+type routesByOrder []Route
+
+func (r routesByOrder) Len() int      { return len(r) }
+func (r routesByOrder) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r routesByOrder) Less(i, j int) bool {
+	if r[i].Priority != r[j].Priority {
+		return r[i].Priority > r[j].Priority
+	}
+	if r[i].Specificity != r[j].Specificity {
+		return r[i].Specificity > r[j].Specificity
+	}
+	return r[i].AppId < r[j].AppId
+}
+
+/*
+	Returns the routes of all apps in the order their use_backend rules
+	must be rendered: by priority, then specificity, then app id. Apps
+	without service fall back to their generated domain, or a path_beg
+	rule on their id.
+*/
+func (data TemplateData) Routes() []Route {
+	routes := []Route{}
+	for _, app := range data.Apps {
+		route := Route{AppId: app.Id, AclName: app.AclName, Backend: app.Backend}
+		if serviceModel, ok := data.Services[app.Id]; ok {
+			route.Acl = serviceModel.Acl
+			route.Priority = serviceModel.Priority
+		} else if len(app.Domain) > 0 {
+			route.Acl = "hdr(host) -i " + app.Domain
+			route.Default = true
+		} else {
+			route.Acl = "path_beg -i " + app.Id
+			route.Default = true
+		}
+		route.Specificity = service.Specificity(route.Acl)
+		routes = append(routes, route)
+	}
+	sort.Stable(routesByOrder(routes))
+	return routes
+}
+
+// A route as evaluated for a request
+type RouteEvaluation struct {
+	Route
+	Matched bool
+	// Whether the rule could be evaluated, rules other than host and
+	// path rules are skipped
+	Understood bool
+}
+
+/*
+	Which backend a request would be routed to, with the routes
+	evaluated in use_backend order until the first match
+*/
+type RouteResolution struct {
+	Host    string
+	Path    string
+	AppId   string
+	Backend string
+	Reason  string
+	// Routes evaluated before and including the matching one
+	Evaluated []RouteEvaluation
+	// Routes which may have matched but could not be evaluated
+	Skipped int
+}
+
+/*
+	Evaluates the routes for a request to the host and path the way
+	HAProxy would, the first matching use_backend rule winning
+*/
+func (data TemplateData) ResolveRoute(host string, path string) RouteResolution {
+	resolution := RouteResolution{Host: host, Path: path, Evaluated: []RouteEvaluation{}}
+	for position, route := range data.Routes() {
+		matched, understood := service.Matches(route.Acl, host, path)
+		resolution.Evaluated = append(resolution.Evaluated, RouteEvaluation{Route: route, Matched: matched, Understood: understood})
+		if !understood {
+			resolution.Skipped++
+			continue
+		}
+		if matched {
+			resolution.AppId = route.AppId
+			resolution.Backend = route.Backend
+			resolution.Reason = fmt.Sprintf("rule %d of %s matches: %s", position+1, route.AppId, route.Acl)
+			return resolution
+		}
+	}
+
+	resolution.Reason = "no rule matches, the frontend has no backend for the request"
+	return resolution
+}
@@ -0,0 +1,73 @@
+package haproxy
+
+import (
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"testing"
+
+	"github.com/QubitProducts/bamboo/services/marathon"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+func TestRoutes(t *testing.T) {
+	Convey("#Routes", t, func() {
+		data := TemplateData{
+			Apps: marathon.AppList{{Id: "/a"}, {Id: "/b"}, {Id: "/c"}, {Id: "/d"}},
+			Services: map[string]service.Service{
+				"/a": {Id: "/a", Acl: "path_beg /api"},
+				"/b": {Id: "/b", Acl: "path_beg /api/v2"},
+				"/c": {Id: "/c", Acl: "hdr(host) -i c.example.com", Priority: -1},
+			},
+		}
+
+		Convey("should order routes by priority, then specificity", func() {
+			ids := []string{}
+			for _, route := range data.Routes() {
+				ids = append(ids, route.AppId)
+			}
+			So(ids, ShouldResemble, []string{"/b", "/a", "/d", "/c"})
+		})
+
+		Convey("should use the default path rule for apps without service", func() {
+			route := data.Routes()[2]
+			So(route.Default, ShouldBeTrue)
+			So(route.Acl, ShouldEqual, "path_beg -i /d")
+		})
+	})
+}
+
+func TestResolveRoute(t *testing.T) {
+	Convey("#ResolveRoute", t, func() {
+		data := TemplateData{
+			Apps: marathon.AppList{
+				{Id: "/api", Backend: "api-cluster"},
+				{Id: "/v2", Backend: "v2-cluster"},
+				{Id: "/site", Backend: "site-cluster"},
+				{Id: "/regex", Backend: "regex-cluster"},
+			},
+			Services: map[string]service.Service{
+				"/api":   {Id: "/api", Acl: "path_beg /api"},
+				"/v2":    {Id: "/v2", Acl: "path_beg /api/v2"},
+				"/site":  {Id: "/site", Acl: "hdr(host) -i Site.example.com", Priority: -1},
+				"/regex": {Id: "/regex", Acl: "path_reg ^/api", Priority: 1},
+			},
+		}
+
+		Convey("should report the first matching route", func() {
+			resolution := data.ResolveRoute("site.example.com", "/api/v2/users")
+			So(resolution.Backend, ShouldEqual, "v2-cluster")
+			So(resolution.Reason, ShouldStartWith, "rule 2 of /v2 matches")
+			So(len(resolution.Evaluated), ShouldEqual, 2)
+		})
+
+		Convey("should match hosts case insensitively", func() {
+			So(data.ResolveRoute("SITE.example.com", "/").AppId, ShouldEqual, "/site")
+		})
+
+		Convey("should skip rules it does not understand", func() {
+			resolution := data.ResolveRoute("other.example.com", "/")
+			So(resolution.Backend, ShouldEqual, "")
+			So(resolution.Skipped, ShouldEqual, 1)
+			So(resolution.Evaluated[0].Understood, ShouldBeFalse)
+		})
+	})
+}
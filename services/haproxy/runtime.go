@@ -0,0 +1,270 @@
+package haproxy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QubitProducts/bamboo/services/marathon"
+)
+
+const runtimeTimeout = 5 * time.Second
+
+type Endpoint struct {
+	Host string
+	Port int
+}
+
+// Task of an app which moved to another host or port
+type Relocation struct {
+	AppId string
+	From  Endpoint
+	To    Endpoint
+}
+
+/*
+	Returns the task relocations turning previous into current, and
+	whether they are the only differences. Any other change, including
+	a change of the number of tasks of an app, requires a reload.
+*/
+func Relocations(previous TemplateData, current TemplateData) ([]Relocation, bool) {
+	if !reflect.DeepEqual(previous.Services, current.Services) ||
+		!reflect.DeepEqual(previous.JwtKeys, current.JwtKeys) ||
+		!reflect.DeepEqual(previous.LuaScripts, current.LuaScripts) ||
+		previous.HAProxy != current.HAProxy ||
+		previous.Resolvers != current.Resolvers ||
+		previous.RouteHeader != current.RouteHeader ||
+		previous.Mirror != current.Mirror ||
+		!reflect.DeepEqual(previous.Spoe, current.Spoe) ||
+		previous.StickTableDefaults != current.StickTableDefaults ||
+		len(previous.Apps) != len(current.Apps) {
+		return nil, false
+	}
+
+	relocations := []Relocation{}
+	for i := range current.Apps {
+		before, after := previous.Apps[i], current.Apps[i]
+		if len(before.Tasks) != len(after.Tasks) || !reflect.DeepEqual(withoutTasks(before), withoutTasks(after)) {
+			return nil, false
+		}
+
+		removed := taskDifference(before.Tasks, after.Tasks)
+		added := taskDifference(after.Tasks, before.Tasks)
+		if len(removed) != len(added) {
+			return nil, false
+		}
+		// tasks of an app are interchangeable, pair them in order
+		for j := range removed {
+			from, to := taskEndpoints(removed[j]), taskEndpoints(added[j])
+			if len(from) != len(to) {
+				return nil, false
+			}
+			for k := range from {
+				// same endpoint, the task changed otherwise
+				if from[k] == to[k] {
+					return nil, false
+				}
+				relocations = append(relocations, Relocation{after.Id, from[k], to[k]})
+			}
+		}
+	}
+	return relocations, true
+}
+
+func withoutTasks(app marathon.App) marathon.App {
+	app.Tasks = nil
+	return app
+}
+
+// Tasks of a not found in b, sorted by endpoint
+func taskDifference(a []marathon.Task, b []marathon.Task) []marathon.Task {
+	existing := map[string]bool{}
+	for _, task := range b {
+		existing[taskIdentity(task)] = true
+	}
+
+	difference := []marathon.Task{}
+	for _, task := range a {
+		if !existing[taskIdentity(task)] {
+			difference = append(difference, task)
+		}
+	}
+	sort.Sort(tasksByEndpoint(difference))
+	return difference
+}
+
+func taskIdentity(task marathon.Task) string {
+	return fmt.Sprintf("%s:%d:%v:%t", task.Host, task.Port, task.Ports, task.Draining)
+}
+
+type tasksByEndpoint []marathon.Task
+
+func (t tasksByEndpoint) Len() int           { return len(t) }
+func (t tasksByEndpoint) Less(i, j int) bool { return taskIdentity(t[i]) < taskIdentity(t[j]) }
+func (t tasksByEndpoint) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+
+// Endpoints of every port of a task
+func taskEndpoints(task marathon.Task) []Endpoint {
+	if len(task.Ports) == 0 {
+		return []Endpoint{{task.Host, task.Port}}
+	}
+	endpoints := []Endpoint{}
+	for _, port := range task.Ports {
+		endpoints = append(endpoints, Endpoint{task.Host, port})
+	}
+	return endpoints
+}
+
+// Server of a running HAProxy as listed by `show servers state`
+type ServerState struct {
+	Backend string
+	Server  string
+	Address string
+	Port    int
+}
+
+/*
+	Parses the output of `show servers state`, e.g.
+
+		1
+		# be_id be_name srv_id srv_name srv_addr ... srv_port ...
+		3 app-cluster 1 app-10.0.0.1-31000 10.0.0.1 ... 31000 ...
+*/
+func ParseServersState(output string) ([]ServerState, error) {
+	states := []ServerState{}
+	columns := map[string]int{}
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			for i, name := range strings.Fields(strings.TrimPrefix(line, "#")) {
+				columns[name] = i
+			}
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(columns) == 0 || len(fields) < len(columns) {
+			// format version line or blank lines
+			continue
+		}
+		port, err := strconv.Atoi(fields[columns["srv_port"]])
+		if err != nil {
+			return nil, fmt.Errorf("invalid server port in %q", line)
+		}
+		states = append(states, ServerState{
+			Backend: fields[columns["be_name"]],
+			Server:  fields[columns["srv_name"]],
+			Address: fields[columns["srv_addr"]],
+			Port:    port,
+		})
+	}
+
+	for _, column := range []string{"be_name", "srv_name", "srv_addr", "srv_port"} {
+		if _, ok := columns[column]; !ok {
+			return nil, errors.New("unexpected servers state output, missing " + column)
+		}
+	}
+	return states, nil
+}
+
+/*
+	HAProxy runtime API on the admin stats socket
+*/
+type RuntimeAPI struct {
+	SocketPath string
+}
+
+func (r RuntimeAPI) command(command string) (string, error) {
+	conn, err := net.DialTimeout("unix", r.SocketPath, runtimeTimeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(runtimeTimeout))
+
+	_, err = conn.Write([]byte(command + "\n"))
+	if err != nil {
+		return "", err
+	}
+	output, err := ioutil.ReadAll(conn)
+	return string(output), err
+}
+
+func (r RuntimeAPI) ServersState() ([]ServerState, error) {
+	output, err := r.command("show servers state")
+	if err != nil {
+		return nil, err
+	}
+	return ParseServersState(output)
+}
+
+func (r RuntimeAPI) SetServerAddr(backend string, server string, address string, port int) error {
+	output, err := r.command(fmt.Sprintf("set server %s/%s addr %s port %d", backend, server, address, port))
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(output, "changed") && !strings.Contains(output, "no need to change") {
+		return fmt.Errorf("set server %s/%s: %s", backend, server, strings.TrimSpace(output))
+	}
+	return nil
+}
+
+// Resolves task hosts to the addresses reported by HAProxy
+var resolveHost = func(host string) (string, error) {
+	if net.ParseIP(host) != nil {
+		return host, nil
+	}
+	addresses, err := net.LookupHost(host)
+	if err != nil {
+		return "", err
+	}
+	return addresses[0], nil
+}
+
+/*
+	Points the servers of the running HAProxy at the new endpoints of
+	the relocated tasks. Fails when a relocated task is not found among
+	the running servers, in which case a reload is required.
+*/
+func ApplyRelocations(runtime RuntimeAPI, relocations []Relocation) error {
+	states, err := runtime.ServersState()
+	if err != nil {
+		return err
+	}
+
+	for _, relocation := range relocations {
+		from, err := resolveHost(relocation.From.Host)
+		if err != nil {
+			return err
+		}
+		to, err := resolveHost(relocation.To.Host)
+		if err != nil {
+			return err
+		}
+
+		found := false
+		for _, server := range states {
+			if server.Address != from || server.Port != relocation.From.Port {
+				continue
+			}
+			found = true
+			err = runtime.SetServerAddr(server.Backend, server.Server, to, relocation.To.Port)
+			if err != nil {
+				return err
+			}
+		}
+		if !found {
+			return fmt.Errorf("no running server of %s at %s:%d", relocation.AppId, from, relocation.From.Port)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package haproxy
+
+import (
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"testing"
+
+	"github.com/QubitProducts/bamboo/services/marathon"
+)
+
+func appWithTasks(tasks ...marathon.Task) TemplateData {
+	return TemplateData{Apps: marathon.AppList{{Id: "/app", Tasks: tasks}}}
+}
+
+func TestRelocations(t *testing.T) {
+	Convey("#Relocations", t, func() {
+		a := marathon.Task{Host: "10.0.0.1", Port: 31000}
+		b := marathon.Task{Host: "10.0.0.2", Port: 31001}
+		c := marathon.Task{Host: "10.0.0.3", Port: 31002}
+
+		Convey("should pair moved tasks", func() {
+			relocations, ok := Relocations(appWithTasks(a, b), appWithTasks(a, c))
+			So(ok, ShouldBeTrue)
+			So(relocations, ShouldResemble, []Relocation{{"/app", Endpoint{"10.0.0.2", 31001}, Endpoint{"10.0.0.3", 31002}}})
+		})
+
+		Convey("should require a reload when the number of tasks changed", func() {
+			_, ok := Relocations(appWithTasks(a, b), appWithTasks(a, b, c))
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("should require a reload when the app changed", func() {
+			current := appWithTasks(a, c)
+			current.Apps[0].HealthCheckPath = "/health"
+			_, ok := Relocations(appWithTasks(a, b), current)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("should require a reload when a task is drained", func() {
+			drained := a
+			drained.Draining = true
+			_, ok := Relocations(appWithTasks(a, b), appWithTasks(drained, c))
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("should require a reload when a Lua script changed", func() {
+			current := appWithTasks(a, c)
+			current.LuaScripts = []LuaScript{{Name: "route", Path: "/etc/haproxy/lua/route-0badcafe.lua"}}
+			_, ok := Relocations(appWithTasks(a, b), current)
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
+
+func TestParseServersState(t *testing.T) {
+	Convey("#ParseServersState", t, func() {
+		Convey("should read backends, servers and addresses", func() {
+			states, err := ParseServersState("1\n" +
+				"# be_id be_name srv_id srv_name srv_addr srv_op_state srv_port\n" +
+				"3 app-cluster 1 app-10.0.0.1-31000 10.0.0.1 2 31000\n")
+			So(err, ShouldBeNil)
+			So(states, ShouldResemble, []ServerState{{"app-cluster", "app-10.0.0.1-31000", "10.0.0.1", 31000}})
+		})
+
+		Convey("should fail on unexpected output", func() {
+			_, err := ParseServersState("Unknown command.\n")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
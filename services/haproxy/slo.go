@@ -0,0 +1,59 @@
+package haproxy
+
+import (
+	"sort"
+)
+
+/*
+	Service level objective of an app, as exported to monitoring along
+	with the backend its requests are routed to
+*/
+type AppSlo struct {
+	AppId   string
+	Backend string
+	// Milliseconds, 0 without latency objective
+	LatencyTarget     int
+	LatencyPercentile float64
+	// Percentages, 0 without availability objective
+	Availability float64
+	ErrorBudget  float64
+	// Days
+	Window int
+	Labels map[string]string `json:",omitempty"`
+}
+
+/*
+	Returns the objectives of apps whose service has one, sorted by
+	app id
+*/
+func (data TemplateData) Slos() []AppSlo {
+	slos := []AppSlo{}
+	for _, app := range data.Apps {
+		serviceModel, ok := data.Services[app.Id]
+		if !ok || serviceModel.Slo == nil {
+			continue
+		}
+		slo := serviceModel.Slo
+		appSlo := AppSlo{
+			AppId:         app.Id,
+			Backend:       app.Backend,
+			LatencyTarget: slo.LatencyTarget,
+			Availability:  slo.Availability,
+			ErrorBudget:   slo.ErrorBudget(),
+			Window:        slo.EffectiveWindow(),
+			Labels:        slo.Labels,
+		}
+		if slo.LatencyTarget > 0 {
+			appSlo.LatencyPercentile = slo.EffectiveLatencyPercentile()
+		}
+		slos = append(slos, appSlo)
+	}
+	sort.Sort(slosByAppId(slos))
+	return slos
+}
+
+type slosByAppId []AppSlo
+
+func (s slosByAppId) Len() int           { return len(s) }
+func (s slosByAppId) Less(i, j int) bool { return s[i].AppId < s[j].AppId }
+func (s slosByAppId) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
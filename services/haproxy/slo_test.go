@@ -0,0 +1,39 @@
+package haproxy
+
+import (
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"testing"
+
+	"github.com/QubitProducts/bamboo/services/marathon"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+func TestSlos(t *testing.T) {
+	Convey("#Slos", t, func() {
+		data := TemplateData{
+			Apps: marathon.AppList{{Id: "/b", Backend: "::b"}, {Id: "/a", Backend: "::a"}, {Id: "/c", Backend: "::c"}},
+			Services: map[string]service.Service{
+				"/a": {Id: "/a", Slo: &service.Slo{Availability: 99.9, Labels: map[string]string{"team": "shop"}}},
+				"/b": {Id: "/b", Slo: &service.Slo{LatencyTarget: 300, LatencyPercentile: 95, Window: 7}},
+				"/c": {Id: "/c"},
+			},
+		}
+
+		Convey("should list apps with objectives by id", func() {
+			slos := data.Slos()
+			So(len(slos), ShouldEqual, 2)
+			So(slos[0].AppId, ShouldEqual, "/a")
+			So(slos[0].Backend, ShouldEqual, "::a")
+			So(slos[0].Labels["team"], ShouldEqual, "shop")
+		})
+
+		Convey("should derive the error budget and defaults", func() {
+			slos := data.Slos()
+			So(slos[0].ErrorBudget, ShouldAlmostEqual, 0.1)
+			So(slos[0].Window, ShouldEqual, 30)
+			So(slos[0].LatencyPercentile, ShouldEqual, 0)
+			So(slos[1].LatencyPercentile, ShouldEqual, 95)
+			So(slos[1].ErrorBudget, ShouldEqual, 0)
+		})
+	})
+}
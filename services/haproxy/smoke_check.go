@@ -0,0 +1,137 @@
+package haproxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+// Probe sent after a configuration is applied
+type SmokeTarget struct {
+	// Service the probe belongs to, empty for canary probes
+	ServiceId string
+	Probe     conf.SmokeProbe
+}
+
+// Outcome of a smoke probe
+type SmokeResult struct {
+	ServiceId  string `json:",omitempty"`
+	Url        string
+	Host       string `json:",omitempty"`
+	Status     int    `json:",omitempty"`
+	DurationMs int64
+	Passed     bool
+	Error      string `json:",omitempty"`
+}
+
+// Returned by redirects, which are checked rather than followed
+var errRedirect = errors.New("redirect not followed")
+
+/*
+	Returns the canary probes followed by the probes of the services
+	routing to an app, by service id. Probes of services without Host
+	are sent with the first hostname of the service ACL.
+*/
+func SmokeTargets(config conf.SmokeCheck, data TemplateData) []SmokeTarget {
+	targets := []SmokeTarget{}
+	for _, probe := range config.Probes {
+		targets = append(targets, SmokeTarget{Probe: probe})
+	}
+
+	routed := map[string]bool{}
+	for _, app := range data.Apps {
+		routed[app.Id] = true
+	}
+	ids := []string{}
+	for id, serviceModel := range data.Services {
+		if serviceModel.SmokeProbe != nil && routed[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		probe := *data.Services[id].SmokeProbe
+		if hostnames := service.Hostnames(data.Services[id].Acl); len(probe.Host) == 0 && len(hostnames) > 0 {
+			probe.Host = hostnames[0]
+		}
+		targets = append(targets, SmokeTarget{ServiceId: id, Probe: probe})
+	}
+	return targets
+}
+
+// Sends the probes at the same time, returning their results in order
+func RunSmokeCheck(config conf.SmokeCheck, targets []SmokeTarget) []SmokeResult {
+	client := &http.Client{
+		Timeout: config.TimeoutDuration(),
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return errRedirect
+		},
+	}
+
+	results := make([]SmokeResult, len(targets))
+	var wait sync.WaitGroup
+	for i, target := range targets {
+		wait.Add(1)
+		go func(i int, target SmokeTarget) {
+			defer wait.Done()
+			results[i] = probe(client, config.Address, target)
+		}(i, target)
+	}
+	wait.Wait()
+	return results
+}
+
+func probe(client *http.Client, address string, target SmokeTarget) SmokeResult {
+	result := SmokeResult{ServiceId: target.ServiceId, Url: target.Probe.Url, Host: target.Probe.Host}
+	if len(target.ServiceId) > 0 {
+		// probes stored before they were restricted to paths
+		if err := target.Probe.ValidatePath(); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+	}
+	if strings.HasPrefix(result.Url, "/") {
+		if len(address) == 0 {
+			result.Error = "the probe is a path, set HAProxy.SmokeCheck.Address"
+			return result
+		}
+		result.Url = strings.TrimSuffix(address, "/") + result.Url
+	}
+	request, err := http.NewRequest("GET", result.Url, nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if len(result.Host) > 0 {
+		request.Host = result.Host
+	}
+	request.Header.Set("User-Agent", "bamboo-smoke-check")
+
+	started := time.Now()
+	response, err := client.Do(request)
+	result.DurationMs = int64(time.Since(started) / time.Millisecond)
+	if response != nil {
+		result.Status = response.StatusCode
+		response.Body.Close()
+	}
+	if urlErr, ok := err.(*url.Error); ok && urlErr.Err == errRedirect {
+		err = nil
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Passed = target.Probe.Passes(result.Status)
+	if !result.Passed {
+		result.Error = fmt.Sprintf("unexpected status %d", result.Status)
+	}
+	return result
+}
@@ -0,0 +1,88 @@
+package haproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/marathon"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+func TestSmokeCheck(t *testing.T) {
+	Convey("#SmokeTargets", t, func() {
+		config := conf.SmokeCheck{Probes: []conf.SmokeProbe{{Url: "/canary"}}}
+		data := TemplateData{
+			Apps: marathon.AppList{{Id: "/api"}},
+			Services: map[string]service.Service{
+				"/api":  {Id: "/api", Acl: "hdr(host) -i api.example.com", SmokeProbe: &conf.SmokeProbe{Url: "/health"}},
+				"/gone": {Id: "/gone", Acl: "hdr(host) -i gone.example.com", SmokeProbe: &conf.SmokeProbe{Url: "/health"}},
+			},
+		}
+
+		Convey("should probe canaries and services routing to an app", func() {
+			So(SmokeTargets(config, data), ShouldResemble, []SmokeTarget{
+				{Probe: conf.SmokeProbe{Url: "/canary"}},
+				{ServiceId: "/api", Probe: conf.SmokeProbe{Url: "/health", Host: "api.example.com"}},
+			})
+		})
+	})
+
+	Convey("#RunSmokeCheck", t, func() {
+		hosts := make(chan string, 10)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hosts <- r.Host
+			switch r.URL.Path {
+			case "/ok":
+				w.WriteHeader(http.StatusOK)
+			case "/moved":
+				http.Redirect(w, r, "/elsewhere", http.StatusFound)
+			default:
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer server.Close()
+		config := conf.SmokeCheck{Address: server.URL + "/", Timeout: 5}
+
+		Convey("should send paths to the address with the Host of the probe", func() {
+			results := RunSmokeCheck(config, []SmokeTarget{{ServiceId: "/api", Probe: conf.SmokeProbe{Url: "/ok", Host: "api.example.com"}}})
+			So(results[0].Passed, ShouldBeTrue)
+			So(results[0].Status, ShouldEqual, http.StatusOK)
+			So(results[0].Url, ShouldEqual, server.URL+"/ok")
+			So(<-hosts, ShouldEqual, "api.example.com")
+		})
+
+		Convey("should check redirects without following them", func() {
+			results := RunSmokeCheck(config, []SmokeTarget{{Probe: conf.SmokeProbe{Url: server.URL + "/moved"}}})
+			So(results[0].Passed, ShouldBeTrue)
+			So(results[0].Status, ShouldEqual, http.StatusFound)
+			So(len(hosts), ShouldEqual, 1)
+		})
+
+		Convey("should fail on unexpected statuses", func() {
+			results := RunSmokeCheck(config, []SmokeTarget{
+				{Probe: conf.SmokeProbe{Url: "/broken"}},
+				{Probe: conf.SmokeProbe{Url: "/ok", ExpectStatus: http.StatusNoContent}},
+			})
+			So(results[0].Passed, ShouldBeFalse)
+			So(results[0].Error, ShouldEqual, "unexpected status 503")
+			So(results[1].Passed, ShouldBeFalse)
+		})
+
+		Convey("should not send service probes to absolute URLs", func() {
+			results := RunSmokeCheck(config, []SmokeTarget{{ServiceId: "/api", Probe: conf.SmokeProbe{Url: server.URL + "/ok"}}})
+			So(results[0].Passed, ShouldBeFalse)
+			So(results[0].Error, ShouldContainSubstring, "must be a path")
+			So(len(hosts), ShouldEqual, 0)
+		})
+
+		Convey("should fail on paths without address", func() {
+			config.Address = ""
+			results := RunSmokeCheck(config, []SmokeTarget{{Probe: conf.SmokeProbe{Url: "/ok"}}})
+			So(results[0].Passed, ShouldBeFalse)
+			So(results[0].Error, ShouldContainSubstring, "HAProxy.SmokeCheck.Address")
+		})
+	})
+}
@@ -0,0 +1,82 @@
+package haproxy
+
+import (
+	"bytes"
+	"fmt"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+// SPOE agent with the names of its engine and servers backend
+type SpoeEngine struct {
+	// App declaring the agent, empty for agents of every service
+	AppId   string
+	Engine  string
+	Backend string
+	Agent   conf.SpoeAgent
+}
+
+/*
+	Returns the engines of the configured agents followed by the
+	engines of agents declared by services, in app order
+*/
+func (data TemplateData) SpoeEngines() []SpoeEngine {
+	engines := []SpoeEngine{}
+	for _, agent := range data.Spoe.Agents {
+		engines = append(engines, newSpoeEngine("", "agent-"+agent.Name, agent))
+	}
+	for _, app := range data.Apps {
+		for _, agent := range data.Services[app.Id].Agents {
+			engines = append(engines, newSpoeEngine(app.Id, "agent-"+app.EscapedId+"-"+agent.Name, agent))
+		}
+	}
+	return engines
+}
+
+func newSpoeEngine(appId string, engine string, agent conf.SpoeAgent) SpoeEngine {
+	return SpoeEngine{AppId: appId, Engine: engine, Backend: engine + "-servers", Agent: agent}
+}
+
+/*
+	Returns the engines requests of an app are sent to
+*/
+func (data TemplateData) SpoeEnginesOf(appId string) []SpoeEngine {
+	engines := []SpoeEngine{}
+	for _, engine := range data.SpoeEngines() {
+		if len(engine.AppId) == 0 || engine.AppId == appId {
+			engines = append(engines, engine)
+		}
+	}
+	return engines
+}
+
+/*
+	Renders the SPOE configuration with one engine per agent, each
+	sending a single message through the group named after the agent
+*/
+func AgentsSpoeConfig(data TemplateData) string {
+	buffer := new(bytes.Buffer)
+	buffer.WriteString("# Generated by Bamboo, do not edit\n")
+	for _, engine := range data.SpoeEngines() {
+		agent := engine.Agent
+		fmt.Fprintf(buffer, `
+[%s]
+spoe-agent %s
+    groups %s
+    option var-prefix %s
+    timeout hello 500ms
+    timeout idle 10s
+    timeout processing %dms
+    use-backend %s
+    log global
+
+spoe-message %s
+    args %s
+
+spoe-group %s
+    messages %s
+`, engine.Engine, engine.Engine, agent.Name, agent.EffectiveVarPrefix(), agent.EffectiveProcessingTimeout(),
+			engine.Backend, agent.Name, agent.EffectiveArgs(), agent.Name, agent.Name)
+	}
+	return buffer.String()
+}
@@ -0,0 +1,43 @@
+package haproxy
+
+import (
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/marathon"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+func TestSpoeEngines(t *testing.T) {
+	Convey("#SpoeEngines", t, func() {
+		waf := conf.SpoeAgent{Name: "waf", Servers: "10.0.0.5:12345", DenyVar: "txn.waf.block"}
+		auth := conf.SpoeAgent{Name: "auth", Servers: "10.0.0.6:12345"}
+		data := TemplateData{
+			Apps:     marathon.AppList{{Id: "/a", EscapedId: "::a"}, {Id: "/b", EscapedId: "::b"}},
+			Services: map[string]service.Service{"/a": {Id: "/a", Agents: []conf.SpoeAgent{auth}}},
+			Spoe:     conf.Spoe{Agents: []conf.SpoeAgent{waf}},
+		}
+
+		Convey("should list configured agents, then agents of services", func() {
+			engines := data.SpoeEngines()
+			So(len(engines), ShouldEqual, 2)
+			So(engines[0].Engine, ShouldEqual, "agent-waf")
+			So(engines[1].Engine, ShouldEqual, "agent-::a-auth")
+			So(engines[1].Backend, ShouldEqual, "agent-::a-auth-servers")
+		})
+
+		Convey("should send requests of an app to its agents and the configured ones", func() {
+			So(len(data.SpoeEnginesOf("/a")), ShouldEqual, 2)
+			So(len(data.SpoeEnginesOf("/b")), ShouldEqual, 1)
+		})
+
+		Convey("should render an engine per agent", func() {
+			config := AgentsSpoeConfig(data)
+			So(strings.Contains(config, "[agent-waf]"), ShouldBeTrue)
+			So(strings.Contains(config, "option var-prefix waf"), ShouldBeTrue)
+			So(strings.Contains(config, "use-backend agent-::a-auth-servers"), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,129 @@
+package haproxy
+
+import (
+	"sort"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+/*
+	Estimated bytes of a stick table entry: the session with its tree
+	nodes and allocator overhead, the IPv4 key and the stored data
+*/
+const (
+	stickEntryOverhead = 128
+	stickIpKeyBytes    = 4
+	// server_id and server_key of `stick on`
+	stickServerBytes = 16
+	// freq_ctr of http_req_rate
+	stickRateBytes = 12
+)
+
+/*
+	Stick table of a backend, shared by its rate limit and sticky
+	sessions since a backend holds a single table
+*/
+type StickTable struct {
+	AppId   string
+	Backend string
+	Size    int
+	// Seconds
+	Expire    int
+	RateLimit *service.RateLimit `json:",omitempty"`
+	Sticky    bool
+	// Estimated memory per entry and of the full table
+	EntryBytes int
+	Bytes      int64
+}
+
+// Estimated memory of all stick tables against the configured budget
+type StickTableUsage struct {
+	Tables      []StickTable
+	TotalBytes  int64
+	BudgetBytes int64
+	OverBudget  bool
+}
+
+/*
+	Returns the stick tables of apps whose service has a rate limit or
+	sticky sessions, sorted by app id
+*/
+func (data TemplateData) StickTables() []StickTable {
+	tables := []StickTable{}
+	for _, app := range data.Apps {
+		serviceModel, ok := data.Services[app.Id]
+		if !ok || (serviceModel.RateLimit == nil && serviceModel.Sticky == nil) {
+			continue
+		}
+		tables = append(tables, newStickTable(app.Id, app.Backend, serviceModel, data.StickTableDefaults))
+	}
+	sort.Sort(stickTablesById(tables))
+	return tables
+}
+
+/*
+	Returns the stick table of an app, nil without rate limit and
+	sticky sessions
+*/
+func (data TemplateData) StickTableOf(appId string) *StickTable {
+	for _, table := range data.StickTables() {
+		if table.AppId == appId {
+			return &table
+		}
+	}
+	return nil
+}
+
+func newStickTable(appId string, backend string, serviceModel service.Service, defaults conf.StickTables) StickTable {
+	table := StickTable{AppId: appId, Backend: backend}
+	entryBytes := stickEntryOverhead + stickIpKeyBytes
+
+	if limit := serviceModel.RateLimit; limit != nil {
+		table.RateLimit = limit
+		table.Size = maxSize(table.Size, limit.TableSize, defaults.DefaultSize)
+		table.Expire = maxSize(table.Expire, limit.EffectivePeriod(), 0)
+		entryBytes += stickRateBytes
+	}
+	if sticky := serviceModel.Sticky; sticky != nil {
+		table.Sticky = true
+		table.Size = maxSize(table.Size, sticky.TableSize, defaults.DefaultSize)
+		table.Expire = maxSize(table.Expire, sticky.EffectiveExpire()*60, 0)
+		entryBytes += stickServerBytes
+	}
+
+	// entries are 8 byte aligned
+	table.EntryBytes = (entryBytes + 7) / 8 * 8
+	table.Bytes = int64(table.EntryBytes) * int64(table.Size)
+	return table
+}
+
+// Size of a table, the default size when none is given
+func maxSize(current int, size int, defaultSize int) int {
+	if size <= 0 {
+		size = defaultSize
+	}
+	if size > current {
+		return size
+	}
+	return current
+}
+
+/*
+	Sums the estimated memory of the stick tables and compares it with
+	the budget in megabytes, 0 for no budget
+*/
+func EstimateStickTables(tables []StickTable, budget int64) StickTableUsage {
+	usage := StickTableUsage{Tables: tables, BudgetBytes: budget << 20}
+	for _, table := range tables {
+		usage.TotalBytes += table.Bytes
+	}
+	usage.OverBudget = budget > 0 && usage.TotalBytes > usage.BudgetBytes
+	return usage
+}
+
+type stickTablesById []StickTable
+
+func (s stickTablesById) Len() int           { return len(s) }
+func (s stickTablesById) Less(i, j int) bool { return s[i].AppId < s[j].AppId }
+func (s stickTablesById) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
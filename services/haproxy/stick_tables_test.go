@@ -0,0 +1,61 @@
+package haproxy
+
+import (
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"testing"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/marathon"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+func TestStickTables(t *testing.T) {
+	Convey("#StickTables", t, func() {
+		data := TemplateData{
+			Apps: marathon.AppList{{Id: "/b", Backend: "::b"}, {Id: "/a", Backend: "::a"}, {Id: "/c", Backend: "::c"}},
+			Services: map[string]service.Service{
+				"/a": {Id: "/a", RateLimit: &service.RateLimit{Requests: 100}},
+				"/b": {Id: "/b", RateLimit: &service.RateLimit{Requests: 10, Period: 60}, Sticky: &service.Sticky{TableSize: 200000}},
+			},
+			StickTableDefaults: conf.StickTables{DefaultSize: 100000},
+		}
+
+		Convey("should only list apps with rate limits or sticky sessions", func() {
+			tables := data.StickTables()
+			So(len(tables), ShouldEqual, 2)
+			So(tables[0].AppId, ShouldEqual, "/a")
+			So(data.StickTableOf("/c"), ShouldBeNil)
+		})
+
+		Convey("should size tables by the service or the default", func() {
+			So(data.StickTableOf("/a").Size, ShouldEqual, 100000)
+			So(data.StickTableOf("/a").Expire, ShouldEqual, 10)
+			So(data.StickTableOf("/b").Size, ShouldEqual, 200000)
+			So(data.StickTableOf("/b").Expire, ShouldEqual, 1800)
+		})
+
+		Convey("should estimate bigger entries for sticky sessions", func() {
+			So(data.StickTableOf("/a").EntryBytes, ShouldEqual, 144)
+			So(data.StickTableOf("/b").EntryBytes, ShouldEqual, 160)
+		})
+	})
+}
+
+func TestEstimateStickTables(t *testing.T) {
+	Convey("#EstimateStickTables", t, func() {
+		tables := []StickTable{{AppId: "/a", Bytes: 3 << 20}, {AppId: "/b", Bytes: 2 << 20}}
+
+		Convey("should sum the tables", func() {
+			So(EstimateStickTables(tables, 0).TotalBytes, ShouldEqual, 5<<20)
+		})
+
+		Convey("should not be over a missing budget", func() {
+			So(EstimateStickTables(tables, 0).OverBudget, ShouldBeFalse)
+		})
+
+		Convey("should compare with the budget in megabytes", func() {
+			So(EstimateStickTables(tables, 5).OverBudget, ShouldBeFalse)
+			So(EstimateStickTables(tables, 4).OverBudget, ShouldBeTrue)
+		})
+	})
+}
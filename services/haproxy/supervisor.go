@@ -0,0 +1,309 @@
+package haproxy
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+// Bytes of HAProxy output kept to explain why it exited
+const processOutputTail = 4096
+
+// Exit of the supervised HAProxy
+type ProcessExit struct {
+	At time.Time
+	// e.g. "exit status 1" or "signal: killed"
+	Reason string
+	// Last output of the process
+	Output string
+}
+
+// Supervised HAProxy master process
+type ProcessStatus struct {
+	Running bool
+	Pid     int       `json:",omitempty"`
+	Started time.Time `json:",omitempty"`
+	// Restarts after the process exited
+	Restarts int
+	LastExit *ProcessExit `json:",omitempty"`
+	// Set while waiting to restart the process
+	NextRestart *time.Time `json:",omitempty"`
+}
+
+/*
+	Runs HAProxy in master-worker mode as a child of Bamboo, started with
+	the written configuration at startup or by the first reload when
+	there is none yet, reloaded with USR2 and restarted with a backoff
+	when it exits
+*/
+type Supervisor struct {
+	BinaryPath string
+	ConfigPath string
+	Args       []string
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Time given to the workers to finish their connections on Stop
+	StopTimeout time.Duration
+
+	lock     sync.Mutex
+	started  bool
+	stopping bool
+	process  *os.Process
+	// Closed when the running process exited
+	exited  chan struct{}
+	backoff time.Duration
+	status  ProcessStatus
+}
+
+// Supervisor of the supervise strategy, nil with other strategies
+var supervisor *Supervisor
+
+func NewSupervisor(config conf.HAProxy) *Supervisor {
+	return &Supervisor{
+		BinaryPath:  config.BinaryPath,
+		ConfigPath:  config.OutputPath,
+		Args:        config.Reload.Supervisor.Args,
+		MinBackoff:  config.Reload.Supervisor.MinBackoffDuration(),
+		MaxBackoff:  config.Reload.Supervisor.MaxBackoffDuration(),
+		StopTimeout: config.Reload.Supervisor.StopTimeoutDuration(),
+	}
+}
+
+/*
+	Starts HAProxy with the configuration written by an earlier run, so
+	that it runs even when the first render leaves the configuration
+	unchanged. Does nothing when no configuration was written yet, the
+	first reload starts HAProxy then.
+*/
+func (s *Supervisor) Start() error {
+	if _, err := os.Stat(s.ConfigPath); os.IsNotExist(err) {
+		return nil
+	}
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stopping || s.started {
+		return nil
+	}
+	return s.startFirst()
+}
+
+/*
+	Starts HAProxy with the written configuration the first time, then
+	has the master reload it. The configuration is checked first, since
+	a master failing to load it keeps the old workers without telling.
+*/
+func (s *Supervisor) Reload() error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stopping {
+		return nil
+	}
+	if !s.started {
+		return s.startFirst()
+	}
+	if s.process == nil {
+		// the restart loads the written configuration
+		return nil
+	}
+	log.Printf("Sending USR2 to supervised HAProxy %d\n", s.process.Pid)
+	return s.process.Signal(syscall.SIGUSR2)
+}
+
+// Checks the written configuration
+func (s *Supervisor) check() error {
+	output, err := exec.Command(s.BinaryPath, "-c", "-f", s.ConfigPath).CombinedOutput()
+	if err != nil {
+		if message := strings.TrimSpace(string(output)); len(message) > 0 {
+			return fmt.Errorf("%s: %s", err, message)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *Supervisor) startFirst() error {
+	s.started = true
+	s.backoff = s.MinBackoff
+	return s.start()
+}
+
+/*
+	Stops HAProxy for good: the master is asked to stop softly with USR1,
+	which lets the workers finish their connections, and is killed when
+	it is still running after the stop timeout
+*/
+func (s *Supervisor) Stop() {
+	s.lock.Lock()
+	s.stopping = true
+	process, exited := s.process, s.exited
+	s.lock.Unlock()
+	if process == nil {
+		return
+	}
+
+	log.Printf("Stopping supervised HAProxy %d\n", process.Pid)
+	process.Signal(syscall.SIGUSR1)
+	select {
+	case <-exited:
+	case <-time.After(s.StopTimeout):
+		log.Printf("Supervised HAProxy %d still running after %s, killing it\n", process.Pid, s.StopTimeout)
+		process.Kill()
+		<-exited
+	}
+}
+
+// Returns the status of the process
+func (s *Supervisor) Status() ProcessStatus {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.status
+}
+
+func (s *Supervisor) start() error {
+	args := append([]string{"-W", "-db", "-f", s.ConfigPath}, s.Args...)
+	cmd := exec.Command(s.BinaryPath, args...)
+	output := &tailWriter{limit: processOutputTail}
+	cmd.Stdout = io.MultiWriter(os.Stdout, output)
+	cmd.Stderr = io.MultiWriter(os.Stderr, output)
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	log.Printf("Started supervised HAProxy %d\n", cmd.Process.Pid)
+
+	s.process = cmd.Process
+	s.exited = make(chan struct{})
+	s.status.Running = true
+	s.status.Pid = cmd.Process.Pid
+	s.status.Started = time.Now()
+	s.status.NextRestart = nil
+	go s.wait(cmd, s.exited, output)
+	return nil
+}
+
+func (s *Supervisor) wait(cmd *exec.Cmd, exited chan struct{}, output *tailWriter) {
+	reason := waitReason(cmd)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	defer close(exited)
+	now := time.Now()
+	log.Printf("Supervised HAProxy %d exited: %s\n", cmd.Process.Pid, reason)
+	s.process = nil
+	s.status.Running = false
+	s.status.LastExit = &ProcessExit{At: now, Reason: reason, Output: output.String()}
+	if s.stopping {
+		return
+	}
+	// a process which ran for a while starts over with the shortest backoff
+	if now.Sub(s.status.Started) > s.MaxBackoff {
+		s.backoff = s.MinBackoff
+	}
+	s.scheduleRestart(now)
+}
+
+// Restarts the process after the backoff, doubling it for the next time
+func (s *Supervisor) scheduleRestart(now time.Time) {
+	delay := s.backoff
+	s.backoff *= 2
+	if s.backoff > s.MaxBackoff {
+		s.backoff = s.MaxBackoff
+	}
+	next := now.Add(delay)
+	s.status.NextRestart = &next
+
+	time.AfterFunc(delay, func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if s.stopping {
+			s.status.NextRestart = nil
+			return
+		}
+		s.status.Restarts++
+		if err := s.start(); err != nil {
+			log.Printf("Unable to restart supervised HAProxy: %s\n", err)
+			s.status.LastExit = &ProcessExit{At: time.Now(), Reason: err.Error()}
+			s.scheduleRestart(time.Now())
+		}
+	})
+}
+
+// Returns why the process exited
+func waitReason(cmd *exec.Cmd) string {
+	err := cmd.Wait()
+	if cmd.ProcessState != nil {
+		return cmd.ProcessState.String()
+	}
+	return err.Error()
+}
+
+/*
+	Returns the status of the HAProxy process of the supervise
+	strategy, false with other strategies
+*/
+func SupervisedProcess() (ProcessStatus, bool) {
+	if supervisor == nil {
+		return ProcessStatus{}, false
+	}
+	return supervisor.Status(), true
+}
+
+/*
+	Starts the HAProxy process of the supervise strategy with the
+	written configuration, if any. Does nothing with other strategies.
+*/
+func StartSupervised() error {
+	if supervisor == nil {
+		return nil
+	}
+	return supervisor.Start()
+}
+
+/*
+	Stops the HAProxy process of the supervise strategy, so that it does
+	not outlive Bamboo. Does nothing with other strategies.
+*/
+func StopSupervised() {
+	if supervisor != nil {
+		supervisor.Stop()
+	}
+}
+
+// Keeps the last bytes written to it
+type tailWriter struct {
+	limit int
+	lock  sync.Mutex
+	tail  []byte
+}
+
+func (t *tailWriter) Write(data []byte) (int, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.tail = append(t.tail, data...)
+	if len(t.tail) > t.limit {
+		t.tail = t.tail[len(t.tail)-t.limit:]
+	}
+	return len(data), nil
+}
+
+func (t *tailWriter) String() string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return string(t.tail)
+}
@@ -0,0 +1,128 @@
+package haproxy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+// Writes an haproxy stand-in passing configuration checks
+func fakeHAProxy(dir string, script string) string {
+	path := filepath.Join(dir, "haproxy")
+	ioutil.WriteFile(path, []byte("#!/bin/sh\nif [ \"$1\" = -c ]; then exit 0; fi\n"+script+"\n"), 0755)
+	return path
+}
+
+func waitForExit(s *Supervisor) ProcessStatus {
+	for i := 0; i < 100; i++ {
+		if status := s.Status(); status.LastExit != nil {
+			return status
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return s.Status()
+}
+
+func TestSupervisor(t *testing.T) {
+	Convey("#Supervisor", t, func() {
+		dir, _ := ioutil.TempDir("", "bamboo-supervisor")
+		defer os.RemoveAll(dir)
+		supervised := &Supervisor{ConfigPath: filepath.Join(dir, "haproxy.cfg"), MinBackoff: time.Hour, MaxBackoff: time.Hour}
+
+		Convey("should not start with an invalid configuration", func() {
+			supervised.BinaryPath = "false"
+			So(supervised.Reload(), ShouldNotBeNil)
+			So(supervised.Status().Running, ShouldBeFalse)
+		})
+
+		Convey("should record why HAProxy exited and schedule a restart", func() {
+			supervised.BinaryPath = fakeHAProxy(dir, "echo \"[ALERT] out of memory\" >&2\nexit 3")
+			So(supervised.Reload(), ShouldBeNil)
+
+			status := waitForExit(supervised)
+			So(status.Running, ShouldBeFalse)
+			So(status.LastExit.Reason, ShouldEqual, "exit status 3")
+			So(status.LastExit.Output, ShouldContainSubstring, "out of memory")
+			So(status.NextRestart, ShouldNotBeNil)
+		})
+
+		Convey("should restart HAProxy after the backoff", func() {
+			supervised.BinaryPath = fakeHAProxy(dir, "exit 3")
+			supervised.MinBackoff = 10 * time.Millisecond
+			So(supervised.Reload(), ShouldBeNil)
+
+			time.Sleep(200 * time.Millisecond)
+			So(supervised.Status().Restarts, ShouldBeGreaterThan, 0)
+		})
+
+		Convey("should stop HAProxy softly without restarting it", func() {
+			supervised.BinaryPath = fakeHAProxy(dir, "trap 'exit 0' USR1\nwhile true; do sleep 0.01; done")
+			supervised.MinBackoff = 10 * time.Millisecond
+			supervised.StopTimeout = time.Hour
+			So(supervised.Reload(), ShouldBeNil)
+			// let the script set its trap
+			time.Sleep(100 * time.Millisecond)
+
+			supervised.Stop()
+			status := supervised.Status()
+			So(status.Running, ShouldBeFalse)
+			So(status.LastExit.Reason, ShouldEqual, "exit status 0")
+			So(status.NextRestart, ShouldBeNil)
+			So(supervised.Reload(), ShouldBeNil)
+			So(supervised.Status().Running, ShouldBeFalse)
+		})
+
+		Convey("should kill HAProxy still running after the stop timeout", func() {
+			supervised.BinaryPath = fakeHAProxy(dir, "trap '' USR1\nwhile true; do sleep 0.01; done")
+			supervised.StopTimeout = 50 * time.Millisecond
+			So(supervised.Reload(), ShouldBeNil)
+			time.Sleep(100 * time.Millisecond)
+
+			supervised.Stop()
+			So(supervised.Status().LastExit.Reason, ShouldEqual, "signal: killed")
+		})
+
+		Convey("should start HAProxy with a configuration written before", func() {
+			supervised.BinaryPath = fakeHAProxy(dir, "trap 'exit 0' USR1\nwhile true; do sleep 0.01; done")
+			supervised.StopTimeout = time.Hour
+			ioutil.WriteFile(supervised.ConfigPath, []byte("global\n"), 0644)
+			defer supervised.Stop()
+
+			So(supervised.Start(), ShouldBeNil)
+			So(supervised.Status().Running, ShouldBeTrue)
+			pid := supervised.Status().Pid
+
+			// let the script set its trap
+			time.Sleep(100 * time.Millisecond)
+			So(supervised.Start(), ShouldBeNil)
+			So(supervised.Status().Pid, ShouldEqual, pid)
+		})
+
+		Convey("should wait for the first reload without a written configuration", func() {
+			supervised.BinaryPath = fakeHAProxy(dir, "exit 3")
+			So(supervised.Start(), ShouldBeNil)
+			So(supervised.Status().Running, ShouldBeFalse)
+			So(supervised.Status().LastExit, ShouldBeNil)
+		})
+
+		Convey("should not start with an invalid written configuration", func() {
+			supervised.BinaryPath = "false"
+			ioutil.WriteFile(supervised.ConfigPath, []byte("invalid\n"), 0644)
+			So(supervised.Start(), ShouldNotBeNil)
+			So(supervised.Status().Running, ShouldBeFalse)
+		})
+	})
+}
+
+func TestTailWriter(t *testing.T) {
+	Convey("#tailWriter", t, func() {
+		tail := &tailWriter{limit: 8}
+		tail.Write([]byte("first line\n"))
+		tail.Write([]byte("second\n"))
+		So(tail.String(), ShouldEqual, "\nsecond\n")
+	})
+}
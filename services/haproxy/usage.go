@@ -0,0 +1,46 @@
+package haproxy
+
+// Counters of a backend of a running HAProxy, reset by reloads
+type BackendStat struct {
+	Backend      string
+	Requests     int64
+	BytesIn      int64
+	BytesOut     int64
+	Responses5xx int64
+	// Current connections
+	Connections int64
+}
+
+/*
+	Parses the backend summary lines of the CSV output of `show stat`
+*/
+func ParseBackendStat(output string) ([]BackendStat, error) {
+	records, err := readStat(output, []string{"pxname", "svname", "stot", "bin", "bout", "hrsp_5xx", "scur"})
+	if err != nil {
+		return nil, err
+	}
+
+	stats := []BackendStat{}
+	for _, record := range records {
+		if record["svname"] != "BACKEND" {
+			continue
+		}
+		stats = append(stats, BackendStat{
+			Backend:      record["pxname"],
+			Requests:     record.number("stot"),
+			BytesIn:      record.number("bin"),
+			BytesOut:     record.number("bout"),
+			Responses5xx: record.number("hrsp_5xx"),
+			Connections:  record.number("scur"),
+		})
+	}
+	return stats, nil
+}
+
+func (r RuntimeAPI) BackendStat() ([]BackendStat, error) {
+	output, err := r.command("show stat")
+	if err != nil {
+		return nil, err
+	}
+	return ParseBackendStat(output)
+}
@@ -0,0 +1,113 @@
+package haproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+// Rendered configuration submitted to the validation hook
+type ValidationRequest struct {
+	RenderId string
+	Revision int64
+	// SHA-1 of the configuration and of the one it replaces
+	ConfigHash   string
+	PreviousHash string
+	Config       string
+}
+
+// Decision of the validation hook
+type ValidationDecision struct {
+	Allowed bool
+	// Why the configuration was rejected
+	Reason string
+}
+
+/*
+	Asks an external service whether a rendered configuration may be
+	applied. Requests and responses follow the data API of OPA: the
+	request is sent as {"input": ...} and the decision is read from
+	"result", or from the top level of the response for other services.
+*/
+type ValidationHook struct {
+	Url     string
+	Headers map[string]string
+	Client  *http.Client
+}
+
+// Returns nil when no validation hook is configured
+func NewValidationHook(config conf.ValidationHook) *ValidationHook {
+	if !config.Enabled() {
+		return nil
+	}
+	return &ValidationHook{
+		Url:     config.Url,
+		Headers: config.Headers,
+		Client:  &http.Client{Timeout: config.TimeoutDuration()},
+	}
+}
+
+type validationInput struct {
+	Input ValidationRequest `json:"input"`
+}
+
+type validationResponse struct {
+	Allowed *bool
+	Reason  string
+	Result  *struct {
+		Allowed *bool
+		Reason  string
+	}
+}
+
+/*
+	Returns the decision of the hook. Fails when the hook can not be
+	reached, responds with another status than 2xx or without decision,
+	e.g. for an undefined OPA policy.
+*/
+func (v *ValidationHook) Validate(request ValidationRequest) (ValidationDecision, error) {
+	body, err := json.Marshal(validationInput{request})
+	if err != nil {
+		return ValidationDecision{}, err
+	}
+	httpRequest, err := http.NewRequest("POST", v.Url, bytes.NewReader(body))
+	if err != nil {
+		return ValidationDecision{}, err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	for name, value := range v.Headers {
+		httpRequest.Header.Set(name, value)
+	}
+
+	response, err := v.Client.Do(httpRequest)
+	if err != nil {
+		return ValidationDecision{}, err
+	}
+	defer response.Body.Close()
+	content, _ := ioutil.ReadAll(response.Body)
+	if response.StatusCode/100 != 2 {
+		if message := strings.TrimSpace(string(content)); len(message) > 0 {
+			return ValidationDecision{}, fmt.Errorf("%s responded %s: %s", v.Url, response.Status, message)
+		}
+		return ValidationDecision{}, fmt.Errorf("%s responded %s", v.Url, response.Status)
+	}
+
+	decoded := validationResponse{}
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		return ValidationDecision{}, fmt.Errorf("invalid response of %s: %s", v.Url, err)
+	}
+	allowed, reason := decoded.Allowed, decoded.Reason
+	if decoded.Result != nil {
+		allowed, reason = decoded.Result.Allowed, decoded.Result.Reason
+	}
+	if allowed == nil {
+		return ValidationDecision{}, errors.New(v.Url + " responded without decision")
+	}
+	return ValidationDecision{Allowed: *allowed, Reason: reason}, nil
+}
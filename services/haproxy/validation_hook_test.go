@@ -0,0 +1,64 @@
+package haproxy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+func TestValidationHook(t *testing.T) {
+	Convey("#ValidationHook", t, func() {
+		status := http.StatusOK
+		response := `{"result": {"allowed": true}}`
+		received := map[string]ValidationRequest{}
+		authorization := ""
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			json.Unmarshal(body, &received)
+			authorization = r.Header.Get("Authorization")
+			w.WriteHeader(status)
+			w.Write([]byte(response))
+		}))
+		defer server.Close()
+		hook := NewValidationHook(conf.ValidationHook{Url: server.URL, Headers: map[string]string{"Authorization": "Bearer secret"}, Timeout: 5})
+		request := ValidationRequest{RenderId: "render-1", ConfigHash: "abc", Config: "global\n"}
+
+		Convey("should not be created without URL", func() {
+			So(NewValidationHook(conf.ValidationHook{}), ShouldBeNil)
+		})
+
+		Convey("should send the configuration as OPA input", func() {
+			decision, err := hook.Validate(request)
+			So(err, ShouldBeNil)
+			So(decision.Allowed, ShouldBeTrue)
+			So(received["input"].Config, ShouldEqual, "global\n")
+			So(received["input"].RenderId, ShouldEqual, "render-1")
+			So(authorization, ShouldEqual, "Bearer secret")
+		})
+
+		Convey("should return rejections with their reason", func() {
+			response = `{"Allowed": false, "Reason": "backend without health check"}`
+			decision, err := hook.Validate(request)
+			So(err, ShouldBeNil)
+			So(decision.Allowed, ShouldBeFalse)
+			So(decision.Reason, ShouldEqual, "backend without health check")
+		})
+
+		Convey("should fail without decision", func() {
+			response = `{}`
+			_, err := hook.Validate(request)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("should fail on error responses", func() {
+			status = http.StatusInternalServerError
+			_, err := hook.Validate(request)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
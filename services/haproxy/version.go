@@ -0,0 +1,194 @@
+package haproxy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"sync"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+// Installed HAProxy version as reported by `haproxy -v`
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+	// Full first line of the version output
+	Raw string
+}
+
+// Version gated capabilities available to templates
+type Features struct {
+	// `resolvers` section and `resolvers` server option (1.6+)
+	Resolvers bool
+	// `server-template` backend directive (1.8+)
+	ServerTemplate bool
+	// Listening sockets transfer on reload with `expose-fd listeners` (1.8+)
+	SeamlessReload bool
+	// Master-worker mode, `-W` (1.8+)
+	MasterWorker bool
+	// Runtime API `set server addr` command (1.8+)
+	RuntimeServerAddr bool
+	// SPOE filters with `http-request send-spoe-group` (1.9+)
+	SpoeGroups bool
+	// 2.x configuration dialect, e.g. `http-request return` (2.0+)
+	Dialect2 bool
+	// JSON Web Token validation with the `jwt_verify` converter (2.5+)
+	JwtVerify bool
+}
+
+type HAProxyInfo struct {
+	Version  Version
+	Features Features
+}
+
+var versionPattern = regexp.MustCompile(`(?:HA-Proxy|HAProxy) version (\d+)\.(\d+)(?:\.(\d+))?`)
+
+var (
+	detected     Version
+	detectedLock sync.RWMutex
+)
+
+/*
+	Parses the output of `haproxy -v`, e.g.
+
+		HA-Proxy version 1.5.8 2014/10/31
+		HAProxy version 2.4.22-0ubuntu0.22.04.2 2023/04/04
+*/
+func ParseVersion(output string) (Version, error) {
+	match := versionPattern.FindStringSubmatch(output)
+	if match == nil {
+		return Version{}, errors.New("Unable to find HAProxy version in: " + output)
+	}
+
+	version := Version{Raw: match[0]}
+	version.Major, _ = strconv.Atoi(match[1])
+	version.Minor, _ = strconv.Atoi(match[2])
+	if len(match[3]) > 0 {
+		version.Patch, _ = strconv.Atoi(match[3])
+	}
+	return version, nil
+}
+
+/*
+	Parses a "major.minor[.patch]" version requirement
+*/
+func ParseVersionRequirement(requirement string) (Version, error) {
+	return ParseVersion("HAProxy version " + requirement)
+}
+
+func (v Version) Known() bool {
+	return v.Major > 0
+}
+
+func (v Version) AtLeast(major int, minor int) bool {
+	return v.Major > major || (v.Major == major && v.Minor >= minor)
+}
+
+func (v Version) Less(other Version) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+	return v.Patch < other.Patch
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+func (v Version) Features() Features {
+	return Features{
+		Resolvers:         v.AtLeast(1, 6),
+		ServerTemplate:    v.AtLeast(1, 8),
+		SeamlessReload:    v.AtLeast(1, 8),
+		MasterWorker:      v.AtLeast(1, 8),
+		RuntimeServerAddr: v.AtLeast(1, 8),
+		SpoeGroups:        v.AtLeast(1, 9),
+		Dialect2:          v.AtLeast(2, 0),
+		JwtVerify:         v.AtLeast(2, 5),
+	}
+}
+
+/*
+	Runs `haproxy -v` with the configured binary and remembers the result
+	for template rendering and configuration checks.
+*/
+func DetectVersion(config conf.HAProxy) (Version, error) {
+	output, err := exec.Command(config.BinaryPath, "-v").CombinedOutput()
+	if err != nil {
+		return Version{}, err
+	}
+
+	version, err := ParseVersion(string(output))
+	if err != nil {
+		return Version{}, err
+	}
+
+	detectedLock.Lock()
+	detected = version
+	detectedLock.Unlock()
+
+	return version, nil
+}
+
+/*
+	Detects the installed version and validates it against the configured
+	minimum version. An unknown version only produces a warning.
+*/
+func CheckVersion(config conf.HAProxy) error {
+	version, err := DetectVersion(config)
+	if err != nil {
+		log.Printf("Unable to detect HAProxy version with %s: %s\n", config.BinaryPath, err)
+		return nil
+	}
+	log.Printf("Detected HAProxy version %s\n", version)
+
+	features := version.Features()
+	if config.Resolvers.Enabled && !(features.Resolvers && features.ServerTemplate) {
+		return fmt.Errorf("HAProxy %s does not support DNS resolvers with server-template, 1.8 or later is required", version)
+	}
+
+	if config.Mirror.Enabled && !features.SpoeGroups {
+		return fmt.Errorf("HAProxy %s does not support SPOE groups for traffic mirroring, 1.9 or later is required", version)
+	}
+
+	if config.Reload.Strategy == "supervise" && !features.MasterWorker {
+		return fmt.Errorf("HAProxy %s does not support master-worker mode for the supervise reload strategy, 1.8 or later is required", version)
+	}
+
+	if len(config.Spoe.Agents) > 0 && !features.SpoeGroups {
+		return fmt.Errorf("HAProxy %s does not support SPOE groups for agents, 1.9 or later is required", version)
+	}
+
+	if len(config.MinimumVersion) == 0 {
+		return nil
+	}
+
+	minimum, err := ParseVersionRequirement(config.MinimumVersion)
+	if err != nil {
+		return err
+	}
+
+	if version.Less(minimum) {
+		return fmt.Errorf("HAProxy %s is older than the minimum supported version %s", version, config.MinimumVersion)
+	}
+	return nil
+}
+
+func CurrentVersion() Version {
+	detectedLock.RLock()
+	defer detectedLock.RUnlock()
+	return detected
+}
+
+func CurrentInfo() HAProxyInfo {
+	version := CurrentVersion()
+	return HAProxyInfo{Version: version, Features: version.Features()}
+}
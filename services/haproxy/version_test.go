@@ -0,0 +1,31 @@
+package haproxy
+
+import (
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	Convey("#ParseVersion", t, func() {
+		Convey("should parse 1.x version output", func() {
+			version, err := ParseVersion("HA-Proxy version 1.5.8 2014/10/31\nCopyright 2000-2014 Willy Tarreau")
+			So(err, ShouldBeNil)
+			So(version.String(), ShouldEqual, "1.5.8")
+			So(version.Features().Resolvers, ShouldBeFalse)
+		})
+
+		Convey("should parse 2.x version output", func() {
+			version, err := ParseVersion("HAProxy version 2.4.22-0ubuntu0.22.04.2 2023/04/04 - https://haproxy.org/")
+			So(err, ShouldBeNil)
+			So(version.Major, ShouldEqual, 2)
+			So(version.Minor, ShouldEqual, 4)
+			So(version.Features().ServerTemplate, ShouldBeTrue)
+			So(version.Features().Dialect2, ShouldBeTrue)
+		})
+
+		Convey("should fail on unknown output", func() {
+			_, err := ParseVersion("command not found")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,255 @@
+package haproxy
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QubitProducts/bamboo/configuration"
+)
+
+// Server counters of a running HAProxy as listed by `show stat`
+type ServerStat struct {
+	Backend string
+	Server  string
+	Status  string
+	Weight  int
+	// Average response time of the last 1024 requests in milliseconds
+	ResponseTime int
+	Requests     int64
+	// Failed connections, failed responses and 5xx responses
+	Errors int64
+}
+
+func (s ServerStat) key() string {
+	return s.Backend + "/" + s.Server
+}
+
+// Servers still taking traffic, draining servers have weight 0
+func (s ServerStat) active() bool {
+	return s.Weight > 0 && (strings.HasPrefix(s.Status, "UP") || s.Status == "no check")
+}
+
+// Line of `show stat` with its values by column name
+type statRecord map[string]string
+
+func (r statRecord) number(column string) int64 {
+	value, _ := strconv.ParseInt(r[column], 10, 64)
+	return value
+}
+
+/*
+	Reads the CSV output of `show stat`, failing when one of the
+	required columns is missing
+*/
+func readStat(output string, required []string) ([]statRecord, error) {
+	reader := csv.NewReader(strings.NewReader(strings.TrimPrefix(output, "# ")))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("unexpected stat output, missing header")
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[name] = i
+	}
+	for _, column := range required {
+		if _, ok := columns[column]; !ok {
+			return nil, errors.New("unexpected stat output, missing " + column)
+		}
+	}
+
+	stats := []statRecord{}
+	for _, record := range records[1:] {
+		if len(record) < len(records[0]) {
+			continue
+		}
+		values := statRecord{}
+		for name, i := range columns {
+			values[name] = record[i]
+		}
+		stats = append(stats, values)
+	}
+	return stats, nil
+}
+
+/*
+	Parses the CSV output of `show stat`, skipping the frontend and
+	backend summary lines
+*/
+func ParseStat(output string) ([]ServerStat, error) {
+	records, err := readStat(output, []string{"pxname", "svname", "status", "weight", "rtime", "stot", "econ", "eresp", "hrsp_5xx"})
+	if err != nil {
+		return nil, err
+	}
+
+	stats := []ServerStat{}
+	for _, record := range records {
+		server := record["svname"]
+		if server == "FRONTEND" || server == "BACKEND" {
+			continue
+		}
+		stats = append(stats, ServerStat{
+			Backend:      record["pxname"],
+			Server:       server,
+			Status:       record["status"],
+			Weight:       int(record.number("weight")),
+			ResponseTime: int(record.number("rtime")),
+			Requests:     record.number("stot"),
+			Errors:       record.number("econ") + record.number("eresp") + record.number("hrsp_5xx"),
+		})
+	}
+	return stats, nil
+}
+
+/*
+	Returns the weight of every active server in percent of its
+	configured weight. Within a backend the fastest server keeps 100%,
+	slower servers get a share proportional to their speed, further
+	lowered by their error rate since the previous stats. Backends with
+	a single active server are left alone.
+*/
+func AdaptiveWeights(previous []ServerStat, current []ServerStat, minWeight int) map[string]int {
+	before := map[string]ServerStat{}
+	for _, stat := range previous {
+		before[stat.key()] = stat
+	}
+
+	backends := map[string][]ServerStat{}
+	for _, stat := range current {
+		if stat.active() {
+			backends[stat.Backend] = append(backends[stat.Backend], stat)
+		}
+	}
+
+	weights := map[string]int{}
+	for _, servers := range backends {
+		if len(servers) < 2 {
+			continue
+		}
+		fastest := 0
+		for _, server := range servers {
+			if server.ResponseTime > 0 && (fastest == 0 || server.ResponseTime < fastest) {
+				fastest = server.ResponseTime
+			}
+		}
+
+		for _, server := range servers {
+			weight := 100.0
+			if fastest > 0 && server.ResponseTime > 0 {
+				weight = weight * float64(fastest) / float64(server.ResponseTime)
+			}
+			if last, ok := before[server.key()]; ok && server.Requests > last.Requests {
+				errorRate := float64(server.Errors-last.Errors) / float64(server.Requests-last.Requests)
+				if errorRate > 0 {
+					weight = weight * (1 - minFloat(errorRate, 1))
+				}
+			}
+			weights[server.key()] = clampWeight(int(weight+0.5), minWeight)
+		}
+	}
+	return weights
+}
+
+func (r RuntimeAPI) Stat() ([]ServerStat, error) {
+	output, err := r.command("show stat")
+	if err != nil {
+		return nil, err
+	}
+	return ParseStat(output)
+}
+
+/*
+	Sets the weights of servers in percent of their configured weight,
+	sending every `set weight` command over a single connection
+*/
+func (r RuntimeAPI) SetWeights(weights map[string]int) error {
+	if len(weights) == 0 {
+		return nil
+	}
+	commands := []string{}
+	for server, weight := range weights {
+		commands = append(commands, fmt.Sprintf("set weight %s %d%%", server, weight))
+	}
+	// set weight answers with an empty line on success
+	output, err := r.command(strings.Join(commands, ";"))
+	if err != nil {
+		return err
+	}
+	if message := strings.TrimSpace(output); len(message) > 0 {
+		return errors.New(message)
+	}
+	return nil
+}
+
+/*
+	Periodically adjusts the server weights of the running HAProxy.
+	Reloads reset weights to the configured ones, every adjustment
+	therefore sets the weights of all active servers.
+*/
+type WeightTuner struct {
+	Config  *configuration.Configuration
+	Runtime RuntimeAPI
+
+	previous []ServerStat
+}
+
+func NewWeightTuner(conf *configuration.Configuration) *WeightTuner {
+	return &WeightTuner{
+		Config:  conf,
+		Runtime: RuntimeAPI{SocketPath: conf.HAProxy.RuntimeSocket},
+	}
+}
+
+func (t *WeightTuner) Run() {
+	for {
+		time.Sleep(t.Config.HAProxy.AdaptiveWeights.IntervalDuration())
+		if err := t.Tune(); err != nil {
+			log.Printf("Unable to adjust HAProxy server weights: %s\n", err)
+			t.Config.StatsD.Increment(1.0, "weights.failed", 1)
+		}
+	}
+}
+
+func (t *WeightTuner) Tune() error {
+	stats, err := t.Runtime.Stat()
+	if err != nil {
+		return err
+	}
+	weights := AdaptiveWeights(t.previous, stats, t.Config.HAProxy.AdaptiveWeights.MinWeight)
+	t.previous = stats
+
+	lowered := 0
+	for _, weight := range weights {
+		if weight < 100 {
+			lowered++
+		}
+	}
+	t.Config.StatsD.Gauge(1.0, "weights.lowered", strconv.Itoa(lowered))
+	return t.Runtime.SetWeights(weights)
+}
+
+func clampWeight(weight int, minWeight int) int {
+	if weight > 100 {
+		return 100
+	}
+	if weight < minWeight {
+		return minWeight
+	}
+	return weight
+}
+
+func minFloat(a float64, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,74 @@
+package haproxy
+
+import (
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestParseStat(t *testing.T) {
+	Convey("#ParseStat", t, func() {
+		Convey("should read the counters of servers", func() {
+			stats, err := ParseStat("# pxname,svname,stot,econ,eresp,status,weight,hrsp_5xx,rtime,\n" +
+				"app-cluster,FRONTEND,120,,,OPEN,,0,,\n" +
+				"app-cluster,app-10.0.0.1-31000,100,1,2,UP,1,3,20,\n" +
+				"app-cluster,BACKEND,100,1,2,UP,1,3,20,\n")
+			So(err, ShouldBeNil)
+			So(stats, ShouldResemble, []ServerStat{{
+				Backend: "app-cluster", Server: "app-10.0.0.1-31000", Status: "UP",
+				Weight: 1, ResponseTime: 20, Requests: 100, Errors: 6,
+			}})
+		})
+
+		Convey("should fail on unexpected output", func() {
+			_, err := ParseStat("Unknown command.\n")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestAdaptiveWeights(t *testing.T) {
+	Convey("#AdaptiveWeights", t, func() {
+		fast := ServerStat{Backend: "app", Server: "a", Status: "UP", Weight: 1, ResponseTime: 10, Requests: 100}
+		slow := ServerStat{Backend: "app", Server: "b", Status: "UP", Weight: 1, ResponseTime: 40, Requests: 100}
+
+		Convey("should lower the weight of slower servers", func() {
+			weights := AdaptiveWeights(nil, []ServerStat{fast, slow}, 10)
+			So(weights, ShouldResemble, map[string]int{"app/a": 100, "app/b": 25})
+		})
+
+		Convey("should lower the weight of failing servers", func() {
+			failing := fast
+			failing.Server = "b"
+			failing.Requests, failing.Errors = 200, 50
+			weights := AdaptiveWeights([]ServerStat{fast, slow}, []ServerStat{fast, failing}, 10)
+			So(weights["app/b"], ShouldEqual, 50)
+		})
+
+		Convey("should keep the minimum weight", func() {
+			slow.ResponseTime = 1000
+			weights := AdaptiveWeights(nil, []ServerStat{fast, slow}, 10)
+			So(weights["app/b"], ShouldEqual, 10)
+		})
+
+		Convey("should leave draining servers and single servers alone", func() {
+			slow.Weight = 0
+			weights := AdaptiveWeights(nil, []ServerStat{fast, slow}, 10)
+			So(weights, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestParseBackendStat(t *testing.T) {
+	Convey("#ParseBackendStat", t, func() {
+		Convey("should read the counters of backends", func() {
+			stats, err := ParseBackendStat("# pxname,svname,scur,stot,bin,bout,hrsp_5xx,\n" +
+				"app-cluster,FRONTEND,3,120,1000,9000,0,\n" +
+				"app-cluster,app-10.0.0.1-31000,2,100,800,8000,3,\n" +
+				"app-cluster,BACKEND,2,100,800,8000,3,\n")
+			So(err, ShouldBeNil)
+			So(stats, ShouldResemble, []BackendStat{{
+				Backend: "app-cluster", Requests: 100, BytesIn: 800, BytesOut: 8000, Responses5xx: 3, Connections: 2,
+			}})
+		})
+	})
+}
@@ -0,0 +1,334 @@
+package history
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/atomicfile"
+	"github.com/QubitProducts/bamboo/services/marathon"
+	"github.com/QubitProducts/bamboo/services/state"
+)
+
+// Actions of membership events
+const (
+	ActionAdded     = "added"
+	ActionRemoved   = "removed"
+	ActionHealthy   = "healthy"
+	ActionUnhealthy = "unhealthy"
+	// The agent of the task entered or left a maintenance window
+	ActionDraining = "draining"
+	ActionActive   = "active"
+)
+
+// Change of a task of a backend. Tasks are identified by host:port.
+type Event struct {
+	Timestamp time.Time
+	AppId     string
+	Task      string
+	TaskId    string `json:",omitempty"`
+	Action    string
+	// State revision the change was rendered in, 0 for health events
+	Revision int64 `json:",omitempty"`
+}
+
+// Task in the backend of an app
+type Member struct {
+	Task     string
+	TaskId   string
+	Draining bool
+	// healthy or unhealthy once Marathon reported a transition
+	Health string `json:",omitempty"`
+}
+
+/*
+	Changes of an app between two times, with the tasks in its backend
+	at the start
+*/
+type Timeline struct {
+	AppId   string `json:",omitempty"`
+	From    time.Time
+	To      time.Time
+	Members map[string][]Member
+	Events  []Event
+}
+
+// Persisted form of the recorder
+type snapshot struct {
+	Members map[string]map[string]Member
+	Events  []Event
+}
+
+/*
+	Records tasks entering and leaving the backends of apps as rendered,
+	and the health transitions Marathon reports for them
+*/
+type Recorder struct {
+	Config *conf.Configuration
+
+	lock sync.Mutex
+	// Current members by app id and task
+	members map[string]map[string]Member
+	// Oldest first
+	events []Event
+}
+
+func NewRecorder(config *conf.Configuration) *Recorder {
+	return &Recorder{
+		Config:  config,
+		members: map[string]map[string]Member{},
+		events:  []Event{},
+	}
+}
+
+/*
+	Records the differences of the rendered apps to the previous ones
+	and saves the log when a path is set. Apps seen for the first time
+	since the log was started have all their tasks added.
+*/
+func (r *Recorder) Update(apps marathon.AppList, revision int64, now time.Time) error {
+	if r.record(apps, revision, now) {
+		return r.Save()
+	}
+	return nil
+}
+
+func (r *Recorder) record(apps marathon.AppList, revision int64, now time.Time) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	events := []Event{}
+	current := map[string]map[string]Member{}
+	for _, app := range apps {
+		previous := r.members[app.Id]
+		members := map[string]Member{}
+		for _, task := range app.Tasks {
+			key := state.TaskKey(task)
+			member, existed := previous[key]
+			event := Event{Timestamp: now, AppId: app.Id, Task: key, TaskId: task.Id, Revision: revision}
+			// a task replaced on the same port left the backend
+			if existed && member.TaskId != task.Id {
+				events = append(events, Event{Timestamp: now, AppId: app.Id, Task: key, TaskId: member.TaskId, Action: ActionRemoved, Revision: revision})
+				existed = false
+			}
+			switch {
+			case !existed:
+				member = Member{Task: key, TaskId: task.Id, Draining: task.Draining}
+				event.Action = ActionAdded
+				events = append(events, event)
+				if task.Draining {
+					event.Action = ActionDraining
+					events = append(events, event)
+				}
+			case member.Draining != task.Draining:
+				member.Draining = task.Draining
+				event.Action = ActionActive
+				if task.Draining {
+					event.Action = ActionDraining
+				}
+				events = append(events, event)
+			}
+			members[key] = member
+		}
+		current[app.Id] = members
+	}
+	for appId, members := range r.members {
+		for key, member := range members {
+			if _, exists := current[appId][key]; !exists {
+				events = append(events, Event{Timestamp: now, AppId: appId, Task: key, TaskId: member.TaskId, Action: ActionRemoved, Revision: revision})
+			}
+		}
+	}
+
+	r.members = current
+	sort.Stable(eventsByTask(events))
+	r.append(events, now)
+	return len(events) > 0
+}
+
+/*
+	Records a health transition of a task reported by Marathon, ignored
+	for tasks not in a backend and reports of an unchanged health
+*/
+func (r *Recorder) RecordHealth(appId string, taskId string, alive bool, now time.Time) error {
+	health := ActionUnhealthy
+	if alive {
+		health = ActionHealthy
+	}
+
+	r.lock.Lock()
+	recorded := false
+	for key, member := range r.members[appId] {
+		if member.TaskId != taskId || member.Health == health {
+			continue
+		}
+		member.Health = health
+		r.members[appId][key] = member
+		r.append([]Event{{Timestamp: now, AppId: appId, Task: key, TaskId: taskId, Action: health}}, now)
+		recorded = true
+	}
+	r.lock.Unlock()
+
+	if recorded {
+		return r.Save()
+	}
+	return nil
+}
+
+// Appends events and drops the ones past the retention
+func (r *Recorder) append(events []Event, now time.Time) {
+	r.events = append(r.events, events...)
+	oldest := now.Add(-r.Config.HAProxy.History.Retention())
+	expired := 0
+	for expired < len(r.events) && r.events[expired].Timestamp.Before(oldest) {
+		expired++
+	}
+	if expired > 0 {
+		r.events = append([]Event{}, r.events[expired:]...)
+	}
+}
+
+/*
+	Returns the changes between from and to of an app, or of all apps
+	when appId is empty, with the members of their backends at from.
+	The members are replayed back from the current ones, and thus only
+	known as far back as the retention.
+*/
+func (r *Recorder) Timeline(appId string, from time.Time, to time.Time) Timeline {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	members := map[string]map[string]Member{}
+	for id, tasks := range r.members {
+		if len(appId) > 0 && id != appId {
+			continue
+		}
+		members[id] = map[string]Member{}
+		for key, member := range tasks {
+			members[id][key] = member
+		}
+	}
+
+	timeline := Timeline{AppId: appId, From: from, To: to, Members: map[string][]Member{}, Events: []Event{}}
+	for i := len(r.events) - 1; i >= 0; i-- {
+		event := r.events[i]
+		if len(appId) > 0 && event.AppId != appId {
+			continue
+		}
+		if event.Timestamp.Before(from) {
+			break
+		}
+		if !event.Timestamp.After(to) {
+			timeline.Events = append([]Event{event}, timeline.Events...)
+		}
+		undo(members, event)
+	}
+
+	for id, tasks := range members {
+		list := []Member{}
+		for _, member := range tasks {
+			list = append(list, member)
+		}
+		if len(list) == 0 {
+			continue
+		}
+		sort.Sort(membersByTask(list))
+		timeline.Members[id] = list
+	}
+	return timeline
+}
+
+// Reverts the members to before the event
+func undo(members map[string]map[string]Member, event Event) {
+	tasks, ok := members[event.AppId]
+	if !ok {
+		tasks = map[string]Member{}
+		members[event.AppId] = tasks
+	}
+	member := tasks[event.Task]
+	switch event.Action {
+	case ActionAdded:
+		delete(tasks, event.Task)
+		return
+	case ActionRemoved:
+		member = Member{Task: event.Task, TaskId: event.TaskId}
+	case ActionDraining:
+		member.Draining = false
+	case ActionActive:
+		member.Draining = true
+	case ActionHealthy, ActionUnhealthy:
+		// the health before is not recorded
+		member.Health = ""
+	}
+	tasks[event.Task] = member
+}
+
+// Reads the log saved at the configured path, if any
+func (r *Recorder) Load() error {
+	path := r.Config.HAProxy.History.Path
+	if len(path) == 0 {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	saved := snapshot{}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if saved.Members != nil {
+		r.members = saved.Members
+	}
+	if saved.Events != nil {
+		r.events = saved.Events
+	}
+	r.append(nil, time.Now())
+	return nil
+}
+
+/*
+	Writes the log to the configured path through a temporary file
+	renamed into place, so that a crash never leaves half a file
+*/
+func (r *Recorder) Save() error {
+	path := r.Config.HAProxy.History.Path
+	if len(path) == 0 {
+		return nil
+	}
+	r.lock.Lock()
+	data, err := json.Marshal(snapshot{Members: r.members, Events: r.events})
+	r.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(path, data, 0600)
+}
+
+type eventsByTask []Event
+
+func (e eventsByTask) Len() int { return len(e) }
+func (e eventsByTask) Less(i, j int) bool {
+	if e[i].AppId != e[j].AppId {
+		return e[i].AppId < e[j].AppId
+	}
+	return e[i].Task < e[j].Task
+}
+func (e eventsByTask) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+
+type membersByTask []Member
+
+func (m membersByTask) Len() int           { return len(m) }
+func (m membersByTask) Less(i, j int) bool { return m[i].Task < m[j].Task }
+func (m membersByTask) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
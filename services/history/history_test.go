@@ -0,0 +1,108 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/marathon"
+)
+
+func apps(tasks ...marathon.Task) marathon.AppList {
+	return marathon.AppList{{Id: "/web", Tasks: tasks}}
+}
+
+func actions(events []Event) []string {
+	list := []string{}
+	for _, event := range events {
+		list = append(list, event.Action+" "+event.Task)
+	}
+	return list
+}
+
+func TestRecorder(t *testing.T) {
+	Convey("#Recorder", t, func() {
+		config := &conf.Configuration{}
+		config.HAProxy.History.RetentionHours = 2
+		recorder := NewRecorder(config)
+		start := time.Date(2016, 5, 24, 12, 0, 0, 0, time.UTC)
+		first := marathon.Task{Id: "web.1", Host: "10.0.0.1", Port: 31000}
+		second := marathon.Task{Id: "web.2", Host: "10.0.0.2", Port: 31000}
+
+		Convey("should record tasks entering and leaving the backend", func() {
+			recorder.Update(apps(first), 1, start)
+			recorder.Update(apps(first, second), 2, start.Add(time.Minute))
+			recorder.Update(apps(second), 3, start.Add(2*time.Minute))
+
+			timeline := recorder.Timeline("/web", start, start.Add(time.Hour))
+			So(actions(timeline.Events), ShouldResemble, []string{"added 10.0.0.1:31000", "added 10.0.0.2:31000", "removed 10.0.0.1:31000"})
+			So(timeline.Events[2].Revision, ShouldEqual, 3)
+		})
+
+		Convey("should record a task replaced on the same port", func() {
+			recorder.Update(apps(first), 1, start)
+			replaced := marathon.Task{Id: "web.3", Host: "10.0.0.1", Port: 31000}
+			recorder.Update(apps(replaced), 2, start.Add(time.Minute))
+
+			timeline := recorder.Timeline("/web", start.Add(time.Minute), start.Add(time.Hour))
+			So(actions(timeline.Events), ShouldResemble, []string{"removed 10.0.0.1:31000", "added 10.0.0.1:31000"})
+			So(timeline.Events[1].TaskId, ShouldEqual, "web.3")
+		})
+
+		Convey("should record draining and health transitions", func() {
+			recorder.Update(apps(first), 1, start)
+			draining := first
+			draining.Draining = true
+			recorder.Update(apps(draining), 2, start.Add(time.Minute))
+			recorder.RecordHealth("/web", "web.1", false, start.Add(2*time.Minute))
+			recorder.RecordHealth("/web", "web.1", false, start.Add(3*time.Minute))
+			recorder.RecordHealth("/web", "web.unknown", true, start.Add(3*time.Minute))
+
+			timeline := recorder.Timeline("/web", start.Add(time.Minute), start.Add(time.Hour))
+			So(actions(timeline.Events), ShouldResemble, []string{"draining 10.0.0.1:31000", "unhealthy 10.0.0.1:31000"})
+		})
+
+		Convey("should return the members at the start", func() {
+			recorder.Update(apps(first), 1, start)
+			recorder.Update(apps(first, second), 2, start.Add(time.Minute))
+			recorder.Update(apps(second), 3, start.Add(2*time.Minute))
+
+			timeline := recorder.Timeline("/web", start.Add(90*time.Second), start.Add(time.Hour))
+			So(len(timeline.Members["/web"]), ShouldEqual, 2)
+			So(timeline.Members["/web"][0].TaskId, ShouldEqual, "web.1")
+			So(actions(timeline.Events), ShouldResemble, []string{"removed 10.0.0.1:31000"})
+		})
+
+		Convey("should drop changes past the retention", func() {
+			recorder.Update(apps(first), 1, start)
+			recorder.Update(apps(first, second), 2, start.Add(3*time.Hour))
+			So(len(recorder.Timeline("", start, start.Add(4*time.Hour)).Events), ShouldEqual, 1)
+		})
+	})
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	Convey("#Save", t, func() {
+		dir, _ := ioutil.TempDir("", "bamboo-history")
+		defer os.RemoveAll(dir)
+		config := &conf.Configuration{}
+		config.HAProxy.History.RetentionHours = 2
+		config.HAProxy.History.Path = filepath.Join(dir, "history.json")
+
+		Convey("should keep the members and changes across restarts", func() {
+			recorder := NewRecorder(config)
+			now := time.Now()
+			recorder.Update(apps(marathon.Task{Id: "web.1", Host: "10.0.0.1", Port: 31000}), 1, now)
+
+			restarted := NewRecorder(config)
+			So(restarted.Load(), ShouldBeNil)
+			So(len(restarted.Timeline("/web", now.Add(-time.Minute), now.Add(time.Minute)).Events), ShouldEqual, 1)
+			restarted.Update(apps(marathon.Task{Id: "web.1", Host: "10.0.0.1", Port: 31000}), 2, now.Add(time.Minute))
+			So(len(restarted.Timeline("/web", now.Add(-time.Minute), now.Add(time.Hour)).Events), ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,191 @@
+package instance
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/samuel/go-zookeeper/zk"
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/state"
+)
+
+/*
+	Status of a running Bamboo instance, published to an ephemeral
+	Zookeeper node next to the services
+*/
+type Instance struct {
+	Id       string
+	Endpoint string
+	Started  time.Time
+	Updated  time.Time
+	Revision int64
+	// Outcome of the latest render and reload of the instance
+	LastReload *state.Reload
+	// Time between the latest Marathon change event and the resulting
+	// successful update
+	ConfigAppliedLagMs int64
+}
+
+type Registry struct {
+	lock   sync.Mutex
+	conn   *zk.Conn
+	zkConf conf.Zookeeper
+	self   Instance
+}
+
+// Returns the registry of this instance
+func NewRegistry(conn *zk.Conn, config *conf.Configuration) *Registry {
+	return &Registry{
+		conn:   conn,
+		zkConf: config.Bamboo.Zookeeper,
+		self:   Instance{Id: SelfId(config), Endpoint: config.Bamboo.Endpoint, Started: time.Now()},
+	}
+}
+
+/*
+	Returns the id of this instance, the Bamboo endpoint or the hostname
+	and bind address
+*/
+func SelfId(config *conf.Configuration) string {
+	if len(config.Bamboo.Endpoint) > 0 {
+		return config.Bamboo.Endpoint
+	}
+	hostname, _ := os.Hostname()
+	return hostname + config.Bamboo.Bind
+}
+
+/*
+	Publishes the latest reload of this instance, the node is created
+	again when the Zookeeper session expired
+*/
+func (r *Registry) Update(reload state.Reload) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.self.Updated = time.Now()
+	r.self.Revision = reload.Revision
+	r.self.LastReload = &reload
+	if reload.AppliedLagMs > 0 {
+		r.self.ConfigAppliedLagMs = reload.AppliedLagMs
+	}
+	return r.publish()
+}
+
+func (r *Registry) Register() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.publish()
+}
+
+func (r *Registry) publish() error {
+	data, err := json.Marshal(r.self)
+	if err != nil {
+		return err
+	}
+
+	path := r.zkConf.InstancesPath() + "/" + url.QueryEscape(r.self.Id)
+	_, err = r.conn.Set(path, data, -1)
+	if err != zk.ErrNoNode {
+		return err
+	}
+
+	err = ensurePathExists(r.conn, r.zkConf.InstancesPath())
+	if err != nil {
+		return err
+	}
+	_, err = r.conn.Create(path, data, zk.FlagEphemeral, zk.WorldACL(zk.PermAll))
+	return err
+}
+
+/*
+	Returns the registered instances sorted by id
+*/
+func All(conn *zk.Conn, zkConf conf.Zookeeper) ([]Instance, error) {
+	instances := []Instance{}
+	keys, _, err := conn.Children(zkConf.InstancesPath())
+	if err == zk.ErrNoNode {
+		return instances, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		data, _, err := conn.Get(zkConf.InstancesPath() + "/" + key)
+		if err == zk.ErrNoNode {
+			// instance went away meanwhile
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		instance := Instance{}
+		if err := json.Unmarshal(data, &instance); err == nil {
+			instances = append(instances, instance)
+		}
+	}
+	sort.Sort(instancesById(instances))
+	return instances, nil
+}
+
+/*
+	Returns the ids of the instances whose latest configuration differs
+	from the one most instances rendered, the one of the latest revision
+	on a tie. Instances which did not render yet are not compared.
+*/
+func Drifted(instances []Instance) map[string]bool {
+	counts := map[string]int{}
+	revisions := map[string]int64{}
+	for _, instance := range instances {
+		if instance.LastReload == nil || len(instance.LastReload.ConfigHash) == 0 {
+			continue
+		}
+		hash := instance.LastReload.ConfigHash
+		counts[hash]++
+		if instance.Revision > revisions[hash] {
+			revisions[hash] = instance.Revision
+		}
+	}
+
+	common := ""
+	for hash, count := range counts {
+		switch {
+		case len(common) == 0, count > counts[common]:
+			common = hash
+		case count < counts[common]:
+		case revisions[hash] > revisions[common]:
+			common = hash
+		case revisions[hash] == revisions[common] && hash < common:
+			// the same on every call
+			common = hash
+		}
+	}
+
+	drifted := map[string]bool{}
+	for _, instance := range instances {
+		if instance.LastReload != nil && counts[instance.LastReload.ConfigHash] > 0 &&
+			instance.LastReload.ConfigHash != common {
+			drifted[instance.Id] = true
+		}
+	}
+	return drifted
+}
+
+type instancesById []Instance
+
+func (s instancesById) Len() int           { return len(s) }
+func (s instancesById) Less(i, j int) bool { return s[i].Id < s[j].Id }
+func (s instancesById) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func ensurePathExists(conn *zk.Conn, path string) error {
+	_, err := conn.Create(path, []byte{}, 0, zk.WorldACL(zk.PermAll))
+	if err == zk.ErrNodeExists {
+		return nil
+	}
+	return err
+}
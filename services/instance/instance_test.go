@@ -0,0 +1,31 @@
+package instance
+
+import (
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"github.com/QubitProducts/bamboo/services/state"
+)
+
+func TestDrifted(t *testing.T) {
+	Convey("#Drifted", t, func() {
+		rendered := func(id string, revision int64, hash string) Instance {
+			return Instance{Id: id, Revision: revision, LastReload: &state.Reload{Revision: revision, ConfigHash: hash}}
+		}
+
+		Convey("should report instances differing from most of the fleet", func() {
+			drifted := Drifted([]Instance{rendered("a", 3, "x"), rendered("b", 3, "x"), rendered("c", 4, "y")})
+			So(drifted, ShouldResemble, map[string]bool{"c": true})
+		})
+
+		Convey("should prefer the latest revision on a tie", func() {
+			drifted := Drifted([]Instance{rendered("a", 3, "x"), rendered("b", 4, "y")})
+			So(drifted, ShouldResemble, map[string]bool{"a": true})
+		})
+
+		Convey("should not compare instances which did not render", func() {
+			drifted := Drifted([]Instance{rendered("a", 3, "x"), {Id: "b"}, rendered("c", 3, "")})
+			So(drifted, ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,303 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+const fetchTimeout = 10 * time.Second
+
+/*
+	Public key a token signature is verified with. Keys of a JSON Web
+	Key Set are selected by the kid of the token header, a single key
+	file has no Kid.
+*/
+type Key struct {
+	Kid  string `json:",omitempty"`
+	Path string
+	// PEM encoded key, written to Path unless empty
+	Pem []byte `json:"-"`
+}
+
+// Key ids safe to match in HAProxy ACLs and file names
+var kidPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+/*
+	Returns the signature keys of a JSON Web Key Set as PEM public
+	keys. Encryption keys and keys with unsupported types or key ids
+	are skipped.
+*/
+func ParseJwks(data []byte) ([]Key, error) {
+	set := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := []Key{}
+	for _, jwk := range set.Keys {
+		if jwk.Use == "enc" || !kidPattern.MatchString(jwk.Kid) {
+			continue
+		}
+		publicKey, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		der, err := x509.MarshalPKIXPublicKey(publicKey)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, Key{
+			Kid: jwk.Kid,
+			Pem: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}),
+		})
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no usable signature key in key set")
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeNumber(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeNumber(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeNumber(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeNumber(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+func decodeNumber(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// Interval at which a key set which was never fetched is retried
+const retryInterval = 30 * time.Second
+
+// Key set fetched from a URL
+type keySet struct {
+	keys []Key
+	// Error of the last fetch, nil once it succeeded
+	err        error
+	fetched    time.Time
+	refreshing bool
+}
+
+var (
+	keySets     = map[string]*keySet{}
+	keySetsLock sync.Mutex
+	// Told about key sets whose keys changed when refreshed
+	onChange func(url string)
+)
+
+/*
+	Sets the function told about key sets whose keys changed when
+	refreshed in the background, so that they are rendered
+*/
+func OnChange(handler func(url string)) {
+	keySetsLock.Lock()
+	defer keySetsLock.Unlock()
+	onChange = handler
+}
+
+func fetchJwks(url string) ([]Key, error) {
+	client := &http.Client{Timeout: fetchTimeout}
+	response, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded %s", url, response.Status)
+	}
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJwks(data)
+}
+
+/*
+	Returns the keys of the key set at url. The key set is fetched on
+	first use, later calls return the keys fetched last and refresh
+	them in the background once older than ttl. The error of the last
+	fetch is returned with the keys until a fetch succeeds.
+*/
+func cachedJwks(url string, ttl time.Duration, now time.Time) ([]Key, error) {
+	keySetsLock.Lock()
+	set, found := keySets[url]
+	if found {
+		age := now.Sub(set.fetched)
+		if !set.refreshing && (age >= ttl || (len(set.keys) == 0 && age >= retryInterval)) {
+			set.refreshing = true
+			go refreshJwks(url)
+		}
+		keys, err := set.keys, set.err
+		keySetsLock.Unlock()
+		return keys, err
+	}
+	keySetsLock.Unlock()
+
+	keys, err := fetchJwks(url)
+	keySetsLock.Lock()
+	defer keySetsLock.Unlock()
+	if _, found := keySets[url]; !found {
+		keySets[url] = &keySet{keys: keys, err: err, fetched: now}
+	}
+	return keys, err
+}
+
+func refreshJwks(url string) {
+	keys, err := fetchJwks(url)
+
+	keySetsLock.Lock()
+	set := keySets[url]
+	set.refreshing = false
+	set.fetched = time.Now()
+	set.err = err
+	changed := err == nil && !sameKeys(set.keys, keys)
+	if err == nil {
+		set.keys = keys
+	}
+	handler := onChange
+	keySetsLock.Unlock()
+
+	if err != nil {
+		log.Printf("Unable to refresh JSON Web Key Set %s, keeping the keys fetched last: %s\n", url, err)
+	}
+	if changed && handler != nil {
+		handler(url)
+	}
+}
+
+func sameKeys(a []Key, b []Key) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Kid != b[i].Kid || !bytes.Equal(a[i].Pem, b[i].Pem) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+	Returns the keys tokens of an app are verified with. Keys of a key
+	set get a path in keyDirectory and are refreshed once older than
+	ttl. When the key set can not be fetched, the keys fetched last are
+	returned with the error.
+*/
+func Keys(keyDirectory string, ttl time.Duration, escapedId string, requirement service.Jwt) ([]Key, error) {
+	if len(requirement.KeyPath) > 0 {
+		return []Key{{Path: requirement.KeyPath}}, nil
+	}
+
+	keys, err := cachedJwks(requirement.JwksUrl, ttl, time.Now())
+	withPaths := []Key{}
+	for _, key := range keys {
+		key.Path = filepath.Join(keyDirectory, escapedId+"-"+key.Kid+".pem")
+		withPaths = append(withPaths, key)
+	}
+	return withPaths, err
+}
+
+/*
+	Returns whether any fetched key differs from the file at its path,
+	in which case HAProxy must be reloaded once they are written
+*/
+func KeysChanged(keys map[string][]Key) bool {
+	for _, appKeys := range keys {
+		for _, key := range appKeys {
+			if len(key.Pem) == 0 {
+				continue
+			}
+			if current, err := ioutil.ReadFile(key.Path); err != nil || !bytes.Equal(current, key.Pem) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+	Writes the fetched keys to their paths, leaving unchanged files
+	alone
+*/
+func WriteKeys(keys map[string][]Key) error {
+	for _, appKeys := range keys {
+		for _, key := range appKeys {
+			if len(key.Pem) == 0 {
+				continue
+			}
+			if current, err := ioutil.ReadFile(key.Path); err == nil && bytes.Equal(current, key.Pem) {
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(key.Path), 0755); err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(key.Path, key.Pem, 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+func encodeNumber(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
+
+func TestParseJwks(t *testing.T) {
+	Convey("#ParseJwks", t, func() {
+		rsaKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+		ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		jwks := `{"keys": [
+			{"kid": "rsa-1", "kty": "RSA", "use": "sig", "n": "` + encodeNumber(rsaKey.N) + `", "e": "AQAB"},
+			{"kid": "ec-1", "kty": "EC", "crv": "P-256", "x": "` + encodeNumber(ecKey.X) + `", "y": "` + encodeNumber(ecKey.Y) + `"},
+			{"kid": "enc-1", "kty": "RSA", "use": "enc", "n": "` + encodeNumber(rsaKey.N) + `", "e": "AQAB"},
+			{"kid": "bad kid", "kty": "RSA", "n": "` + encodeNumber(rsaKey.N) + `", "e": "AQAB"}
+		]}`
+
+		Convey("should convert signature keys to PEM public keys", func() {
+			keys, err := ParseJwks([]byte(jwks))
+			So(err, ShouldBeNil)
+			So(len(keys), ShouldEqual, 2)
+			So(keys[0].Kid, ShouldEqual, "rsa-1")
+			So(keys[1].Kid, ShouldEqual, "ec-1")
+
+			block, _ := pem.Decode(keys[0].Pem)
+			publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+			So(err, ShouldBeNil)
+			So(publicKey.(*rsa.PublicKey).N.Cmp(rsaKey.N), ShouldEqual, 0)
+		})
+
+		Convey("should fail without usable keys", func() {
+			_, err := ParseJwks([]byte(`{"keys": []}`))
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("#cachedJwks", t, func() {
+		rsaKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+		kid := atomic.Value{}
+		kid.Store("k1")
+		var fetches int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&fetches, 1)
+			w.Write([]byte(`{"keys": [{"kid": "` + kid.Load().(string) + `", "kty": "RSA", "n": "` + encodeNumber(rsaKey.N) + `", "e": "AQAB"}]}`))
+		}))
+		defer server.Close()
+		now := time.Now()
+
+		Convey("should fetch a key set once while it is fresh", func() {
+			keys, err := cachedJwks(server.URL, time.Minute, now)
+			So(err, ShouldBeNil)
+			So(keys[0].Kid, ShouldEqual, "k1")
+			cachedJwks(server.URL, time.Minute, now.Add(time.Second))
+			So(atomic.LoadInt32(&fetches), ShouldEqual, 1)
+		})
+
+		Convey("should refresh a stale key set in the background", func() {
+			changed := make(chan string, 1)
+			OnChange(func(url string) { changed <- url })
+			defer OnChange(nil)
+
+			cachedJwks(server.URL+"/rotated", time.Minute, now)
+			kid.Store("k2")
+			keys, _ := cachedJwks(server.URL+"/rotated", time.Minute, now.Add(2*time.Minute))
+			So(keys[0].Kid, ShouldEqual, "k1")
+
+			So(<-changed, ShouldEqual, server.URL+"/rotated")
+			keys, _ = cachedJwks(server.URL+"/rotated", time.Minute, time.Now())
+			So(keys[0].Kid, ShouldEqual, "k2")
+		})
+	})
+
+	Convey("#KeysChanged", t, func() {
+		dir, _ := ioutil.TempDir("", "bamboo-jwt")
+		defer os.RemoveAll(dir)
+		key := Key{Kid: "k1", Path: filepath.Join(dir, "app-k1.pem"), Pem: []byte("key")}
+
+		Convey("should report keys which are not written yet", func() {
+			So(KeysChanged(map[string][]Key{"/app": {key}}), ShouldBeTrue)
+		})
+
+		Convey("should not report written keys", func() {
+			So(WriteKeys(map[string][]Key{"/app": {key}}), ShouldBeNil)
+			So(KeysChanged(map[string][]Key{"/app": {key}}), ShouldBeFalse)
+			So(KeysChanged(map[string][]Key{"/app": {{Path: "/etc/haproxy/app.pem"}}}), ShouldBeFalse)
+		})
+	})
+
+	Convey("#Keys", t, func() {
+		Convey("should use the key file of the service", func() {
+			keys, err := Keys("/etc/haproxy/jwt", time.Minute, "app", service.Jwt{KeyPath: "/etc/haproxy/app.pem"})
+			So(err, ShouldBeNil)
+			So(keys, ShouldResemble, []Key{{Path: "/etc/haproxy/app.pem"}})
+		})
+	})
+}
@@ -0,0 +1,204 @@
+package limits
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/samuel/go-zookeeper/zk"
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+/*
+	Temporary server limits of an app, taking precedence over the
+	limits of its service until they expire or are cleared
+*/
+type Override struct {
+	AppId    string
+	MaxConn  int
+	MaxQueue int
+	Reason   string `json:",omitempty"`
+	Set      time.Time
+	// Zero when the override never expires
+	Expires time.Time
+}
+
+func (o Override) Expired(at time.Time) bool {
+	return !o.Expires.IsZero() && !at.Before(o.Expires)
+}
+
+func (o Override) Validate() error {
+	if o.MaxConn < 0 || o.MaxQueue < 0 {
+		return errors.New("MaxConn and MaxQueue must not be negative")
+	}
+	if o.MaxConn == 0 && o.MaxQueue == 0 {
+		return errors.New("MaxConn or MaxQueue must be set")
+	}
+	return nil
+}
+
+/*
+	Returns the limits of the servers of an app: the override, then
+	the service limits, then the configured defaults
+*/
+func Effective(defaults conf.ServerLimits, serviceModel service.Service, override *Override) service.Limits {
+	limits := service.Limits{MaxConn: defaults.MaxConn, MaxQueue: defaults.MaxQueue}
+	if serviceModel.Limits != nil {
+		if serviceModel.Limits.MaxConn > 0 {
+			limits.MaxConn = serviceModel.Limits.MaxConn
+		}
+		if serviceModel.Limits.MaxQueue > 0 {
+			limits.MaxQueue = serviceModel.Limits.MaxQueue
+		}
+	}
+	if override != nil {
+		if override.MaxConn > 0 {
+			limits.MaxConn = override.MaxConn
+		}
+		if override.MaxQueue > 0 {
+			limits.MaxQueue = override.MaxQueue
+		}
+	}
+	return limits
+}
+
+/*
+	Stores the override, replacing an earlier one of the app
+*/
+func SetOverride(conn *zk.Conn, zkConf conf.Zookeeper, override Override) error {
+	data, err := json.Marshal(override)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Create(zkConf.LimitsPath(), []byte{}, 0, zk.WorldACL(zk.PermAll))
+	if err != nil && err != zk.ErrNodeExists {
+		return err
+	}
+
+	path := zkConf.LimitsPath() + "/" + url.QueryEscape(override.AppId)
+	_, err = conn.Create(path, data, 0, zk.WorldACL(zk.PermAll))
+	if err == zk.ErrNodeExists {
+		_, err = conn.Set(path, data, -1)
+	}
+	return err
+}
+
+/*
+	Removes the override of an app, zk.ErrNoNode when there is none
+*/
+func ClearOverride(conn *zk.Conn, zkConf conf.Zookeeper, appId string) error {
+	return conn.Delete(zkConf.LimitsPath()+"/"+url.QueryEscape(appId), -1)
+}
+
+/*
+	Returns the overrides in effect sorted by app id. Expired overrides
+	are left out, CleanupOverrides removes them.
+*/
+func Overrides(conn *zk.Conn, zkConf conf.Zookeeper) ([]Override, error) {
+	overrides := []Override{}
+	now := time.Now()
+	err := readOverrides(conn, zkConf, func(path string, version int32, override Override) error {
+		if !override.Expired(now) {
+			overrides = append(overrides, override)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(overridesByAppId(overrides))
+	return overrides, nil
+}
+
+/*
+	Removes the expired overrides, returning how many were removed
+*/
+func CleanupOverrides(conn *zk.Conn, zkConf conf.Zookeeper, now time.Time) (int, error) {
+	removed := 0
+	err := readOverrides(conn, zkConf, func(path string, version int32, override Override) error {
+		if !override.Expired(now) {
+			return nil
+		}
+		// an override changed meanwhile is kept by the version check
+		err := conn.Delete(path, version)
+		if err == zk.ErrNoNode || err == zk.ErrBadVersion {
+			return nil
+		}
+		if err == nil {
+			removed++
+		}
+		return err
+	})
+	return removed, err
+}
+
+// Runs CleanupOverrides every service.CleanupInterval
+func RunCleanup(conn *zk.Conn, zkConf conf.Zookeeper) {
+	for {
+		time.Sleep(service.CleanupInterval)
+		removed, err := CleanupOverrides(conn, zkConf, time.Now())
+		if err != nil {
+			log.Printf("Unable to remove expired limit overrides: %s\n", err)
+		}
+		if removed > 0 {
+			log.Printf("Removed %d expired limit overrides\n", removed)
+		}
+	}
+}
+
+// Calls visit with every readable stored override and its node
+func readOverrides(conn *zk.Conn, zkConf conf.Zookeeper, visit func(path string, version int32, override Override) error) error {
+	keys, _, err := conn.Children(zkConf.LimitsPath())
+	if err == zk.ErrNoNode {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		path := zkConf.LimitsPath() + "/" + key
+		data, stat, err := conn.Get(path)
+		if err == zk.ErrNoNode {
+			// cleared meanwhile
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		override := Override{}
+		if err := json.Unmarshal(data, &override); err != nil {
+			continue
+		}
+		if err := visit(path, stat.Version, override); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+	Returns when the next of the overrides expires, false when none
+	of them expires
+*/
+func NextExpiry(overrides []Override) (time.Time, bool) {
+	var next time.Time
+	for _, override := range overrides {
+		if !override.Expires.IsZero() && (next.IsZero() || override.Expires.Before(next)) {
+			next = override.Expires
+		}
+	}
+	return next, !next.IsZero()
+}
+
+type overridesByAppId []Override
+
+func (o overridesByAppId) Len() int           { return len(o) }
+func (o overridesByAppId) Less(i, j int) bool { return o[i].AppId < o[j].AppId }
+func (o overridesByAppId) Swap(i, j int)      { o[i], o[j] = o[j], o[i] }
@@ -0,0 +1,42 @@
+package limits
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+func TestLimits(t *testing.T) {
+	Convey("#Effective", t, func() {
+		defaults := conf.ServerLimits{MaxConn: 100, MaxQueue: 10}
+
+		Convey("should use the defaults without service limits", func() {
+			So(Effective(defaults, service.Service{}, nil), ShouldResemble, service.Limits{MaxConn: 100, MaxQueue: 10})
+		})
+
+		Convey("should prefer the override, then the service limits", func() {
+			serviceModel := service.Service{Limits: &service.Limits{MaxConn: 200, MaxQueue: 20}}
+			override := &Override{AppId: "/app", MaxConn: 500}
+			So(Effective(defaults, serviceModel, override), ShouldResemble, service.Limits{MaxConn: 500, MaxQueue: 20})
+		})
+	})
+
+	Convey("#Validate", t, func() {
+		So(Override{AppId: "/app", MaxQueue: 5}.Validate(), ShouldBeNil)
+		So(Override{AppId: "/app"}.Validate(), ShouldNotBeNil)
+		So(Override{AppId: "/app", MaxConn: -1}.Validate(), ShouldNotBeNil)
+	})
+
+	Convey("#NextExpiry", t, func() {
+		next, ok := NextExpiry([]Override{
+			{AppId: "/a", Expires: time.Unix(3000, 0)},
+			{AppId: "/b"},
+			{AppId: "/c", Expires: time.Unix(2000, 0)},
+		})
+		So(ok, ShouldBeTrue)
+		So(next, ShouldResemble, time.Unix(2000, 0))
+	})
+}
@@ -0,0 +1,227 @@
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/QubitProducts/bamboo/configuration"
+)
+
+const (
+	SeverityWarning = "warning"
+	SeverityError   = "error"
+)
+
+// HAProxy default of tune.maxaccept for multi process setups
+const defaultMaxAccept = 64
+
+// Lint finding at a line of the rendered configuration
+type Issue struct {
+	Severity string
+	Line     int
+	Message  string
+}
+
+func (i Issue) String() string {
+	if i.Line > 0 {
+		return fmt.Sprintf("%s at line %d: %s", i.Severity, i.Line, i.Message)
+	}
+	return fmt.Sprintf("%s: %s", i.Severity, i.Message)
+}
+
+type Issues []Issue
+
+func (issues Issues) HasErrors() bool {
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+var sectionKeywords = map[string]bool{
+	"global": true, "defaults": true, "frontend": true, "backend": true,
+	"listen": true, "resolvers": true, "userlist": true, "peers": true,
+	"mailers": true, "program": true, "http-errors": true, "cache": true,
+	"ring": true,
+}
+
+type section struct {
+	keyword string
+	name    string
+	line    int
+	servers int
+	// acl name => line of its first declaration in the section
+	acls map[string]int
+}
+
+func (s *section) proxy() bool {
+	return s.keyword == "frontend" || s.keyword == "backend" || s.keyword == "listen"
+}
+
+func (s *section) receivesTraffic() bool {
+	return s.keyword == "frontend" || s.keyword == "listen"
+}
+
+/*
+	Checks a rendered configuration for practical limits and mistakes
+	HAProxy accepts silently, e.g. an ACL name shared by two apps
+*/
+func Lint(content string, limits configuration.Lint) Issues {
+	issues := Issues{}
+	sections := []*section{}
+	var current *section
+	aclCount, bindCount, maxConn, maxAccept := 0, 0, 0, defaultMaxAccept
+	usedBackends := map[string]int{}
+
+	for index, text := range strings.Split(content, "\n") {
+		number := index + 1
+		fields := strings.Fields(stripComment(text))
+		if len(fields) == 0 {
+			continue
+		}
+
+		if sectionKeywords[fields[0]] {
+			current = &section{keyword: fields[0], line: number, acls: map[string]int{}}
+			if len(fields) > 1 {
+				current.name = fields[1]
+			}
+			sections = append(sections, current)
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		switch fields[0] {
+		case "acl":
+			aclCount++
+			if len(fields) < 2 {
+				continue
+			}
+			if first, ok := current.acls[fields[1]]; ok {
+				issues = append(issues, Issue{SeverityWarning, number,
+					fmt.Sprintf("ACL %s is declared again in %s %s (first at line %d), its conditions are OR-ed", fields[1], current.keyword, current.name, first)})
+			} else {
+				current.acls[fields[1]] = number
+			}
+		case "server":
+			current.servers++
+		case "server-template":
+			if len(fields) > 2 {
+				current.servers += templateSlots(fields[2])
+			}
+		case "bind":
+			bindCount++
+		case "use_backend", "default_backend":
+			if len(fields) > 1 {
+				if _, ok := usedBackends[fields[1]]; !ok {
+					usedBackends[fields[1]] = number
+				}
+			}
+		case "maxconn":
+			if current.keyword == "global" && len(fields) > 1 {
+				maxConn, _ = strconv.Atoi(fields[1])
+			}
+		case "tune.maxaccept":
+			if len(fields) > 1 {
+				maxAccept, _ = strconv.Atoi(fields[1])
+			}
+		}
+	}
+
+	names := map[string]*section{}
+	backends := map[string]bool{}
+	frontendCount := 0
+	for _, s := range sections {
+		if !s.proxy() {
+			continue
+		}
+		if s.receivesTraffic() {
+			frontendCount++
+		}
+		if s.keyword != "frontend" {
+			backends[s.name] = true
+		}
+
+		if other, ok := names[s.name]; ok {
+			issues = append(issues, Issue{SeverityError, s.line,
+				fmt.Sprintf("%s %s has the same name as the %s at line %d", s.keyword, s.name, other.keyword, other.line)})
+		} else {
+			names[s.name] = s
+		}
+
+		if s.keyword != "frontend" {
+			if s.servers == 0 {
+				issues = append(issues, Issue{SeverityWarning, s.line,
+					fmt.Sprintf("%s %s has no servers and answers 503", s.keyword, s.name)})
+			}
+			if limits.MaxServersPerBackend > 0 && s.servers > limits.MaxServersPerBackend {
+				issues = append(issues, Issue{SeverityWarning, s.line,
+					fmt.Sprintf("%s %s has %d servers, more than %d", s.keyword, s.name, s.servers, limits.MaxServersPerBackend)})
+			}
+		}
+	}
+
+	for backend, line := range usedBackends {
+		// backend names built from log formats are resolved at runtime
+		if !backends[backend] && !strings.Contains(backend, "%") {
+			issues = append(issues, Issue{SeverityError, line, fmt.Sprintf("backend %s is used but not declared", backend)})
+		}
+	}
+
+	if limits.MaxAcls > 0 && aclCount > limits.MaxAcls {
+		issues = append(issues, Issue{SeverityWarning, 0,
+			fmt.Sprintf("%d ACLs declared, more than %d slow down request processing", aclCount, limits.MaxAcls)})
+	}
+	if limits.MaxFrontends > 0 && frontendCount > limits.MaxFrontends {
+		issues = append(issues, Issue{SeverityWarning, 0,
+			fmt.Sprintf("%d frontends and listen sections declared, more than %d", frontendCount, limits.MaxFrontends)})
+	}
+	if maxConn > 0 && maxAccept > 0 && bindCount*maxAccept > maxConn {
+		issues = append(issues, Issue{SeverityWarning, 0,
+			fmt.Sprintf("%d binds accepting up to tune.maxaccept=%d connections at once exceed global maxconn %d, lower tune.maxaccept", bindCount, maxAccept, maxConn)})
+	}
+
+	sortIssues(issues)
+	return issues
+}
+
+// Number of servers of a server-template, "<num>" or "<first>-<last>"
+func templateSlots(value string) int {
+	bounds := strings.SplitN(value, "-", 2)
+	first, _ := strconv.Atoi(bounds[0])
+	if len(bounds) == 1 {
+		return first
+	}
+	last, _ := strconv.Atoi(bounds[1])
+	return last - first + 1
+}
+
+// Comments start with # at the beginning of a word
+func stripComment(line string) string {
+	for index, char := range line {
+		if char == '#' && (index == 0 || line[index-1] == ' ' || line[index-1] == '\t') {
+			return line[:index]
+		}
+	}
+	return line
+}
+
+type issuesByLine Issues
+
+func (s issuesByLine) Len() int { return len(s) }
+func (s issuesByLine) Less(i, j int) bool {
+	if s[i].Line != s[j].Line {
+		return s[i].Line < s[j].Line
+	}
+	return s[i].Message < s[j].Message
+}
+func (s issuesByLine) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+func sortIssues(issues Issues) {
+	sort.Sort(issuesByLine(issues))
+}
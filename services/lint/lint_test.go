@@ -0,0 +1,50 @@
+package lint
+
+import (
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"testing"
+
+	"github.com/QubitProducts/bamboo/configuration"
+)
+
+const config = `frontend http-in
+        bind *:80
+        acl app-aclrule hdr(host) -i app.example.com
+        use_backend app-cluster if app-aclrule
+backend app-cluster
+        server app-1 10.0.0.1:31000
+`
+
+func TestLint(t *testing.T) {
+	Convey("#Lint", t, func() {
+		Convey("should accept a sound configuration", func() {
+			So(Lint(config, configuration.Lint{}), ShouldBeEmpty)
+		})
+
+		Convey("should report undeclared backends as errors", func() {
+			issues := Lint(config+"        use_backend other if app-aclrule\n", configuration.Lint{})
+			So(issues.HasErrors(), ShouldBeTrue)
+			So(issues[0].Line, ShouldEqual, 7)
+		})
+
+		Convey("should warn about ACL names declared twice", func() {
+			issues := Lint(`frontend http-in
+        acl app hdr(host) -i a.example.com
+        acl app hdr(host) -i b.example.com
+`, configuration.Lint{})
+			So(len(issues), ShouldEqual, 1)
+			So(issues[0].Severity, ShouldEqual, SeverityWarning)
+			So(issues[0].Line, ShouldEqual, 3)
+		})
+
+		Convey("should warn about backends above the server limit", func() {
+			issues := Lint(config, configuration.Lint{MaxServersPerBackend: 0})
+			So(issues, ShouldBeEmpty)
+
+			content := config + "        server-template app- 1-10 _app._tcp.marathon.mesos\n"
+			issues = Lint(content, configuration.Lint{MaxServersPerBackend: 5})
+			So(len(issues), ShouldEqual, 1)
+			So(issues[0].Message, ShouldEqual, "backend app-cluster has 11 servers, more than 5")
+		})
+	})
+}
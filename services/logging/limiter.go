@@ -0,0 +1,151 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/QubitProducts/bamboo/configuration"
+)
+
+type class struct {
+	windowStart time.Time
+	seen        int
+	suppressed  int
+}
+
+/*
+	Limits the number of messages logged per message class. Messages
+	above the burst of a window are sampled or dropped, and a summary of
+	the suppressed messages is logged once the window ends.
+*/
+type Limiter struct {
+	lock       sync.Mutex
+	interval   time.Duration
+	burst      int
+	sampleRate int
+	classes    map[string]*class
+
+	now    func() time.Time
+	output func(string)
+}
+
+/*
+	Returns a limiter logging at most burst messages per class and
+	interval, a zero interval disables rate limiting
+*/
+func NewLimiter(interval time.Duration, burst int, sampleRate int) *Limiter {
+	return &Limiter{
+		interval:   interval,
+		burst:      burst,
+		sampleRate: sampleRate,
+		classes:    map[string]*class{},
+		now:        time.Now,
+		output:     func(message string) { log.Print(message) },
+	}
+}
+
+func (l *Limiter) enabled() bool {
+	return l.interval > 0
+}
+
+/*
+	Logs a message of the given class unless the class exceeded its burst
+*/
+func (l *Limiter) Printf(className string, format string, v ...interface{}) {
+	if !l.enabled() {
+		l.output(fmt.Sprintf(format, v...))
+		return
+	}
+
+	l.lock.Lock()
+	now := l.now()
+	summaries := l.expire(now)
+
+	c, ok := l.classes[className]
+	if !ok {
+		c = &class{windowStart: now}
+		l.classes[className] = c
+	}
+	c.seen++
+	above := c.seen - l.burst
+	allowed := above <= 0 || (l.sampleRate > 0 && above%l.sampleRate == 0)
+	if !allowed {
+		c.suppressed++
+	}
+	l.lock.Unlock()
+
+	for _, summary := range summaries {
+		l.output(summary)
+	}
+	if allowed {
+		message := fmt.Sprintf(format, v...)
+		if above > 0 {
+			message = fmt.Sprintf("[sampled 1/%d] %s", l.sampleRate, message)
+		}
+		l.output(message)
+	}
+}
+
+/*
+	Logs the summaries of ended windows, called periodically so that
+	suppressed messages are reported even if the class went quiet
+*/
+func (l *Limiter) Flush() {
+	l.lock.Lock()
+	summaries := l.expire(l.now())
+	l.lock.Unlock()
+
+	for _, summary := range summaries {
+		l.output(summary)
+	}
+}
+
+// Removes classes whose window ended and returns their summaries
+func (l *Limiter) expire(now time.Time) []string {
+	names := []string{}
+	for name, c := range l.classes {
+		if now.Sub(c.windowStart) >= l.interval {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	summaries := []string{}
+	for _, name := range names {
+		if suppressed := l.classes[name].suppressed; suppressed > 0 {
+			summaries = append(summaries, fmt.Sprintf("Suppressed %d similar messages (%s) in the last %s", suppressed, name, l.interval))
+		}
+		delete(l.classes, name)
+	}
+	return summaries
+}
+
+var defaultLimiter = NewLimiter(0, 0, 0)
+
+/*
+	Enables rate limiting of Logf according to the configuration
+*/
+func Configure(conf configuration.Logging) {
+	if !conf.RateLimit {
+		return
+	}
+
+	limiter := NewLimiter(time.Duration(conf.Interval)*time.Second, conf.Burst, conf.SampleRate)
+	defaultLimiter = limiter
+	go func() {
+		for _ = range time.Tick(limiter.interval) {
+			limiter.Flush()
+		}
+	}()
+	log.Printf("Logging at most %d messages per class every %s", conf.Burst, limiter.interval)
+}
+
+/*
+	Logs a message of a noisy class through the configured limiter
+*/
+func Logf(className string, format string, v ...interface{}) {
+	defaultLimiter.Printf(className, format, v...)
+}
@@ -0,0 +1,59 @@
+package logging
+
+import (
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func testLimiter(sampleRate int) (*Limiter, *time.Time, *[]string) {
+	now := time.Unix(0, 0)
+	messages := []string{}
+	limiter := NewLimiter(time.Minute, 2, sampleRate)
+	limiter.now = func() time.Time { return now }
+	limiter.output = func(message string) { messages = append(messages, message) }
+	return limiter, &now, &messages
+}
+
+func TestLimiter(t *testing.T) {
+	Convey("#Printf", t, func() {
+		Convey("should log every message when disabled", func() {
+			limiter, _, messages := testLimiter(0)
+			limiter.interval = 0
+			for i := 0; i < 5; i++ {
+				limiter.Printf("marathon", "down")
+			}
+			So(len(*messages), ShouldEqual, 5)
+		})
+
+		Convey("should suppress messages above the burst of a class", func() {
+			limiter, _, messages := testLimiter(0)
+			for i := 0; i < 5; i++ {
+				limiter.Printf("marathon", "down")
+			}
+			limiter.Printf("zookeeper", "down")
+			So(*messages, ShouldResemble, []string{"down", "down", "down"})
+		})
+
+		Convey("should sample messages above the burst", func() {
+			limiter, _, messages := testLimiter(2)
+			for i := 0; i < 6; i++ {
+				limiter.Printf("marathon", "down %d", i)
+			}
+			So(*messages, ShouldResemble, []string{"down 0", "down 1", "[sampled 1/2] down 3", "[sampled 1/2] down 5"})
+		})
+
+		Convey("should summarize suppressed messages once the window ended", func() {
+			limiter, now, messages := testLimiter(0)
+			for i := 0; i < 5; i++ {
+				limiter.Printf("marathon", "down")
+			}
+			*now = now.Add(time.Minute)
+			limiter.Flush()
+			So((*messages)[2], ShouldEqual, "Suppressed 3 similar messages (marathon) in the last 1m0s")
+
+			limiter.Printf("marathon", "down")
+			So(len(*messages), ShouldEqual, 4)
+		})
+	})
+}
@@ -3,16 +3,45 @@ package marathon
 import (
 	"encoding/json"
 	"github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/capture"
 	"io/ioutil"
 	"net/http"
+	"path"
 	"sort"
+	"strconv"
 	"strings"
 )
 
 // Describes an app process running
 type Task struct {
+	Id   string
 	Host string
 	Port int
+	// All ports of the task, indexed like the app service ports
+	Ports   []int
+	SlaveId string
+	// Attributes of the Mesos agent running the task,
+	// only available when Mesos is configured
+	Attributes map[string]string
+	// The agent is in a Mesos maintenance window
+	Draining bool
+}
+
+// Marathon placement constraint, e.g. ["edge", "CLUSTER", "true"]
+type Constraint struct {
+	Field    string
+	Operator string
+	Value    string
+}
+
+// Service port of an app with its rendered HAProxy names
+type ServicePort struct {
+	Index int
+	Port  int
+	// Marathon port definition name, the index when unnamed
+	Name     string
+	Backend  string
+	Frontend string
 }
 
 // An app may have multiple processes
@@ -22,7 +51,28 @@ type App struct {
 	HealthCheckPath string
 	Tasks           []Task
 	ServicePort     int
-	Env             map[string]string
+	ServicePorts    []ServicePort
+	// Rendered names of the first service port
+	Backend  string
+	Frontend string
+	AclName  string
+	Env      map[string]string
+	Labels   map[string]string
+	// Hostname generated by HAProxy.Naming.Domain, empty without
+	Domain string
+	// Resolve tasks through HAProxy DNS resolvers instead of
+	// rendering them, enabled with env BAMBOO_DNS_RESOLUTION
+	DnsResolution bool
+	// Mesos-DNS name of the app, e.g. /group/app => app-group
+	MesosDnsName string
+	// Number of server-template slots, env BAMBOO_DNS_SLOTS
+	ServerSlots int
+	Constraints []Constraint
+	// Ids of the apps this app depends on
+	Dependencies []string
+	// Server limits, zero for the HAProxy default
+	MaxConn  int
+	MaxQueue int
 }
 
 type AppList []App
@@ -51,6 +101,7 @@ type MarathonTask struct {
 	Host         string
 	Ports        []int
 	ServicePorts []int
+	SlaveId      string
 	StartedAt    string
 	StagedAt     string
 	Version      string
@@ -77,76 +128,93 @@ type MarathonApp struct {
 	HealthChecks []HealthChecks    `json:healthChecks`
 	Ports        []int             `json:ports`
 	Env          map[string]string `json:env`
+	Labels       map[string]string `json:"labels"`
+	Constraints  [][]string        `json:"constraints"`
+	Dependencies []string          `json:"dependencies"`
+	// Since Marathon 0.15, ports can be named
+	PortDefinitions []PortDefinition `json:"portDefinitions"`
+}
+
+type PortDefinition struct {
+	Port int    `json:"port"`
+	Name string `json:"name"`
 }
 
 type HealthChecks struct {
 	Path string `json:path`
 }
 
-func fetchMarathonApps(endpoint string) (map[string]MarathonApp, error) {
-	response, err := http.Get(endpoint + "/v2/apps")
+// Raw responses of a Marathon endpoint, as recorded by capture
+type responses struct {
+	Tasks json.RawMessage
+	Apps  json.RawMessage
+}
 
+func fetchResponses(endpoint string) (responses, error) {
+	raw := responses{}
+	tasks, err := fetchBody(endpoint + "/v2/tasks")
 	if err != nil {
-		return nil, err
-	} else {
-		defer response.Body.Close()
-		var appResponse MarathonApps
-
-		contents, err := ioutil.ReadAll(response.Body)
-		if err != nil {
-			return nil, err
-		}
-
-		err = json.Unmarshal(contents, &appResponse)
-		if err != nil {
-			return nil, err
-		}
-
-		dataById := map[string]MarathonApp{}
-
-		for _, appConfig := range appResponse.Apps {
-			dataById[appConfig.Id] = appConfig
-		}
-
-		return dataById, nil
+		return raw, err
 	}
+	apps, err := fetchBody(endpoint + "/v2/apps")
+	if err != nil {
+		return raw, err
+	}
+	raw.Tasks = tasks
+	raw.Apps = apps
+	return raw, nil
 }
 
-func fetchTasks(endpoint string) (map[string][]MarathonTask, error) {
+func fetchBody(url string) ([]byte, error) {
 	client := &http.Client{}
-	req, err := http.NewRequest("GET", endpoint+"/v2/tasks", nil)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
 	req.Header.Add("Accept", "application/json")
 	response, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	return ioutil.ReadAll(response.Body)
+}
 
-	var tasks MarathonTasks
-
+func parseMarathonApps(contents []byte) (map[string]MarathonApp, error) {
+	var appResponse MarathonApps
+	err := json.Unmarshal(contents, &appResponse)
 	if err != nil {
 		return nil, err
-	} else {
-		contents, err := ioutil.ReadAll(response.Body)
-		defer response.Body.Close()
-		if err != nil {
-			return nil, err
-		}
+	}
 
-		err = json.Unmarshal(contents, &tasks)
-		if err != nil {
-			return nil, err
-		}
+	dataById := map[string]MarathonApp{}
 
-		taskList := tasks.Tasks
-		sort.Sort(taskList)
+	for _, appConfig := range appResponse.Apps {
+		dataById[appConfig.Id] = appConfig
+	}
 
-		tasksById := map[string][]MarathonTask{}
-		for _, task := range taskList {
-			if tasksById[task.AppId] == nil {
-				tasksById[task.AppId] = []MarathonTask{}
-			}
-			tasksById[task.AppId] = append(tasksById[task.AppId], task)
-		}
+	return dataById, nil
+}
+
+func parseTasks(contents []byte) (map[string][]MarathonTask, error) {
+	var tasks MarathonTasks
+	err := json.Unmarshal(contents, &tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	taskList := tasks.Tasks
+	sort.Sort(taskList)
 
-		return tasksById, nil
+	tasksById := map[string][]MarathonTask{}
+	for _, task := range taskList {
+		if tasksById[task.AppId] == nil {
+			tasksById[task.AppId] = []MarathonTask{}
+		}
+		tasksById[task.AppId] = append(tasksById[task.AppId], task)
 	}
+
+	return tasksById, nil
 }
 
 func createApps(tasksById map[string][]MarathonTask, marathonApps map[string]MarathonApp) AppList {
@@ -158,7 +226,7 @@ func createApps(tasksById map[string][]MarathonTask, marathonApps map[string]Mar
 
 		for _, task := range tasks {
 			if len(task.Ports) > 0 {
-				simpleTasks = append(simpleTasks, Task{Host: task.Host, Port: task.Ports[0]})
+				simpleTasks = append(simpleTasks, Task{Id: task.Id, Host: task.Host, Port: task.Ports[0], Ports: task.Ports, SlaveId: task.SlaveId})
 			}
 		}
 
@@ -176,10 +244,18 @@ func createApps(tasksById map[string][]MarathonTask, marathonApps map[string]Mar
 			Tasks:           simpleTasks,
 			HealthCheckPath: parseHealthCheckPath(marathonApps[appId].HealthChecks),
 			Env:             marathonApps[appId].Env,
+			Labels:          marathonApps[appId].Labels,
+			Constraints:     parseConstraints(marathonApps[appId].Constraints),
+			Dependencies:    parseDependencies(appPath, marathonApps[appId].Dependencies),
 		}
 
-		if len(marathonApps[appId].Ports) > 0 {
-			app.ServicePort = marathonApps[appId].Ports[0]
+		app.DnsResolution, _ = strconv.ParseBool(app.Env["BAMBOO_DNS_RESOLUTION"])
+		app.MesosDnsName = mesosDnsName(appPath)
+		app.ServerSlots, _ = strconv.Atoi(app.Env["BAMBOO_DNS_SLOTS"])
+
+		app.ServicePorts = parseServicePorts(marathonApps[appId])
+		if len(app.ServicePorts) > 0 {
+			app.ServicePort = app.ServicePorts[0].Port
 		}
 
 		apps = append(apps, app)
@@ -187,6 +263,49 @@ func createApps(tasksById map[string][]MarathonTask, marathonApps map[string]Mar
 	return apps
 }
 
+// Mesos-DNS names apps by their reversed path segments joined with dashes
+func mesosDnsName(appPath string) string {
+	segments := strings.Split(strings.Trim(appPath, "/"), "/")
+	for i, j := 0, len(segments)-1; i < j; i, j = i+1, j-1 {
+		segments[i], segments[j] = segments[j], segments[i]
+	}
+	return strings.Join(segments, "-")
+}
+
+func parseServicePorts(marathonApp MarathonApp) []ServicePort {
+	servicePorts := []ServicePort{}
+	if len(marathonApp.PortDefinitions) > 0 {
+		for index, definition := range marathonApp.PortDefinitions {
+			name := definition.Name
+			if len(name) == 0 {
+				name = strconv.Itoa(index)
+			}
+			servicePorts = append(servicePorts, ServicePort{Index: index, Port: definition.Port, Name: name})
+		}
+		return servicePorts
+	}
+
+	for index, port := range marathonApp.Ports {
+		servicePorts = append(servicePorts, ServicePort{Index: index, Port: port, Name: strconv.Itoa(index)})
+	}
+	return servicePorts
+}
+
+func parseConstraints(constraints [][]string) []Constraint {
+	parsed := []Constraint{}
+	for _, constraint := range constraints {
+		if len(constraint) < 2 {
+			continue
+		}
+		c := Constraint{Field: constraint[0], Operator: constraint[1]}
+		if len(constraint) > 2 {
+			c.Value = constraint[2]
+		}
+		parsed = append(parsed, c)
+	}
+	return parsed
+}
+
 func parseHealthCheckPath(checks []HealthChecks) string {
 	if len(checks) > 0 {
 		return checks[0].Path
@@ -200,35 +319,106 @@ func parseHealthCheckPath(checks []HealthChecks) string {
 
 	Parameters:
 		endpoint: Marathon HTTP endpoint, e.g. http://localhost:8080
+		render: records or replays the responses, nil to fetch them
 */
-func FetchApps(maraconf configuration.Marathon) (AppList, error) {
-
+func FetchApps(maraconf configuration.Marathon, render *capture.Render) (AppList, error) {
 	var applist AppList
-	var err error
-
-	// try all configured endpoints until one succeeds
-	for _, url := range maraconf.Endpoints() {
-		applist, err = _fetchApps(url)
-		if err == nil {
-			return applist, err
+	bodies, err := render.FetchBodies("marathon", func() (map[string][]byte, error) {
+		var err error
+		// try all configured endpoints until one succeeds
+		for _, url := range maraconf.Endpoints() {
+			var raw responses
+			raw, err = fetchResponses(url)
+			if err == nil {
+				applist, err = createAppList(raw)
+			}
+			if err == nil {
+				return map[string][]byte{"tasks": raw.Tasks, "apps": raw.Apps}, nil
+			}
 		}
+		// return last error
+		return nil, err
+	})
+	if err != nil {
+		return nil, err
 	}
-	// return last error
-	return nil, err
+	if applist == nil {
+		// replayed responses
+		return createAppList(responses{Tasks: bodies["tasks"], Apps: bodies["apps"]})
+	}
+	return applist, nil
 }
 
-func _fetchApps(url string) (AppList, error) {
-	tasks, err := fetchTasks(url)
+func createAppList(raw responses) (AppList, error) {
+	tasks, err := parseTasks(raw.Tasks)
 	if err != nil {
 		return nil, err
 	}
 
-	marathonApps, err := fetchMarathonApps(url)
+	marathonApps, err := parseMarathonApps(raw.Apps)
 	if err != nil {
 		return nil, err
 	}
 
 	apps := createApps(tasks, marathonApps)
 	sort.Sort(apps)
-	return apps, nil
+	return orderByDependencies(apps), nil
+}
+
+// Resolves dependencies relative to the group of the app
+func parseDependencies(appPath string, dependencies []string) []string {
+	resolved := []string{}
+	for _, dependency := range dependencies {
+		if !strings.HasPrefix(dependency, "/") {
+			dependency = path.Join(path.Dir(appPath), dependency)
+		}
+		resolved = append(resolved, dependency)
+	}
+	return resolved
+}
+
+/*
+	Orders apps sorted by id so that apps come after the apps they
+	depend on. Apps in a dependency cycle keep their order.
+*/
+func orderByDependencies(apps AppList) AppList {
+	known := map[string]bool{}
+	for _, app := range apps {
+		known[app.Id] = true
+	}
+
+	ordered := AppList{}
+	placed := map[string]bool{}
+	for len(ordered) < len(apps) {
+		progress := false
+		for _, app := range apps {
+			if placed[app.Id] || !dependenciesPlaced(app, known, placed) {
+				continue
+			}
+			ordered = append(ordered, app)
+			placed[app.Id] = true
+			progress = true
+		}
+		if progress {
+			continue
+		}
+		// cycle: place the first remaining app
+		for _, app := range apps {
+			if !placed[app.Id] {
+				ordered = append(ordered, app)
+				placed[app.Id] = true
+				break
+			}
+		}
+	}
+	return ordered
+}
+
+func dependenciesPlaced(app App, known map[string]bool, placed map[string]bool) bool {
+	for _, dependency := range app.Dependencies {
+		if known[dependency] && !placed[dependency] && dependency != app.Id {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,66 @@
+package marathon
+
+import (
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func ids(apps AppList) []string {
+	result := []string{}
+	for _, app := range apps {
+		result = append(result, app.Id)
+	}
+	return result
+}
+
+func TestParseDependencies(t *testing.T) {
+	Convey("#parseDependencies", t, func() {
+		Convey("should resolve dependencies relative to the app group", func() {
+			deps := parseDependencies("/shop/web", []string{"/db", "api", "../auth"})
+			So(deps, ShouldResemble, []string{"/db", "/shop/api", "/auth"})
+		})
+	})
+}
+
+func TestOrderByDependencies(t *testing.T) {
+	Convey("#orderByDependencies", t, func() {
+		Convey("should order apps after their dependencies", func() {
+			apps := AppList{
+				App{Id: "/a", Dependencies: []string{"/c"}},
+				App{Id: "/b"},
+				App{Id: "/c", Dependencies: []string{"/d"}},
+				App{Id: "/d"},
+			}
+			So(ids(orderByDependencies(apps)), ShouldResemble, []string{"/b", "/d", "/c", "/a"})
+		})
+
+		Convey("should ignore unknown dependencies", func() {
+			apps := AppList{App{Id: "/a", Dependencies: []string{"/missing"}}, App{Id: "/b"}}
+			So(ids(orderByDependencies(apps)), ShouldResemble, []string{"/a", "/b"})
+		})
+
+		Convey("should keep the order of apps in a cycle", func() {
+			apps := AppList{
+				App{Id: "/a", Dependencies: []string{"/b"}},
+				App{Id: "/b", Dependencies: []string{"/a"}},
+				App{Id: "/c"},
+			}
+			So(ids(orderByDependencies(apps)), ShouldResemble, []string{"/c", "/a", "/b"})
+		})
+	})
+}
+
+func TestParseServicePorts(t *testing.T) {
+	Convey("#parseServicePorts", t, func() {
+		Convey("should name unnamed port definitions after their index", func() {
+			ports := parseServicePorts(MarathonApp{PortDefinitions: []PortDefinition{{Port: 10000, Name: "http"}, {Port: 10001}}})
+			So(ports, ShouldResemble, []ServicePort{{Index: 0, Port: 10000, Name: "http"}, {Index: 1, Port: 10001, Name: "1"}})
+		})
+
+		Convey("should fall back to the ports of older Marathon versions", func() {
+			ports := parseServicePorts(MarathonApp{Ports: []int{10000}})
+			So(ports, ShouldResemble, []ServicePort{{Index: 0, Port: 10000, Name: "0"}})
+		})
+	})
+}
@@ -0,0 +1,198 @@
+package marathon
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/logging"
+)
+
+const CallbackPath = "/api/marathon/event_callback"
+
+/*
+	Health of the Marathon event subscription, so that Marathon no
+	longer sending events shows before routing goes stale
+*/
+type SubscriptionHealth struct {
+	// Whether a Marathon endpoint lists the callback of this instance
+	Subscribed  bool
+	LastChecked time.Time `json:",omitempty"`
+	CheckError  string    `json:",omitempty"`
+	// Events received on the callback since the start
+	EventsReceived int64
+	LastEvent      time.Time `json:",omitempty"`
+	LastEventType  string    `json:",omitempty"`
+}
+
+var (
+	subscription     SubscriptionHealth
+	subscriptionLock sync.RWMutex
+)
+
+// Counts an event received on the callback
+func RecordEvent(eventType string) {
+	subscriptionLock.Lock()
+	defer subscriptionLock.Unlock()
+	subscription.EventsReceived++
+	subscription.LastEvent = time.Now()
+	subscription.LastEventType = eventType
+}
+
+func Subscription() SubscriptionHealth {
+	subscriptionLock.RLock()
+	defer subscriptionLock.RUnlock()
+	return subscription
+}
+
+/*
+	Client of the event subscription calls, with the headers and TLS
+	settings of Marathon.EventSubscription
+*/
+type SubscriptionClient struct {
+	client  *http.Client
+	headers map[string]string
+}
+
+func NewSubscriptionClient(config configuration.EventSubscription) (*SubscriptionClient, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.TLS.InsecureSkipVerify}
+	if len(config.TLS.CaFile) > 0 {
+		pem, err := ioutil.ReadFile(config.TLS.CaFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", config.TLS.CaFile)
+		}
+	}
+	if len(config.TLS.CertFile) > 0 {
+		certificate, err := tls.LoadX509KeyPair(config.TLS.CertFile, config.TLS.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return &SubscriptionClient{
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+		},
+		headers: config.Headers,
+	}, nil
+}
+
+func (c *SubscriptionClient) do(method string, url string) (*http.Response, error) {
+	request, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range c.headers {
+		request.Header.Set(name, value)
+	}
+	return c.client.Do(request)
+}
+
+/*
+	Registers the callback URL with Marathon, returning the response
+	body
+*/
+func (c *SubscriptionClient) Subscribe(endpoint string, callbackUrl string) (string, error) {
+	response, err := c.do("POST", endpoint+"/v2/eventSubscriptions?callbackUrl="+callbackUrl)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	return string(body), err
+}
+
+/*
+	Returns whether Marathon has a subscription for the callback URL
+*/
+func (c *SubscriptionClient) Subscribed(endpoint string, callbackUrl string) (bool, error) {
+	response, err := c.do("GET", endpoint+"/v2/eventSubscriptions")
+	if err != nil {
+		return false, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("%s responded %s", endpoint, response.Status)
+	}
+
+	subscriptions := struct {
+		CallbackUrls []string `json:"callbackUrls"`
+	}{}
+	if err := json.NewDecoder(response.Body).Decode(&subscriptions); err != nil {
+		return false, err
+	}
+	for _, url := range subscriptions.CallbackUrls {
+		if url == callbackUrl {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+/*
+	Checks the subscription every interval and reports it with the
+	age of the last event to StatsD
+*/
+func MonitorSubscription(conf *configuration.Configuration, client *SubscriptionClient, interval time.Duration) {
+	callbackUrl := conf.Bamboo.Endpoint + CallbackPath
+	for {
+		checkSubscription(conf, client, callbackUrl)
+		time.Sleep(interval)
+	}
+}
+
+func checkSubscription(conf *configuration.Configuration, client *SubscriptionClient, callbackUrl string) {
+	subscribed := false
+	var checkErr error
+	for _, endpoint := range conf.Marathon.Endpoints() {
+		found, err := client.Subscribed(endpoint, callbackUrl)
+		if err != nil {
+			checkErr = err
+			continue
+		}
+		// all endpoints of a cluster share the subscriptions
+		subscribed, checkErr = found, nil
+		break
+	}
+
+	subscriptionLock.Lock()
+	subscription.Subscribed = subscribed
+	subscription.LastChecked = time.Now()
+	subscription.CheckError = ""
+	if checkErr != nil {
+		subscription.CheckError = checkErr.Error()
+	}
+	health := subscription
+	subscriptionLock.Unlock()
+
+	if checkErr != nil {
+		logging.Logf("marathon.subscription", "Unable to check the Marathon event subscription: %s\n", checkErr)
+	} else if !subscribed {
+		logging.Logf("marathon.subscription", "Marathon has no event subscription for %s\n", callbackUrl)
+	}
+
+	gauge := "0"
+	if subscribed {
+		gauge = "1"
+	}
+	conf.StatsD.Gauge(1.0, "marathon.subscribed", gauge)
+	if !health.LastEvent.IsZero() {
+		age := int64(time.Since(health.LastEvent) / time.Second)
+		conf.StatsD.Gauge(1.0, "marathon.last_event_age", strconv.FormatInt(age, 10))
+	}
+}
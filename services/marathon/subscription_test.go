@@ -0,0 +1,80 @@
+package marathon
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"github.com/QubitProducts/bamboo/configuration"
+)
+
+func TestSubscribed(t *testing.T) {
+	Convey("#Subscribed", t, func() {
+		var authorization string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization = r.Header.Get("Authorization")
+			w.Write([]byte(`{"callbackUrls": ["http://bamboo-1:8000/api/marathon/event_callback"]}`))
+		}))
+		defer server.Close()
+		client, _ := NewSubscriptionClient(configuration.EventSubscription{
+			Headers: map[string]string{"Authorization": "Bearer gateway-token"},
+		})
+
+		Convey("should find the callback of this instance", func() {
+			subscribed, err := client.Subscribed(server.URL, "http://bamboo-1:8000"+CallbackPath)
+			So(err, ShouldBeNil)
+			So(subscribed, ShouldBeTrue)
+		})
+
+		Convey("should not find the callbacks of other instances", func() {
+			subscribed, err := client.Subscribed(server.URL, "http://bamboo-2:8000"+CallbackPath)
+			So(err, ShouldBeNil)
+			So(subscribed, ShouldBeFalse)
+		})
+
+		Convey("should send the configured headers", func() {
+			client.Subscribed(server.URL, "http://bamboo-1:8000"+CallbackPath)
+			So(authorization, ShouldEqual, "Bearer gateway-token")
+		})
+	})
+
+	Convey("#NewSubscriptionClient", t, func() {
+		Convey("should fail on CA files without certificates", func() {
+			file, _ := ioutil.TempFile("", "ca")
+			defer os.Remove(file.Name())
+			_, err := NewSubscriptionClient(configuration.EventSubscription{TLS: configuration.TLS{CaFile: file.Name()}})
+			So(err.Error(), ShouldEqual, "no certificate in "+file.Name())
+		})
+
+		Convey("should verify servers with the CA file", func() {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"callbackUrls": []}`))
+			}))
+			defer server.Close()
+			file, _ := ioutil.TempFile("", "ca")
+			defer os.Remove(file.Name())
+			pem.Encode(file, &pem.Block{Type: "CERTIFICATE", Bytes: server.TLS.Certificates[0].Certificate[0]})
+			file.Close()
+
+			client, err := NewSubscriptionClient(configuration.EventSubscription{TLS: configuration.TLS{CaFile: file.Name()}})
+			So(err, ShouldBeNil)
+			_, err = client.Subscribed(server.URL, "http://bamboo-1:8000"+CallbackPath)
+			So(err, ShouldBeNil)
+
+			client, _ = NewSubscriptionClient(configuration.EventSubscription{})
+			_, err = client.Subscribed(server.URL, "http://bamboo-1:8000"+CallbackPath)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("#RecordEvent", t, func() {
+		before := Subscription().EventsReceived
+		RecordEvent("status_update_event")
+		So(Subscription().EventsReceived, ShouldEqual, before+1)
+		So(Subscription().LastEventType, ShouldEqual, "status_update_event")
+	})
+}
@@ -0,0 +1,139 @@
+package mesos
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/QubitProducts/bamboo/configuration"
+)
+
+// Scheduled unavailability of Mesos agents
+type Window struct {
+	// Hostnames and IPs of the machines
+	Hosts []string
+	Start time.Time
+	// Zero when the machines are unavailable until further notice
+	End time.Time
+}
+
+/*
+	Returns whether the machines are drained at the given time, which
+	starts drainBefore ahead of the window
+*/
+func (w Window) Draining(at time.Time, drainBefore time.Duration) bool {
+	if at.Before(w.Start.Add(-drainBefore)) {
+		return false
+	}
+	return w.End.IsZero() || at.Before(w.End)
+}
+
+type maintenanceSchedule struct {
+	Windows []struct {
+		MachineIds []struct {
+			Hostname string `json:"hostname"`
+			Ip       string `json:"ip"`
+		} `json:"machine_ids"`
+		Unavailability struct {
+			Start    maintenanceTime  `json:"start"`
+			Duration *maintenanceTime `json:"duration"`
+		} `json:"unavailability"`
+	} `json:"windows"`
+}
+
+type maintenanceTime struct {
+	Nanoseconds int64 `json:"nanoseconds"`
+}
+
+func parseSchedule(content []byte) ([]Window, error) {
+	var schedule maintenanceSchedule
+	err := json.Unmarshal(content, &schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	windows := []Window{}
+	for _, scheduled := range schedule.Windows {
+		window := Window{Hosts: []string{}, Start: time.Unix(0, scheduled.Unavailability.Start.Nanoseconds)}
+		if scheduled.Unavailability.Duration != nil {
+			window.End = window.Start.Add(time.Duration(scheduled.Unavailability.Duration.Nanoseconds))
+		}
+		for _, machine := range scheduled.MachineIds {
+			if len(machine.Hostname) > 0 {
+				window.Hosts = append(window.Hosts, machine.Hostname)
+			}
+			if len(machine.Ip) > 0 {
+				window.Hosts = append(window.Hosts, machine.Ip)
+			}
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+func fetchMaintenance(endpoint string) ([]Window, error) {
+	response, err := http.Get(endpoint + "/maintenance/schedule")
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	contents, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	return parseSchedule(contents)
+}
+
+/*
+	Returns the maintenance windows scheduled on the Mesos master
+
+	Parameters:
+		mesosConf: Mesos master configuration, every endpoint is tried
+		until one succeeds
+*/
+func FetchMaintenance(mesosConf configuration.Mesos) ([]Window, error) {
+	var windows []Window
+	var err error
+
+	for _, url := range mesosConf.Endpoints() {
+		windows, err = fetchMaintenance(url)
+		if err == nil {
+			return windows, nil
+		}
+	}
+	return nil, err
+}
+
+// Hosts drained at the given time
+func DrainingHosts(windows []Window, at time.Time, drainBefore time.Duration) map[string]bool {
+	hosts := map[string]bool{}
+	for _, window := range windows {
+		if window.Draining(at, drainBefore) {
+			for _, host := range window.Hosts {
+				hosts[host] = true
+			}
+		}
+	}
+	return hosts
+}
+
+/*
+	Returns the next time after the given one at which a host starts or
+	stops being drained, false when no window starts or ends later
+*/
+func NextTransition(windows []Window, at time.Time, drainBefore time.Duration) (time.Time, bool) {
+	var next time.Time
+	for _, window := range windows {
+		for _, transition := range []time.Time{window.Start.Add(-drainBefore), window.End} {
+			if transition.IsZero() || !transition.After(at) {
+				continue
+			}
+			if next.IsZero() || transition.Before(next) {
+				next = transition
+			}
+		}
+	}
+	return next, !next.IsZero()
+}
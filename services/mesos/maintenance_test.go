@@ -0,0 +1,67 @@
+package mesos
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseSchedule(t *testing.T) {
+	Convey("#parseSchedule", t, func() {
+		Convey("should read hosts and times of windows", func() {
+			windows, err := parseSchedule([]byte(`{"windows": [{
+				"machine_ids": [{"hostname": "agent1", "ip": "10.0.0.1"}],
+				"unavailability": {"start": {"nanoseconds": 1000000000000}, "duration": {"nanoseconds": 3600000000000}}
+			}, {
+				"machine_ids": [{"hostname": "agent2"}],
+				"unavailability": {"start": {"nanoseconds": 2000000000000}}
+			}]}`))
+
+			So(err, ShouldBeNil)
+			So(len(windows), ShouldEqual, 2)
+			So(windows[0].Hosts, ShouldResemble, []string{"agent1", "10.0.0.1"})
+			So(windows[0].Start, ShouldResemble, time.Unix(1000, 0))
+			So(windows[0].End, ShouldResemble, time.Unix(4600, 0))
+			So(windows[1].End.IsZero(), ShouldBeTrue)
+		})
+	})
+}
+
+func TestDrainingHosts(t *testing.T) {
+	windows := []Window{
+		Window{Hosts: []string{"agent1"}, Start: time.Unix(1000, 0), End: time.Unix(2000, 0)},
+		Window{Hosts: []string{"agent2"}, Start: time.Unix(3000, 0)},
+	}
+
+	Convey("#DrainingHosts", t, func() {
+		Convey("should drain hosts inside their window", func() {
+			So(DrainingHosts(windows, time.Unix(1500, 0), 0), ShouldResemble, map[string]bool{"agent1": true})
+			So(DrainingHosts(windows, time.Unix(2000, 0), 0), ShouldBeEmpty)
+		})
+
+		Convey("should drain hosts ahead of their window", func() {
+			So(DrainingHosts(windows, time.Unix(2900, 0), 200*time.Second), ShouldResemble, map[string]bool{"agent2": true})
+		})
+
+		Convey("should keep hosts of open ended windows drained", func() {
+			So(DrainingHosts(windows, time.Unix(99999, 0), 0), ShouldResemble, map[string]bool{"agent2": true})
+		})
+	})
+
+	Convey("#NextTransition", t, func() {
+		Convey("should return the next start or end of a window", func() {
+			next, ok := NextTransition(windows, time.Unix(1500, 0), 0)
+			So(ok, ShouldBeTrue)
+			So(next, ShouldResemble, time.Unix(2000, 0))
+
+			next, _ = NextTransition(windows, time.Unix(2000, 0), 100*time.Second)
+			So(next, ShouldResemble, time.Unix(2900, 0))
+		})
+
+		Convey("should report when nothing changes anymore", func() {
+			_, ok := NextTransition(windows, time.Unix(3000, 0), 0)
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,77 @@
+package mesos
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/QubitProducts/bamboo/configuration"
+)
+
+// Mesos agent (slave) with its attributes
+type Agent struct {
+	Id         string
+	Hostname   string
+	Attributes map[string]string
+}
+
+type mesosSlaves struct {
+	Slaves []mesosSlave `json:"slaves"`
+}
+
+type mesosSlave struct {
+	Id         string                 `json:"id"`
+	Hostname   string                 `json:"hostname"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+func fetchAgents(endpoint string) (map[string]Agent, error) {
+	response, err := http.Get(endpoint + "/master/slaves")
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	contents, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var slaves mesosSlaves
+	err = json.Unmarshal(contents, &slaves)
+	if err != nil {
+		return nil, err
+	}
+
+	agents := map[string]Agent{}
+	for _, slave := range slaves.Slaves {
+		agent := Agent{Id: slave.Id, Hostname: slave.Hostname, Attributes: map[string]string{}}
+		// scalar attributes are numbers, text attributes are strings
+		for name, value := range slave.Attributes {
+			agent.Attributes[name] = fmt.Sprint(value)
+		}
+		agents[slave.Id] = agent
+	}
+	return agents, nil
+}
+
+/*
+	Returns the Mesos agents keyed by agent id
+
+	Parameters:
+		mesosConf: Mesos master configuration, every endpoint is tried
+		until one succeeds
+*/
+func FetchAgents(mesosConf configuration.Mesos) (map[string]Agent, error) {
+	var agents map[string]Agent
+	var err error
+
+	for _, url := range mesosConf.Endpoints() {
+		agents, err = fetchAgents(url)
+		if err == nil {
+			return agents, nil
+		}
+	}
+	return nil, err
+}
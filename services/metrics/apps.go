@@ -0,0 +1,146 @@
+package metrics
+
+import (
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/marathon"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+/*
+	Decides which apps get per-app metrics. Apps keep their slot while
+	they exist, so the set of buckets only changes when apps come and
+	go rather than with every render.
+*/
+type Guard struct {
+	config conf.AppMetrics
+
+	lock  sync.Mutex
+	slots map[string]bool
+}
+
+func NewGuard(config conf.AppMetrics) *Guard {
+	return &Guard{config: config, slots: map[string]bool{}}
+}
+
+/*
+	Returns the ids of the apps with metrics, sorted, and the number of
+	opted in apps left out by the cardinality limit
+*/
+func (g *Guard) Select(appIds []string) ([]string, int) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	eligible := []string{}
+	existing := map[string]bool{}
+	for _, id := range appIds {
+		if g.optedIn(id) {
+			eligible = append(eligible, id)
+			existing[id] = true
+		}
+	}
+	sort.Strings(eligible)
+
+	// release the slots of removed or opted out apps
+	for id := range g.slots {
+		if !existing[id] {
+			delete(g.slots, id)
+		}
+	}
+
+	selected := []string{}
+	dropped := 0
+	for _, id := range eligible {
+		if !g.slots[id] && len(g.slots) >= g.config.MaxApps {
+			dropped++
+			continue
+		}
+		g.slots[id] = true
+		selected = append(selected, id)
+	}
+	return selected, dropped
+}
+
+func (g *Guard) optedIn(appId string) bool {
+	for _, pattern := range g.config.Exclude {
+		if matched, _ := path.Match(pattern, appId); matched {
+			return false
+		}
+	}
+	if len(g.config.Include) == 0 {
+		return true
+	}
+	for _, pattern := range g.config.Include {
+		if matched, _ := path.Match(pattern, appId); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Bucket of an app metric, e.g. /shop/web => apps.shop_web.tasks
+func AppBucket(appId string, metric string) string {
+	name := strings.Trim(appId, "/")
+	name = strings.NewReplacer("/", "_", ".", "_").Replace(name)
+	return "apps." + name + "." + metric
+}
+
+/*
+	Sends the task and draining task gauges of the selected apps, the
+	seconds since their tasks changed, the objectives of their services,
+	and the number of apps left out
+*/
+func ReportApps(statsd *conf.StatsD, guard *Guard, apps marathon.AppList, services map[string]service.Service, backendChanges map[string]time.Time) {
+	byId := map[string]marathon.App{}
+	ids := []string{}
+	for _, app := range apps {
+		byId[app.Id] = app
+		ids = append(ids, app.Id)
+	}
+
+	selected, dropped := guard.Select(ids)
+	for _, id := range selected {
+		draining := 0
+		for _, task := range byId[id].Tasks {
+			if task.Draining {
+				draining++
+			}
+		}
+		statsd.Gauge(1.0, AppBucket(id, "tasks"), strconv.Itoa(len(byId[id].Tasks)))
+		statsd.Gauge(1.0, AppBucket(id, "draining"), strconv.Itoa(draining))
+		if changed, ok := backendChanges[id]; ok {
+			age := int64(time.Since(changed) / time.Second)
+			statsd.Gauge(1.0, AppBucket(id, "backend_change_age"), strconv.FormatInt(age, 10))
+		}
+		if slo := services[id].Slo; slo != nil {
+			reportSlo(statsd, id, *slo)
+		}
+	}
+	statsd.Gauge(1.0, "apps.metrics.dropped", strconv.Itoa(dropped))
+}
+
+// Gauges of the objectives set, so that alerts can refer to them
+func reportSlo(statsd *conf.StatsD, appId string, slo service.Slo) {
+	for metric, value := range SloGauges(slo) {
+		statsd.Gauge(1.0, AppBucket(appId, metric), strconv.FormatFloat(value, 'f', -1, 64))
+	}
+}
+
+func SloGauges(slo service.Slo) map[string]float64 {
+	gauges := map[string]float64{"slo.window": float64(slo.EffectiveWindow())}
+	if slo.LatencyTarget > 0 {
+		gauges["slo.latency_target"] = float64(slo.LatencyTarget)
+		gauges["slo.latency_percentile"] = slo.EffectiveLatencyPercentile()
+	}
+	if slo.Availability > 0 {
+		gauges["slo.availability"] = slo.Availability
+		gauges["slo.error_budget"] = slo.ErrorBudget()
+	}
+	return gauges
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+func TestGuard(t *testing.T) {
+	Convey("#Select", t, func() {
+		Convey("should cap the number of apps with metrics", func() {
+			guard := NewGuard(conf.AppMetrics{MaxApps: 2})
+			selected, dropped := guard.Select([]string{"/c", "/a", "/b"})
+			So(selected, ShouldResemble, []string{"/a", "/b"})
+			So(dropped, ShouldEqual, 1)
+		})
+
+		Convey("should keep slots of existing apps", func() {
+			guard := NewGuard(conf.AppMetrics{MaxApps: 2})
+			guard.Select([]string{"/b", "/c"})
+			selected, _ := guard.Select([]string{"/a", "/b", "/c"})
+			So(selected, ShouldResemble, []string{"/b", "/c"})
+		})
+
+		Convey("should release slots of removed apps", func() {
+			guard := NewGuard(conf.AppMetrics{MaxApps: 2})
+			guard.Select([]string{"/b", "/c"})
+			selected, dropped := guard.Select([]string{"/a", "/b"})
+			So(selected, ShouldResemble, []string{"/a", "/b"})
+			So(dropped, ShouldEqual, 0)
+		})
+
+		Convey("should only select opted in apps", func() {
+			guard := NewGuard(conf.AppMetrics{MaxApps: 10, Include: []string{"/prod/*"}, Exclude: []string{"/prod/batch"}})
+			selected, _ := guard.Select([]string{"/prod/web", "/prod/batch", "/dev/web"})
+			So(selected, ShouldResemble, []string{"/prod/web"})
+		})
+	})
+
+	Convey("#AppBucket", t, func() {
+		So(AppBucket("/shop/web.v2", "tasks"), ShouldEqual, "apps.shop_web_v2.tasks")
+	})
+
+	Convey("#SloGauges", t, func() {
+		Convey("should only report the objectives set", func() {
+			gauges := SloGauges(service.Slo{LatencyTarget: 250})
+			So(gauges, ShouldResemble, map[string]float64{"slo.window": 30, "slo.latency_target": 250, "slo.latency_percentile": 99})
+		})
+
+		Convey("should report the error budget of an availability objective", func() {
+			gauges := SloGauges(service.Slo{Availability: 99.5, Window: 7})
+			So(gauges["slo.error_budget"], ShouldAlmostEqual, 0.5)
+			So(gauges["slo.window"], ShouldEqual, 7)
+		})
+	})
+}
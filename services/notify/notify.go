@@ -0,0 +1,189 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+// Events owners are notified of
+const (
+	EventServiceCreated  = "service.created"
+	EventServiceUpdated  = "service.updated"
+	EventServiceDeleted  = "service.deleted"
+	EventServiceRestored = "service.restored"
+	// The Marathon app of the service is gone
+	EventServiceOrphaned = "service.orphaned"
+	// HAProxy failed to reload a configuration naming the backend
+	EventReloadFailed = "reload.failed"
+	// The smoke probe of the service failed after a reload
+	EventSmokeFailed = "smoke.failed"
+)
+
+// Body of a webhook call, and content of an email
+type Notification struct {
+	Event     string
+	ServiceId string
+	Message   string
+	At        time.Time
+}
+
+/*
+	Delivers notifications to the contact of an owner it handles,
+	doing nothing for owners without such a contact
+*/
+type Notifier interface {
+	Notify(owner service.Owner, notification Notification) error
+}
+
+type WebhookNotifier struct {
+	Client *http.Client
+}
+
+func (n *WebhookNotifier) Notify(owner service.Owner, notification Notification) error {
+	if len(owner.Webhook) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	response, err := n.Client.Post(owner.Webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("%s responded %s", owner.Webhook, response.Status)
+	}
+	return nil
+}
+
+type EmailNotifier struct {
+	// host:port of the SMTP relay
+	Host    string
+	From    string
+	Timeout time.Duration
+}
+
+func (n *EmailNotifier) Notify(owner service.Owner, notification Notification) error {
+	if len(owner.Email) == 0 {
+		return nil
+	}
+	conn, err := net.DialTimeout("tcp", n.Host, n.Timeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(n.Timeout))
+	host, _, _ := net.SplitHostPort(n.Host)
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if err := client.Mail(n.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(owner.Email); err != nil {
+		return err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(emailMessage(n.From, owner.Email, notification)); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func emailMessage(from string, to string, notification Notification) []byte {
+	message := &bytes.Buffer{}
+	fmt.Fprintf(message, "From: %s\r\n", from)
+	fmt.Fprintf(message, "To: %s\r\n", to)
+	fmt.Fprintf(message, "Subject: [bamboo] %s %s\r\n", notification.Event, notification.ServiceId)
+	fmt.Fprintf(message, "Date: %s\r\n", notification.At.Format(time.RFC1123Z))
+	fmt.Fprintf(message, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(message, "%s\r\n", strings.Replace(notification.Message, "\n", "\r\n", -1))
+	return message.Bytes()
+}
+
+/*
+	Sends notifications to the owners of services in the background,
+	through every configured notifier. Services without owner are
+	skipped. A nil dispatcher sends nothing.
+*/
+type Dispatcher struct {
+	Notifiers []Notifier
+	StatsD    *conf.StatsD
+
+	pending sync.WaitGroup
+}
+
+func NewDispatcher(config *conf.Configuration) *Dispatcher {
+	notifiers := []Notifier{
+		&WebhookNotifier{Client: &http.Client{Timeout: config.Notifications.TimeoutDuration()}},
+	}
+	if config.Notifications.EmailEnabled() {
+		notifiers = append(notifiers, &EmailNotifier{
+			Host:    config.Notifications.SmtpHost,
+			From:    config.Notifications.From,
+			Timeout: config.Notifications.TimeoutDuration(),
+		})
+	}
+	return &Dispatcher{Notifiers: notifiers, StatsD: &config.StatsD}
+}
+
+func (d *Dispatcher) Notify(serviceModel service.Service, event string, message string) {
+	if d == nil || serviceModel.Owner == nil {
+		return
+	}
+	owner := *serviceModel.Owner
+	notification := Notification{Event: event, ServiceId: serviceModel.Id, Message: message, At: time.Now()}
+	for _, notifier := range d.Notifiers {
+		d.pending.Add(1)
+		go func(notifier Notifier) {
+			defer d.pending.Done()
+			if err := notifier.Notify(owner, notification); err != nil {
+				log.Printf("Unable to notify the owner of %s of %s: %s\n", notification.ServiceId, event, err)
+				d.StatsD.Increment(1.0, "notifications.failed", 1)
+				return
+			}
+			d.StatsD.Increment(1.0, "notifications.sent", 1)
+		}(notifier)
+	}
+}
+
+/*
+	Waits for the notifications being sent, at most for the timeout,
+	e.g. before Bamboo exits
+*/
+func (d *Dispatcher) Wait(timeout time.Duration) {
+	if d == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		d.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
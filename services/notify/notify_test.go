@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+// Records notifications instead of delivering them
+type recordingNotifier struct {
+	notifications chan Notification
+}
+
+func (n *recordingNotifier) Notify(owner service.Owner, notification Notification) error {
+	n.notifications <- notification
+	return nil
+}
+
+func TestDispatcher(t *testing.T) {
+	Convey("#Notify", t, func() {
+		recorder := &recordingNotifier{notifications: make(chan Notification, 10)}
+		dispatcher := &Dispatcher{Notifiers: []Notifier{recorder}, StatsD: &conf.StatsD{}}
+
+		Convey("should notify the owner of a service", func() {
+			owned := service.Service{Id: "/app", Owner: &service.Owner{Email: "team@example.com"}}
+			dispatcher.Notify(owned, EventServiceDeleted, "Service /app deleted")
+			dispatcher.Wait(time.Second)
+
+			So(len(recorder.notifications), ShouldEqual, 1)
+			notification := <-recorder.notifications
+			So(notification.Event, ShouldEqual, EventServiceDeleted)
+			So(notification.ServiceId, ShouldEqual, "/app")
+		})
+
+		Convey("should skip services without owner", func() {
+			dispatcher.Notify(service.Service{Id: "/app"}, EventServiceDeleted, "Service /app deleted")
+			dispatcher.Wait(time.Second)
+			So(len(recorder.notifications), ShouldEqual, 0)
+		})
+
+		Convey("should do nothing without dispatcher", func() {
+			var disabled *Dispatcher
+			disabled.Notify(service.Service{Id: "/app", Owner: &service.Owner{Email: "team@example.com"}}, EventServiceDeleted, "")
+			disabled.Wait(time.Second)
+		})
+	})
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	Convey("#WebhookNotifier", t, func() {
+		received := make(chan Notification, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			notification := Notification{}
+			json.Unmarshal(body, &notification)
+			received <- notification
+		}))
+		defer server.Close()
+		notifier := &WebhookNotifier{Client: &http.Client{Timeout: time.Second}}
+
+		Convey("should post the notification", func() {
+			err := notifier.Notify(service.Owner{Webhook: server.URL}, Notification{Event: EventServiceOrphaned, ServiceId: "/app"})
+			So(err, ShouldBeNil)
+			So((<-received).ServiceId, ShouldEqual, "/app")
+		})
+
+		Convey("should skip owners without webhook", func() {
+			So(notifier.Notify(service.Owner{Email: "team@example.com"}, Notification{}), ShouldBeNil)
+			So(len(received), ShouldEqual, 0)
+		})
+	})
+}
+
+func TestEmailMessage(t *testing.T) {
+	Convey("#emailMessage", t, func() {
+		at := time.Date(2016, 5, 24, 12, 0, 0, 0, time.UTC)
+		message := string(emailMessage("bamboo@example.com", "team@example.com", Notification{
+			Event: EventReloadFailed, ServiceId: "/app", Message: "first\nsecond", At: at,
+		}))
+
+		So(message, ShouldContainSubstring, "Subject: [bamboo] reload.failed /app\r\n")
+		So(message, ShouldContainSubstring, "To: team@example.com\r\n")
+		So(strings.HasSuffix(message, "\r\n\r\nfirst\r\nsecond\r\n"), ShouldBeTrue)
+	})
+}
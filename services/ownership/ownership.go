@@ -0,0 +1,89 @@
+package ownership
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+// Request of the webhook method
+type Claim struct {
+	Domain    string
+	Team      string
+	ServiceId string
+}
+
+// Resolves TXT records, replaced in tests
+var lookupTXT = net.LookupTXT
+
+/*
+	Returns an error unless the team owns every domain, checked with the
+	configured method
+*/
+func Check(config conf.DomainOwnership, team string, serviceId string, domains []string) error {
+	for _, domain := range domains {
+		claim := Claim{Domain: domain, Team: team, ServiceId: serviceId}
+		var err error
+		switch config.Method {
+		case "txt":
+			err = checkTxt(config, claim)
+		case "webhook":
+			err = checkWebhook(config, claim)
+		default:
+			err = fmt.Errorf("unknown domain ownership method %s", config.Method)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+	The TXT records of the closest domain, the domain itself or a parent
+	having any, must name the team
+*/
+func checkTxt(config conf.DomainOwnership, claim Claim) error {
+	for domain := claim.Domain; strings.Contains(domain, "."); domain = domain[strings.Index(domain, ".")+1:] {
+		records, err := lookupTXT(config.TxtPrefix + "." + domain)
+		if err != nil || len(records) == 0 {
+			continue
+		}
+		for _, record := range records {
+			if strings.TrimSpace(record) == claim.Team {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s is owned by another team according to %s.%s", claim.Domain, config.TxtPrefix, domain)
+	}
+	return fmt.Errorf("no TXT record %s.%s names the owner of %s", config.TxtPrefix, claim.Domain, claim.Domain)
+}
+
+func checkWebhook(config conf.DomainOwnership, claim Claim) error {
+	body, err := json.Marshal(claim)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: config.TimeoutDuration()}
+	response, err := client.Post(config.WebhookUrl, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("unable to confirm the owner of %s: %s", claim.Domain, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return nil
+	}
+
+	message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+	if reason := strings.TrimSpace(string(message)); len(reason) > 0 {
+		return fmt.Errorf("%s is not owned by %s: %s", claim.Domain, claim.Team, reason)
+	}
+	return fmt.Errorf("%s is not owned by %s", claim.Domain, claim.Team)
+}
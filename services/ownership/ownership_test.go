@@ -0,0 +1,63 @@
+package ownership
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+func TestCheck(t *testing.T) {
+	Convey("#Check", t, func() {
+		Convey("with TXT records", func() {
+			records := map[string][]string{
+				"_bamboo.example.com":      {"platform"},
+				"_bamboo.shop.example.com": {"payments"},
+			}
+			lookupTXT = func(name string) ([]string, error) {
+				if values, ok := records[name]; ok {
+					return values, nil
+				}
+				return nil, errors.New("no such host")
+			}
+			config := conf.DomainOwnership{Method: "txt", TxtPrefix: "_bamboo"}
+
+			Convey("should accept domains below the closest record of the team", func() {
+				So(Check(config, "payments", "/shop", []string{"api.shop.example.com"}), ShouldBeNil)
+				So(Check(config, "platform", "/docs", []string{"docs.example.com"}), ShouldBeNil)
+			})
+
+			Convey("should reject domains of other teams", func() {
+				So(Check(config, "platform", "/shop", []string{"api.shop.example.com"}), ShouldNotBeNil)
+			})
+
+			Convey("should reject domains without record", func() {
+				So(Check(config, "platform", "/other", []string{"other.org"}), ShouldNotBeNil)
+			})
+		})
+
+		Convey("with a webhook", func() {
+			var claim string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				claim = r.URL.Path
+				if r.Header.Get("Content-Type") != "application/json" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				http.Error(w, "owned by payments", http.StatusForbidden)
+			}))
+			defer server.Close()
+			config := conf.DomainOwnership{Method: "webhook", WebhookUrl: server.URL + "/verify", Timeout: 5}
+
+			Convey("should reject domains the webhook does not confirm", func() {
+				err := Check(config, "platform", "/shop", []string{"shop.example.com"})
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "shop.example.com is not owned by platform: owned by payments")
+				So(claim, ShouldEqual, "/verify")
+			})
+		})
+	})
+}
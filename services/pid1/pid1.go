@@ -0,0 +1,103 @@
+package pid1
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/kardianos/osext"
+)
+
+// Set in the environment of the Bamboo process started by Run
+const ChildEnv = "BAMBOO_INIT_CHILD"
+
+// Signals passed on to Bamboo
+var forwardedSignals = []os.Signal{
+	syscall.SIGTERM,
+	syscall.SIGINT,
+	syscall.SIGHUP,
+	syscall.SIGQUIT,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+}
+
+/*
+	Whether Bamboo runs as PID 1, e.g. as the entrypoint of a container,
+	and has to take the responsibilities of init
+*/
+func Required() bool {
+	return os.Getpid() == 1 && len(os.Getenv(ChildEnv)) == 0
+}
+
+/*
+	Runs Bamboo again with the same arguments as a child process and
+	acts as init: signals are forwarded to Bamboo and every exited
+	process is reaped, including orphans reparented to PID 1 like old
+	HAProxy processes. Returns the exit code of Bamboo once it exited.
+*/
+func Run() int {
+	executable, err := osext.Executable()
+	if err != nil {
+		log.Printf("Unable to find the Bamboo executable: %s\n", err)
+		return 1
+	}
+
+	signals := make(chan os.Signal, 16)
+	signal.Notify(signals, append(forwardedSignals, syscall.SIGCHLD)...)
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), ChildEnv+"=1")
+	if err := cmd.Start(); err != nil {
+		log.Printf("Unable to start Bamboo: %s\n", err)
+		return 1
+	}
+	log.Printf("Running as PID 1: started Bamboo %d, forwarding signals and reaping orphaned processes\n", cmd.Process.Pid)
+
+	for sig := range signals {
+		if sig != syscall.SIGCHLD {
+			cmd.Process.Signal(sig)
+			continue
+		}
+		if status, exited := reap(cmd.Process.Pid); exited {
+			return exitCode(status)
+		}
+	}
+	return 1
+}
+
+/*
+	Reaps every exited child, returning the status of the given one
+	when it is among them. Signals are coalesced, so one SIGCHLD can
+	stand for several exits.
+*/
+func reap(pid int) (syscall.WaitStatus, bool) {
+	var childStatus syscall.WaitStatus
+	exited := false
+	for {
+		var status syscall.WaitStatus
+		reaped, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil || reaped <= 0 {
+			return childStatus, exited
+		}
+		if reaped == pid {
+			childStatus = status
+			exited = true
+		}
+	}
+}
+
+// Exit code of a shell for the status, 128 + signal when killed
+func exitCode(status syscall.WaitStatus) int {
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return status.ExitStatus()
+}
@@ -0,0 +1,39 @@
+package pid1
+
+import (
+	"os/exec"
+	"syscall"
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestReap(t *testing.T) {
+	Convey("#reap", t, func() {
+		Convey("should return the status of the child among the reaped processes", func() {
+			other := exec.Command("true")
+			other.Start()
+			child := exec.Command("sh", "-c", "exit 7")
+			child.Start()
+
+			var status syscall.WaitStatus
+			exited := false
+			for !exited {
+				status, exited = reap(child.Process.Pid)
+			}
+			So(exitCode(status), ShouldEqual, 7)
+		})
+	})
+}
+
+func TestExitCode(t *testing.T) {
+	Convey("#exitCode", t, func() {
+		Convey("should return the exit status of an exited process", func() {
+			So(exitCode(syscall.WaitStatus(3<<8)), ShouldEqual, 3)
+		})
+
+		Convey("should return 128 and the signal of a killed process", func() {
+			So(exitCode(syscall.WaitStatus(syscall.SIGKILL)), ShouldEqual, 137)
+		})
+	})
+}
@@ -0,0 +1,178 @@
+package policy
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+// Prefix of the ids of the policies uploaded by Bamboo
+const policyIdPrefix = "bamboo/"
+
+/*
+	Uploads the Rego policies of Bamboo.Policy.Directory and of the
+	bundle at Bamboo.Policy.BundleUrl to the policy API of the OPA server
+	evaluating them, and removes the ones no longer there
+*/
+type Loader struct {
+	Config conf.Policy
+	// Content of the policies uploaded so far by id
+	uploaded map[string]string
+}
+
+func NewLoader(config conf.Policy) *Loader {
+	return &Loader{Config: config, uploaded: map[string]string{}}
+}
+
+func (l *Loader) Run() {
+	for {
+		if err := l.Load(); err != nil {
+			log.Printf("Unable to load the service policies: %s\n", err)
+		}
+		time.Sleep(l.Config.LoadIntervalDuration())
+	}
+}
+
+/*
+	Uploads the policies changed since the last load. Nothing is removed
+	when the policies can not be read, so that a failed download keeps
+	the policies loaded before.
+*/
+func (l *Loader) Load() error {
+	policies := map[string]string{}
+	if len(l.Config.Directory) > 0 {
+		if err := readDirectory(l.Config.Directory, policies); err != nil {
+			return err
+		}
+	}
+	if len(l.Config.BundleUrl) > 0 {
+		if err := l.readBundle(policies); err != nil {
+			return err
+		}
+	}
+
+	for id, content := range policies {
+		if uploaded, found := l.uploaded[id]; found && uploaded == content {
+			continue
+		}
+		if err := l.request("PUT", id, content); err != nil {
+			return err
+		}
+		l.uploaded[id] = content
+	}
+	for id := range l.uploaded {
+		if _, found := policies[id]; found {
+			continue
+		}
+		if err := l.request("DELETE", id, ""); err != nil {
+			return err
+		}
+		delete(l.uploaded, id)
+	}
+	return nil
+}
+
+// The .rego files below a directory, by id "bamboo/directory/<path>"
+func readDirectory(directory string, policies map[string]string) error {
+	return filepath.Walk(directory, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(file) != ".rego" {
+			return nil
+		}
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		relative, _ := filepath.Rel(directory, file)
+		policies[policyIdPrefix+"directory/"+filepath.ToSlash(relative)] = string(content)
+		return nil
+	})
+}
+
+// The .rego files of the bundle, by id "bamboo/bundle/<path>"
+func (l *Loader) readBundle(policies map[string]string) error {
+	client := &http.Client{Timeout: l.Config.TimeoutDuration()}
+	response, err := client.Get(l.Config.BundleUrl)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("bundle download responded %s", response.Status)
+	}
+
+	archive, err := gzip.NewReader(response.Body)
+	if err != nil {
+		return fmt.Errorf("bundle is not a .tar.gz archive: %s", err)
+	}
+	reader := tar.NewReader(archive)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("unreadable bundle: %s", err)
+		}
+		if header.Typeflag != tar.TypeReg || path.Ext(header.Name) != ".rego" {
+			continue
+		}
+		content, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return fmt.Errorf("unreadable bundle: %s", err)
+		}
+		name := strings.TrimPrefix(path.Clean("/"+header.Name), "/")
+		policies[policyIdPrefix+"bundle/"+name] = string(content)
+	}
+}
+
+// URL of a policy in the policy API of the OPA server of Url
+func (l *Loader) policyUrl(id string) (string, error) {
+	parsed, err := url.Parse(l.Config.Url)
+	if err != nil {
+		return "", err
+	}
+	return (&url.URL{Scheme: parsed.Scheme, User: parsed.User, Host: parsed.Host, Path: "/v1/policies/" + id}).String(), nil
+}
+
+func (l *Loader) request(method string, id string, content string) error {
+	policyUrl, err := l.policyUrl(id)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(method, policyUrl, bytes.NewBufferString(content))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "text/plain")
+	client := &http.Client{Timeout: l.Config.TimeoutDuration()}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1<<20))
+	// a policy already removed from OPA needs no removal
+	if method == "DELETE" && response.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("%s of policy %s responded %s: %s", method, id, response.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package policy
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+func bundle(files map[string]string) []byte {
+	var archive bytes.Buffer
+	compressed := gzip.NewWriter(&archive)
+	writer := tar.NewWriter(compressed)
+	for name, content := range files {
+		writer.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		writer.Write([]byte(content))
+	}
+	writer.Close()
+	compressed.Close()
+	return archive.Bytes()
+}
+
+func TestLoader(t *testing.T) {
+	Convey("#Load", t, func() {
+		directory, _ := ioutil.TempDir("", "bamboo-policies")
+		defer os.RemoveAll(directory)
+		ioutil.WriteFile(filepath.Join(directory, "services.rego"), []byte("package bamboo.services\n"), 0644)
+		ioutil.WriteFile(filepath.Join(directory, "README.md"), []byte("policies\n"), 0644)
+
+		bundleStatus := http.StatusOK
+		bundleBody := bundle(map[string]string{"teams/teams.rego": "package bamboo.teams\n", "data.json": "{}"})
+		requests := []string{}
+		policies := map[string]string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/bundle.tar.gz" {
+				w.WriteHeader(bundleStatus)
+				w.Write(bundleBody)
+				return
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			requests = append(requests, r.Method+" "+r.URL.Path)
+			if r.Method == "PUT" {
+				policies[r.URL.Path] = string(body)
+			}
+		}))
+		defer server.Close()
+		loader := NewLoader(conf.Policy{
+			Url:       server.URL + "/v1/data/bamboo/services",
+			Timeout:   5,
+			Directory: directory,
+			BundleUrl: server.URL + "/bundle.tar.gz",
+		})
+
+		Convey("should upload the policies of the directory and the bundle", func() {
+			So(loader.Load(), ShouldBeNil)
+			So(policies, ShouldResemble, map[string]string{
+				"/v1/policies/bamboo/directory/services.rego": "package bamboo.services\n",
+				"/v1/policies/bamboo/bundle/teams/teams.rego": "package bamboo.teams\n",
+			})
+		})
+
+		Convey("should only upload changed policies", func() {
+			loader.Load()
+			requests = []string{}
+			ioutil.WriteFile(filepath.Join(directory, "services.rego"), []byte("package bamboo.services\n\ndeny[msg] { false }\n"), 0644)
+			So(loader.Load(), ShouldBeNil)
+			So(requests, ShouldResemble, []string{"PUT /v1/policies/bamboo/directory/services.rego"})
+		})
+
+		Convey("should remove the policies no longer there", func() {
+			loader.Load()
+			requests = []string{}
+			os.Remove(filepath.Join(directory, "services.rego"))
+			So(loader.Load(), ShouldBeNil)
+			So(requests, ShouldResemble, []string{"DELETE /v1/policies/bamboo/directory/services.rego"})
+		})
+
+		Convey("should keep the policies when the bundle can not be downloaded", func() {
+			loader.Load()
+			requests = []string{}
+			bundleStatus = http.StatusBadGateway
+			So(loader.Load(), ShouldNotBeNil)
+			So(requests, ShouldBeEmpty)
+		})
+	})
+}
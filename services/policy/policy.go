@@ -0,0 +1,114 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+// Mutations of services evaluated against the policies
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionPurge   = "purge"
+	ActionRestore = "restore"
+)
+
+/*
+	Input of the policies: the service as requested and as stored
+	before, nil when there is none
+*/
+type Input struct {
+	Action    string
+	ServiceId string
+	Service   *service.Service `json:",omitempty"`
+	Previous  *service.Service `json:",omitempty"`
+	// Team named by the request, see Bamboo.DomainOwnership.TeamHeader
+	Team string `json:",omitempty"`
+}
+
+type Decision struct {
+	Allowed bool
+	// Explanations of the violated policies
+	Violations []string
+}
+
+type dataRequest struct {
+	Input Input `json:"input"`
+}
+
+// Result of the decision, an object or a set of violations
+type dataResponse struct {
+	Result *json.RawMessage `json:"result"`
+}
+
+type resultObject struct {
+	Allow      *bool
+	Violations []string
+	Deny       []string
+}
+
+/*
+	Evaluates a mutation with the data API of OPA. The decision may be
+	an object with "allow" and "violations" (or "deny"), or the set of
+	violations of a deny rule. An undefined decision is an error, since
+	the policies are most likely not loaded.
+*/
+func Evaluate(config conf.Policy, input Input) (Decision, error) {
+	body, err := json.Marshal(dataRequest{input})
+	if err != nil {
+		return Decision{}, err
+	}
+	client := &http.Client{Timeout: config.TimeoutDuration()}
+	response, err := client.Post(config.Url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return Decision{}, err
+	}
+	defer response.Body.Close()
+	content, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if response.StatusCode/100 != 2 {
+		if message := strings.TrimSpace(string(content)); len(message) > 0 {
+			return Decision{}, fmt.Errorf("%s responded %s: %s", config.Url, response.Status, message)
+		}
+		return Decision{}, fmt.Errorf("%s responded %s", config.Url, response.Status)
+	}
+
+	decoded := dataResponse{}
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		return Decision{}, fmt.Errorf("invalid response of %s: %s", config.Url, err)
+	}
+	if decoded.Result == nil {
+		return Decision{}, errors.New("the decision is undefined, are the policies loaded?")
+	}
+	return decide(*decoded.Result)
+}
+
+func decide(result json.RawMessage) (Decision, error) {
+	violations := []string{}
+	if err := json.Unmarshal(result, &violations); err == nil {
+		return Decision{Allowed: len(violations) == 0, Violations: violations}, nil
+	}
+
+	object := resultObject{}
+	if err := json.Unmarshal(result, &object); err != nil {
+		return Decision{}, fmt.Errorf("unexpected decision %s", result)
+	}
+	if object.Allow == nil && object.Violations == nil && object.Deny == nil {
+		return Decision{}, fmt.Errorf("decision %s has neither allow nor violations", result)
+	}
+	violations = append(append(violations, object.Violations...), object.Deny...)
+	allowed := len(violations) == 0
+	if object.Allow != nil {
+		allowed = allowed && *object.Allow
+	}
+	return Decision{Allowed: allowed, Violations: violations}, nil
+}
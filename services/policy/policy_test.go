@@ -0,0 +1,74 @@
+package policy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+func TestEvaluate(t *testing.T) {
+	Convey("#Evaluate", t, func() {
+		status := http.StatusOK
+		response := `{"result": {"allow": true}}`
+		received := map[string]Input{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			json.Unmarshal(body, &received)
+			w.WriteHeader(status)
+			w.Write([]byte(response))
+		}))
+		defer server.Close()
+		config := conf.Policy{Url: server.URL, Timeout: 5}
+		input := Input{Action: ActionCreate, ServiceId: "/web", Service: &service.Service{Id: "/web", Acl: "hdr(host) -i web.example.com"}, Team: "web"}
+
+		Convey("should send the mutation as input", func() {
+			decision, err := Evaluate(config, input)
+			So(err, ShouldBeNil)
+			So(decision.Allowed, ShouldBeTrue)
+			So(received["input"].Action, ShouldEqual, ActionCreate)
+			So(received["input"].Service.Acl, ShouldEqual, "hdr(host) -i web.example.com")
+			So(received["input"].Team, ShouldEqual, "web")
+		})
+
+		Convey("should deny with the violations of an object", func() {
+			response = `{"result": {"allow": false, "violations": ["ACLs must match hosts of the team"]}}`
+			decision, err := Evaluate(config, input)
+			So(err, ShouldBeNil)
+			So(decision.Allowed, ShouldBeFalse)
+			So(decision.Violations, ShouldResemble, []string{"ACLs must match hosts of the team"})
+		})
+
+		Convey("should deny with the set of a deny rule", func() {
+			response = `{"result": ["services need an owner"]}`
+			decision, err := Evaluate(config, input)
+			So(err, ShouldBeNil)
+			So(decision.Allowed, ShouldBeFalse)
+			So(decision.Violations, ShouldResemble, []string{"services need an owner"})
+		})
+
+		Convey("should allow an empty set of violations", func() {
+			response = `{"result": []}`
+			decision, err := Evaluate(config, input)
+			So(err, ShouldBeNil)
+			So(decision.Allowed, ShouldBeTrue)
+		})
+
+		Convey("should fail on undefined decisions", func() {
+			response = `{}`
+			_, err := Evaluate(config, input)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("should fail on error responses", func() {
+			status = http.StatusInternalServerError
+			_, err := Evaluate(config, input)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,121 @@
+package preview
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/marathon"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+// Longest DNS label
+const maxLabelLength = 63
+
+var invalidLabelCharacters = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Preview route as listed by the API
+type Route struct {
+	Branch   string
+	AppId    string
+	Hostname string
+	Created  time.Time
+	Expires  *time.Time `json:",omitempty"`
+}
+
+/*
+	Returns the hostname of a branch below the preview domain, e.g.
+	feature-login.preview.example.com for feature/Login
+*/
+func Hostname(branch string, domain string) (string, error) {
+	label := invalidLabelCharacters.ReplaceAllString(strings.ToLower(branch), "-")
+	if len(label) > maxLabelLength {
+		label = label[:maxLabelLength]
+	}
+	label = strings.Trim(label, "-")
+	if len(label) == 0 {
+		return "", errors.New("branch name contains no letters or digits")
+	}
+	return label + "." + domain, nil
+}
+
+/*
+	Returns the service routing the hostname of a branch to an app,
+	expiring after ttl seconds
+*/
+func NewService(config conf.Previews, branch string, appId string, ttl int64, now time.Time) (service.Service, error) {
+	hostname, err := Hostname(branch, config.Domain)
+	if err != nil {
+		return service.Service{}, err
+	}
+	if ttl <= 0 {
+		ttl = config.DefaultTTL
+	}
+	expires := now.Add(time.Duration(ttl) * time.Second)
+	return service.Service{
+		Id:      appId,
+		Acl:     "hdr(host) -i " + hostname,
+		TTL:     ttl,
+		Expires: &expires,
+		Preview: &service.Preview{Branch: branch, Created: now},
+		Changed: &now,
+	}, nil
+}
+
+/*
+	Returns the preview routes, sorted by branch
+*/
+func Routes(services map[string]service.Service) []Route {
+	routes := []Route{}
+	for _, serviceModel := range services {
+		if serviceModel.Preview == nil {
+			continue
+		}
+		hostnames := service.Hostnames(serviceModel.Acl)
+		route := Route{
+			Branch:  serviceModel.Preview.Branch,
+			AppId:   serviceModel.Id,
+			Created: serviceModel.Preview.Created,
+			Expires: serviceModel.Expires,
+		}
+		if len(hostnames) > 0 {
+			route.Hostname = hostnames[0]
+		}
+		routes = append(routes, route)
+	}
+	sort.Sort(routesByBranch(routes))
+	return routes
+}
+
+/*
+	Returns the ids of preview services whose Marathon app does not
+	exist, once they are older than the grace period given to deploy
+	the app
+*/
+func Orphaned(apps marathon.AppList, services map[string]service.Service, grace time.Duration, now time.Time) []string {
+	deployed := map[string]bool{}
+	for _, app := range apps {
+		deployed[app.Id] = true
+	}
+
+	orphaned := []string{}
+	for id, serviceModel := range services {
+		if serviceModel.Preview == nil || deployed[id] {
+			continue
+		}
+		if now.Sub(serviceModel.Preview.Created) >= grace {
+			orphaned = append(orphaned, id)
+		}
+	}
+	sort.Strings(orphaned)
+	return orphaned
+}
+
+type routesByBranch []Route
+
+func (r routesByBranch) Len() int           { return len(r) }
+func (r routesByBranch) Less(i, j int) bool { return r[i].Branch < r[j].Branch }
+func (r routesByBranch) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
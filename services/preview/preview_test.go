@@ -0,0 +1,48 @@
+package preview
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/marathon"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+func TestPreview(t *testing.T) {
+	Convey("#Hostname", t, func() {
+		hostname, err := Hostname("feature/Login_Form", "preview.example.com")
+		So(err, ShouldBeNil)
+		So(hostname, ShouldEqual, "feature-login-form.preview.example.com")
+
+		_, err = Hostname("///", "preview.example.com")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("#NewService", t, func() {
+		now := time.Now()
+		config := conf.Previews{Domain: "preview.example.com", DefaultTTL: 3600}
+		serviceModel, err := NewService(config, "pr-42", "/review/pr-42", 0, now)
+		So(err, ShouldBeNil)
+		So(serviceModel.Acl, ShouldEqual, "hdr(host) -i pr-42.preview.example.com")
+		So(serviceModel.Expires.Equal(now.Add(time.Hour)), ShouldBeTrue)
+
+		routes := Routes(map[string]service.Service{serviceModel.Id: serviceModel, "/app": {Id: "/app"}})
+		So(len(routes), ShouldEqual, 1)
+		So(routes[0].Hostname, ShouldEqual, "pr-42.preview.example.com")
+	})
+
+	Convey("#Orphaned", t, func() {
+		now := time.Now()
+		services := map[string]service.Service{
+			"/review/gone":     {Id: "/review/gone", Preview: &service.Preview{Branch: "gone", Created: now.Add(-time.Hour)}},
+			"/review/new":      {Id: "/review/new", Preview: &service.Preview{Branch: "new", Created: now}},
+			"/review/deployed": {Id: "/review/deployed", Preview: &service.Preview{Branch: "deployed", Created: now.Add(-time.Hour)}},
+			"/app":             {Id: "/app"},
+		}
+		apps := marathon.AppList{{Id: "/review/deployed"}}
+
+		So(Orphaned(apps, services, 10*time.Minute, now), ShouldResemble, []string{"/review/gone"})
+	})
+}
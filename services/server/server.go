@@ -0,0 +1,107 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/zenazn/goji/graceful"
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+/*
+	Serves handler on the listener with the timeouts and connection
+	limit of the configuration, shutting down gracefully
+*/
+func Serve(listener net.Listener, handler http.Handler, config conf.Server) error {
+	if config.MaxConnections > 0 {
+		listener = LimitListener(listener, config.MaxConnections)
+	}
+	idle := newIdleCloser(config.IdleTimeoutDuration())
+	server := &graceful.Server{
+		Handler:      handler,
+		ReadTimeout:  config.ReadTimeoutDuration(),
+		WriteTimeout: config.WriteTimeoutDuration(),
+		ConnState:    idle.track,
+	}
+	return server.Serve(listener)
+}
+
+/*
+	Returns a listener accepting at most max connections at once, further
+	connections are accepted once others are closed
+*/
+func LimitListener(listener net.Listener, max int) net.Listener {
+	return &limitListener{Listener: listener, slots: make(chan struct{}, max)}
+}
+
+type limitListener struct {
+	net.Listener
+	slots chan struct{}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	l.slots <- struct{}{}
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		<-l.slots
+		return nil, err
+	}
+	return &limitConn{Conn: conn, release: func() { <-l.slots }}, nil
+}
+
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+/*
+	Closes keep-alive connections waiting longer than the timeout for
+	their next request, using the connection states of net/http
+*/
+type idleCloser struct {
+	timeout time.Duration
+	lock    sync.Mutex
+	timers  map[net.Conn]*time.Timer
+}
+
+func newIdleCloser(timeout time.Duration) *idleCloser {
+	return &idleCloser{timeout: timeout, timers: map[net.Conn]*time.Timer{}}
+}
+
+func (i *idleCloser) track(conn net.Conn, state http.ConnState) {
+	if i.timeout <= 0 {
+		return
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if timer, ok := i.timers[conn]; ok {
+		timer.Stop()
+		delete(i.timers, conn)
+	}
+	if state == http.StateIdle {
+		var timer *time.Timer
+		timer = time.AfterFunc(i.timeout, func() {
+			i.lock.Lock()
+			// a request arrived meanwhile
+			current := i.timers[conn] == timer
+			if current {
+				delete(i.timers, conn)
+			}
+			i.lock.Unlock()
+			if current {
+				conn.Close()
+			}
+		})
+		i.timers[conn] = timer
+	}
+}
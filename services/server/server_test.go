@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestLimitListener(t *testing.T) {
+	Convey("#LimitListener", t, func() {
+		inner, _ := net.Listen("tcp", "127.0.0.1:0")
+		listener := LimitListener(inner, 1)
+		Reset(func() { listener.Close() })
+
+		accepted := make(chan net.Conn, 2)
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				accepted <- conn
+			}
+		}()
+		net.Dial("tcp", inner.Addr().String())
+		net.Dial("tcp", inner.Addr().String())
+
+		Convey("should accept further connections once others are closed", func() {
+			first := <-accepted
+			select {
+			case <-accepted:
+				t.Fatal("second connection accepted over the limit")
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			first.Close()
+			select {
+			case <-accepted:
+			case <-time.After(time.Second):
+				t.Fatal("second connection not accepted")
+			}
+		})
+	})
+}
+
+func TestIdleCloser(t *testing.T) {
+	Convey("#idleCloser", t, func() {
+		idle := newIdleCloser(20 * time.Millisecond)
+		client, conn := net.Pipe()
+		Reset(func() { client.Close() })
+
+		Convey("should close connections idle for longer than the timeout", func() {
+			idle.track(conn, http.StateIdle)
+			_, err := client.Read(make([]byte, 1))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("should keep connections serving a request", func() {
+			idle.track(conn, http.StateIdle)
+			idle.track(conn, http.StateActive)
+			time.Sleep(40 * time.Millisecond)
+			So(len(idle.timers), ShouldEqual, 0)
+			go conn.Write([]byte("x"))
+			_, err := client.Read(make([]byte, 1))
+			So(err, ShouldBeNil)
+		})
+	})
+}
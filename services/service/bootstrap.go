@@ -0,0 +1,101 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/samuel/go-zookeeper/zk"
+	conf "github.com/QubitProducts/bamboo/configuration"
+)
+
+/*
+	Reads the services of a bootstrap file, a list of services or the
+	services by app id as returned by GET /api/services, sorted by id.
+	Every service is validated as if written through the API.
+*/
+func ReadBootstrap(path string) ([]Service, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return decodeBootstrap(data, time.Now())
+}
+
+func decodeBootstrap(data []byte, now time.Time) ([]Service, error) {
+	services := []Service{}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(data, &services); err != nil {
+			return nil, err
+		}
+	} else {
+		byId := map[string]Service{}
+		if err := json.Unmarshal(data, &byId); err != nil {
+			return nil, err
+		}
+		for id, serviceModel := range byId {
+			if len(serviceModel.Id) == 0 {
+				serviceModel.Id = id
+			}
+			services = append(services, serviceModel)
+		}
+	}
+
+	seen := map[string]bool{}
+	for i := range services {
+		serviceModel := &services[i]
+		if len(serviceModel.Id) == 0 {
+			return nil, fmt.Errorf("service %d has no Id", i+1)
+		}
+		if seen[serviceModel.Id] {
+			return nil, fmt.Errorf("service %s is defined twice", serviceModel.Id)
+		}
+		seen[serviceModel.Id] = true
+
+		// the state of the store it was exported from does not apply
+		if err := Normalize(serviceModel, now); err != nil {
+			return nil, fmt.Errorf("service %s: %s", serviceModel.Id, err)
+		}
+	}
+	sort.Sort(servicesById(services))
+	return services, nil
+}
+
+/*
+	Creates the services when the store holds none, deleted services
+	included, and returns how many were created. Does nothing once the
+	store holds services, so that it can run on every start. Services
+	created meanwhile, e.g. by another instance bootstrapping at the
+	same time, are kept.
+*/
+func Bootstrap(conn *zk.Conn, zkConf conf.Zookeeper, services []Service) (int, error) {
+	stored, deleted, err := read(conn, zkConf)
+	if err != nil {
+		return 0, err
+	}
+	if len(stored) > 0 || len(deleted) > 0 {
+		return 0, nil
+	}
+
+	created := 0
+	for _, serviceModel := range services {
+		_, err := Create(conn, zkConf, serviceModel)
+		if err == zk.ErrNodeExists {
+			continue
+		}
+		if err != nil {
+			return created, err
+		}
+		created++
+	}
+	return created, nil
+}
+
+type servicesById []Service
+
+func (s servicesById) Len() int           { return len(s) }
+func (s servicesById) Less(i, j int) bool { return s[i].Id < s[j].Id }
+func (s servicesById) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestDecodeBootstrap(t *testing.T) {
+	Convey("#decodeBootstrap", t, func() {
+		now := time.Date(2016, 6, 1, 12, 0, 0, 0, time.UTC)
+
+		Convey("should read a list of services sorted by id", func() {
+			services, err := decodeBootstrap([]byte(`[{"Id": "/b", "Acl": "path_beg /b"}, {"Id": "/a", "Acl": "path_beg /a"}]`), now)
+			So(err, ShouldBeNil)
+			So(len(services), ShouldEqual, 2)
+			So(services[0].Id, ShouldEqual, "/a")
+			So(*services[0].Changed, ShouldResemble, now)
+		})
+
+		Convey("should read services by app id as listed by the API", func() {
+			services, err := decodeBootstrap([]byte(`{"/a": {"Acl": "path_beg /a", "Deleted": {"At": "2016-05-01T00:00:00Z"}}}`), now)
+			So(err, ShouldBeNil)
+			So(services[0].Id, ShouldEqual, "/a")
+			So(services[0].Deleted, ShouldBeNil)
+		})
+
+		Convey("should set the expiry of services with a TTL", func() {
+			services, err := decodeBootstrap([]byte(`[{"Id": "/pr-1", "Acl": "path_beg /pr-1", "TTL": 60}]`), now)
+			So(err, ShouldBeNil)
+			So(*services[0].Expires, ShouldResemble, now.Add(time.Minute))
+		})
+
+		Convey("should refuse invalid files", func() {
+			_, err := decodeBootstrap([]byte(`[{"Acl": "path_beg /a"}]`), now)
+			So(err, ShouldNotBeNil)
+			_, err = decodeBootstrap([]byte(`[{"Id": "/a"}, {"Id": "/a"}]`), now)
+			So(err, ShouldNotBeNil)
+			_, err = decodeBootstrap([]byte(`[{"Id": "/a", "TTL": -1}]`), now)
+			So(err, ShouldNotBeNil)
+			_, err = decodeBootstrap([]byte(`"/a"`), now)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
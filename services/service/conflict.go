@@ -0,0 +1,70 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Two services whose ACLs can match the same request, the one rendered
+// first wins
+type Conflict struct {
+	Services []string
+	Acls     []string
+	Reason   string
+}
+
+func conflictBetween(a Service, b Service) (Conflict, bool) {
+	ruleA := parseRule(a.Acl)
+	patternA, patternB, ok := ruleA.overlap(parseRule(b.Acl))
+	if !ok {
+		return Conflict{}, false
+	}
+	return Conflict{
+		Services: []string{a.Id, b.Id},
+		Acls:     []string{a.Acl, b.Acl},
+		Reason: fmt.Sprintf("%s %s %q of %s overlaps %s %q of %s", ruleA.subject,
+			patternA.match, patternA.value, a.Id, patternB.match, patternB.value, b.Id),
+	}, true
+}
+
+/*
+	Returns the conflicts of a service with other services, e.g. before
+	storing it
+*/
+func ConflictsWith(serviceModel Service, services map[string]Service) []Conflict {
+	conflicts := []Conflict{}
+	for _, id := range sortedIds(services) {
+		if id == serviceModel.Id {
+			continue
+		}
+		if conflict, ok := conflictBetween(serviceModel, services[id]); ok {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	return conflicts
+}
+
+/*
+	Returns every pair of services whose ACLs overlap
+*/
+func Conflicts(services map[string]Service) []Conflict {
+	conflicts := []Conflict{}
+	ids := sortedIds(services)
+	for i := range ids {
+		for j := i + 1; j < len(ids); j++ {
+			if conflict, ok := conflictBetween(services[ids[i]], services[ids[j]]); ok {
+				conflicts = append(conflicts, conflict)
+			}
+		}
+	}
+	return conflicts
+}
+
+func sortedIds(services map[string]Service) []string {
+	ids := []string{}
+	for id := range services {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestConflicts(t *testing.T) {
+	Convey("#Conflicts", t, func() {
+		services := map[string]Service{
+			"/app":    {Id: "/app", Acl: "hdr(host) -i app.example.com"},
+			"/domain": {Id: "/domain", Acl: "hdr_dom(host) -i example.com"},
+			"/api":    {Id: "/api", Acl: "path_beg /api"},
+			"/other":  {Id: "/other", Acl: "hdr(host) -i other.example.org"},
+		}
+
+		Convey("should report services matching the same hosts", func() {
+			conflicts := Conflicts(services)
+			So(len(conflicts), ShouldEqual, 1)
+			So(conflicts[0].Services, ShouldResemble, []string{"/app", "/domain"})
+		})
+
+		Convey("should compare host names case insensitively", func() {
+			conflicts := ConflictsWith(Service{Id: "/new", Acl: "hdr(host) OTHER.example.org"}, services)
+			So(len(conflicts), ShouldEqual, 1)
+			So(conflicts[0].Services, ShouldResemble, []string{"/new", "/other"})
+		})
+
+		Convey("should report nested path prefixes", func() {
+			conflicts := ConflictsWith(Service{Id: "/v2", Acl: "path_beg /api/v2"}, services)
+			So(len(conflicts), ShouldEqual, 1)
+		})
+
+		Convey("should ignore the service itself and rules it does not understand", func() {
+			So(ConflictsWith(services["/api"], services), ShouldBeEmpty)
+			So(ConflictsWith(Service{Id: "/re", Acl: "path_reg ^/api"}, services), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestDomains(t *testing.T) {
+	Convey("#Domains", t, func() {
+		Convey("should return exact hostnames and suffix domains", func() {
+			domains, ok := Domains("hdr_dom(host) -i Example.com")
+			So(ok, ShouldBeTrue)
+			So(domains, ShouldResemble, []string{"example.com"})
+
+			domains, ok = Domains("hdr_end(host) -i .shop.example.com")
+			So(ok, ShouldBeTrue)
+			So(domains, ShouldResemble, []string{"shop.example.com"})
+		})
+
+		Convey("should not attribute host prefixes and regular expressions", func() {
+			_, ok := Domains("hdr_beg(host) -i shop.")
+			So(ok, ShouldBeFalse)
+			_, ok = Domains("hdr_reg(host) ^shop")
+			So(ok, ShouldBeFalse)
+			_, ok = Domains("hdr_end(host) shop.example.com")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("should not attribute criteria other than host and path rules", func() {
+			for _, acl := range []string{"hdr(host,1) victim.com", "ssl_fc_sni victim.com", "base_beg victim.com/", "req.ssl_sni -i victim.com"} {
+				_, ok := Domains(acl)
+				So(ok, ShouldBeFalse)
+			}
+		})
+
+		Convey("should not attribute several conditions", func() {
+			_, ok := Domains("hdr(host) -i mine.com || ssl_fc_sni victim.com")
+			So(ok, ShouldBeFalse)
+			_, ok = Domains("path_beg /api ssl_fc_sni victim.com")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("should ignore path rules", func() {
+			domains, ok := Domains("path_beg /api")
+			So(ok, ShouldBeTrue)
+			So(domains, ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	matchExact  = "exact"
+	matchPrefix = "prefix"
+	matchSuffix = "suffix"
+)
+
+// Host or path values an ACL matches
+type pattern struct {
+	match string
+	value string
+}
+
+/*
+	Routing rule of a service ACL. Only host and path rules are
+	understood, other criteria (regular expressions, files, cookies...)
+	are never reported as conflicting.
+*/
+type rule struct {
+	// "host" or "path", empty when not understood
+	subject    string
+	patterns   []pattern
+	ignoreCase bool
+}
+
+var hostCriterion = regexp.MustCompile(`^(?:req\.)?(hdr|hdr_beg|hdr_end|hdr_dom)\(host\)$`)
+var pathCriterion = regexp.MustCompile(`^(path|path_beg|path_end|path_dir)$`)
+
+var criterionMatches = map[string]string{
+	"hdr": matchExact, "hdr_beg": matchPrefix, "hdr_end": matchSuffix,
+	"path": matchExact, "path_beg": matchPrefix, "path_end": matchSuffix, "path_dir": matchPrefix,
+	"str": matchExact, "beg": matchPrefix, "end": matchSuffix, "dir": matchPrefix,
+}
+
+func parseRule(acl string) rule {
+	fields := strings.Fields(acl)
+	if len(fields) == 0 {
+		return rule{}
+	}
+
+	criterion := strings.ToLower(fields[0])
+	r := rule{}
+	var match string
+	if groups := hostCriterion.FindStringSubmatch(criterion); groups != nil {
+		r.subject = "host"
+		match = criterionMatches[groups[1]]
+	} else if pathCriterion.MatchString(criterion) {
+		r.subject = "path"
+		match = criterionMatches[criterion]
+	} else {
+		return rule{}
+	}
+	domain := criterion == "hdr_dom(host)" || criterion == "req.hdr_dom(host)"
+	ignoreCase := r.subject == "host"
+
+	for i := 1; i < len(fields); i++ {
+		field := fields[i]
+		switch {
+		case field == "-i":
+			ignoreCase = true
+		case field == "-m" && i+1 < len(fields):
+			i++
+			method, ok := criterionMatches[fields[i]]
+			if !ok {
+				return rule{}
+			}
+			match = method
+			domain = false
+		case field == "-f" || field == "-M" || field == "-u":
+			// values from files or maps are not known
+			return rule{}
+		case strings.HasPrefix(field, "-") && field != "--":
+		default:
+			value := field
+			if ignoreCase {
+				value = strings.ToLower(value)
+			}
+			if domain {
+				r.patterns = append(r.patterns, pattern{matchExact, value}, pattern{matchSuffix, "." + value})
+			} else {
+				r.patterns = append(r.patterns, pattern{match, value})
+			}
+		}
+	}
+	r.ignoreCase = ignoreCase
+	return r
+}
+
+func (p pattern) matches(value string) bool {
+	switch p.match {
+	case matchExact:
+		return value == p.value
+	case matchPrefix:
+		return strings.HasPrefix(value, p.value)
+	default:
+		return strings.HasSuffix(value, p.value)
+	}
+}
+
+// Whether some value can be matched by both patterns
+func (p pattern) overlaps(other pattern) bool {
+	if p.match == other.match {
+		switch p.match {
+		case matchExact:
+			return p.value == other.value
+		case matchPrefix:
+			return strings.HasPrefix(p.value, other.value) || strings.HasPrefix(other.value, p.value)
+		default:
+			return strings.HasSuffix(p.value, other.value) || strings.HasSuffix(other.value, p.value)
+		}
+	}
+	if other.match == matchExact {
+		p, other = other, p
+	}
+	switch {
+	case p.match == matchExact && other.match == matchPrefix:
+		return strings.HasPrefix(p.value, other.value)
+	case p.match == matchExact && other.match == matchSuffix:
+		return strings.HasSuffix(p.value, other.value)
+	}
+	// a value can always start with one and end with the other
+	return true
+}
+
+func (r rule) overlap(other rule) (pattern, pattern, bool) {
+	if len(r.subject) == 0 || r.subject != other.subject {
+		return pattern{}, pattern{}, false
+	}
+	for _, a := range r.patterns {
+		for _, b := range other.patterns {
+			if a.overlaps(b) {
+				return a, b, true
+			}
+		}
+	}
+	return pattern{}, pattern{}, false
+}
+
+/*
+	Returns the hostnames the ACL matches exactly, including the
+	domains of hdr_dom(host) rules
+*/
+func Hostnames(acl string) []string {
+	r := parseRule(acl)
+	hostnames := []string{}
+	if r.subject != "host" {
+		return hostnames
+	}
+	for _, p := range r.patterns {
+		if p.match == matchExact {
+			hostnames = append(hostnames, p.value)
+		}
+	}
+	return hostnames
+}
+
+/*
+	Returns how specific the routing rule of an ACL is: exact values are
+	more specific than prefixes and suffixes, longer values more specific
+	than shorter ones. Rules which are not understood score 0.
+*/
+func Specificity(acl string) int {
+	specificity := 0
+	for _, p := range parseRule(acl).patterns {
+		score := len(p.value)
+		if p.match == matchExact {
+			score += 1000
+		}
+		if score > specificity {
+			specificity = score
+		}
+	}
+	return specificity
+}
+
+/*
+	Returns whether the ACL matches a request for the host and path,
+	and whether the rule is understood at all. Rules which are not
+	understood never match.
+*/
+func Matches(acl string, host string, path string) (matched bool, understood bool) {
+	r := parseRule(acl)
+	value := path
+	switch r.subject {
+	case "host":
+		value = host
+	case "path":
+	default:
+		return false, false
+	}
+	if r.ignoreCase {
+		value = strings.ToLower(value)
+	}
+	for _, p := range r.patterns {
+		if p.matches(value) {
+			return true, true
+		}
+	}
+	return false, true
+}
+
+/*
+	Returns the domains an ACL routes: its exact hostnames and the
+	domains of suffix rules. ok is false unless the ACL is a single host
+	or path rule with plain values, e.g. when it matches hosts by prefix
+	or regular expression, by another criterion such as ssl_fc_sni or
+	base_beg, or combines several conditions.
+*/
+func Domains(acl string) (domains []string, ok bool) {
+	domains = []string{}
+	if len(strings.Fields(acl)) == 0 {
+		return domains, true
+	}
+
+	r := parseRule(acl)
+	switch r.subject {
+	case "path":
+		for _, p := range r.patterns {
+			if !strings.HasPrefix(p.value, "/") {
+				return domains, false
+			}
+		}
+		return domains, true
+	case "host":
+	default:
+		return domains, false
+	}
+	seen := map[string]bool{}
+	for _, p := range r.patterns {
+		if p.match == matchPrefix || (p.match == matchSuffix && !strings.HasPrefix(p.value, ".")) {
+			return domains, false
+		}
+		domain := strings.TrimPrefix(p.value, ".")
+		if !domainPattern.MatchString(domain) {
+			return domains, false
+		}
+		if !seen[domain] {
+			seen[domain] = true
+			domains = append(domains, domain)
+		}
+	}
+	return domains, true
+}
+
+// Hostname, optionally followed by a port
+var domainPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*(:[0-9]+)?$`)
@@ -1,7 +1,13 @@
 package service
 
 import (
+	"encoding/json"
+	"errors"
+	"log"
 	"net/url"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/samuel/go-zookeeper/zk"
 	conf "github.com/QubitProducts/bamboo/configuration"
@@ -10,41 +16,656 @@ import (
 type Service struct {
 	Id  string `param:"id"`
 	Acl string `param:"acl"`
+	// Overrides the HAProxy check derived from Marathon health checks
+	HealthCheck *HealthCheck `json:",omitempty"`
+	// Routing rules of higher priority are rendered first
+	Priority int `json:",omitempty"`
+	// Share of the traffic mirrored to a shadow backend
+	Mirror *Mirror `json:",omitempty"`
+	// Overrides the default server limits
+	Limits *Limits `json:",omitempty"`
+	// Bearer token requirement enforced by HAProxy
+	Jwt *Jwt `json:",omitempty"`
+	// Lua actions run for the requests or responses of the service
+	Lua []LuaHook `json:",omitempty"`
+	// SPOE agents requests of the service are sent to
+	Agents []conf.SpoeAgent `json:",omitempty"`
+	// Request logging of the service
+	Logging *Logging `json:",omitempty"`
+	// Requests per client address, tracked in a stick table
+	RateLimit *RateLimit `json:",omitempty"`
+	// Clients sticking to a server, tracked in a stick table
+	Sticky *Sticky `json:",omitempty"`
+	// Service level objective exported to monitoring
+	Slo *Slo `json:",omitempty"`
+	// Seconds the service lives when written, e.g. the route of a
+	// review app; 0 for a permanent service
+	TTL int64 `json:",omitempty"`
+	// When the service is removed, set from TTL
+	Expires *time.Time `json:",omitempty"`
+	// Set on services registered through /api/previews
+	Preview *Preview `json:",omitempty"`
+	// Set while the service is deleted and can still be restored
+	Deleted *Deletion `json:",omitempty"`
+	// Contact notified of changes affecting the service
+	Owner *Owner `json:",omitempty"`
+	// Link to the ticket or change request behind the service
+	Ticket string `json:",omitempty"`
+	// When the service was last written through the API
+	Changed *time.Time `json:",omitempty"`
+	// Request sent through HAProxy after reloads, the owner is
+	// notified when it fails
+	SmokeProbe *conf.SmokeProbe `json:",omitempty"`
 }
 
+// Soft deletion of a service, purged for good at Purge
+type Deletion struct {
+	At    time.Time
+	Purge time.Time
+}
+
+// Branch of a preview environment the service routes to
+type Preview struct {
+	Branch  string
+	Created time.Time
+}
+
+func (s Service) Expired(at time.Time) bool {
+	return s.Expires != nil && !at.Before(*s.Expires)
+}
+
+func (s Service) Purged(at time.Time) bool {
+	return s.Deleted != nil && !at.Before(s.Deleted.Purge)
+}
+
+/*
+	Rejects requests of client addresses sending more than Requests
+	requests within Period seconds with 429
+*/
+type RateLimit struct {
+	Requests int
+	// Seconds, defaults to 10
+	Period int
+	// Tracked client addresses, the configured default when 0
+	TableSize int
+}
+
+func (r RateLimit) EffectivePeriod() int {
+	if r.Period <= 0 {
+		return 10
+	}
+	return r.Period
+}
+
+func (r RateLimit) Validate() error {
+	if r.Requests <= 0 {
+		return errors.New("RateLimit.Requests must be greater than 0")
+	}
+	if r.Period < 0 || r.TableSize < 0 {
+		return errors.New("RateLimit.Period and TableSize must not be negative")
+	}
+	return nil
+}
+
+/*
+	Sends the requests of a client address to the same server until
+	it was idle for Expire minutes
+*/
+type Sticky struct {
+	// Minutes, defaults to 30
+	Expire int
+	// Tracked client addresses, the configured default when 0
+	TableSize int
+}
+
+func (s Sticky) EffectiveExpire() int {
+	if s.Expire <= 0 {
+		return 30
+	}
+	return s.Expire
+}
+
+func (s Sticky) Validate() error {
+	if s.Expire < 0 || s.TableSize < 0 {
+		return errors.New("Sticky.Expire and TableSize must not be negative")
+	}
+	return nil
+}
+
+var logFacilities = map[string]bool{
+	"kern": true, "user": true, "mail": true, "daemon": true, "auth": true, "syslog": true,
+	"lpr": true, "news": true, "uucp": true, "cron": true, "auth2": true, "ftp": true,
+	"ntp": true, "audit": true, "alert": true, "cron2": true,
+	"local0": true, "local1": true, "local2": true, "local3": true,
+	"local4": true, "local5": true, "local6": true, "local7": true,
+}
+
+var logLevels = map[string]bool{
+	"emerg": true, "alert": true, "crit": true, "err": true,
+	"warning": true, "notice": true, "info": true, "debug": true,
+}
+
+/*
+	Logging of the requests of a service. HAProxy logs requests with
+	the settings of the frontend receiving them: Target, Facility,
+	Level and Format apply to sections of the service itself, e.g.
+	its TCP listener, while sampling also applies to requests
+	received by shared frontends.
+*/
+type Logging struct {
+	// Syslog endpoint, e.g. 10.0.0.10:514, udp@logs:514 or /dev/log
+	Target string
+	// Defaults to local0
+	Facility string
+	// Maximum level of the sent logs, all levels when empty
+	Level string
+	// HAProxy log-format, the format of the frontend when empty
+	Format string
+	// Percentage of logged requests, all requests when 0
+	SampleRate int
+}
+
+func (l Logging) EffectiveFacility() string {
+	if len(l.Facility) == 0 {
+		return "local0"
+	}
+	return l.Facility
+}
+
+func (l Logging) Validate() error {
+	if strings.ContainsAny(l.Target, " \t\"'") {
+		return errors.New("Logging.Target must not contain spaces or quotes")
+	}
+	if !logFacilities[l.EffectiveFacility()] {
+		return errors.New("Logging.Facility must be a syslog facility, e.g. local0")
+	}
+	if len(l.Level) > 0 && !logLevels[l.Level] {
+		return errors.New("Logging.Level must be a syslog level, e.g. info")
+	}
+	if strings.ContainsAny(l.Format, "\"\n") {
+		return errors.New("Logging.Format must not contain quotes or line breaks")
+	}
+	if l.SampleRate < 0 || l.SampleRate > 100 {
+		return errors.New("Logging.SampleRate must be between 0 and 100")
+	}
+	return nil
+}
+
+var sloLabelPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+/*
+	Service level objective of a service. Bamboo does not enforce it,
+	it exports it with the routing state so that alerting is defined
+	next to the routes it applies to.
+*/
+type Slo struct {
+	// Milliseconds requests should be served within, 0 for none
+	LatencyTarget int
+	// Percentile of requests the latency target applies to, defaults to 99
+	LatencyPercentile float64
+	// Percentage of successful requests, e.g. 99.9, 0 for none
+	Availability float64
+	// Days the objective is measured over, defaults to 30
+	Window int
+	// Passed through to alerting, e.g. the owning team
+	Labels map[string]string `json:",omitempty"`
+}
+
+func (s Slo) EffectiveLatencyPercentile() float64 {
+	if s.LatencyPercentile <= 0 {
+		return 99
+	}
+	return s.LatencyPercentile
+}
+
+func (s Slo) EffectiveWindow() int {
+	if s.Window <= 0 {
+		return 30
+	}
+	return s.Window
+}
+
+// Percentage of requests allowed to fail within the window
+func (s Slo) ErrorBudget() float64 {
+	if s.Availability <= 0 {
+		return 0
+	}
+	return 100 - s.Availability
+}
+
+func (s Slo) Validate() error {
+	if s.LatencyTarget < 0 || s.Window < 0 {
+		return errors.New("Slo.LatencyTarget and Window must not be negative")
+	}
+	if s.LatencyPercentile < 0 || s.LatencyPercentile >= 100 {
+		return errors.New("Slo.LatencyPercentile must be between 0 and 100")
+	}
+	if s.Availability < 0 || s.Availability >= 100 {
+		return errors.New("Slo.Availability must be between 0 and 100")
+	}
+	if s.LatencyTarget == 0 && s.Availability == 0 {
+		return errors.New("Slo.LatencyTarget or Availability must be set")
+	}
+	for name := range s.Labels {
+		if !sloLabelPattern.MatchString(name) {
+			return errors.New("Slo label " + name + " must be a metric label name")
+		}
+	}
+	return nil
+}
+
+var luaActionPattern = regexp.MustCompile(`^[A-Za-z0-9_.]+$`)
+
+/*
+	Invokes an action registered by a Lua script with
+	core.register_action, e.g. {"Phase": "request", "Action": "route"}
+	renders `http-request lua.route`
+*/
+type LuaHook struct {
+	// request or response
+	Phase  string
+	Action string
+	Args   []string `json:",omitempty"`
+}
+
+func (h LuaHook) Validate() error {
+	if h.Phase != "request" && h.Phase != "response" {
+		return errors.New("Lua hook phase must be request or response")
+	}
+	if !luaActionPattern.MatchString(h.Action) {
+		return errors.New("Lua hook action must only contain letters, digits, dots and underscores")
+	}
+	for _, arg := range h.Args {
+		if len(arg) == 0 || strings.ContainsAny(arg, " \t\"'") {
+			return errors.New("Lua hook arguments must not be empty or contain spaces or quotes")
+		}
+	}
+	return nil
+}
+
+var jwtAlgorithms = map[string]bool{
+	"RS256": true, "RS384": true, "RS512": true,
+	"ES256": true, "ES384": true, "ES512": true,
+	"PS256": true, "PS384": true, "PS512": true,
+}
+
+/*
+	Requests must carry a bearer token signed with one of the keys of
+	JwksUrl, or the public key at KeyPath, and issued by Issuer for
+	Audience. Empty Issuer and Audience are not checked.
+*/
+type Jwt struct {
+	Issuer   string
+	Audience string
+	// Signature algorithm, defaults to RS256
+	Algorithm string
+	// JSON Web Key Set fetched by Bamboo
+	JwksUrl string
+	// PEM public key file on the HAProxy host
+	KeyPath string
+}
+
+func (j Jwt) EffectiveAlgorithm() string {
+	if len(j.Algorithm) == 0 {
+		return "RS256"
+	}
+	return j.Algorithm
+}
+
+func (j Jwt) Validate() error {
+	if (len(j.JwksUrl) == 0) == (len(j.KeyPath) == 0) {
+		return errors.New("Jwt requires either JwksUrl or KeyPath")
+	}
+	if !jwtAlgorithms[j.EffectiveAlgorithm()] {
+		return errors.New("Jwt.Algorithm must be one of RS256, RS384, RS512, ES256, ES384, ES512, PS256, PS384 or PS512")
+	}
+	if strings.ContainsAny(j.Issuer+j.Audience+j.KeyPath, " \t\r\n\"'") {
+		return errors.New("Jwt.Issuer, Audience and KeyPath must not contain spaces, line breaks or quotes")
+	}
+	if len(j.JwksUrl) > 0 {
+		if parsed, err := url.Parse(j.JwksUrl); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return errors.New("Jwt.JwksUrl must be an http or https URL")
+		}
+	}
+	return nil
+}
+
+/*
+	Connection limits of every server of a service, zero keeps the
+	configured default
+*/
+type Limits struct {
+	MaxConn  int
+	MaxQueue int
+}
+
+func (l Limits) Validate() error {
+	if l.MaxConn < 0 || l.MaxQueue < 0 {
+		return errors.New("Limits.MaxConn and MaxQueue must not be negative")
+	}
+	return nil
+}
+
+/*
+	Mirrors a percentage of the requests of a service to spoa-mirror
+	agents, which replay them against the shadow backend
+*/
+type Mirror struct {
+	// Percentage of mirrored requests, 1 to 100
+	Percent int
+	// comma separated host:port of the spoa-mirror agents
+	Agents string
+}
+
+func (m Mirror) AgentList() []string {
+	agents := []string{}
+	for _, agent := range strings.Split(m.Agents, ",") {
+		if agent = strings.TrimSpace(agent); len(agent) > 0 {
+			agents = append(agents, agent)
+		}
+	}
+	return agents
+}
+
+func (m Mirror) Validate() error {
+	if m.Percent < 1 || m.Percent > 100 {
+		return errors.New("Mirror.Percent must be between 1 and 100")
+	}
+	if len(m.AgentList()) == 0 {
+		return errors.New("Mirror.Agents must list at least one spoa-mirror agent")
+	}
+	return nil
+}
+
+/*
+	Contact of the team owning a service, told about changes and
+	failures affecting it by email, webhook or both
+*/
+type Owner struct {
+	Email string `json:",omitempty"`
+	// Receives a POST of every notification as JSON
+	Webhook string `json:",omitempty"`
+}
+
+func (o Owner) Validate() error {
+	if len(o.Email) == 0 && len(o.Webhook) == 0 {
+		return errors.New("Owner.Email or Owner.Webhook must be set")
+	}
+	if len(o.Email) > 0 && (!strings.Contains(o.Email, "@") || strings.ContainsAny(o.Email, " \r\n<>,")) {
+		return errors.New("Owner.Email must be a single email address")
+	}
+	if len(o.Webhook) > 0 {
+		if parsed, err := url.Parse(o.Webhook); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return errors.New("Owner.Webhook must be an http or https URL")
+		}
+	}
+	return nil
+}
+
+/*
+	HAProxy server check settings, zero values fall back to the
+	Marathon health check and HAProxy defaults
+*/
+type HealthCheck struct {
+	// HTTP check path, a TCP check is used when empty
+	Path string
+	// Check port, defaults to the task port
+	Port int
+	// Interval between two checks in milliseconds
+	Interval int
+	// Consecutive successful checks to consider a server up
+	Rise int
+	// Consecutive failed checks to consider a server down
+	Fall int
+}
+
+func (h HealthCheck) Validate() error {
+	if h.Port < 0 || h.Port > 65535 {
+		return errors.New("HealthCheck.Port must be between 0 and 65535")
+	}
+	if h.Interval < 0 || h.Rise < 0 || h.Fall < 0 {
+		return errors.New("HealthCheck.Interval, Rise and Fall must not be negative")
+	}
+	if len(h.Path) > 0 && !strings.HasPrefix(h.Path, "/") {
+		return errors.New("HealthCheck.Path must start with /")
+	}
+	return nil
+}
+
+func (s Service) Validate() error {
+	if s.TTL < 0 {
+		return errors.New("TTL must not be negative")
+	}
+	if s.HealthCheck != nil {
+		if err := s.HealthCheck.Validate(); err != nil {
+			return err
+		}
+	}
+	if s.Limits != nil {
+		if err := s.Limits.Validate(); err != nil {
+			return err
+		}
+	}
+	if s.Jwt != nil {
+		if err := s.Jwt.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, hook := range s.Lua {
+		if err := hook.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, agent := range s.Agents {
+		if err := agent.Validate(); err != nil {
+			return err
+		}
+	}
+	if s.Logging != nil {
+		if err := s.Logging.Validate(); err != nil {
+			return err
+		}
+	}
+	if s.RateLimit != nil {
+		if err := s.RateLimit.Validate(); err != nil {
+			return err
+		}
+	}
+	if s.Sticky != nil {
+		if err := s.Sticky.Validate(); err != nil {
+			return err
+		}
+	}
+	if s.Slo != nil {
+		if err := s.Slo.Validate(); err != nil {
+			return err
+		}
+	}
+	if s.Owner != nil {
+		if err := s.Owner.Validate(); err != nil {
+			return err
+		}
+	}
+	if s.SmokeProbe != nil {
+		if err := s.SmokeProbe.ValidatePath(); err != nil {
+			return err
+		}
+	}
+	if strings.ContainsAny(s.Ticket, "\r\n") {
+		return errors.New("Ticket must be a single line")
+	}
+	if s.Mirror != nil {
+		return s.Mirror.Validate()
+	}
+	return nil
+}
+
+/*
+	Prepares a service sent by a client to be written at now and
+	validates it: the fields managed by Bamboo are cleared, Changed is
+	set and Expires follows from the TTL
+*/
+func Normalize(serviceModel *Service, now time.Time) error {
+	// Preview is only set by /api/previews
+	serviceModel.Preview = nil
+	serviceModel.Deleted = nil
+	serviceModel.Expires = nil
+	serviceModel.Changed = &now
+	if serviceModel.TTL > 0 {
+		expires := now.Add(time.Duration(serviceModel.TTL) * time.Second)
+		serviceModel.Expires = &expires
+	}
+	return serviceModel.Validate()
+}
+
+/*
+	Returns the services by app id, leaving out deleted ones
+*/
 func All(conn *zk.Conn, zkConf conf.Zookeeper) (map[string]Service, error) {
+	services, _, err := read(conn, zkConf)
+	return services, err
+}
+
+/*
+	Returns the deleted services which can still be restored, by app id
+*/
+func AllDeleted(conn *zk.Conn, zkConf conf.Zookeeper) (map[string]Service, error) {
+	_, deleted, err := read(conn, zkConf)
+	return deleted, err
+}
+
+/*
+	Reads the services and the deleted services, leaving out expired
+	services and deleted services past their purge time, which are
+	removed by Cleanup
+*/
+func read(conn *zk.Conn, zkConf conf.Zookeeper) (map[string]Service, map[string]Service, error) {
 
 	err := ensurePathExists(conn, zkConf.Path)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	services := map[string]Service{}
+	deleted := map[string]Service{}
 	keys, _, err2 := conn.Children(zkConf.Path)
 
 	if err2 != nil {
-		return nil, err2
+		return nil, nil, err2
 	}
 
+	now := time.Now()
 	for _, childPath := range keys {
 		bite, _, e := conn.Get(zkConf.Path + "/" + childPath)
+		if e == zk.ErrNoNode {
+			// deleted meanwhile
+			continue
+		}
 		if e != nil {
-			return nil, e
-			break
+			return nil, nil, e
+		}
+		appId, _ := unescapeSlashes(childPath)
+		serviceModel := decodeService(appId, bite)
+		if serviceModel.Expired(now) || serviceModel.Purged(now) {
+			continue
+		}
+		if serviceModel.Deleted != nil {
+			deleted[appId] = serviceModel
+			continue
+		}
+		services[appId] = serviceModel
+	}
+	return services, deleted, nil
+}
+
+// Interval at which RunCleanup removes expired and purged services
+const CleanupInterval = time.Minute
+
+/*
+	Removes expired services and deleted services past their purge time
+	for good, returning how many were removed
+*/
+func Cleanup(conn *zk.Conn, zkConf conf.Zookeeper, now time.Time) (int, error) {
+	keys, _, err := conn.Children(zkConf.Path)
+	if err == zk.ErrNoNode {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, childPath := range keys {
+		path := zkConf.Path + "/" + childPath
+		data, stat, err := conn.Get(path)
+		if err == zk.ErrNoNode {
+			continue
+		}
+		if err != nil {
+			return removed, err
 		}
 		appId, _ := unescapeSlashes(childPath)
-		services[appId] = Service{Id: appId, Acl: string(bite)}
+		serviceModel := decodeService(appId, data)
+		if !serviceModel.Expired(now) && !serviceModel.Purged(now) {
+			continue
+		}
+		// a service rewritten meanwhile is kept by the version check
+		err = conn.Delete(path, stat.Version)
+		if err == zk.ErrNoNode || err == zk.ErrBadVersion {
+			continue
+		}
+		if err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// Runs Cleanup every CleanupInterval
+func RunCleanup(conn *zk.Conn, zkConf conf.Zookeeper) {
+	for {
+		time.Sleep(CleanupInterval)
+		removed, err := Cleanup(conn, zkConf, time.Now())
+		if err != nil {
+			log.Printf("Unable to remove expired services: %s\n", err)
+		}
+		if removed > 0 {
+			log.Printf("Removed %d expired or purged services\n", removed)
+		}
 	}
-	return services, nil
+}
+
+/*
+	Returns when the next of the services expires, false when none of
+	them expires
+*/
+func NextExpiry(services map[string]Service) (time.Time, bool) {
+	var next time.Time
+	for _, serviceModel := range services {
+		if serviceModel.Expires != nil && (next.IsZero() || serviceModel.Expires.Before(next)) {
+			next = *serviceModel.Expires
+		}
+	}
+	return next, !next.IsZero()
 }
 
 /*
    Read ZK ACL:
    http://zookeeper.apache.org/doc/trunk/zookeeperProgrammers.html#sc_ACLPermissions
 */
-func Create(conn *zk.Conn, zkConf conf.Zookeeper, appId string, domainValue string) (string, error) {
-	path := concatPath(zkConf.Path, appId)
-	resPath, err := conn.Create(path, []byte(domainValue), 0, defaultACL())
+func Create(conn *zk.Conn, zkConf conf.Zookeeper, serviceModel Service) (string, error) {
+	path := concatPath(zkConf.Path, serviceModel.Id)
+	data, err := encodeService(serviceModel)
+	if err != nil {
+		return "", err
+	}
+
+	resPath, err := conn.Create(path, data, 0, defaultACL())
+	if err == zk.ErrNodeExists {
+		// a deleted or expired service is replaced instead of restored
+		return path, replaceDeleted(conn, zkConf, path, data)
+	}
 	if err != nil {
 		return "", err
 	}
@@ -52,9 +673,30 @@ func Create(conn *zk.Conn, zkConf conf.Zookeeper, appId string, domainValue stri
 	return resPath, nil
 }
 
-func Put(conn *zk.Conn, zkConf conf.Zookeeper, appId string, domainValue string) (*zk.Stat, error) {
+func replaceDeleted(conn *zk.Conn, zkConf conf.Zookeeper, path string, data []byte) error {
+	current, stat, err := conn.Get(path)
+	if err != nil {
+		return err
+	}
+	if stored := decodeService("", current); stored.Deleted == nil && !stored.Expired(time.Now()) {
+		return zk.ErrNodeExists
+	}
+	if _, err := conn.Set(path, data, stat.Version); err != nil {
+		return err
+	}
+	conn.Set(zkConf.Path, []byte{}, -1)
+	return nil
+}
+
+func Put(conn *zk.Conn, zkConf conf.Zookeeper, appId string, serviceModel Service) (*zk.Stat, error) {
 	path := concatPath(zkConf.Path, appId)
-	stats, err := conn.Set(path, []byte(domainValue), -1)
+	serviceModel.Id = appId
+	data, err := encodeService(serviceModel)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := conn.Set(path, data, -1)
 
 	if err != nil {
 		return nil, err
@@ -65,11 +707,134 @@ func Put(conn *zk.Conn, zkConf conf.Zookeeper, appId string, domainValue string)
 	return stats, nil
 }
 
+// Returned when updating a deleted service
+var ErrDeleted = errors.New("service is deleted")
+
+/*
+	Replaces a stored service, keeping the fields managed by Bamboo such
+	as Preview. Returns zk.ErrNoNode when there is no such service or it
+	has expired, and ErrDeleted when it is deleted.
+*/
+func Update(conn *zk.Conn, zkConf conf.Zookeeper, appId string, serviceModel Service) (Service, error) {
+	var changeErr error
+	updated, err := rewrite(conn, zkConf, appId, func(stored *Service) bool {
+		switch {
+		case stored.Deleted != nil:
+			changeErr = ErrDeleted
+			return false
+		case stored.Expired(time.Now()):
+			changeErr = zk.ErrNoNode
+			return false
+		}
+		serviceModel.Id = appId
+		serviceModel.Preview = stored.Preview
+		serviceModel.Deleted = nil
+		*stored = serviceModel
+		return true
+	})
+	if changeErr != nil {
+		return updated, changeErr
+	}
+	return updated, err
+}
+
+/*
+	Returns the stored service, deleted or not
+*/
+func Get(conn *zk.Conn, zkConf conf.Zookeeper, appId string) (Service, error) {
+	data, _, err := conn.Get(concatPath(zkConf.Path, appId))
+	if err != nil {
+		return Service{}, err
+	}
+	return decodeService(appId, data), nil
+}
+
+/*
+	Removes the service for good
+*/
 func Delete(conn *zk.Conn, zkConf conf.Zookeeper, appId string) error {
 	path := concatPath(zkConf.Path, appId)
 	return conn.Delete(path, -1)
 }
 
+/*
+	Marks the service deleted, so that it is no longer rendered but can
+	be restored until the retention has passed. Returns zk.ErrNoNode
+	when there is no such service or it is already deleted.
+*/
+func SoftDelete(conn *zk.Conn, zkConf conf.Zookeeper, appId string, retention time.Duration, at time.Time) (Service, error) {
+	return rewrite(conn, zkConf, appId, func(serviceModel *Service) bool {
+		if serviceModel.Deleted != nil {
+			return false
+		}
+		serviceModel.Deleted = &Deletion{At: at, Purge: at.Add(retention)}
+		return true
+	})
+}
+
+/*
+	Restores a deleted service. Returns zk.ErrNoNode when there is no
+	such deleted service.
+*/
+func Restore(conn *zk.Conn, zkConf conf.Zookeeper, appId string) (Service, error) {
+	return rewrite(conn, zkConf, appId, func(serviceModel *Service) bool {
+		if serviceModel.Deleted == nil || serviceModel.Purged(time.Now()) {
+			return false
+		}
+		serviceModel.Deleted = nil
+		return true
+	})
+}
+
+/*
+	Applies change to the stored service and writes it back unless
+	change returns false, failing when the service was written
+	meanwhile
+*/
+func rewrite(conn *zk.Conn, zkConf conf.Zookeeper, appId string, change func(*Service) bool) (Service, error) {
+	path := concatPath(zkConf.Path, appId)
+	data, stat, err := conn.Get(path)
+	if err != nil {
+		return Service{}, err
+	}
+	serviceModel := decodeService(appId, data)
+	if !change(&serviceModel) {
+		return serviceModel, zk.ErrNoNode
+	}
+
+	data, err = encodeService(serviceModel)
+	if err != nil {
+		return serviceModel, err
+	}
+	if _, err := conn.Set(path, data, stat.Version); err != nil {
+		return serviceModel, err
+	}
+	// Force triger an event on parent
+	conn.Set(zkConf.Path, []byte{}, -1)
+	return serviceModel, nil
+}
+
+/*
+	Services are stored as JSON. Nodes written by older versions only
+	contain the raw ACL string, which is still accepted. Older versions
+	read JSON nodes as the ACL itself, so they must not share the store
+	with this version; see Upgrading the service store in the README.
+*/
+func decodeService(appId string, data []byte) Service {
+	serviceModel := Service{}
+	if len(data) > 0 && data[0] == '{' {
+		if err := json.Unmarshal(data, &serviceModel); err == nil {
+			serviceModel.Id = appId
+			return serviceModel
+		}
+	}
+	return Service{Id: appId, Acl: string(data)}
+}
+
+func encodeService(serviceModel Service) ([]byte, error) {
+	return json.Marshal(serviceModel)
+}
+
 func concatPath(parentPath string, appId string) string {
 	return parentPath + "/" + escapeSlashes(appId)
 }
@@ -0,0 +1,104 @@
+package service
+
+import (
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"testing"
+	"time"
+)
+
+func TestExpiry(t *testing.T) {
+	Convey("#Expired", t, func() {
+		now := time.Now()
+		expires := now.Add(time.Minute)
+		serviceModel := Service{Id: "/review/pr-42", TTL: 60, Expires: &expires}
+
+		So(serviceModel.Expired(now), ShouldBeFalse)
+		So(serviceModel.Expired(expires), ShouldBeTrue)
+		So(Service{Id: "/app"}.Expired(now), ShouldBeFalse)
+		So(Service{Id: "/app", TTL: -1}.Validate(), ShouldNotBeNil)
+	})
+
+	Convey("#NextExpiry", t, func() {
+		first := time.Now().Add(time.Minute)
+		second := first.Add(time.Hour)
+		services := map[string]Service{
+			"/app":  {Id: "/app"},
+			"/pr-1": {Id: "/pr-1", Expires: &second},
+			"/pr-2": {Id: "/pr-2", Expires: &first},
+		}
+
+		next, ok := NextExpiry(services)
+		So(ok, ShouldBeTrue)
+		So(next, ShouldResemble, first)
+
+		_, ok = NextExpiry(map[string]Service{"/app": {Id: "/app"}})
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestDeletion(t *testing.T) {
+	Convey("#Purged", t, func() {
+		now := time.Now()
+		serviceModel := Service{Id: "/app", Deleted: &Deletion{At: now, Purge: now.Add(time.Hour)}}
+
+		So(serviceModel.Purged(now), ShouldBeFalse)
+		So(serviceModel.Purged(now.Add(time.Hour)), ShouldBeTrue)
+		So(Service{Id: "/app"}.Purged(now), ShouldBeFalse)
+	})
+
+	Convey("#decodeService", t, func() {
+		Convey("should keep the deletion of a service", func() {
+			at := time.Date(2016, 5, 24, 12, 0, 0, 0, time.UTC)
+			data, _ := encodeService(Service{Id: "/app", Acl: "path_beg /app", Deleted: &Deletion{At: at, Purge: at.Add(time.Hour)}})
+			serviceModel := decodeService("/app", data)
+			So(serviceModel.Deleted, ShouldNotBeNil)
+			So(serviceModel.Deleted.Purge, ShouldResemble, at.Add(time.Hour))
+		})
+	})
+}
+
+func TestOwner(t *testing.T) {
+	Convey("#Validate", t, func() {
+		So(Owner{Email: "team@example.com"}.Validate(), ShouldBeNil)
+		So(Owner{Webhook: "https://hooks.example.com/bamboo"}.Validate(), ShouldBeNil)
+		So(Owner{}.Validate(), ShouldNotBeNil)
+		So(Owner{Email: "team@example.com, other@example.com"}.Validate(), ShouldNotBeNil)
+		So(Owner{Webhook: "ftp://hooks.example.com"}.Validate(), ShouldNotBeNil)
+
+		So(Service{Id: "/app", Acl: "path_beg /app", SmokeProbe: &conf.SmokeProbe{Url: "/health"}}.Validate(), ShouldBeNil)
+		So(Service{Id: "/app", Acl: "path_beg /app", SmokeProbe: &conf.SmokeProbe{Url: "http://169.254.169.254/latest/meta-data/"}}.Validate(), ShouldNotBeNil)
+		So(Service{Id: "/app", Acl: "path_beg /app", SmokeProbe: &conf.SmokeProbe{Url: "//169.254.169.254/latest/meta-data/"}}.Validate(), ShouldNotBeNil)
+
+		So(Jwt{Issuer: "https://auth.example.com/", KeyPath: "/etc/haproxy/app.pem"}.Validate(), ShouldBeNil)
+		So(Jwt{Issuer: "https://auth.example.com/\r\nhttp-request allow", KeyPath: "/etc/haproxy/app.pem"}.Validate(), ShouldNotBeNil)
+		So(Jwt{Audience: "api\n", KeyPath: "/etc/haproxy/app.pem"}.Validate(), ShouldNotBeNil)
+	})
+}
+
+func TestNormalize(t *testing.T) {
+	Convey("#Normalize", t, func() {
+		now := time.Date(2016, 5, 1, 10, 0, 0, 0, time.UTC)
+		earlier := now.Add(-time.Hour)
+
+		Convey("should clear the fields managed by Bamboo", func() {
+			serviceModel := Service{Id: "/app", Acl: "path_beg /app", Preview: &Preview{Branch: "feature"}, Deleted: &Deletion{At: earlier}, Expires: &earlier, Changed: &earlier}
+			So(Normalize(&serviceModel, now), ShouldBeNil)
+			So(serviceModel.Preview, ShouldBeNil)
+			So(serviceModel.Deleted, ShouldBeNil)
+			So(serviceModel.Expires, ShouldBeNil)
+			So(*serviceModel.Changed, ShouldResemble, now)
+		})
+
+		Convey("should expire services with a TTL", func() {
+			serviceModel := Service{Id: "/app", Acl: "path_beg /app", TTL: 60}
+			So(Normalize(&serviceModel, now), ShouldBeNil)
+			So(*serviceModel.Expires, ShouldResemble, now.Add(time.Minute))
+		})
+
+		Convey("should validate the service", func() {
+			serviceModel := Service{Id: "/app", Acl: "path_beg /app", Owner: &Owner{}}
+			So(Normalize(&serviceModel, now), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,131 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/QubitProducts/bamboo/services/haproxy"
+	"github.com/QubitProducts/bamboo/services/marathon"
+)
+
+const (
+	ChangeApp     = "app"
+	ChangeTask    = "task"
+	ChangeService = "service"
+
+	ActionAdded   = "added"
+	ActionRemoved = "removed"
+	ActionChanged = "changed"
+)
+
+// Compact record of one app, task or service change. Tasks are
+// identified by host:port within their app.
+type Change struct {
+	Revision  int64
+	Timestamp time.Time
+	Type      string
+	Id        string
+	AppId     string `json:",omitempty"`
+	Action    string
+}
+
+// Changes since a revision, Truncated is set when older changes were
+// already discarded and consumers should reload the full state
+type ChangeFeed struct {
+	Revision  int64
+	Truncated bool
+	Changes   []Change
+}
+
+/*
+	Returns the app and service changes between two template data sets
+*/
+func diffData(previous haproxy.TemplateData, current haproxy.TemplateData) []Change {
+	previousApps := map[string]interface{}{}
+	for _, app := range previous.Apps {
+		previousApps[app.Id] = app
+	}
+	currentApps := map[string]interface{}{}
+	for _, app := range current.Apps {
+		currentApps[app.Id] = app
+	}
+
+	previousServices := map[string]interface{}{}
+	for id, service := range previous.Services {
+		previousServices[id] = service
+	}
+	currentServices := map[string]interface{}{}
+	for id, service := range current.Services {
+		currentServices[id] = service
+	}
+
+	changes := diffById(ChangeApp, previousApps, currentApps)
+	changes = append(changes, diffTasks(previous.Apps, current.Apps)...)
+	return append(changes, diffById(ChangeService, previousServices, currentServices)...)
+}
+
+func diffTasks(previous marathon.AppList, current marathon.AppList) []Change {
+	previousTasks := tasksByApp(previous)
+	currentTasks := tasksByApp(current)
+
+	changes := []Change{}
+	for appId := range previousTasks {
+		if _, exists := currentTasks[appId]; !exists {
+			currentTasks[appId] = map[string]interface{}{}
+		}
+	}
+	for appId, tasks := range currentTasks {
+		before, exists := previousTasks[appId]
+		if !exists {
+			before = map[string]interface{}{}
+		}
+		for _, change := range diffById(ChangeTask, before, tasks) {
+			change.AppId = appId
+			changes = append(changes, change)
+		}
+	}
+	sortChanges(changes)
+	return changes
+}
+
+func tasksByApp(apps marathon.AppList) map[string]map[string]interface{} {
+	tasksByApp := map[string]map[string]interface{}{}
+	for _, app := range apps {
+		tasks := map[string]interface{}{}
+		for _, task := range app.Tasks {
+			tasks[TaskKey(task)] = task
+		}
+		tasksByApp[app.Id] = tasks
+	}
+	return tasksByApp
+}
+
+func TaskKey(task marathon.Task) string {
+	return fmt.Sprintf("%s:%d", task.Host, task.Port)
+}
+
+func diffById(changeType string, previous map[string]interface{}, current map[string]interface{}) []Change {
+	changes := []Change{}
+	for id, item := range current {
+		old, existed := previous[id]
+		if !existed {
+			changes = append(changes, Change{Type: changeType, Id: id, Action: ActionAdded})
+		} else if !sameContent(old, item) {
+			changes = append(changes, Change{Type: changeType, Id: id, Action: ActionChanged})
+		}
+	}
+	for id := range previous {
+		if _, exists := current[id]; !exists {
+			changes = append(changes, Change{Type: changeType, Id: id, Action: ActionRemoved})
+		}
+	}
+	sortChanges(changes)
+	return changes
+}
+
+func sameContent(a interface{}, b interface{}) bool {
+	contentA, _ := json.Marshal(a)
+	contentB, _ := json.Marshal(b)
+	return string(contentA) == string(contentB)
+}
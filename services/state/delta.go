@@ -0,0 +1,166 @@
+package state
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/QubitProducts/bamboo/services/marathon"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+type AppDelta struct {
+	Added   []marathon.App
+	Changed []marathon.App
+	Removed []string
+}
+
+// Task of an app, removed tasks only carry Host and Port
+type AppTask struct {
+	AppId string
+	Task  marathon.Task
+}
+
+type TaskDelta struct {
+	Added   []AppTask
+	Changed []AppTask
+	Removed []AppTask
+}
+
+type ServiceDelta struct {
+	Added   []service.Service
+	Changed []service.Service
+	Removed []string
+}
+
+/*
+	Net changes between revision Since and Revision. When Truncated is
+	set, changes after Since were discarded, or Since is ahead of
+	Revision, e.g. after a restart, and the delta is empty; consumers
+	must reload the full state.
+*/
+type Delta struct {
+	Since     int64
+	Revision  int64
+	Truncated bool
+	Apps      AppDelta
+	Tasks     TaskDelta
+	Services  ServiceDelta
+}
+
+type changeKey struct {
+	changeType string
+	appId      string
+	id         string
+}
+
+/*
+	Returns the net changes after the given revision, using the latest
+	tracked data for added and changed entries
+*/
+func (t *Tracker) DeltaSince(since int64) Delta {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delta := Delta{
+		Since:    since,
+		Revision: t.revision,
+		Apps:     AppDelta{[]marathon.App{}, []marathon.App{}, []string{}},
+		Tasks:    TaskDelta{[]AppTask{}, []AppTask{}, []AppTask{}},
+		Services: ServiceDelta{[]service.Service{}, []service.Service{}, []string{}},
+	}
+	// a revision ahead of the tracker was handed out before a restart
+	if since < t.droppedRevision || since > t.revision {
+		delta.Truncated = true
+		return delta
+	}
+
+	// first and last action of every entry decide its net change
+	keys := []changeKey{}
+	first := map[changeKey]string{}
+	last := map[changeKey]string{}
+	for _, change := range t.changes {
+		if change.Revision <= since {
+			continue
+		}
+		key := changeKey{change.Type, change.AppId, change.Id}
+		if _, seen := first[key]; !seen {
+			first[key] = change.Action
+			keys = append(keys, key)
+		}
+		last[key] = change.Action
+	}
+
+	apps := map[string]marathon.App{}
+	tasks := map[changeKey]marathon.Task{}
+	for _, app := range t.data.Apps {
+		apps[app.Id] = app
+		for _, task := range app.Tasks {
+			tasks[changeKey{ChangeTask, app.Id, TaskKey(task)}] = task
+		}
+	}
+
+	for _, key := range keys {
+		existedBefore := first[key] != ActionAdded
+		existsNow := last[key] != ActionRemoved
+
+		action := ActionChanged
+		switch {
+		case !existedBefore && !existsNow:
+			continue
+		case !existedBefore:
+			action = ActionAdded
+		case !existsNow:
+			action = ActionRemoved
+		}
+
+		switch key.changeType {
+		case ChangeApp:
+			delta.Apps.add(action, key.id, apps[key.id])
+		case ChangeTask:
+			delta.Tasks.add(action, key, tasks[key])
+		case ChangeService:
+			delta.Services.add(action, key.id, t.data.Services[key.id])
+		}
+	}
+	return delta
+}
+
+func (d *AppDelta) add(action string, id string, app marathon.App) {
+	switch action {
+	case ActionAdded:
+		d.Added = append(d.Added, app)
+	case ActionChanged:
+		d.Changed = append(d.Changed, app)
+	default:
+		d.Removed = append(d.Removed, id)
+	}
+}
+
+func (d *TaskDelta) add(action string, key changeKey, task marathon.Task) {
+	switch action {
+	case ActionAdded:
+		d.Added = append(d.Added, AppTask{key.appId, task})
+	case ActionChanged:
+		d.Changed = append(d.Changed, AppTask{key.appId, task})
+	default:
+		d.Removed = append(d.Removed, AppTask{key.appId, removedTask(key.id)})
+	}
+}
+
+func (d *ServiceDelta) add(action string, id string, serviceModel service.Service) {
+	switch action {
+	case ActionAdded:
+		d.Added = append(d.Added, serviceModel)
+	case ActionChanged:
+		d.Changed = append(d.Changed, serviceModel)
+	default:
+		d.Removed = append(d.Removed, id)
+	}
+}
+
+// Rebuilds the host and port of a removed task from its key
+func removedTask(key string) marathon.Task {
+	separator := strings.LastIndex(key, ":")
+	port, _ := strconv.Atoi(key[separator+1:])
+	return marathon.Task{Host: key[:separator], Port: port}
+}
@@ -0,0 +1,113 @@
+package state
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"time"
+
+	"github.com/QubitProducts/bamboo/services/haproxy"
+)
+
+// Renders kept in the reload history
+const reloadHistorySize = 100
+
+/*
+	Outcome of the latest render and reload, telling whether the live
+	proxy reflects the tracked state
+*/
+type Reload struct {
+	RenderId string
+	// Empty when HAProxy was not reloaded
+	ReloadId   string
+	Revision   int64
+	Timestamp  time.Time
+	DurationMs int64
+	// SHA-1 of the rendered configuration
+	ConfigHash string
+	// Whether HAProxy was reloaded, false for unchanged configurations
+	// and in no-reload mode
+	Reloaded bool
+	// Whether relocated tasks were updated through the HAProxy runtime
+	// API instead of a reload
+	RuntimeUpdate bool
+	Success       bool
+	Error         string `json:",omitempty"`
+	// Whether the validation hook rejected the configuration, with the
+	// reason in Error
+	Rejected bool
+	// Time between the oldest Marathon event of the update and its
+	// successful completion, 0 for updates not caused by Marathon
+	AppliedLagMs int64
+	// Probes sent through HAProxy once the configuration was applied,
+	// added when they completed
+	SmokeCheck  []haproxy.SmokeResult `json:",omitempty"`
+	SmokeFailed bool                  `json:",omitempty"`
+}
+
+func (t *Tracker) RecordReload(reload Reload) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.lastReload = &reload
+	t.reloads = append(t.reloads, reload)
+	if overflow := len(t.reloads) - reloadHistorySize; overflow > 0 {
+		t.reloads = t.reloads[overflow:]
+	}
+	t.refreshView()
+}
+
+/*
+	Adds the results of the smoke check of a render to its reload,
+	unless the reload left the history meanwhile
+*/
+func (t *Tracker) RecordSmokeCheck(renderId string, results []haproxy.SmokeResult) {
+	failed := false
+	for _, result := range results {
+		failed = failed || !result.Passed
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for i := range t.reloads {
+		if t.reloads[i].RenderId == renderId {
+			t.reloads[i].SmokeCheck = results
+			t.reloads[i].SmokeFailed = failed
+		}
+	}
+	if t.lastReload != nil && t.lastReload.RenderId == renderId {
+		reload := *t.lastReload
+		reload.SmokeCheck = results
+		reload.SmokeFailed = failed
+		t.lastReload = &reload
+	}
+	t.refreshView()
+}
+
+// Returns the latest render and reload outcomes, newest first
+func (t *Tracker) Reloads() []Reload {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	reloads := make([]Reload, len(t.reloads))
+	for i, reload := range t.reloads {
+		reloads[len(t.reloads)-1-i] = reload
+	}
+	return reloads
+}
+
+/*
+	Returns the latest render and reload outcome, nil before the first
+	update
+*/
+func (t *Tracker) LastReload() *Reload {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.lastReload == nil {
+		return nil
+	}
+	reload := *t.lastReload
+	return &reload
+}
+
+func HashConfig(content string) string {
+	sum := sha1.Sum([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,215 @@
+package state
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/QubitProducts/bamboo/services/haproxy"
+)
+
+// Number of changes kept for the change feed
+const DefaultChangeLogSize = 10000
+
+/*
+	Tracks the revision of the template data. The revision is bumped
+	whenever the data fetched by the update loop effectively changes.
+*/
+type Tracker struct {
+	lock     sync.Mutex
+	revision int64
+	hash     string
+	// closed and replaced on every revision bump to wake up watchers
+	changed chan struct{}
+
+	data haproxy.TemplateData
+	// Bounded change log, oldest first
+	changes       []Change
+	changeLogSize int
+	// Latest revision whose changes were partly or fully discarded
+	droppedRevision int64
+	// When the tasks of each app last changed, by app id
+	backendChanges map[string]time.Time
+
+	lastReload *Reload
+	// Bounded reload history, oldest first
+	reloads []Reload
+
+	view View
+	// closed and replaced on every rebuild of the view
+	viewChanged chan struct{}
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		changed:        make(chan struct{}),
+		changes:        []Change{},
+		changeLogSize:  DefaultChangeLogSize,
+		backendChanges: map[string]time.Time{},
+		viewChanged:    make(chan struct{}),
+	}
+}
+
+func (t *Tracker) Revision() int64 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.revision
+}
+
+/*
+	Records the latest template data, returns the current revision and
+	whether it was bumped. Data missing the apps or services, which are
+	nil when Marathon or Zookeeper could not be read, is not recorded,
+	so that outages do not show as every app and service removed.
+*/
+func (t *Tracker) Update(data haproxy.TemplateData) (int64, bool) {
+	if data.Apps == nil || data.Services == nil {
+		return t.Revision(), false
+	}
+	hash := hashData(data)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if hash == t.hash {
+		return t.revision, false
+	}
+
+	previous := t.data
+	t.hash = hash
+	t.data = data
+	t.revision++
+	t.recordChanges(diffData(previous, data))
+	t.refreshView()
+	close(t.changed)
+	t.changed = make(chan struct{})
+	return t.revision, true
+}
+
+/*
+	Returns the current revision and the template data it was
+	recorded for
+*/
+func (t *Tracker) Data() (int64, haproxy.TemplateData) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.revision, t.data
+}
+
+/*
+	Blocks until the revision is greater than since or the timeout
+	expires, and returns the current revision
+*/
+func (t *Tracker) Wait(since int64, timeout time.Duration) int64 {
+	deadline := time.After(timeout)
+	for {
+		t.lock.Lock()
+		revision, changed := t.revision, t.changed
+		t.lock.Unlock()
+
+		if revision > since {
+			return revision
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return revision
+		}
+	}
+}
+
+/*
+	Returns the changes after the given revision
+*/
+func (t *Tracker) ChangesSince(since int64) ChangeFeed {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	feed := ChangeFeed{Revision: t.revision, Changes: []Change{}}
+	feed.Truncated = since < t.droppedRevision
+
+	for _, change := range t.changes {
+		if change.Revision > since {
+			feed.Changes = append(feed.Changes, change)
+		}
+	}
+	return feed
+}
+
+func (t *Tracker) recordChanges(changes []Change) {
+	now := time.Now()
+	for i := range changes {
+		changes[i].Revision = t.revision
+		changes[i].Timestamp = now
+	}
+	t.changes = append(t.changes, changes...)
+	t.recordBackendChanges(changes, now)
+
+	if overflow := len(t.changes) - t.changeLogSize; overflow > 0 {
+		t.droppedRevision = t.changes[overflow-1].Revision
+		t.changes = append([]Change{}, t.changes[overflow:]...)
+	}
+}
+
+/*
+	Records when the tasks of apps changed. Apps appearing count as a
+	change, so apps seen since the start have the time Bamboo first
+	saw them.
+*/
+func (t *Tracker) recordBackendChanges(changes []Change, at time.Time) {
+	for _, change := range changes {
+		switch {
+		case change.Type == ChangeTask:
+			t.backendChanges[change.AppId] = at
+		case change.Type == ChangeApp && change.Action == ActionAdded:
+			t.backendChanges[change.Id] = at
+		}
+	}
+	// removed apps come last, after the changes of their tasks
+	for _, change := range changes {
+		if change.Type == ChangeApp && change.Action == ActionRemoved {
+			delete(t.backendChanges, change.Id)
+		}
+	}
+}
+
+/*
+	Returns when the tasks of each current app last changed, by app id
+*/
+func (t *Tracker) BackendChanges() map[string]time.Time {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	changes := map[string]time.Time{}
+	for appId, at := range t.backendChanges {
+		changes[appId] = at
+	}
+	return changes
+}
+
+type changesById []Change
+
+func (c changesById) Len() int { return len(c) }
+func (c changesById) Less(i, j int) bool {
+	if c[i].Type != c[j].Type {
+		return c[i].Type < c[j].Type
+	}
+	if c[i].AppId != c[j].AppId {
+		return c[i].AppId < c[j].AppId
+	}
+	return c[i].Id < c[j].Id
+}
+func (c changesById) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+
+func sortChanges(changes []Change) {
+	sort.Sort(changesById(changes))
+}
+
+func hashData(data haproxy.TemplateData) string {
+	content, _ := json.Marshal(data)
+	sum := sha1.Sum(content)
+	return hex.EncodeToString(sum[:])
+}
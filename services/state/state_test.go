@@ -0,0 +1,222 @@
+package state
+
+import (
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+
+	"github.com/QubitProducts/bamboo/services/haproxy"
+	"github.com/QubitProducts/bamboo/services/marathon"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+func templateData(appIds ...string) haproxy.TemplateData {
+	apps := marathon.AppList{}
+	for _, id := range appIds {
+		apps = append(apps, marathon.App{Id: id})
+	}
+	return haproxy.TemplateData{Apps: apps, Services: map[string]service.Service{}}
+}
+
+func TestTracker(t *testing.T) {
+	Convey("#Update", t, func() {
+		tracker := NewTracker()
+
+		Convey("should bump the revision on effective changes only", func() {
+			revision, bumped := tracker.Update(templateData("/a"))
+			So(revision, ShouldEqual, 1)
+			So(bumped, ShouldBeTrue)
+
+			revision, bumped = tracker.Update(templateData("/a"))
+			So(revision, ShouldEqual, 1)
+			So(bumped, ShouldBeFalse)
+		})
+
+		Convey("should not record data Marathon or Zookeeper could not be read for", func() {
+			tracker.Update(templateData("/a"))
+
+			failed := templateData()
+			failed.Apps = nil
+			revision, bumped := tracker.Update(failed)
+			So(revision, ShouldEqual, 1)
+			So(bumped, ShouldBeFalse)
+			failed = templateData("/a")
+			failed.Services = nil
+			_, bumped = tracker.Update(failed)
+			So(bumped, ShouldBeFalse)
+			So(len(tracker.ChangesSince(0).Changes), ShouldEqual, 1)
+		})
+
+		Convey("should record app changes", func() {
+			tracker.Update(templateData("/a", "/b"))
+			tracker.Update(templateData("/b", "/c"))
+
+			feed := tracker.ChangesSince(1)
+			So(feed.Revision, ShouldEqual, 2)
+			So(feed.Truncated, ShouldBeFalse)
+			So(len(feed.Changes), ShouldEqual, 2)
+			So(feed.Changes[0].Id, ShouldEqual, "/a")
+			So(feed.Changes[0].Action, ShouldEqual, ActionRemoved)
+			So(feed.Changes[1].Id, ShouldEqual, "/c")
+			So(feed.Changes[1].Action, ShouldEqual, ActionAdded)
+		})
+
+		Convey("should record when the tasks of apps changed", func() {
+			tracker.Update(templateData("/a", "/b"))
+			first := tracker.BackendChanges()
+			So(len(first), ShouldEqual, 2)
+
+			data := templateData("/a", "/c")
+			data.Apps[0].Tasks = []marathon.Task{{Host: "10.0.0.1", Port: 31000}}
+			tracker.Update(data)
+			changes := tracker.BackendChanges()
+			So(changes["/a"], ShouldHappenAfter, first["/a"])
+			So(changes["/c"], ShouldHappenAfter, first["/b"])
+			_, exists := changes["/b"]
+			So(exists, ShouldBeFalse)
+		})
+
+		Convey("should flag truncated feeds", func() {
+			tracker.changeLogSize = 1
+			tracker.Update(templateData("/a"))
+			tracker.Update(templateData("/b"))
+
+			So(tracker.ChangesSince(0).Truncated, ShouldBeTrue)
+			So(tracker.ChangesSince(2).Truncated, ShouldBeFalse)
+		})
+	})
+
+	Convey("#Wait", t, func() {
+		tracker := NewTracker()
+
+		Convey("should return once the revision moves past since", func() {
+			go tracker.Update(templateData("/a"))
+			So(tracker.Wait(0, time.Second), ShouldEqual, 1)
+		})
+
+		Convey("should return the current revision on timeout", func() {
+			So(tracker.Wait(0, time.Millisecond), ShouldEqual, 0)
+		})
+	})
+
+	Convey("#DeltaSince", t, func() {
+		tracker := NewTracker()
+
+		Convey("should return the net changes after since", func() {
+			tracker.Update(templateData("/a", "/b"))
+			tracker.Update(templateData("/b", "/c"))
+			tracker.Update(templateData("/b", "/d"))
+
+			delta := tracker.DeltaSince(1)
+			So(delta.Revision, ShouldEqual, 3)
+			So(delta.Truncated, ShouldBeFalse)
+			So(delta.Apps.Removed, ShouldResemble, []string{"/a"})
+			So(len(delta.Apps.Added), ShouldEqual, 1)
+			So(delta.Apps.Added[0].Id, ShouldEqual, "/d")
+		})
+
+		Convey("should flag deltas past the discarded changes as truncated", func() {
+			tracker.changeLogSize = 1
+			tracker.Update(templateData("/a"))
+			tracker.Update(templateData("/b"))
+
+			So(tracker.DeltaSince(0).Truncated, ShouldBeTrue)
+			So(tracker.DeltaSince(2).Truncated, ShouldBeFalse)
+		})
+
+		Convey("should flag revisions ahead of the tracker as truncated", func() {
+			tracker.Update(templateData("/a"))
+
+			delta := tracker.DeltaSince(5)
+			So(delta.Truncated, ShouldBeTrue)
+			So(delta.Revision, ShouldEqual, 1)
+		})
+	})
+
+	Convey("#LastReload", t, func() {
+		tracker := NewTracker()
+
+		Convey("should be nil before the first update", func() {
+			So(tracker.LastReload(), ShouldBeNil)
+		})
+
+		Convey("should return the recorded outcome", func() {
+			tracker.RecordReload(Reload{RenderId: "render-1", Success: true})
+			So(tracker.LastReload().RenderId, ShouldEqual, "render-1")
+			So(tracker.LastReload().Success, ShouldBeTrue)
+		})
+	})
+
+	Convey("#Reloads", t, func() {
+		tracker := NewTracker()
+
+		Convey("should return the history newest first", func() {
+			tracker.RecordReload(Reload{RenderId: "render-1"})
+			tracker.RecordReload(Reload{RenderId: "render-2", Rejected: true})
+			reloads := tracker.Reloads()
+			So(len(reloads), ShouldEqual, 2)
+			So(reloads[0].RenderId, ShouldEqual, "render-2")
+			So(reloads[0].Rejected, ShouldBeTrue)
+		})
+
+		Convey("should be bounded", func() {
+			for i := 0; i < reloadHistorySize+5; i++ {
+				tracker.RecordReload(Reload{Revision: int64(i)})
+			}
+			reloads := tracker.Reloads()
+			So(len(reloads), ShouldEqual, reloadHistorySize)
+			So(reloads[len(reloads)-1].Revision, ShouldEqual, 5)
+		})
+	})
+
+	Convey("#RecordSmokeCheck", t, func() {
+		tracker := NewTracker()
+
+		Convey("should add the results to the reload of the render", func() {
+			tracker.RecordReload(Reload{RenderId: "render-1", Success: true})
+			tracker.RecordReload(Reload{RenderId: "render-2", Success: true})
+			tracker.RecordSmokeCheck("render-1", []haproxy.SmokeResult{{Url: "/a", Passed: true}, {Url: "/b"}})
+			reloads := tracker.Reloads()
+			So(reloads[0].SmokeCheck, ShouldBeNil)
+			So(len(reloads[1].SmokeCheck), ShouldEqual, 2)
+			So(reloads[1].SmokeFailed, ShouldBeTrue)
+			So(tracker.LastReload().SmokeFailed, ShouldBeFalse)
+		})
+	})
+
+	Convey("#View", t, func() {
+		tracker := NewTracker()
+
+		Convey("should join apps with their services", func() {
+			data := templateData("/routed", "/unmapped")
+			data.Apps[0].Tasks = []marathon.Task{{Host: "10.0.0.1", Port: 31000}}
+			data.Services["/routed"] = service.Service{Id: "/routed", Acl: "hdr(host) -i routed.example.com"}
+			data.Services["/gone"] = service.Service{Id: "/gone"}
+			tracker.Update(data)
+
+			view := tracker.View()
+			So(view.Revision, ShouldEqual, 1)
+			So(len(view.Rows), ShouldEqual, 3)
+			So(view.Rows[0].Id, ShouldEqual, "/gone")
+			So(view.Rows[0].Status, ShouldEqual, ViewMissingApp)
+			So(view.Rows[0].App, ShouldBeNil)
+			So(view.Rows[1].Id, ShouldEqual, "/unmapped")
+			So(view.Rows[1].Status, ShouldEqual, ViewDefaultRule)
+			So(view.Rows[2].Status, ShouldEqual, ViewRouted)
+			So(view.Rows[2].Tasks, ShouldEqual, 1)
+			So(view.Rows[2].Service.Acl, ShouldEqual, "hdr(host) -i routed.example.com")
+			So(view.Rows[2].BackendChanged, ShouldNotBeNil)
+		})
+
+		Convey("should bump the version on reloads", func() {
+			tracker.Update(templateData("/a"))
+			version := tracker.View().Version
+
+			go tracker.RecordReload(Reload{RenderId: "render-1", Revision: 1})
+			view := tracker.WaitView(version, time.Second)
+			So(view.Version, ShouldEqual, version+1)
+			So(view.Revision, ShouldEqual, 1)
+			So(view.LastReload.RenderId, ShouldEqual, "render-1")
+		})
+	})
+}
@@ -0,0 +1,133 @@
+package state
+
+import (
+	"sort"
+	"time"
+
+	"github.com/QubitProducts/bamboo/services/haproxy"
+	"github.com/QubitProducts/bamboo/services/marathon"
+	"github.com/QubitProducts/bamboo/services/service"
+)
+
+// Status of an app or service in the view
+const (
+	// App routed by its service
+	ViewRouted = "routed"
+	// App without service, routed by the default rule
+	ViewDefaultRule = "default-rule"
+	// Service without app in Marathon
+	ViewMissingApp = "missing-app"
+)
+
+/*
+	Apps joined with their services and the latest reload, rebuilt by
+	the update loop so that readers never fetch Marathon or Zookeeper.
+	The version is bumped on every rebuild, including reloads that
+	leave the revision unchanged.
+*/
+type View struct {
+	Version    int64
+	Revision   int64
+	Rows       []ViewRow
+	LastReload *Reload
+}
+
+type ViewRow struct {
+	Id      string
+	Status  string
+	App     *marathon.App    `json:",omitempty"`
+	Service *service.Service `json:",omitempty"`
+	Tasks   int
+	// When the tasks of the app last changed
+	BackendChanged *time.Time `json:",omitempty"`
+}
+
+/*
+	Returns the current view. Rows are sorted by status, apps missing
+	in Marathon and apps without service first, then by id.
+*/
+func (t *Tracker) View() View {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.view
+}
+
+/*
+	Blocks until the view version is greater than since or the timeout
+	expires, and returns the current view
+*/
+func (t *Tracker) WaitView(since int64, timeout time.Duration) View {
+	deadline := time.After(timeout)
+	for {
+		t.lock.Lock()
+		view, changed := t.view, t.viewChanged
+		t.lock.Unlock()
+
+		if view.Version > since {
+			return view
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return view
+		}
+	}
+}
+
+// Rebuilds the view, called with the lock held
+func (t *Tracker) refreshView() {
+	view := buildView(t.data, t.backendChanges)
+	view.Version = t.view.Version + 1
+	view.Revision = t.revision
+	if t.lastReload != nil {
+		reload := *t.lastReload
+		view.LastReload = &reload
+	}
+	t.view = view
+	close(t.viewChanged)
+	t.viewChanged = make(chan struct{})
+}
+
+func buildView(data haproxy.TemplateData, backendChanges map[string]time.Time) View {
+	rows := []ViewRow{}
+	for i := range data.Apps {
+		app := data.Apps[i]
+		row := ViewRow{Id: app.Id, Status: ViewDefaultRule, App: &app, Tasks: len(app.Tasks)}
+		if serviceModel, ok := data.Services[app.Id]; ok {
+			row.Status = ViewRouted
+			row.Service = &serviceModel
+		}
+		if changed, ok := backendChanges[app.Id]; ok {
+			row.BackendChanged = &changed
+		}
+		rows = append(rows, row)
+	}
+
+	apps := map[string]bool{}
+	for _, app := range data.Apps {
+		apps[app.Id] = true
+	}
+	for id, serviceModel := range data.Services {
+		if !apps[id] {
+			serviceModel := serviceModel
+			rows = append(rows, ViewRow{Id: id, Status: ViewMissingApp, Service: &serviceModel})
+		}
+	}
+
+	sort.Sort(viewRowsByStatus(rows))
+	return View{Rows: rows}
+}
+
+var viewStatusOrder = map[string]int{ViewMissingApp: 0, ViewDefaultRule: 1, ViewRouted: 2}
+
+type viewRowsByStatus []ViewRow
+
+func (v viewRowsByStatus) Len() int { return len(v) }
+func (v viewRowsByStatus) Less(i, j int) bool {
+	if v[i].Status != v[j].Status {
+		return viewStatusOrder[v[i].Status] < viewStatusOrder[v[j].Status]
+	}
+	return v[i].Id < v[j].Id
+}
+func (v viewRowsByStatus) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
@@ -0,0 +1,130 @@
+package template
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	PhaseParse   = "parse"
+	PhaseExecute = "execute"
+	PhaseLimit   = "limit"
+)
+
+// Render guards, zero values disable the corresponding limit
+type Limits struct {
+	Timeout       time.Duration
+	MaxOutputSize int
+}
+
+// Template error with its position in the template when known
+type RenderError struct {
+	Phase   string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *RenderError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s error at line %d: %s", e.Phase, e.Line, e.Message)
+	}
+	return fmt.Sprintf("%s error: %s", e.Phase, e.Message)
+}
+
+var errOutputTooLarge = errors.New("output size limit exceeded")
+var errRenderCancelled = errors.New("render timeout exceeded")
+
+// text/template errors read "template: <name>:<line>[:<column>]: <message>"
+var templateErrorPattern = regexp.MustCompile(`^template: [^:]*:(\d+)(?::(\d+))?: (.*)$`)
+
+/*
+	Writer failing once the output size limit is exceeded or the render
+	has been cancelled, which aborts the template execution
+*/
+type limitedWriter struct {
+	buffer    bytes.Buffer
+	limit     int
+	cancelled int32
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if atomic.LoadInt32(&w.cancelled) == 1 {
+		return 0, errRenderCancelled
+	}
+	if w.limit > 0 && w.buffer.Len()+len(p) > w.limit {
+		return 0, errOutputTooLarge
+	}
+	return w.buffer.Write(p)
+}
+
+/*
+	Renders a template like RenderTemplate within the given limits.
+	Errors are returned as *RenderError. A template still running when
+	the timeout expires is abandoned; it stops at its next output.
+*/
+func RenderTemplateWithLimits(templateName string, templateContent string, data interface{}, limits Limits) (string, error) {
+	tpl, err := parseTemplate(templateName, templateContent)
+	if err != nil {
+		return "", newRenderError(PhaseParse, err)
+	}
+
+	writer := &limitedWriter{limit: limits.MaxOutputSize}
+	done := make(chan error, 1)
+	go func() {
+		done <- tpl.Execute(writer, data)
+	}()
+
+	var timeout <-chan time.Time
+	if limits.Timeout > 0 {
+		timeout = time.After(limits.Timeout)
+	}
+
+	select {
+	case err = <-done:
+	case <-timeout:
+		atomic.StoreInt32(&writer.cancelled, 1)
+		return "", &RenderError{Phase: PhaseLimit, Message: fmt.Sprintf("rendering took longer than %s", limits.Timeout)}
+	}
+
+	if err != nil {
+		if isLimitError(err) {
+			return "", &RenderError{Phase: PhaseLimit, Message: fmt.Sprintf("output is larger than %d bytes", limits.MaxOutputSize)}
+		}
+		return "", newRenderError(PhaseExecute, err)
+	}
+	return writer.buffer.String(), nil
+}
+
+func isLimitError(err error) bool {
+	// text/template wraps writer errors
+	return err == errOutputTooLarge || strings.Contains(err.Error(), errOutputTooLarge.Error())
+}
+
+func newRenderError(phase string, err error) *RenderError {
+	renderError := &RenderError{Phase: phase, Message: err.Error()}
+	match := templateErrorPattern.FindStringSubmatch(err.Error())
+	if match != nil {
+		renderError.Line, _ = strconv.Atoi(match[1])
+		renderError.Column, _ = strconv.Atoi(match[2])
+		renderError.Message = match[3]
+	}
+	return renderError
+}
+
+/*
+	Parses a template without rendering it, errors are *RenderError
+*/
+func ValidateTemplate(templateName string, templateContent string) error {
+	_, err := parseTemplate(templateName, templateContent)
+	if err != nil {
+		return newRenderError(PhaseParse, err)
+	}
+	return nil
+}
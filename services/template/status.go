@@ -0,0 +1,57 @@
+package template
+
+import (
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+/*
+	Whether the HAProxy template parses, checked at startup and on
+	every render. Bamboo is degraded while the template is invalid: it
+	keeps serving its APIs but leaves the running configuration alone.
+*/
+type Status struct {
+	Path    string
+	Valid   bool
+	Error   *RenderError `json:",omitempty"`
+	Checked time.Time
+}
+
+var statusLock sync.RWMutex
+var currentStatus = Status{Valid: true}
+
+func CurrentStatus() Status {
+	statusLock.RLock()
+	defer statusLock.RUnlock()
+	return currentStatus
+}
+
+/*
+	Reads and parses the template, recording the result as the current
+	status
+*/
+func CheckTemplate(path string) Status {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return RecordParse(path, &RenderError{Phase: PhaseParse, Message: err.Error()})
+	}
+	return RecordParse(path, ValidateTemplate(path, string(content)))
+}
+
+/*
+	Records the outcome of a render or validation. Only parse errors make
+	the template invalid, templates failing while executing did parse.
+*/
+func RecordParse(path string, err error) Status {
+	status := Status{Path: path, Valid: true, Checked: time.Now()}
+	if renderError, ok := err.(*RenderError); ok && renderError.Phase == PhaseParse {
+		status.Valid = false
+		status.Error = renderError
+	}
+
+	statusLock.Lock()
+	defer statusLock.Unlock()
+	currentStatus = status
+	return status
+}
@@ -0,0 +1,51 @@
+package template
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestTemplateStatus(t *testing.T) {
+	Convey("#CheckTemplate", t, func() {
+		file, _ := ioutil.TempFile("", "haproxy_template")
+		file.Close()
+		Reset(func() {
+			os.Remove(file.Name())
+			RecordParse("", nil)
+		})
+
+		Convey("should be valid for parsing templates", func() {
+			ioutil.WriteFile(file.Name(), []byte("{{ range .Apps }}{{ .Id }}{{ end }}"), 0644)
+			status := CheckTemplate(file.Name())
+			So(status.Valid, ShouldBeTrue)
+			So(status.Error, ShouldBeNil)
+		})
+
+		Convey("should record parse errors with their line", func() {
+			ioutil.WriteFile(file.Name(), []byte("global\n{{ range .Apps }"), 0644)
+			status := CheckTemplate(file.Name())
+			So(status.Valid, ShouldBeFalse)
+			So(status.Error.Line, ShouldEqual, 2)
+			So(CurrentStatus().Valid, ShouldBeFalse)
+		})
+
+		Convey("should be invalid when the template can not be read", func() {
+			os.Remove(file.Name())
+			So(CheckTemplate(file.Name()).Valid, ShouldBeFalse)
+		})
+	})
+
+	Convey("#RecordParse", t, func() {
+		Reset(func() { RecordParse("", nil) })
+
+		Convey("should keep templates failing while executing valid", func() {
+			RecordParse("haproxy_template.cfg", &RenderError{Phase: PhaseParse, Message: "unexpected EOF"})
+			So(RecordParse("haproxy_template.cfg", &RenderError{Phase: PhaseExecute, Message: "nil pointer"}).Valid, ShouldBeTrue)
+			So(RecordParse("haproxy_template.cfg", errors.New("render failed by fault injection")).Valid, ShouldBeTrue)
+		})
+	})
+}
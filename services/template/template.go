@@ -2,7 +2,13 @@ package template
 
 import (
 	"bytes"
+	"fmt"
+	"sort"
+	"strings"
 	"text/template"
+	"time"
+	"github.com/QubitProducts/bamboo/services/jwt"
+	"github.com/QubitProducts/bamboo/services/marathon"
 	"github.com/QubitProducts/bamboo/services/service"
 )
 
@@ -16,17 +22,247 @@ func getService(data map[string]service.Service, appId string) service.Service {
 	return serviceModel
 }
 
+/*
+	Returns the tasks running on agents with the given attribute value,
+	e.g. {{ range tasksWithAttribute $app.Tasks "edge" "true" }}
+*/
+func tasksWithAttribute(tasks []marathon.Task, name string, value string) []marathon.Task {
+	matching := []marathon.Task{}
+	for _, task := range tasks {
+		if attribute, ok := task.Attributes[name]; ok && attribute == value {
+			matching = append(matching, task)
+		}
+	}
+	return matching
+}
+
+/*
+	Returns the value of the first app constraint on the given field
+*/
+func getConstraint(app marathon.App, field string) string {
+	for _, constraint := range app.Constraints {
+		if constraint.Field == field {
+			return constraint.Value
+		}
+	}
+	return ""
+}
+
+/*
+	Returns the HTTP check path of an app, the service health check
+	override takes precedence over the Marathon health check
+*/
+func healthCheckPath(app marathon.App, serviceModel service.Service) string {
+	if serviceModel.HealthCheck != nil {
+		return serviceModel.HealthCheck.Path
+	}
+	return app.HealthCheckPath
+}
+
+/*
+	Returns the HAProxy server check options of an app, e.g.
+	"check port 8080 inter 5000 rise 2 fall 3"
+*/
+func checkOptions(app marathon.App, serviceModel service.Service) string {
+	check := serviceModel.HealthCheck
+	if check == nil {
+		if len(app.HealthCheckPath) > 0 {
+			return "check inter 30000"
+		}
+		return ""
+	}
+
+	options := "check"
+	if check.Port > 0 {
+		options += fmt.Sprintf(" port %d", check.Port)
+	}
+	if check.Interval > 0 {
+		options += fmt.Sprintf(" inter %d", check.Interval)
+	} else {
+		options += " inter 30000"
+	}
+	if check.Rise > 0 {
+		options += fmt.Sprintf(" rise %d", check.Rise)
+	}
+	if check.Fall > 0 {
+		options += fmt.Sprintf(" fall %d", check.Fall)
+	}
+	return options
+}
+
+/*
+	Returns the HAProxy server limit options of an app, e.g.
+	"maxconn 100 maxqueue 20"
+*/
+func limitOptions(app marathon.App) string {
+	options := []string{}
+	if app.MaxConn > 0 {
+		options = append(options, fmt.Sprintf("maxconn %d", app.MaxConn))
+	}
+	if app.MaxQueue > 0 {
+		options = append(options, fmt.Sprintf("maxqueue %d", app.MaxQueue))
+	}
+	return strings.Join(options, " ")
+}
+
+/*
+	Returns the http-request rules denying requests without a valid
+	bearer token for services requiring a JWT. HAProxy 2.5+ verifies
+	tokens natively, older versions through the jwtverify Lua script
+	of haproxy-lua-jwt, which must be loaded and configured globally.
+*/
+func jwtRules(serviceModel service.Service, keys []jwt.Key, native bool) string {
+	requirement := serviceModel.Jwt
+	if requirement == nil {
+		return ""
+	}
+	if !native {
+		return strings.Join([]string{
+			"http-request lua.jwtverify",
+			"http-request deny deny_status 401 unless { var(txn.authorized) -m bool }",
+		}, directiveSeparator)
+	}
+
+	rules := []string{
+		"http-request set-var(txn.jwt) http_auth_bearer",
+		"http-request set-var(txn.jwt_alg) var(txn.jwt),jwt_header_query('$.alg')",
+		"http-request set-var(txn.jwt_kid) var(txn.jwt),jwt_header_query('$.kid')",
+		"http-request set-var(txn.jwt_exp) var(txn.jwt),jwt_payload_query('$.exp','int')",
+		"http-request set-var(txn.now) date()",
+		"http-request deny deny_status 401 unless { var(txn.jwt_alg) -m str " + requirement.EffectiveAlgorithm() + " }",
+	}
+	if len(requirement.Issuer) > 0 {
+		rules = append(rules, "http-request deny deny_status 401 unless { var(txn.jwt),jwt_payload_query('$.iss') -m str "+requirement.Issuer+" }")
+	}
+	if len(requirement.Audience) > 0 {
+		rules = append(rules, "http-request deny deny_status 401 unless { var(txn.jwt),jwt_payload_query('$.aud') -m str "+requirement.Audience+" }")
+	}
+	rules = append(rules,
+		"http-request deny deny_status 401 unless { var(txn.jwt_exp) -m found }",
+		"http-request deny deny_status 401 if { var(txn.jwt_exp),sub(txn.now) -m int lt 0 }",
+	)
+
+	switch {
+	case len(keys) == 0:
+		// the key set could never be fetched
+		rules = append(rules, "http-request deny deny_status 401")
+	case len(keys[0].Kid) == 0:
+		rules = append(rules, fmt.Sprintf("http-request deny deny_status 401 unless { var(txn.jwt),jwt_verify(txn.jwt_alg,%q) -m int 1 }", keys[0].Path))
+	default:
+		kids := []string{}
+		for _, key := range keys {
+			kids = append(kids, key.Kid)
+		}
+		rules = append(rules, "http-request deny deny_status 401 unless { var(txn.jwt_kid) -m str "+strings.Join(kids, " ")+" }")
+		for _, key := range keys {
+			rules = append(rules, fmt.Sprintf("http-request deny deny_status 401 if { var(txn.jwt_kid) -m str %s } !{ var(txn.jwt),jwt_verify(txn.jwt_alg,%q) -m int 1 }", key.Kid, key.Path))
+		}
+	}
+	return strings.Join(rules, directiveSeparator)
+}
+
+/*
+	Returns the directives running the Lua hooks of a service, e.g.
+	"http-request lua.route"
+*/
+func luaHooks(serviceModel service.Service) string {
+	directives := []string{}
+	for _, hook := range serviceModel.Lua {
+		directive := "http-" + hook.Phase + " lua." + hook.Action
+		if len(hook.Args) > 0 {
+			directive += " " + strings.Join(hook.Args, " ")
+		}
+		directives = append(directives, directive)
+	}
+	return strings.Join(directives, directiveSeparator)
+}
+
+/*
+	Returns the log directives of a service for sections receiving its
+	requests, e.g. its TCP listener:
+	"log 10.0.0.10:514 sample 1:10 local0 info"
+*/
+func logDirectives(serviceModel service.Service) string {
+	logging := serviceModel.Logging
+	if logging == nil {
+		return ""
+	}
+	directives := []string{}
+	if len(logging.Target) > 0 {
+		directives = append(directives, "no log")
+		directive := "log " + logging.Target
+		if logging.SampleRate > 0 && logging.SampleRate < 100 {
+			// sample <ranges>:<size>, e.g. 1-25:100 logs a quarter
+			directive += fmt.Sprintf(" sample 1-%d:100", logging.SampleRate)
+		}
+		directive += " " + logging.EffectiveFacility()
+		if len(logging.Level) > 0 {
+			directive += " " + logging.Level
+		}
+		directives = append(directives, directive)
+	}
+	if len(logging.Format) > 0 {
+		directives = append(directives, fmt.Sprintf("log-format \"%s\"", logging.Format))
+	}
+	return strings.Join(directives, directiveSeparator)
+}
+
+/*
+	Returns the backend rules sampling the logged requests of a service
+	received by shared frontends
+*/
+func logSampling(serviceModel service.Service) string {
+	logging := serviceModel.Logging
+	if logging == nil || logging.SampleRate <= 0 || logging.SampleRate >= 100 {
+		return ""
+	}
+	return fmt.Sprintf("http-request set-log-level silent unless { rand(100) lt %d }", logging.SampleRate)
+}
+
+/*
+	Returns the metadata of a service rendered as comments above its
+	rules and backend, e.g. "owner: payments@example.com", so that a
+	rule of haproxy.cfg can be traced back to its source
+*/
+func annotations(serviceModel service.Service) []string {
+	lines := []string{}
+	if owner := serviceModel.Owner; owner != nil {
+		contacts := []string{}
+		for _, contact := range []string{owner.Email, owner.Webhook} {
+			if len(contact) > 0 {
+				contacts = append(contacts, contact)
+			}
+		}
+		lines = append(lines, "owner: "+strings.Join(contacts, ", "))
+	}
+	if len(serviceModel.Ticket) > 0 {
+		lines = append(lines, "ticket: "+serviceModel.Ticket)
+	}
+	if serviceModel.Changed != nil {
+		lines = append(lines, "changed: "+serviceModel.Changed.UTC().Format(time.RFC3339))
+	}
+	for i, line := range lines {
+		// a line break would end the comment
+		lines[i] = strings.NewReplacer("\r", " ", "\n", " ").Replace(line)
+	}
+	return lines
+}
+
+// Directives are rendered at the indentation of backend directives
+const directiveSeparator = "\n        "
+
 /*
 	Returns string content of a rendered template
 */
 func RenderTemplate(templateName string, templateContent string, data interface{}) (string, error) {
-	funcMap := template.FuncMap{ "hasKey": hasKey,  "getService": getService }
-
-	tpl := template.Must(template.New(templateName).Funcs(funcMap).Parse(templateContent))
+	tpl, err := parseTemplate(templateName, templateContent)
+	if err != nil {
+		return "", err
+	}
 
 	strBuffer := new(bytes.Buffer)
 
-	err := tpl.Execute(strBuffer, data)
+	err = tpl.Execute(strBuffer, data)
 	if err != nil {
 		return "", err
 	}
@@ -34,3 +270,32 @@ func RenderTemplate(templateName string, templateContent string, data interface{
 	return strBuffer.String(), nil
 }
 
+// Helper functions available to templates
+var funcMap = template.FuncMap{
+	"hasKey":             hasKey,
+	"getService":         getService,
+	"tasksWithAttribute": tasksWithAttribute,
+	"getConstraint":      getConstraint,
+	"healthCheckPath":    healthCheckPath,
+	"checkOptions":       checkOptions,
+	"limitOptions":       limitOptions,
+	"jwtRules":           jwtRules,
+	"luaHooks":           luaHooks,
+	"logDirectives":      logDirectives,
+	"logSampling":        logSampling,
+	"annotations":        annotations,
+}
+
+// Returns the names of the helper functions, sorted
+func FunctionNames() []string {
+	names := []string{}
+	for name := range funcMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func parseTemplate(templateName string, templateContent string) (*template.Template, error) {
+	return template.New(templateName).Funcs(funcMap).Parse(templateContent)
+}
@@ -3,6 +3,10 @@ package template
 import (
 	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
 	"testing"
+	"time"
+
+	"github.com/QubitProducts/bamboo/services/jwt"
+	"github.com/QubitProducts/bamboo/services/service"
 )
 
 func TestTemplateWriter(t *testing.T) {
@@ -17,3 +21,120 @@ func TestTemplateWriter(t *testing.T) {
 		})
 	})
 }
+
+func TestRenderTemplateWithLimits(t *testing.T) {
+	Convey("#RenderTemplateWithLimits", t, func() {
+		limits := Limits{Timeout: time.Second, MaxOutputSize: 16}
+		params := map[string]interface{}{"id": "app", "ids": make([]int, 100)}
+
+		Convey("should render template as string", func() {
+			content, err := RenderTemplateWithLimits("preview", "{{.id}}", params, limits)
+			So(err, ShouldBeNil)
+			So(content, ShouldEqual, "app")
+		})
+
+		Convey("should report parse errors with line numbers", func() {
+			_, err := RenderTemplateWithLimits("preview", "line\n{{ .id }", params, limits)
+			So(err.(*RenderError).Phase, ShouldEqual, PhaseParse)
+			So(err.(*RenderError).Line, ShouldEqual, 2)
+		})
+
+		Convey("should fail when the output is too large", func() {
+			_, err := RenderTemplateWithLimits("preview", "{{ range .ids }}output{{ end }}", params, limits)
+			So(err.(*RenderError).Phase, ShouldEqual, PhaseLimit)
+		})
+	})
+}
+
+func TestJwtRules(t *testing.T) {
+	Convey("#jwtRules", t, func() {
+		serviceModel := service.Service{Jwt: &service.Jwt{Issuer: "https://auth.example.com/", JwksUrl: "https://auth.example.com/jwks"}}
+		keys := []jwt.Key{{Kid: "k1", Path: "/etc/haproxy/jwt/app-k1.pem"}}
+
+		Convey("should verify tokens natively", func() {
+			rules := jwtRules(serviceModel, keys, true)
+			So(rules, ShouldContainSubstring, "unless { var(txn.jwt_alg) -m str RS256 }")
+			So(rules, ShouldContainSubstring, "jwt_payload_query('$.iss') -m str https://auth.example.com/ }")
+			So(rules, ShouldContainSubstring, "http-request deny deny_status 401 unless { var(txn.jwt_exp) -m found }")
+			So(rules, ShouldContainSubstring, `if { var(txn.jwt_kid) -m str k1 } !{ var(txn.jwt),jwt_verify(txn.jwt_alg,"/etc/haproxy/jwt/app-k1.pem") -m int 1 }`)
+		})
+
+		Convey("should deny every request without keys", func() {
+			So(jwtRules(serviceModel, nil, true), ShouldEndWith, "http-request deny deny_status 401")
+		})
+
+		Convey("should fall back to Lua before HAProxy 2.5", func() {
+			So(jwtRules(serviceModel, keys, false), ShouldStartWith, "http-request lua.jwtverify")
+		})
+
+		Convey("should render nothing without requirement", func() {
+			So(jwtRules(service.Service{}, keys, true), ShouldEqual, "")
+		})
+	})
+}
+
+func TestLuaHooks(t *testing.T) {
+	Convey("#luaHooks", t, func() {
+		Convey("should render an action per hook", func() {
+			serviceModel := service.Service{Lua: []service.LuaHook{
+				{Phase: "request", Action: "route", Args: []string{"canary"}},
+				{Phase: "response", Action: "headers"},
+			}}
+			So(luaHooks(serviceModel), ShouldEqual, "http-request lua.route canary\n        http-response lua.headers")
+		})
+	})
+}
+
+func TestLogDirectives(t *testing.T) {
+	Convey("#logDirectives", t, func() {
+		Convey("should replace the inherited log targets", func() {
+			serviceModel := service.Service{Logging: &service.Logging{Target: "10.0.0.10:514", Level: "info", Format: "%ci %ft %b", SampleRate: 10}}
+			So(logDirectives(serviceModel), ShouldEqual,
+				"no log\n        log 10.0.0.10:514 sample 1-10:100 local0 info\n        log-format \"%ci %ft %b\"")
+		})
+
+		Convey("should render nothing without logging", func() {
+			So(logDirectives(service.Service{}), ShouldEqual, "")
+		})
+	})
+
+	Convey("#logSampling", t, func() {
+		So(logSampling(service.Service{Logging: &service.Logging{SampleRate: 25}}), ShouldEqual,
+			"http-request set-log-level silent unless { rand(100) lt 25 }")
+		So(logSampling(service.Service{Logging: &service.Logging{Target: "/dev/log"}}), ShouldEqual, "")
+	})
+}
+
+func TestAnnotations(t *testing.T) {
+	Convey("#annotations", t, func() {
+		Convey("should render the metadata of the service", func() {
+			changed := time.Date(2016, 5, 24, 14, 0, 0, 0, time.FixedZone("CEST", 7200))
+			serviceModel := service.Service{
+				Owner:   &service.Owner{Email: "payments@example.com", Webhook: "https://hooks.example.com/bamboo"},
+				Ticket:  "https://jira.example.com/browse/OPS-42",
+				Changed: &changed,
+			}
+			So(annotations(serviceModel), ShouldResemble, []string{
+				"owner: payments@example.com, https://hooks.example.com/bamboo",
+				"ticket: https://jira.example.com/browse/OPS-42",
+				"changed: 2016-05-24T12:00:00Z",
+			})
+		})
+
+		Convey("should keep each annotation on one line", func() {
+			So(annotations(service.Service{Ticket: "OPS-42\nbackend evil"}), ShouldResemble, []string{"ticket: OPS-42 backend evil"})
+		})
+
+		Convey("should render nothing without metadata", func() {
+			So(annotations(service.Service{}), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestFunctionNames(t *testing.T) {
+	Convey("#FunctionNames", t, func() {
+		names := FunctionNames()
+		So(len(names), ShouldEqual, len(funcMap))
+		So(names[0], ShouldEqual, "annotations")
+	})
+}
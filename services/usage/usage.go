@@ -0,0 +1,238 @@
+package usage
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/atomicfile"
+	"github.com/QubitProducts/bamboo/services/haproxy"
+)
+
+// Counters of the running HAProxy the usage is sampled from
+type Source interface {
+	BackendStat() ([]haproxy.BackendStat, error)
+}
+
+// Usage of a backend during an hour
+type Bucket struct {
+	Start           time.Time
+	Requests        int64
+	BytesIn         int64
+	BytesOut        int64
+	Responses5xx    int64
+	PeakConnections int64
+}
+
+// Usage of a backend summed over the requested hours
+type Usage struct {
+	Backend      string
+	Requests     int64
+	BytesIn      int64
+	BytesOut     int64
+	Responses5xx int64
+	// Share of the requests answered with a 5xx response
+	ErrorRate       float64
+	PeakConnections int64
+	Hours           []Bucket `json:",omitempty"`
+}
+
+/*
+	Aggregates samples of the HAProxy counters into hourly buckets per
+	backend. Counters lower than in the previous sample were reset by
+	a reload and count from zero.
+*/
+type Recorder struct {
+	Config *conf.Configuration
+	Source Source
+
+	lock     sync.Mutex
+	previous map[string]haproxy.BackendStat
+	buckets  map[string][]Bucket
+}
+
+func NewRecorder(config *conf.Configuration) *Recorder {
+	return &Recorder{
+		Config:  config,
+		Source:  haproxy.RuntimeAPI{SocketPath: config.HAProxy.RuntimeSocket},
+		buckets: map[string][]Bucket{},
+	}
+}
+
+// Samples every interval, never returns
+func (r *Recorder) Run() {
+	if err := r.Load(); err != nil {
+		log.Printf("Unable to load backend usage: %s\n", err)
+	}
+	for {
+		time.Sleep(r.Config.HAProxy.Usage.IntervalDuration())
+		if err := r.Sample(time.Now()); err != nil {
+			log.Printf("Unable to record backend usage: %s\n", err)
+			r.Config.StatsD.Increment(1.0, "usage.failed", 1)
+		}
+	}
+}
+
+// Records the current counters and saves the usage when a path is set
+func (r *Recorder) Sample(now time.Time) error {
+	stats, err := r.Source.BackendStat()
+	if err != nil {
+		return err
+	}
+	r.Record(stats, now)
+	return r.Save()
+}
+
+/*
+	Adds the counters grown since the previous sample to the bucket of
+	the hour and drops buckets past the retention. The first sample of
+	a backend only serves as baseline.
+*/
+func (r *Recorder) Record(stats []haproxy.BackendStat, now time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.buckets == nil {
+		r.buckets = map[string][]Bucket{}
+	}
+
+	current := map[string]haproxy.BackendStat{}
+	hour := now.UTC().Truncate(time.Hour)
+	for _, stat := range stats {
+		current[stat.Backend] = stat
+		last, ok := r.previous[stat.Backend]
+		if !ok {
+			continue
+		}
+
+		buckets := r.buckets[stat.Backend]
+		if len(buckets) == 0 || !buckets[len(buckets)-1].Start.Equal(hour) {
+			buckets = append(buckets, Bucket{Start: hour})
+		}
+		bucket := &buckets[len(buckets)-1]
+		bucket.Requests += grown(last.Requests, stat.Requests)
+		bucket.BytesIn += grown(last.BytesIn, stat.BytesIn)
+		bucket.BytesOut += grown(last.BytesOut, stat.BytesOut)
+		bucket.Responses5xx += grown(last.Responses5xx, stat.Responses5xx)
+		if stat.Connections > bucket.PeakConnections {
+			bucket.PeakConnections = stat.Connections
+		}
+		r.buckets[stat.Backend] = buckets
+	}
+	r.previous = current
+	r.prune(now)
+}
+
+// Increase of a counter between samples
+func grown(last int64, current int64) int64 {
+	if current < last {
+		return current
+	}
+	return current - last
+}
+
+func (r *Recorder) prune(now time.Time) {
+	oldest := now.UTC().Truncate(time.Hour).Add(-r.Config.HAProxy.Usage.Retention())
+	for backend, buckets := range r.buckets {
+		kept := []Bucket{}
+		for _, bucket := range buckets {
+			if bucket.Start.After(oldest) {
+				kept = append(kept, bucket)
+			}
+		}
+		if len(kept) == 0 {
+			delete(r.buckets, backend)
+			continue
+		}
+		r.buckets[backend] = kept
+	}
+}
+
+/*
+	Returns the usage of every backend since the given time sorted by
+	backend, with the hourly buckets when hourly is set
+*/
+func (r *Recorder) Summary(since time.Time, hourly bool) []Usage {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	from := since.UTC().Truncate(time.Hour)
+	summary := []Usage{}
+	for backend, buckets := range r.buckets {
+		usage := Usage{Backend: backend}
+		for _, bucket := range buckets {
+			if bucket.Start.Before(from) {
+				continue
+			}
+			usage.Requests += bucket.Requests
+			usage.BytesIn += bucket.BytesIn
+			usage.BytesOut += bucket.BytesOut
+			usage.Responses5xx += bucket.Responses5xx
+			if bucket.PeakConnections > usage.PeakConnections {
+				usage.PeakConnections = bucket.PeakConnections
+			}
+			if hourly {
+				usage.Hours = append(usage.Hours, bucket)
+			}
+		}
+		if usage.Requests > 0 {
+			usage.ErrorRate = float64(usage.Responses5xx) / float64(usage.Requests)
+		}
+		summary = append(summary, usage)
+	}
+	sort.Sort(usageByBackend(summary))
+	return summary
+}
+
+// Reads the usage saved at the configured path, if any
+func (r *Recorder) Load() error {
+	path := r.Config.HAProxy.Usage.Path
+	if len(path) == 0 {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	buckets := map[string][]Bucket{}
+	if err := json.Unmarshal(data, &buckets); err != nil {
+		return err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.buckets = buckets
+	return nil
+}
+
+/*
+	Writes the usage to the configured path through a temporary file
+	renamed into place, so that a crash never leaves half a file
+*/
+func (r *Recorder) Save() error {
+	path := r.Config.HAProxy.Usage.Path
+	if len(path) == 0 {
+		return nil
+	}
+	r.lock.Lock()
+	data, err := json.Marshal(r.buckets)
+	r.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(path, data, 0600)
+}
+
+type usageByBackend []Usage
+
+func (u usageByBackend) Len() int           { return len(u) }
+func (u usageByBackend) Less(i, j int) bool { return u[i].Backend < u[j].Backend }
+func (u usageByBackend) Swap(i, j int)      { u[i], u[j] = u[j], u[i] }
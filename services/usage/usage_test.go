@@ -0,0 +1,80 @@
+package usage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/QubitProducts/bamboo/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	conf "github.com/QubitProducts/bamboo/configuration"
+	"github.com/QubitProducts/bamboo/services/haproxy"
+)
+
+func TestRecord(t *testing.T) {
+	Convey("#Record", t, func() {
+		config := &conf.Configuration{}
+		config.HAProxy.Usage.RetentionHours = 2
+		recorder := &Recorder{Config: config}
+		start := time.Date(2016, 5, 24, 12, 10, 0, 0, time.UTC)
+		stat := func(requests int64, errors int64) []haproxy.BackendStat {
+			return []haproxy.BackendStat{{Backend: "app", Requests: requests, BytesOut: requests * 10, Responses5xx: errors, Connections: requests / 10}}
+		}
+
+		Convey("should only take the first sample as baseline", func() {
+			recorder.Record(stat(100, 0), start)
+			So(recorder.Summary(start, false), ShouldBeEmpty)
+		})
+
+		Convey("should sum the growth of the counters", func() {
+			recorder.Record(stat(100, 0), start)
+			recorder.Record(stat(150, 5), start.Add(time.Minute))
+			recorder.Record(stat(200, 5), start.Add(2*time.Minute))
+			So(recorder.Summary(start, false), ShouldResemble, []Usage{{
+				Backend: "app", Requests: 100, BytesOut: 1000, Responses5xx: 5, ErrorRate: 0.05, PeakConnections: 20,
+			}})
+		})
+
+		Convey("should count reset counters from zero", func() {
+			recorder.Record(stat(100, 0), start)
+			recorder.Record(stat(30, 0), start.Add(time.Minute))
+			So(recorder.Summary(start, false)[0].Requests, ShouldEqual, 30)
+		})
+
+		Convey("should keep a bucket per hour within the retention", func() {
+			recorder.Record(stat(100, 0), start)
+			recorder.Record(stat(110, 0), start.Add(time.Minute))
+			recorder.Record(stat(130, 0), start.Add(time.Hour))
+			usage := recorder.Summary(start, true)
+			So(len(usage[0].Hours), ShouldEqual, 2)
+			So(usage[0].Hours[1].Requests, ShouldEqual, 20)
+
+			recorder.Record(stat(160, 0), start.Add(2*time.Hour))
+			So(len(recorder.Summary(start, true)[0].Hours), ShouldEqual, 2)
+			So(recorder.Summary(start.Add(2*time.Hour), false)[0].Requests, ShouldEqual, 30)
+		})
+	})
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	Convey("#Save", t, func() {
+		directory, _ := ioutil.TempDir("", "bamboo-usage")
+		defer os.RemoveAll(directory)
+		config := &conf.Configuration{}
+		config.HAProxy.Usage.RetentionHours = 24
+		config.HAProxy.Usage.Path = filepath.Join(directory, "usage.json")
+		at := time.Date(2016, 5, 24, 12, 10, 0, 0, time.UTC)
+
+		Convey("should keep the usage across restarts", func() {
+			recorder := &Recorder{Config: config}
+			recorder.Record([]haproxy.BackendStat{{Backend: "app", Requests: 10}}, at)
+			recorder.Record([]haproxy.BackendStat{{Backend: "app", Requests: 15}}, at)
+			So(recorder.Save(), ShouldBeNil)
+
+			restarted := &Recorder{Config: config}
+			So(restarted.Load(), ShouldBeNil)
+			So(restarted.Summary(at, false)[0].Requests, ShouldEqual, 5)
+		})
+	})
+}
@@ -6,6 +6,7 @@ var bambooApp = angular.module("bamboo", [
     ServiceFormModule.name
   ])
   .factory("State", require("./components/resources/state-resource"))
+  .factory("View", require("./components/resources/view-resource"))
   .factory("Service", require("./components/resources/service-resource"))
   .run(["$templateCache", function ($templateCache) {
     $templateCache.put("bamboo/modal-confirm", require("./components/modal/modal-confirm.html"));
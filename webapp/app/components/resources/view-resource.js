@@ -0,0 +1,13 @@
+module.exports = ["$resource", function ($resource) {
+  var index = $resource("/api/view", {});
+  return {
+    get: function () {
+      return index.get().$promise;
+    },
+
+    // resolves once the view changed after the given version
+    watch: function (since) {
+      return index.get({ watch: true, since: since }).$promise;
+    }
+  }
+}];
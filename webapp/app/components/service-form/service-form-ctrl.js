@@ -1,3 +1,5 @@
+var _ = require("lodash");
+
 module.exports = ["$scope", "$modal", "$rootScope", function ($scope, $modal, $rootScope) {
 
   $scope.showModal = function (modalOptions) {
@@ -20,9 +22,14 @@ module.exports = ["$scope", "$modal", "$rootScope", function ($scope, $modal, $r
     $rootScope.$broadcast("services.reset");
   };
 
+  // error responses carry a machine readable Code next to the Message
   var handleError = function (payload) {
+    var error = payload.data || {};
     $scope.loading = false;
-    $scope.errors = payload.data;
+    $scope.errors = error.Message || payload.data;
+    if (error.Code === "SERVICE_CONFLICT") {
+      $scope.errors += ": " + _.pluck(error.Details, "Reason").join("; ");
+    }
   };
 
   $scope.doAction = function () {
@@ -1,55 +1,56 @@
 var _ = require("lodash");
 
-module.exports = ["State", "$rootScope", function (State, $rootScope) {
+// Status of a view row to the actions offered for it
+var actionTypes = {
+  "routed": "default",
+  "default-rule": "service",
+  "missing-app": "marathon"
+};
+
+module.exports = ["View", "$rootScope", "$timeout", function (View, $rootScope, $timeout) {
   return {
     restrict: "AE",
     link: function (scope) {
+      var version = 0;
+      var watching = true;
+
+      // rows come sorted by the server, missing apps and apps without service first
+      var render = function (view) {
+        version = view.Version;
+        scope.services = _.map(view.Rows, function (row) {
+          return {
+            id: row.Id,
+            service: row.Service,
+            app: row.App,
+            actionType: actionTypes[row.Status]
+          };
+        });
+      };
+
       var fetch = function () {
-        State.get().then(function (payload) {
-          var appsMap = _.indexBy(payload.Apps, "Id");
-          var appIds  = _.keys(appsMap);
-          var servicesKeys = _.keys(payload.Services);
-
-          var services = _.map(_.union(appIds, servicesKeys), function (id) {
-            var actionType;
-            var app = appsMap[id];
-            var serviceModel = payload.Services[id];
-
-            // Add required action
-            if (app && serviceModel !== undefined) {
-              actionType = "default";
-            } else {
-              if (!app) {
-                actionType = "marathon";
-              } else if (!serviceModel) {
-                actionType = "service";
-              }
-            }
-
-            return {
-              id: id,
-              service: serviceModel,
-              app: app,
-              actionType: actionType
-            };
-          });
-
-          scope.services = _.sortBy(services, function (d) {
-            if (d.actionType === "service") {
-              return 0;
-            } else if (d.actionType === "marathon") {
-              return -1;
-            }
-            return 5;
-          });
+        return View.get().then(render);
+      };
+
+      var watch = function () {
+        if (!watching) {
+          return;
+        }
+        View.watch(version).then(function (view) {
+          render(view);
+          watch();
+        }, function () {
+          $timeout(watch, 5000);
         });
       };
 
-      fetch();
+      fetch().finally(watch);
 
       $rootScope.$on("services.reset", fetch);
+      scope.$on("$destroy", function () {
+        watching = false;
+      });
     },
 
     template: require("./service-list.html")
   };
-}];
\ No newline at end of file
+}];